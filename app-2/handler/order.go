@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Order is the saga message handed to the order worker, which charges and ships it.
+type Order struct {
+	ID     string  `json:"order_id"`
+	Item   string  `json:"item"`
+	Amount float64 `json:"amount"`
+}
+
+// Order statuses as tracked by app-2, which owns the inventory reservation
+const (
+	orderReserved  = "reserved"
+	orderCompleted = "completed"
+	orderCancelled = "cancelled"
+)
+
+// orderStore keeps reservations in memory; it's a demo, not an inventory system.
+type orderStore struct {
+	mu     sync.Mutex
+	orders map[string]string
+}
+
+func (s *orderStore) set(id, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders[id] = status
+}
+
+func (s *orderStore) get(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, ok := s.orders[id]
+	return status, ok
+}
+
+// PlaceOrder starts the saga demo: it reserves stock and hands the order to the order
+// worker (charge → ship). The worker reports back through /complete, or /release when a
+// later step failed and the reservation has to be compensated.
+func (s *server) PlaceOrder(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "POST /orders")
+	defer span.End()
+	currentSpanId := span.SpanContext().SpanID().String()
+
+	order, err := s.svc.PlaceOrder(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.WithTrace(ctx, currentSpanId).Info("order reserved and submitted", zap.String("order_id", order.ID))
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"order_id": order.ID, "status": orderReserved})
+}
+
+// GetOrder returns the saga status of an order.
+func (s *server) GetOrder(c *fiber.Ctx, id string) error {
+	status, ok := s.svc.OrderStatus(id)
+	if !ok {
+		return apperr.New(apperr.NotFound, "Order not found", nil)
+	}
+	return c.JSON(fiber.Map{"order_id": id, "status": status})
+}
+
+// CompleteOrder marks an order shipped.
+func (s *server) CompleteOrder(c *fiber.Ctx, id string) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "POST /orders/:id/complete")
+	defer span.End()
+
+	if err := s.svc.CompleteOrder(ctx, id); err != nil {
+		return err
+	}
+
+	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("order completed", zap.String("order_id", id))
+	return c.JSON(fiber.Map{"order_id": id, "status": orderCompleted})
+}
+
+// ReleaseOrder compensates the reservation of an order whose later step failed.
+func (s *server) ReleaseOrder(c *fiber.Ctx, id string) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "POST /orders/:id/release")
+	defer span.End()
+
+	if err := s.svc.ReleaseOrder(ctx, id, c.Query("reason")); err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"order_id": id, "status": orderCancelled})
+}
+
+// PlaceOrder reserves stock for a new order and hands it to the order worker,
+// releasing the reservation again if the handoff fails.
+func (s *Service) PlaceOrder(ctx context.Context) (Order, error) {
+	order := Order{ID: uuid.NewString(), Item: "widget", Amount: float64(s.rand.Intn(9000)+1000) / 100}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("saga.order_id", order.ID))
+
+	if err := s.reserveStock(ctx, order); err != nil {
+		appErr := apperr.New(apperr.Conflict, "Item out of stock", err)
+		shared.RecordError(ctx, appErr, "")
+		return Order{}, appErr
+	}
+	s.orders.set(order.ID, orderReserved)
+
+	release, err := s.publishBulkhead.Acquire(ctx)
+	if err != nil {
+		s.compensateReservation(ctx, order.ID, "publish bulkhead full")
+		appErr := apperr.New(apperr.Unavailable, "Too many concurrent publishes", err)
+		shared.RecordError(ctx, appErr, "RabbitMQ publish bulkhead full")
+		return Order{}, appErr
+	}
+	defer release()
+
+	if err := s.publishOrder(ctx, order); err != nil {
+		s.compensateReservation(ctx, order.ID, "order could not be handed to the worker")
+		appErr := apperr.New(apperr.Unavailable, "Failed to submit order", err)
+		shared.RecordError(ctx, appErr, "Failed to publish order")
+		return Order{}, appErr
+	}
+	return order, nil
+}
+
+// OrderStatus reports where the order is in the saga.
+func (s *Service) OrderStatus(id string) (string, bool) {
+	return s.orders.get(id)
+}
+
+// CompleteOrder marks the order as done once the worker has shipped it.
+func (s *Service) CompleteOrder(ctx context.Context, id string) error {
+	if _, ok := s.orders.get(id); !ok {
+		return apperr.New(apperr.NotFound, "Order not found", nil)
+	}
+	s.orders.set(id, orderCompleted)
+	trace.SpanFromContext(ctx).AddEvent("saga.completed", trace.WithAttributes(attribute.String("saga.order_id", id)))
+	return nil
+}
+
+// ReleaseOrder compensates the reservation after a later saga step failed.
+func (s *Service) ReleaseOrder(ctx context.Context, id, reason string) error {
+	if _, ok := s.orders.get(id); !ok {
+		return apperr.New(apperr.NotFound, "Order not found", nil)
+	}
+	s.compensateReservation(ctx, id, reason)
+	return nil
+}
+
+// reserveStock is the first saga step; it occasionally fails as if the item sold out.
+func (s *Service) reserveStock(ctx context.Context, order Order) error {
+	ctx, span := s.tracer.Start(ctx, "saga reserve")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("saga.order_id", order.ID),
+		attribute.String("saga.step", "reserve"),
+	)
+
+	s.RandomDelay(ctx)
+	if s.rand.Intn(10) == 0 {
+		err := errors.New("no stock left for " + order.Item)
+		shared.RecordError(ctx, err, "")
+		return err
+	}
+	span.AddEvent("saga.step.completed")
+	return nil
+}
+
+// compensateReservation undoes the reserve step.
+func (s *Service) compensateReservation(ctx context.Context, id, reason string) {
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("saga.compensation", trace.WithAttributes(
+		attribute.String("saga.order_id", id),
+		attribute.String("saga.step", "reserve"),
+		attribute.String("saga.reason", reason),
+	))
+	s.orders.set(id, orderCancelled)
+
+	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Warn("reservation released",
+		zap.String("order_id", id),
+		zap.String("reason", reason),
+	)
+}
+
+// publishOrder hands the order to the order worker with the trace context in the headers.
+func (s *Service) publishOrder(ctx context.Context, order Order) error {
+	body, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	return s.publisher.Publish(ctx, "orders", amqp091.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	})
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/amqp"
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/attrs"
+	"github.com/daanielsharon/observability-go/shared/bulkhead"
+	"github.com/daanielsharon/observability-go/shared/chaos"
+	"github.com/daanielsharon/observability-go/shared/clock"
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"github.com/daanielsharon/observability-go/shared/random"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Publisher sends a message to a queue on the default exchange, with the trace
+// context of ctx in its headers.
+type Publisher interface {
+	Publish(ctx context.Context, queue string, msg amqp091.Publishing) error
+}
+
+// dialPublisher opens a connection per publish, which is what app-2 has always done.
+type dialPublisher struct {
+	url string
+}
+
+func (p dialPublisher) Publish(ctx context.Context, queue string, msg amqp091.Publishing) error {
+	conn, err := amqp.Dial(p.url, "app-2")
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	return amqp.Publish(ctx, ch, "", queue, msg)
+}
+
+// forwardedTTL is how long a forwarded request's idempotency key is remembered.
+const forwardedTTL = 10 * time.Minute
+
+// forwardedKeys remembers the idempotency keys of requests already forwarded, so a
+// retried request isn't published twice.
+type forwardedKeys struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+// contains reports whether key was forwarded within forwardedTTL of now, dropping
+// older keys now and then.
+func (k *forwardedKeys) contains(key string, now time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if now.Sub(k.lastSweep) > forwardedTTL {
+		for key, t := range k.seen {
+			if now.Sub(t) > forwardedTTL {
+				delete(k.seen, key)
+			}
+		}
+		k.lastSweep = now
+	}
+	t, ok := k.seen[key]
+	return ok && now.Sub(t) <= forwardedTTL
+}
+
+func (k *forwardedKeys) add(key string, now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.seen[key] = now
+}
+
+// Deps are the dependencies of a Service. Nil Clock and Rand use real time and random.Default.
+type Deps struct {
+	Publisher Publisher
+	Clock     clock.Clock
+	Rand      random.Source
+}
+
+// Service is app-2's business logic: processing requests from app-1 and the order saga,
+// kept apart from Fiber so it can run against fakes.
+type Service struct {
+	publisher Publisher
+	clock     clock.Clock
+	rand      random.Source
+	tracer    trace.Tracer
+	orders    *orderStore
+	forwarded *forwardedKeys
+	// publishBulkhead caps concurrent publishes so a stalled broker can't pile up requests
+	publishBulkhead *bulkhead.Bulkhead
+}
+
+func NewService(d Deps) *Service {
+	return &Service{
+		publisher:       d.Publisher,
+		clock:           clock.Or(d.Clock),
+		rand:            random.Or(d.Rand),
+		tracer:          otel.Tracer("app-2"),
+		orders:          &orderStore{orders: make(map[string]string)},
+		forwarded:       &forwardedKeys{seen: make(map[string]time.Time)},
+		publishBulkhead: bulkhead.New("rabbitmq-publish", 10, 200*time.Millisecond),
+	}
+}
+
+// Process does app-2's share of a request and forwards it to consumer-1. Mirrored
+// requests are processed but not forwarded; forwarded reports which happened. A
+// request whose idempotency key was forwarded already is not published again, so the
+// caller can retry it.
+func (s *Service) Process(ctx context.Context, idempotencyKey string) (forwarded bool, err error) {
+	s.RandomDelay(ctx)
+	if err := chaos.Inject(ctx); err != nil {
+		if errors.Is(err, chaos.ErrInjected) {
+			appErr := apperr.New(apperr.Unavailable, "Injected failure", err)
+			shared.RecordError(ctx, appErr, "")
+			return false, appErr
+		}
+		return false, apperr.New(apperr.Timeout, "Request cancelled", err)
+	}
+
+	// Mirrored requests must not have side effects: don't publish
+	if telemetry.IsShadow(ctx) {
+		return false, nil
+	}
+
+	if idempotencyKey != "" && s.forwarded.contains(idempotencyKey, s.clock.Now()) {
+		trace.SpanFromContext(ctx).AddEvent("idempotent replay, not forwarded again")
+		return true, nil
+	}
+
+	release, err := s.publishBulkhead.Acquire(ctx)
+	if err != nil {
+		appErr := apperr.New(apperr.Unavailable, "Too many concurrent publishes", err)
+		shared.RecordError(ctx, appErr, "RabbitMQ publish bulkhead full")
+		return false, appErr
+	}
+	defer release()
+
+	// Publish message to consumer-1 with trace context
+	err = s.publisher.Publish(ctx, "task_queue", amqp091.Publishing{
+		ContentType: "text/plain",
+		Body:        []byte("Hello from app-2"),
+	})
+	if err != nil {
+		appErr := apperr.New(apperr.Unavailable, "Failed to publish message", err)
+		shared.RecordError(ctx, appErr, "Failed to publish message")
+		return false, appErr
+	}
+	if idempotencyKey != "" {
+		s.forwarded.add(idempotencyKey, s.clock.Now())
+	}
+	return true, nil
+}
+
+// RandomDelay waits up to a second and returns the delay in milliseconds.
+func (s *Service) RandomDelay(ctx context.Context) int {
+	_, span := s.tracer.Start(ctx, "simulateRandomDelay")
+	defer span.End()
+
+	delay := s.rand.Intn(1000) // 0–1000 ms
+	s.clock.Sleep(time.Duration(delay) * time.Millisecond)
+	span.SetAttributes(attrs.DelayMS.Int(delay))
+	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("simulateRandomDelay working", zap.Int("delay_ms", delay))
+	return delay
+}
+
+// RandomError fails half the time.
+func (s *Service) RandomError(ctx context.Context) error {
+	ctx, span := s.tracer.Start(ctx, "simulateRandomError")
+	defer span.End()
+
+	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("simulateRandomError working")
+	if s.rand.Intn(2) == 0 {
+		err := errors.New("simulated random error")
+		shared.RecordError(ctx, err, "")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/attrs"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+	"github.com/daanielsharon/observability-go/shared/testkit"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// published is a message the fake publisher was given, with the span it was sent under.
+type published struct {
+	queue string
+	msg   amqp091.Publishing
+	span  trace.SpanContext
+}
+
+// fakePublisher records publishes and fails them with err.
+type fakePublisher struct {
+	err  error
+	sent []published
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, queue string, msg amqp091.Publishing) error {
+	p.sent = append(p.sent, published{queue: queue, msg: msg, span: trace.SpanContextFromContext(ctx)})
+	return p.err
+}
+
+func TestServiceProcess(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		shadow        bool
+		publishErr    error
+		wantForwarded bool
+		wantPublishes int
+		wantCode      apperr.Code
+	}{
+		{name: "forwards", wantForwarded: true, wantPublishes: 1},
+		{name: "mirrored request is not forwarded", shadow: true},
+		{name: "publish fails", publishErr: errors.New("channel closed"), wantPublishes: 1, wantCode: apperr.Unavailable},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := testkit.RecordSpans(t)
+			pub := &fakePublisher{err: tt.publishErr}
+			clk := testkit.NewSleepClock()
+			svc := NewService(Deps{Publisher: pub, Clock: clk, Rand: testkit.FixedRand{N: 250}})
+
+			ctx, root := otel.Tracer("test").Start(context.Background(), "root")
+			if tt.shadow {
+				ctx = telemetry.WithShadow(ctx)
+			}
+			forwarded, err := svc.Process(ctx, "")
+			root.End()
+
+			if forwarded != tt.wantForwarded {
+				t.Errorf("forwarded = %v, want %v", forwarded, tt.wantForwarded)
+			}
+			if len(pub.sent) != tt.wantPublishes {
+				t.Fatalf("published %d messages, want %d", len(pub.sent), tt.wantPublishes)
+			}
+			if slept := clk.Slept(); len(slept) != 1 || slept[0] != 250*time.Millisecond {
+				t.Errorf("slept %v, want [250ms]", slept)
+			}
+			rootSpan := testkit.FindSpan(t, exporter, "root")
+			if len(pub.sent) > 0 {
+				if pub.sent[0].queue != "task_queue" {
+					t.Errorf("published to %q, want task_queue", pub.sent[0].queue)
+				}
+				// The trace context travels with the message from the caller's span
+				if pub.sent[0].span.TraceID() != rootSpan.SpanContext.TraceID() {
+					t.Errorf("message published outside the caller's trace")
+				}
+			}
+
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Process = %v, want nil", err)
+				}
+				return
+			}
+			var appErr *apperr.Error
+			if !errors.As(err, &appErr) || appErr.Code != tt.wantCode {
+				t.Fatalf("Process = %v, want code %s", err, tt.wantCode)
+			}
+			if rootSpan.Status.Code != codes.Error {
+				t.Errorf("root span status = %v, want Error", rootSpan.Status.Code)
+			}
+			if v, ok := testkit.Attr(rootSpan, "error.code"); !ok || v.AsString() != string(tt.wantCode) {
+				t.Errorf("error.code = %q, want %s", v.Emit(), tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestServiceProcessIdempotencyKey(t *testing.T) {
+	testkit.RecordSpans(t)
+	pub := &fakePublisher{}
+	clk := testkit.NewSleepClock()
+	svc := NewService(Deps{Publisher: pub, Clock: clk, Rand: testkit.FixedRand{}})
+
+	// A retry of a forwarded request succeeds without publishing again
+	for i := 0; i < 2; i++ {
+		if forwarded, err := svc.Process(context.Background(), "req-1"); err != nil || !forwarded {
+			t.Fatalf("Process #%d = %v, %v; want forwarded", i+1, forwarded, err)
+		}
+	}
+	if len(pub.sent) != 1 {
+		t.Fatalf("published %d messages for one key, want 1", len(pub.sent))
+	}
+
+	// Another key, or the same one once forgotten, is published
+	if _, err := svc.Process(context.Background(), "req-2"); err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(forwardedTTL + time.Second)
+	if _, err := svc.Process(context.Background(), "req-1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(pub.sent) != 3 {
+		t.Errorf("published %d messages, want 3", len(pub.sent))
+	}
+}
+
+func TestServiceProcessFailedPublishIsRetried(t *testing.T) {
+	testkit.RecordSpans(t)
+	pub := &fakePublisher{err: errors.New("channel closed")}
+	svc := NewService(Deps{Publisher: pub, Clock: testkit.NewSleepClock(), Rand: testkit.FixedRand{}})
+
+	if _, err := svc.Process(context.Background(), "req-1"); err == nil {
+		t.Fatal("Process succeeded with a failing publisher")
+	}
+	pub.err = nil
+	if forwarded, err := svc.Process(context.Background(), "req-1"); err != nil || !forwarded {
+		t.Fatalf("retry = %v, %v; want forwarded", forwarded, err)
+	}
+	if len(pub.sent) != 2 {
+		t.Errorf("published %d times, want 2: the failed attempt and the retry", len(pub.sent))
+	}
+}
+
+func TestServiceRandomDelay(t *testing.T) {
+	exporter := testkit.RecordSpans(t)
+	clk := testkit.NewSleepClock()
+	svc := NewService(Deps{Clock: clk, Rand: testkit.FixedRand{N: 999}})
+
+	if got := svc.RandomDelay(context.Background()); got != 999 {
+		t.Fatalf("RandomDelay = %d, want 999", got)
+	}
+	span := testkit.FindSpan(t, exporter, "simulateRandomDelay")
+	if v, ok := testkit.Attr(span, attrs.DelayMS); !ok || v.AsInt64() != 999 {
+		t.Errorf("delay_ms = %v, want 999", v.Emit())
+	}
+}
+
+func TestServiceRandomError(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		draw    int
+		wantErr bool
+	}{
+		{"fails on 0", 0, true},
+		{"passes on 1", 1, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := testkit.RecordSpans(t)
+			svc := NewService(Deps{Clock: testkit.NewSleepClock(), Rand: testkit.FixedRand{N: tt.draw}})
+
+			err := svc.RandomError(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RandomError = %v, want error %v", err, tt.wantErr)
+			}
+			span := testkit.FindSpan(t, exporter, "simulateRandomError")
+			wantStatus := codes.Unset
+			if tt.wantErr {
+				wantStatus = codes.Error
+			}
+			if span.Status.Code != wantStatus {
+				t.Errorf("span status = %v, want %v", span.Status.Code, wantStatus)
+			}
+		})
+	}
+}
+
+func TestServicePlaceOrder(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		draw       int
+		publishErr error
+		wantCode   apperr.Code
+		// wantStatus is the order's status afterwards; empty when no order was kept
+		wantStatus string
+	}{
+		{name: "reserved and handed off", draw: 1, wantStatus: orderReserved},
+		{name: "out of stock", draw: 0, wantCode: apperr.Conflict},
+		{name: "handoff fails", draw: 1, publishErr: errors.New("channel closed"), wantCode: apperr.Unavailable, wantStatus: orderCancelled},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := testkit.RecordSpans(t)
+			pub := &fakePublisher{err: tt.publishErr}
+			svc := NewService(Deps{Publisher: pub, Clock: testkit.NewSleepClock(), Rand: testkit.FixedRand{N: tt.draw}})
+
+			_, err := svc.PlaceOrder(context.Background())
+
+			if tt.wantCode != "" {
+				var appErr *apperr.Error
+				if !errors.As(err, &appErr) || appErr.Code != tt.wantCode {
+					t.Fatalf("PlaceOrder = %v, want code %s", err, tt.wantCode)
+				}
+			} else if err != nil {
+				t.Fatalf("PlaceOrder = %v, want nil", err)
+			}
+
+			reserve := testkit.FindSpan(t, exporter, "saga reserve")
+			if v, ok := testkit.Attr(reserve, "saga.step"); !ok || v.AsString() != "reserve" {
+				t.Errorf("saga.step = %q, want reserve", v.Emit())
+			}
+			if tt.wantStatus == "" {
+				if reserve.Status.Code != codes.Error {
+					t.Errorf("saga reserve status = %v, want Error", reserve.Status.Code)
+				}
+				if len(pub.sent) != 0 {
+					t.Errorf("published %d messages, want none", len(pub.sent))
+				}
+				return
+			}
+
+			if len(pub.sent) != 1 || pub.sent[0].queue != "orders" {
+				t.Fatalf("published %v, want one message to orders", pub.sent)
+			}
+			var order Order
+			if err := json.Unmarshal(pub.sent[0].msg.Body, &order); err != nil {
+				t.Fatalf("order message: %v", err)
+			}
+			if status, ok := svc.OrderStatus(order.ID); !ok || status != tt.wantStatus {
+				t.Errorf("order status = %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,218 +1,154 @@
 package handler
 
 import (
-	"context"
-	"errors"
-	"fmt"
-	"math/rand"
-	"net/http"
-	"observability-go/logger"
+	"os"
 	"time"
 
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/cache"
+	"github.com/daanielsharon/observability-go/shared/db"
+	"github.com/daanielsharon/observability-go/shared/httpclient"
+	"github.com/daanielsharon/observability-go/shared/httpserver"
+	"github.com/daanielsharon/observability-go/shared/logger"
 
 	"github.com/gofiber/fiber/v2"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
-func RegisterRoutes(app *fiber.App, log *zap.Logger) {
-	tracer := otel.Tracer("app-1")
-
-	// Normal hello
-	app.Get("/hello", func(c *fiber.Ctx) error {
-		ctx := c.UserContext()
-		ctx, span := tracer.Start(ctx, "GET /hello")
-		defer span.End()
-		currentSpanId := span.SpanContext().SpanID().String()
-
-		logger.WithTrace(ctx, currentSpanId).Info("handling /hello")
-		simulateSlowFunction(ctx)
-
-		logger.WithTrace(ctx, currentSpanId).Info("hello success")
-		return c.JSON(fiber.Map{"message": "hello"})
-	})
-
-	// Random delay endpoint
-	app.Get("/random-delay", func(c *fiber.Ctx) error {
-		ctx := c.UserContext()
-		ctx, span := tracer.Start(ctx, "GET /random-delay")
-		defer span.End()
-
-		logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("random-delay working")
-
-		delay := simulateRandomDelay(ctx)
-		return c.JSON(fiber.Map{"delay_ms": delay})
+func RegisterRoutes(app *fiber.App, log *zap.Logger, database db.Querier, userCache *cache.ReadThrough[User]) {
+	// HTTP client with OpenTelemetry transport and connection-phase events. No hedging:
+	// POST /process publishes to RabbitMQ, so a second copy would publish twice.
+	var clientOpts []httpclient.Option
+	// Split app-2 traffic between versions, e.g. APP2_BACKENDS=v1=app-2:8081:90,v2=app-2-canary:8081:10
+	backends, err := httpclient.ParseBackends(os.Getenv("APP2_BACKENDS"))
+	if err != nil {
+		log.Fatal("invalid APP2_BACKENDS", zap.Error(err))
+	}
+	if len(backends) > 0 {
+		clientOpts = append(clientOpts, httpclient.WithWeightedRouting("app-2:8081", backends))
+	}
+	client := httpclient.New(clientOpts...)
+
+	svc := NewService(Deps{
+		Client:  client,
+		App2URL: app2URL(),
+		// Optionally copy a share of app-2 calls to a canary (MIRROR_TARGET, MIRROR_PERCENT)
+		Mirror:    httpclient.MirrorFromEnv(client, log),
+		DB:        database,
+		UserCache: userCache,
 	})
+	RegisterService(app, log, svc)
+}
 
-	// Random error endpoint
-	app.Get("/random-error", func(c *fiber.Ctx) error {
-		ctx := c.UserContext()
-		ctx, span := tracer.Start(ctx, "GET /random-error")
-		defer span.End()
-		currentSpanId := span.SpanContext().SpanID().String()
-
-		logger.WithTrace(ctx, currentSpanId).Info("random-error working")
-
-		if err := simulateRandomError(ctx); err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			logger.WithTrace(ctx, currentSpanId).Error("error in /random-error", zap.Error(err))
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+// RegisterService mounts svc's endpoints on app, as described by openapi.yaml.
+func RegisterService(app *fiber.App, log *zap.Logger, svc *Service) {
+	srv := &server{svc: svc, tracer: otel.Tracer("app-1")}
+	err := RegisterHandlers(app, srv, func(op httpserver.Operation) []fiber.Handler {
+		// Hello is static enough for clients to cache for a minute
+		if op.ID == "getHello" {
+			return []fiber.Handler{httpserver.Cacheable(time.Minute)}
 		}
-
-		logger.WithTrace(ctx, currentSpanId).Info("random-error success")
-		return c.JSON(fiber.Map{"message": "success"})
+		return nil
 	})
+	if err != nil {
+		log.Fatal("failed to register API handlers", zap.Error(err))
+	}
+}
 
-	// Multi-function call (chained spans)
-	app.Get("/chain", func(c *fiber.Ctx) error {
-		ctx := c.UserContext()
-		ctx, span := tracer.Start(ctx, "GET /chain")
-		defer span.End()
-		currentSpanId := span.SpanContext().SpanID().String()
-
-		logger.WithTrace(ctx, currentSpanId).Info("chain working")
-
-		step1(ctx)
-		step2(ctx)
-		step3(ctx)
-
-		return c.JSON(fiber.Map{"message": "chain done"})
-	})
-
-	// New endpoint that calls app-2
-	app.Get("/call-app2", func(c *fiber.Ctx) error {
-		ctx := c.UserContext()
-		ctx, span := tracer.Start(ctx, "GET /call-app2")
-		defer span.End()
-		currentSpanId := span.SpanContext().SpanID().String()
-
-		logger.WithTrace(ctx, currentSpanId).Info("Calling app-2 service")
-
-		simulateRandomDelay(ctx)
-
-		// Create HTTP client with OpenTelemetry transport
-		client := &http.Client{
-			Transport: otelhttp.NewTransport(http.DefaultTransport),
-		}
-
-		// Create request with context
-		req, err := http.NewRequestWithContext(
-			ctx,
-			"POST",
-			"http://app-2:8081/process",
-			nil,
-		)
-		if err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, "Failed to create request to app-2")
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to create request to app-2",
-			})
-		}
+//go:generate go run ../../cmd/openapi-gen -package handler -out api.gen.go openapi.yaml
 
-		// Add any headers if needed
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Request-ID", c.Get("X-Request-ID"))
-
-		// Make the request
-		resp, err := client.Do(req)
-		if err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, "Failed to call app-2")
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": fmt.Sprintf("Failed to call app-2: %v", err),
-			})
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			errMsg := fmt.Sprintf("app-2 returned status: %d", resp.StatusCode)
-			span.RecordError(errors.New(errMsg))
-			span.SetStatus(codes.Error, errMsg)
-			return c.Status(resp.StatusCode).JSON(fiber.Map{
-				"error": errMsg,
-			})
-		}
-
-		logger.WithTrace(ctx, currentSpanId).Info("Successfully called app-2")
-		return c.JSON(fiber.Map{
-			"message": "Successfully called app-2",
-			"status":  "success",
-		})
-	})
+// server implements the generated ServerInterface on top of Service.
+type server struct {
+	svc    *Service
+	tracer trace.Tracer
 }
 
-// --- Simulated Functions ---
-
-func simulateSlowFunction(ctx context.Context) {
-	_, span := otel.Tracer("app-1").Start(ctx, "simulateSlowFunction")
+// GetHello is the normal hello.
+func (s *server) GetHello(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	ctx, span := s.tracer.Start(ctx, "GET /hello")
 	defer span.End()
+	currentSpanId := span.SpanContext().SpanID().String()
 
-	delay := 200
-	span.SetAttributes(attribute.Int("delay_ms", delay))
-	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("simulateSlowFunction working")
-	time.Sleep(time.Duration(delay) * time.Millisecond)
+	logger.WithTrace(ctx, currentSpanId).Info("handling /hello")
+	s.svc.SlowFunction(ctx)
+
+	logger.WithTrace(ctx, currentSpanId).Info("hello success")
+	return c.JSON(fiber.Map{"message": "hello"})
 }
 
-func simulateRandomDelay(ctx context.Context) int {
-	_, span := otel.Tracer("app-1").Start(ctx, "simulateRandomDelay")
+// GetRandomDelay is the random delay endpoint.
+func (s *server) GetRandomDelay(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	ctx, span := s.tracer.Start(ctx, "GET /random-delay")
 	defer span.End()
 
-	delay := rand.Intn(1000) // 0–1000 ms
-	time.Sleep(time.Duration(delay) * time.Millisecond)
-	span.SetAttributes(attribute.Int("delay_ms", delay))
-	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("simulateRandomDelay working", zap.Int("delay_ms", delay))
-	return delay
+	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("random-delay working")
+
+	delay := s.svc.RandomDelay(ctx)
+	return c.JSON(fiber.Map{"delay_ms": delay})
 }
 
-func simulateRandomError(ctx context.Context) error {
-	_, span := otel.Tracer("app-1").Start(ctx, "simulateRandomError")
+// GetRandomError is the random error endpoint.
+func (s *server) GetRandomError(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	ctx, span := s.tracer.Start(ctx, "GET /random-error")
 	defer span.End()
+	currentSpanId := span.SpanContext().SpanID().String()
 
-	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("simulateRandomError working")
-	if rand.Intn(2) == 0 {
-		span.RecordError(errors.New("simulated random error"))
-		span.SetStatus(codes.Error, "simulated random error")
-		return errors.New("simulated random error")
+	logger.WithTrace(ctx, currentSpanId).Info("random-error working")
+
+	if err := s.svc.RandomError(ctx); err != nil {
+		appErr := apperr.New(apperr.Internal, "simulated random error", err)
+		shared.RecordError(ctx, appErr, "")
+		logger.WithTrace(ctx, currentSpanId).Error("error in /random-error", zap.Error(err))
+		return appErr
 	}
-	return nil
-}
 
-// --- Chained functions to see span breakdown ---
+	logger.WithTrace(ctx, currentSpanId).Info("random-error success")
+	return c.JSON(fiber.Map{"message": "success"})
+}
 
-func step1(ctx context.Context) {
-	_, span := otel.Tracer("app-1").Start(ctx, "step1")
+// GetChain is the multi-function call (chained spans).
+func (s *server) GetChain(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	ctx, span := s.tracer.Start(ctx, "GET /chain")
 	defer span.End()
+	currentSpanId := span.SpanContext().SpanID().String()
 
-	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("step1 working")
-	time.Sleep(100 * time.Millisecond)
-	step1Subtask(ctx)
+	logger.WithTrace(ctx, currentSpanId).Info("chain working")
+	s.svc.Chain(ctx)
+
+	return c.JSON(fiber.Map{"message": "chain done"})
 }
 
-func step1Subtask(ctx context.Context) {
-	_, span := otel.Tracer("app-1").Start(ctx, "step1Subtask")
+// CallApp2 is the endpoint that calls app-2.
+func (s *server) CallApp2(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	ctx, span := s.tracer.Start(ctx, "GET /call-app2")
 	defer span.End()
+	currentSpanId := span.SpanContext().SpanID().String()
 
-	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("step1Subtask working")
-	time.Sleep(50 * time.Millisecond)
-}
+	logger.WithTrace(ctx, currentSpanId).Info("Calling app-2 service")
 
-func step2(ctx context.Context) {
-	_, span := otel.Tracer("app-1").Start(ctx, "step2")
-	defer span.End()
+	if err := s.svc.CallApp2(ctx, c.Get("X-Request-ID")); err != nil {
+		return err
+	}
 
-	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("step2 working")
-	time.Sleep(200 * time.Millisecond)
+	logger.WithTrace(ctx, currentSpanId).Info("Successfully called app-2")
+	return c.JSON(fiber.Map{
+		"message": "Successfully called app-2",
+		"status":  "success",
+	})
 }
 
-func step3(ctx context.Context) {
-	_, span := otel.Tracer("app-1").Start(ctx, "step3")
-	defer span.End()
-
-	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("step3 working")
-	time.Sleep(150 * time.Millisecond)
+// app2URL reads APP2_URL (default http://app-2:8081).
+func app2URL() string {
+	if u := os.Getenv("APP2_URL"); u != "" {
+		return u
+	}
+	return "http://app-2:8081"
 }
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/attrs"
+	"github.com/daanielsharon/observability-go/shared/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Beacon types accepted by POST /rum.
+const (
+	beaconPageLoad = "page_load"
+	beaconFetch    = "fetch"
+	beaconError    = "error"
+)
+
+// maxBeacons bounds how many beacons one POST /rum may carry.
+const maxBeacons = 50
+
+var (
+	rumEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rum_events_total",
+		Help: "Browser beacons received on /rum, by type (page_load, fetch, error).",
+	}, []string{"type"})
+	rumDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rum_duration_seconds",
+		Help:    "Page load and fetch durations measured in the browser.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"type"})
+)
+
+// beacon is one frontend measurement. Start is a Unix time in milliseconds and
+// Timings are milestones in milliseconds after it (dns, ttfb, dom_content_loaded, ...).
+type beacon struct {
+	Type        string             `json:"type"`
+	Page        string             `json:"page"`
+	SessionID   string             `json:"session_id,omitempty"`
+	Traceparent string             `json:"traceparent,omitempty"`
+	Start       int64              `json:"start,omitempty"`
+	DurationMS  float64            `json:"duration_ms,omitempty"`
+	Timings     map[string]float64 `json:"timings,omitempty"`
+
+	// fetch
+	URL    string `json:"url,omitempty"`
+	Method string `json:"method,omitempty"`
+	Status int    `json:"status,omitempty"`
+
+	// error
+	Message string `json:"message,omitempty"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+// PostRUM takes frontend performance beacons: one object or an array of them.
+func (s *server) PostRUM(c *fiber.Ctx) error {
+	beacons, err := parseBeacons(c.Body())
+	if err != nil {
+		return err
+	}
+
+	// Beacons continue the page's trace, as siblings of this request's server span
+	parent := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(c.GetReqHeaders()))
+	// Fiber reuses the header buffer once the request ends; the spans keep this
+	userAgent := strings.Clone(c.Get(fiber.HeaderUserAgent))
+	tracer := otel.Tracer("rum")
+	for _, b := range beacons {
+		recordBeacon(parent, tracer, b, userAgent)
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+func parseBeacons(body []byte) ([]beacon, error) {
+	var beacons []beacon
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &beacons); err != nil {
+			return nil, apperr.New(apperr.InvalidInput, "invalid beacon batch", err)
+		}
+	} else {
+		var b beacon
+		if err := json.Unmarshal(body, &b); err != nil {
+			return nil, apperr.New(apperr.InvalidInput, "invalid beacon", err)
+		}
+		beacons = append(beacons, b)
+	}
+
+	if len(beacons) > maxBeacons {
+		return nil, apperr.New(apperr.InvalidInput, "too many beacons", nil)
+	}
+	for _, b := range beacons {
+		switch b.Type {
+		case beaconPageLoad, beaconFetch, beaconError:
+		default:
+			return nil, apperr.New(apperr.InvalidInput, "unknown beacon type "+b.Type, nil)
+		}
+	}
+	return beacons, nil
+}
+
+// recordBeacon turns b into a span backdated to when it happened in the browser, plus
+// metrics and, for JS errors, a warning log.
+func recordBeacon(parent context.Context, tracer trace.Tracer, b beacon, userAgent string) {
+	duration := time.Duration(b.DurationMS * float64(time.Millisecond))
+	start := time.Now().Add(-duration)
+	if b.Start > 0 {
+		start = time.UnixMilli(b.Start)
+	}
+	if b.Traceparent != "" {
+		carrier := propagation.MapCarrier{"traceparent": b.Traceparent}
+		parent = otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	}
+
+	kind := trace.SpanKindInternal
+	name := "RUM " + b.Type
+	kv := []attribute.KeyValue{
+		attrs.RUMEvent.String(b.Type),
+		attrs.Page.String(b.Page),
+		attribute.String("user_agent.original", userAgent),
+	}
+	if b.SessionID != "" {
+		kv = append(kv, attrs.SessionID.String(b.SessionID))
+	}
+	if b.Type == beaconFetch {
+		kind = trace.SpanKindClient
+		name = "RUM fetch " + b.Method
+		kv = append(kv,
+			attribute.String("url.full", b.URL),
+			attribute.String("http.request.method", b.Method),
+			attribute.Int("http.response.status_code", b.Status),
+		)
+	}
+
+	ctx, span := tracer.Start(parent, name,
+		trace.WithSpanKind(kind),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(kv...),
+	)
+	for milestone, ms := range b.Timings {
+		span.AddEvent(milestone, trace.WithTimestamp(start.Add(time.Duration(ms*float64(time.Millisecond)))))
+	}
+
+	rumEvents.WithLabelValues(b.Type).Inc()
+	switch b.Type {
+	case beaconError:
+		span.AddEvent("exception", trace.WithAttributes(
+			attribute.String("exception.type", "javascript"),
+			attribute.String("exception.message", b.Message),
+			attribute.String("exception.stacktrace", b.Stack),
+		))
+		span.SetStatus(codes.Error, b.Message)
+		logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Warn("browser error",
+			zap.String("page", b.Page),
+			zap.String("message", b.Message),
+		)
+	case beaconFetch:
+		// Status 0 is a network failure: the browser never got a response
+		if b.Status == 0 || b.Status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "fetch failed")
+		}
+		fallthrough
+	default:
+		rumDuration.WithLabelValues(b.Type).Observe(duration.Seconds())
+	}
+	span.End(trace.WithTimestamp(start.Add(duration)))
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/attrs"
+	"github.com/daanielsharon/observability-go/shared/bulkhead"
+	"github.com/daanielsharon/observability-go/shared/cache"
+	"github.com/daanielsharon/observability-go/shared/clock"
+	"github.com/daanielsharon/observability-go/shared/db"
+	"github.com/daanielsharon/observability-go/shared/flags"
+	"github.com/daanielsharon/observability-go/shared/httpclient"
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"github.com/daanielsharon/observability-go/shared/random"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Deps are the dependencies of a Service. Nil Clock and Rand use real time and random.Default.
+type Deps struct {
+	// Client calls app-2.
+	Client httpclient.Doer
+	// App2URL is app-2's base URL, e.g. http://app-2:8081.
+	App2URL string
+	// Mirror copies a share of app-2 calls to a canary; nil mirrors nothing.
+	Mirror *httpclient.Mirror
+	// DB holds the users table; without it the user endpoints answer 503.
+	DB db.Querier
+	// UserCache sits in front of DB for single-user reads; nil reads DB every time.
+	UserCache *cache.ReadThrough[User]
+	Clock     clock.Clock
+	Rand      random.Source
+}
+
+// Service is app-1's business logic, the simulated work and the calls to app-2,
+// kept apart from Fiber so it can run against fakes.
+type Service struct {
+	client       httpclient.Doer
+	app2URL      string
+	mirror       *httpclient.Mirror
+	db           db.Querier
+	userCache    *cache.ReadThrough[User]
+	clock        clock.Clock
+	rand         random.Source
+	tracer       trace.Tracer
+	app2Bulkhead *bulkhead.Bulkhead
+}
+
+func NewService(d Deps) *Service {
+	return &Service{
+		client:    d.Client,
+		app2URL:   d.App2URL,
+		mirror:    d.Mirror,
+		db:        d.DB,
+		userCache: d.UserCache,
+		clock:     clock.Or(d.Clock),
+		rand:      random.Or(d.Rand),
+		tracer:    otel.Tracer("app-1"),
+		// Cap concurrent calls to app-2 so a slow app-2 can't exhaust this service
+		app2Bulkhead: bulkhead.New("app-2-http", 20, 200*time.Millisecond),
+	}
+}
+
+// SlowFunction does 200ms of work, plus a second in slow mode.
+func (s *Service) SlowFunction(ctx context.Context) {
+	ctx, span := s.tracer.Start(ctx, "simulateSlowFunction")
+	defer span.End()
+
+	delay := 200
+	if flags.Enabled(ctx, flags.SlowMode) {
+		delay += 1000
+	}
+	span.SetAttributes(attrs.DelayMS.Int(delay))
+	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("simulateSlowFunction working")
+	s.clock.Sleep(time.Duration(delay) * time.Millisecond)
+}
+
+// RandomDelay waits up to a second and returns the delay in milliseconds.
+func (s *Service) RandomDelay(ctx context.Context) int {
+	_, span := s.tracer.Start(ctx, "simulateRandomDelay")
+	defer span.End()
+
+	delay := s.rand.Intn(1000) // 0–1000 ms
+	s.clock.Sleep(time.Duration(delay) * time.Millisecond)
+	span.SetAttributes(attrs.DelayMS.Int(delay))
+	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("simulateRandomDelay working", zap.Int("delay_ms", delay))
+	return delay
+}
+
+// RandomError fails half the time while the chaos flag is on.
+func (s *Service) RandomError(ctx context.Context) error {
+	ctx, span := s.tracer.Start(ctx, "simulateRandomError")
+	defer span.End()
+
+	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("simulateRandomError working")
+	if flags.Enabled(ctx, flags.Chaos) && s.rand.Intn(2) == 0 {
+		err := errors.New("simulated random error")
+		shared.RecordError(ctx, err, "")
+		return err
+	}
+	return nil
+}
+
+// Chain runs three steps, the first with a subtask, to show a span breakdown.
+func (s *Service) Chain(ctx context.Context) {
+	steps := shared.Steps(ctx, shared.WithStepSpans())
+	_ = steps.Run("step1", func(ctx context.Context) error {
+		s.work(ctx, "step1", 100*time.Millisecond)
+		return shared.Steps(ctx, shared.WithStepSpans()).Run("step1Subtask", func(ctx context.Context) error {
+			s.work(ctx, "step1Subtask", 50*time.Millisecond)
+			return nil
+		})
+	})
+	_ = steps.Run("step2", func(ctx context.Context) error {
+		s.work(ctx, "step2", 200*time.Millisecond)
+		return nil
+	})
+	_ = steps.Run("step3", func(ctx context.Context) error {
+		s.work(ctx, "step3", 150*time.Millisecond)
+		return nil
+	})
+}
+
+// work stands in for a step's real work.
+func (s *Service) work(ctx context.Context, name string, d time.Duration) {
+	logger.WithTrace(ctx, trace.SpanFromContext(ctx).SpanContext().SpanID().String()).Info(name + " working")
+	s.clock.Sleep(d)
+}
+
+// CallApp2 asks app-2 to process a request, retrying transient failures, and mirrors
+// the call to the canary if one is configured. Errors are *apperr.Error values.
+func (s *Service) CallApp2(ctx context.Context, requestID string) error {
+	s.RandomDelay(ctx)
+
+	release, err := s.app2Bulkhead.Acquire(ctx)
+	if err != nil {
+		appErr := apperr.New(apperr.Unavailable, "Too many concurrent calls to app-2", err)
+		shared.RecordError(ctx, appErr, "app-2 bulkhead full")
+		return appErr
+	}
+	defer release()
+
+	s.mirror.Send(ctx, http.MethodPost, "/process", http.Header{
+		"Content-Type":                  {"application/json"},
+		"X-Request-Id":                  {requestID},
+		httpclient.IdempotencyKeyHeader: {requestID},
+	})
+
+	// Each attempt in its own span. POST /process publishes to RabbitMQ; app-2 dedupes on
+	// the request ID sent as the idempotency key, so failures are retried safely
+	policy := httpclient.DefaultRetryPolicy()
+	policy.Clock = s.clock
+	resp, err := httpclient.DoWithRetry(ctx, s.client, policy, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.app2URL+"/process", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-ID", requestID)
+		req.Header.Set(httpclient.IdempotencyKeyHeader, requestID)
+		return req, nil
+	})
+	if err != nil {
+		appErr := apperr.New(apperr.Upstream, "Failed to call app-2", err)
+		shared.RecordError(ctx, appErr, "Failed to call app-2")
+		return appErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errMsg := fmt.Sprintf("app-2 returned status: %d", resp.StatusCode)
+		appErr := apperr.New(apperr.Upstream, errMsg, nil)
+		shared.RecordError(ctx, appErr, errMsg)
+		return appErr
+	}
+	return nil
+}
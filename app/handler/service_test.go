@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/attrs"
+	"github.com/daanielsharon/observability-go/shared/testkit"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// doerFunc is a fake app-2 that records the requests sent to it.
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
+
+func respond(status int) *http.Response {
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(""))}
+}
+
+func TestServiceRandomDelay(t *testing.T) {
+	exporter := testkit.RecordSpans(t)
+	clk := testkit.NewSleepClock()
+	svc := NewService(Deps{Clock: clk, Rand: testkit.FixedRand{N: 420}})
+
+	if got := svc.RandomDelay(context.Background()); got != 420 {
+		t.Fatalf("RandomDelay = %d, want 420", got)
+	}
+	if clk.Total() != 420*time.Millisecond {
+		t.Errorf("slept %v, want 420ms", clk.Total())
+	}
+	span := testkit.FindSpan(t, exporter, "simulateRandomDelay")
+	if v, ok := testkit.Attr(span, attrs.DelayMS); !ok || v.AsInt64() != 420 {
+		t.Errorf("delay_ms = %v, want 420", v.Emit())
+	}
+}
+
+func TestServiceSlowFunction(t *testing.T) {
+	exporter := testkit.RecordSpans(t)
+	clk := testkit.NewSleepClock()
+	svc := NewService(Deps{Clock: clk, Rand: testkit.FixedRand{}})
+
+	svc.SlowFunction(context.Background())
+
+	if clk.Total() != 200*time.Millisecond {
+		t.Errorf("slept %v, want 200ms", clk.Total())
+	}
+	span := testkit.FindSpan(t, exporter, "simulateSlowFunction")
+	if v, ok := testkit.Attr(span, attrs.DelayMS); !ok || v.AsInt64() != 200 {
+		t.Errorf("delay_ms = %v, want 200", v.Emit())
+	}
+	if v, ok := testkit.Attr(span, "feature_flag.slow_mode"); !ok || v.AsBool() {
+		t.Errorf("feature_flag.slow_mode = %v, want false", v.Emit())
+	}
+}
+
+func TestServiceRandomError(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		draw    int
+		wantErr bool
+	}{
+		{"fails on 0", 0, true},
+		{"passes on 1", 1, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := testkit.RecordSpans(t)
+			svc := NewService(Deps{Clock: testkit.NewSleepClock(), Rand: testkit.FixedRand{N: tt.draw}})
+
+			err := svc.RandomError(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RandomError = %v, want error %v", err, tt.wantErr)
+			}
+			span := testkit.FindSpan(t, exporter, "simulateRandomError")
+			wantStatus := codes.Unset
+			if tt.wantErr {
+				wantStatus = codes.Error
+			}
+			if span.Status.Code != wantStatus {
+				t.Errorf("span status = %v, want %v", span.Status.Code, wantStatus)
+			}
+		})
+	}
+}
+
+func TestServiceChain(t *testing.T) {
+	exporter := testkit.RecordSpans(t)
+	clk := testkit.NewSleepClock()
+	svc := NewService(Deps{Clock: clk, Rand: testkit.FixedRand{}})
+
+	svc.Chain(context.Background())
+
+	if clk.Total() != 500*time.Millisecond {
+		t.Errorf("slept %v, want 500ms", clk.Total())
+	}
+	step1 := testkit.FindSpan(t, exporter, "step1")
+	sub := testkit.FindSpan(t, exporter, "step1Subtask")
+	if sub.Parent.SpanID() != step1.SpanContext.SpanID() {
+		t.Errorf("step1Subtask is not a child of step1")
+	}
+	for _, name := range []string{"step2", "step3"} {
+		if s := testkit.FindSpan(t, exporter, name); s.Parent.SpanID() == step1.SpanContext.SpanID() {
+			t.Errorf("%s is a child of step1", name)
+		}
+	}
+}
+
+func TestServiceCallApp2(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		status       int
+		err          error
+		wantAttempts int
+		wantCode     apperr.Code
+	}{
+		{name: "ok", status: http.StatusOK, wantAttempts: 1},
+		{name: "server error is retried", status: http.StatusInternalServerError, wantAttempts: 3, wantCode: apperr.Upstream},
+		{name: "client error", status: http.StatusBadRequest, wantAttempts: 1, wantCode: apperr.Upstream},
+		{name: "transport error is retried", err: errors.New("connection refused"), wantAttempts: 3, wantCode: apperr.Upstream},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := testkit.RecordSpans(t)
+			var reqs []*http.Request
+			client := doerFunc(func(req *http.Request) (*http.Response, error) {
+				reqs = append(reqs, req)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return respond(tt.status), nil
+			})
+			svc := NewService(Deps{Client: client, App2URL: "http://app-2.test", Clock: testkit.NewSleepClock(), Rand: testkit.FixedRand{}})
+
+			ctx, root := otel.Tracer("test").Start(context.Background(), "root")
+			err := svc.CallApp2(ctx, "req-1")
+			root.End()
+
+			// POST /process carries the request ID as its idempotency key, so transient
+			// failures are retried
+			if len(reqs) != tt.wantAttempts {
+				t.Fatalf("sent %d requests, want %d", len(reqs), tt.wantAttempts)
+			}
+			for _, req := range reqs {
+				if req.Method != http.MethodPost || req.URL.String() != "http://app-2.test/process" {
+					t.Errorf("request = %s %s, want POST http://app-2.test/process", req.Method, req.URL)
+				}
+				if got := req.Header.Get("X-Request-ID"); got != "req-1" {
+					t.Errorf("X-Request-ID = %q, want req-1", got)
+				}
+				if got := req.Header.Get("Idempotency-Key"); got != "req-1" {
+					t.Errorf("Idempotency-Key = %q, want req-1", got)
+				}
+			}
+
+			rootSpan := testkit.FindSpan(t, exporter, "root")
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("CallApp2 = %v, want nil", err)
+				}
+				if rootSpan.Status.Code == codes.Error {
+					t.Errorf("root span status is Error")
+				}
+				return
+			}
+			var appErr *apperr.Error
+			if !errors.As(err, &appErr) || appErr.Code != tt.wantCode {
+				t.Fatalf("CallApp2 = %v, want code %s", err, tt.wantCode)
+			}
+			if rootSpan.Status.Code != codes.Error {
+				t.Errorf("root span status = %v, want Error", rootSpan.Status.Code)
+			}
+			if v, ok := testkit.Attr(rootSpan, "error.code"); !ok || v.AsString() != string(tt.wantCode) {
+				t.Errorf("error.code = %q, want %s", v.Emit(), tt.wantCode)
+			}
+			for i := 1; i <= tt.wantAttempts; i++ {
+				if attempt := testkit.FindSpan(t, exporter, fmt.Sprintf("attempt %d", i)); attempt.Parent.SpanID() != rootSpan.SpanContext.SpanID() {
+					t.Errorf("attempt %d span is not a child of the caller's span", i)
+				}
+			}
+		})
+	}
+}
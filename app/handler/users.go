@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/attrs"
+	"github.com/daanielsharon/observability-go/shared/db"
+	"github.com/daanielsharon/observability-go/shared/id"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var usersTotal = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "users_total",
+	Help: "Rows in the users table, as of the last count-users cron run on any replica.",
+})
+
+// User is a row of the users table.
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// userInput is the body of POST /users and PUT /users/{id}.
+type userInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// usersSchema creates the users table; app runs it at startup.
+const usersSchema = `CREATE TABLE IF NOT EXISTS users (
+	id         text PRIMARY KEY,
+	name       text NOT NULL,
+	email      text NOT NULL UNIQUE,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now()
+)`
+
+const userColumns = "id, name, email, created_at, updated_at"
+
+// MigrateUsers creates the users table if it isn't there yet.
+func MigrateUsers(ctx context.Context, q db.Querier) error {
+	_, err := q.Exec(ctx, usersSchema)
+	return err
+}
+
+func scanUser(row pgx.Row) (User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt)
+	return u, err
+}
+
+// CountUsers sets users_total from the users table. It runs as the count-users cron job;
+// one replica counting is enough, and the others read the gauge from Prometheus.
+func CountUsers(ctx context.Context, q db.Querier) error {
+	var n int64
+	if err := q.QueryRow(ctx, "SELECT count(*) FROM users").Scan(&n); err != nil {
+		return db.Error(err, "User")
+	}
+	usersTotal.Set(float64(n))
+	return nil
+}
+
+// usersUnavailable is what the user endpoints fail with when app runs without a database.
+var usersUnavailable = apperr.New(apperr.Unavailable, "Users need a database", nil)
+
+// ListUsers returns up to limit users, newest first.
+func (s *Service) ListUsers(ctx context.Context, limit int) ([]User, error) {
+	if s.db == nil {
+		return nil, usersUnavailable
+	}
+	rows, err := s.db.Query(ctx, "SELECT "+userColumns+" FROM users ORDER BY created_at DESC, id LIMIT $1", limit)
+	if err != nil {
+		return nil, db.Error(err, "User")
+	}
+	users, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (User, error) { return scanUser(row) })
+	if err != nil {
+		return nil, db.Error(err, "User")
+	}
+	return users, nil
+}
+
+// GetUser returns the user with id.
+func (s *Service) GetUser(ctx context.Context, userID string) (User, error) {
+	if s.db == nil {
+		return User{}, usersUnavailable
+	}
+	attrs.Set(ctx, attrs.UserID.String(userID))
+	load := func(ctx context.Context) (User, error) {
+		u, err := scanUser(s.db.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", userID))
+		return u, db.Error(err, "User")
+	}
+	if s.userCache == nil {
+		return load(ctx)
+	}
+	return s.userCache.Get(ctx, userID, load)
+}
+
+// forgetUser drops a changed user from the cache. A stale entry only lives until its
+// TTL, so failing to drop it is recorded rather than failing the change.
+func (s *Service) forgetUser(ctx context.Context, userID string) {
+	if s.userCache == nil {
+		return
+	}
+	if err := s.userCache.Invalidate(ctx, userID); err != nil {
+		shared.RecordError(ctx, err, "failed to invalidate cached user")
+	}
+}
+
+// CreateUser adds a user; a taken email is a Conflict.
+func (s *Service) CreateUser(ctx context.Context, in userInput) (User, error) {
+	if s.db == nil {
+		return User{}, usersUnavailable
+	}
+	userID := id.New()
+	attrs.Set(ctx, attrs.UserID.String(userID))
+	u, err := scanUser(s.db.QueryRow(ctx,
+		"INSERT INTO users (id, name, email) VALUES ($1, $2, $3) RETURNING "+userColumns,
+		userID, in.Name, in.Email))
+	return u, db.Error(err, "User")
+}
+
+// UpdateUser replaces the name and email of the user with id.
+func (s *Service) UpdateUser(ctx context.Context, userID string, in userInput) (User, error) {
+	if s.db == nil {
+		return User{}, usersUnavailable
+	}
+	attrs.Set(ctx, attrs.UserID.String(userID))
+	u, err := scanUser(s.db.QueryRow(ctx,
+		"UPDATE users SET name = $2, email = $3, updated_at = now() WHERE id = $1 RETURNING "+userColumns,
+		userID, in.Name, in.Email))
+	if err == nil {
+		s.forgetUser(ctx, userID)
+	}
+	return u, db.Error(err, "User")
+}
+
+// DeleteUser removes the user with id.
+func (s *Service) DeleteUser(ctx context.Context, userID string) error {
+	if s.db == nil {
+		return usersUnavailable
+	}
+	attrs.Set(ctx, attrs.UserID.String(userID))
+	tag, err := s.db.Exec(ctx, "DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		return db.Error(err, "User")
+	}
+	if tag.RowsAffected() == 0 {
+		return db.Error(pgx.ErrNoRows, "User")
+	}
+	s.forgetUser(ctx, userID)
+	return nil
+}
+
+// parseUser reads a user body; the spec has already checked its shape.
+func parseUser(c *fiber.Ctx) (userInput, error) {
+	var in userInput
+	if err := json.Unmarshal(c.Body(), &in); err != nil {
+		return in, apperr.New(apperr.InvalidInput, "Invalid user", err)
+	}
+	in.Name = strings.TrimSpace(in.Name)
+	in.Email = strings.ToLower(strings.TrimSpace(in.Email))
+	return in, nil
+}
+
+// ListUsers lists users, newest first.
+func (s *server) ListUsers(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "GET /users")
+	defer span.End()
+
+	users, err := s.svc.ListUsers(ctx, c.QueryInt("limit", 50))
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"users": users})
+}
+
+// CreateUser adds a user.
+func (s *server) CreateUser(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "POST /users")
+	defer span.End()
+
+	in, err := parseUser(c)
+	if err != nil {
+		return err
+	}
+	u, err := s.svc.CreateUser(ctx, in)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(u)
+}
+
+// GetUser returns one user.
+func (s *server) GetUser(c *fiber.Ctx, id string) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "GET /users/:id")
+	defer span.End()
+
+	u, err := s.svc.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(u)
+}
+
+// UpdateUser replaces a user's name and email.
+func (s *server) UpdateUser(c *fiber.Ctx, id string) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "PUT /users/:id")
+	defer span.End()
+
+	in, err := parseUser(c)
+	if err != nil {
+		return err
+	}
+	u, err := s.svc.UpdateUser(ctx, id, in)
+	if err != nil {
+		return err
+	}
+	return c.JSON(u)
+}
+
+// DeleteUser removes a user.
+func (s *server) DeleteUser(c *fiber.Ctx, id string) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "DELETE /users/:id")
+	defer span.End()
+
+	if err := s.svc.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
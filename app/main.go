@@ -2,125 +2,138 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"observability-go/handler"
-	"observability-go/logger"
+	"encoding/json"
+	"errors"
+	"net/http"
 	"os"
-	"strconv"
 	"time"
 
+	"github.com/daanielsharon/observability-go/app/handler"
+	"github.com/daanielsharon/observability-go/profiles"
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/bootstrap"
+	"github.com/daanielsharon/observability-go/shared/cache"
+	"github.com/daanielsharon/observability-go/shared/cron"
+	"github.com/daanielsharon/observability-go/shared/db"
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/flags"
+	"github.com/daanielsharon/observability-go/shared/httpserver"
+	"github.com/daanielsharon/observability-go/shared/lock"
+	"github.com/daanielsharon/observability-go/shared/runner"
+	"github.com/daanielsharon/observability-go/shared/tracequery"
+
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/pprof"
-	"github.com/gofiber/fiber/v2/middleware/recover"
-	"github.com/gofiber/fiber/v2/middleware/requestid"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 	"go.uber.org/zap"
-
-	"github.com/gofiber/adaptor/v2"
-)
-
-var (
-	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "http_request_duration_seconds",
-		Help: "Duration of HTTP requests.",
-	}, []string{"method", "path", "status"})
-	zapLogger *zap.Logger
 )
 
-func initTracer() func() {
-	ctx := context.Background()
-	// Using HTTP instead of gRPC
-	httpClient := otlptracehttp.NewClient(
-		otlptracehttp.WithEndpoint("tempo:4318"),
-		otlptracehttp.WithInsecure(),
-	)
+func main() {
+	// Spans go to Tempo over OTLP HTTP unless the profile or environment says otherwise
+	svc := bootstrap.New(bootstrap.Config{Profiles: profiles.FS, TraceEndpoint: "tempo:4318", TraceProtocol: "http"})
+	r := svc.Runner
 
-	exp, err := otlptrace.New(ctx, httpClient)
-	if err != nil {
-		zapLogger.Fatal("failed to create HTTP exporter", zap.Error(err))
+	if err := flags.Load(); err != nil {
+		svc.Log.Fatal("failed to load feature flags", zap.Error(err))
 	}
 
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String(os.Getenv("SERVICE_NAME")),
-		),
-	)
+	// Redis backs the user cache, the cron lock and the quota counters; app works without it
+	cacheCfg, err := cache.ConfigFromEnv()
 	if err != nil {
-		zapLogger.Fatal("failed to create resource", zap.Error(err))
+		svc.Log.Fatal("invalid cache config", zap.Error(err))
 	}
+	diagnostics.RegisterConfig("cache", cacheCfg)
+	redisClient := cache.NewClient(cacheCfg)
+	r.WaitForOptional("redis", runner.TCPCheck(cacheCfg.Addr))
+	r.Add("redis", runner.Hook{
+		OnStart: func(ctx context.Context) error { return nil },
+		OnStop: func(ctx context.Context) error {
+			return redisClient.Close()
+		},
+	})
 
-	tp := trace.NewTracerProvider(
-		trace.WithBatcher(exp),
-		trace.WithResource(res),
-	)
+	// API keys identify clients (X-API-Key); quotas are counted in Redis so all replicas share them
+	quotaCfg := httpserver.QuotaFromEnv()
+	diagnostics.RegisterConfig("quota", quotaCfg)
+	quota := httpserver.Quota(quotaCfg, httpserver.RedisQuotaStore(redisClient), svc.PathFilter.Match)
 
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(
-		propagation.NewCompositeTextMapPropagator(
-			propagation.TraceContext{},
-			propagation.Baggage{},
-		),
-	)
+	app := svc.HTTP(bootstrap.WithLimits(), bootstrap.WithCORS(), bootstrap.WithMiddleware(quota))
 
-	return func() { _ = tp.Shutdown(ctx) }
-}
+	// Add a test endpoint to generate 5xx errors
+	app.Get("/error", func(c *fiber.Ctx) error {
+		return apperr.New(apperr.Internal, "Internal Server Error", nil)
+	})
 
-func main() {
-	zapLogger = logger.New("loki:3100", os.Getenv("LOG_FILE"))
-	cleanup := initTracer()
-	defer cleanup()
+	// Spans from Tempo merged with logs from Loki for one trace, for demos without Grafana;
+	// served on the ops port with the other debug handlers
+	traces := &tracequery.Client{
+		TempoURL: envOr("TEMPO_URL", "http://tempo:3200"),
+		LokiURL:  envOr("LOKI_URL", "http://loki:3100"),
+		HTTP:     &http.Client{Timeout: 10 * time.Second},
+	}
+	svc.Admin("GET /debug/trace/{id}", traceHandler(traces))
 
-	app := fiber.New()
-	app.Use(requestid.New())
+	// Feature flags: GET to read, PUT a JSON object to toggle
+	svc.Admin("/admin/flags", flags.Handler())
 
-	// Initialize pprof with default options
-	pprofConfig := pprof.Config{
-		Next:   nil,
-		Prefix: "/debug/pprof",
+	// Postgres for the users endpoints; the pool connects lazily, the schema is applied at startup
+	dbCfg, err := db.ConfigFromEnv()
+	if err != nil {
+		svc.Log.Fatal("invalid database config", zap.Error(err))
+	}
+	diagnostics.RegisterConfig("database", dbCfg)
+	pool, err := db.Open(dbCfg)
+	if err != nil {
+		svc.Log.Fatal("invalid database config", zap.Error(err))
 	}
-	app.Use(pprof.New(pprofConfig))
-	app.Use(recover.New())
-
-	// Prometheus middleware to collect metrics
-	app.Use(func(c *fiber.Ctx) error {
-		start := time.Now()
-		err := c.Next()
-
-		// Gunakan pattern route, bukan raw path
-		normalizedPath := c.Route().Path
-		statusCode := strconv.Itoa(c.Response().StatusCode())
-
-		// Add status code label to the metrics
-		requestDuration.WithLabelValues(
-			c.Method(),
-			normalizedPath,
-			statusCode,
-		).Observe(time.Since(start).Seconds())
-
-		return err
+	r.WaitFor("postgres", runner.TCPCheck(db.Addr(pool)))
+	r.Add("postgres", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			return handler.MigrateUsers(ctx, pool)
+		},
+		OnStop: func(ctx context.Context) error {
+			pool.Close()
+			return nil
+		},
 	})
 
-	// Add a test endpoint to generate 5xx errors
-	app.Get("/error", func(c *fiber.Ctx) error {
-		return c.Status(500).SendString("Internal Server Error")
-	})
+	// count-users runs on one replica at a time, coordinated through a Redis lock
+	r.Add("cron-count-users", cron.Schedule(svc.Log, cron.Job{
+		Name:  "count-users",
+		Every: time.Minute,
+		Lock:  lock.New("count-users", redisClient, 30*time.Second, svc.Log),
+		Run: func(ctx context.Context) error {
+			return handler.CountUsers(ctx, pool)
+		},
+	}), "postgres", "redis")
+
+	handler.RegisterRoutes(app, svc.Log, pool, cache.NewReadThrough[handler.User]("users", redisClient, cacheCfg.TTL))
 
-	// Prometheus metrics endpoint
-	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+	svc.Serve("postgres", "redis")
+}
 
-	handler.RegisterRoutes(app, zapLogger)
+// traceHandler serves the timeline of one trace; ?since= bounds the search (default 1h).
+func traceHandler(traces *tracequery.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since := time.Hour
+		if v, err := time.ParseDuration(r.URL.Query().Get("since")); err == nil {
+			since = v
+		}
+		t, err := traces.Timeline(r.Context(), r.PathValue("id"), since)
+		if errors.Is(err, tracequery.ErrInvalidTraceID) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to query tempo and loki: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(t)
+	})
+}
 
-	zapLogger.Info(fmt.Sprintf("starting server on :%s", os.Getenv("PORT")))
-	if err := app.Listen(fmt.Sprintf(":%s", os.Getenv("PORT"))); err != nil {
-		zapLogger.Fatal("server failed", zap.Error(err))
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
+	return def
 }
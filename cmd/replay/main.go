@@ -0,0 +1,329 @@
+// replay sends the requests recorded in service access logs or traffic capture files
+// again, against a target, at their original pace or faster. Every replayed request
+// starts a new trace whose spans, in every service it reaches, are tagged replay=true:
+//
+//	replay [-target url] [-speed 1] [-concurrency 16] [-otlp host:port] [-v] [file ...]
+//
+// With no files it reads standard input. Access logs carry no headers or bodies, so
+// those requests are replayed without them; captured requests keep theirs, minus
+// credentials and truncated body tails.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/httpclient"
+	"github.com/daanielsharon/observability-go/shared/httpserver"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logTimeLayout is zap's ISO8601 encoding used by the service logs.
+const logTimeLayout = "2006-01-02T15:04:05.000Z0700"
+
+// skippedHeaders are recomputed or replaced when a captured request is sent again.
+var skippedHeaders = map[string]bool{
+	"Host": true, "Content-Length": true, "Connection": true, "Accept-Encoding": true,
+	"Traceparent": true, "Tracestate": true, "Baggage": true, "X-Request-Id": true,
+}
+
+// request is one request read back from an access log entry or a captured exchange.
+type request struct {
+	Time        time.Time
+	Method      string
+	Path        string
+	Query       string
+	ContentType string
+	Headers     map[string][]string
+	Body        string
+	// Status is the status the service originally answered with.
+	Status int
+	// TraceID is the original trace, known for captured requests.
+	TraceID string
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "base URL the requests are sent to")
+	speed := flag.Float64("speed", 1, "pace relative to the original traffic, e.g. 10 for ten times faster; 0 sends as fast as possible")
+	concurrency := flag.Int("concurrency", 16, "maximum requests in flight")
+	otlp := flag.String("otlp", "localhost:4318", "OTLP/HTTP endpoint the replay traces are exported to")
+	verbose := flag.Bool("v", false, "print every request")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: replay [flags] [log-file ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *speed < 0 || *concurrency < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	requests, err := readAll(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		os.Exit(1)
+	}
+	if len(requests) == 0 {
+		fmt.Fprintln(os.Stderr, "replay: no access log entries or captured requests found")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	shutdown, err := telemetry.InitTracer(ctx, telemetry.ConfigFromEnv("replay", *otlp, "http"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "replay: tracing disabled:", err)
+	}
+	defer shutdown()
+
+	r := &replayer{
+		target:  strings.TrimRight(*target, "/"),
+		client:  httpclient.New(),
+		verbose: *verbose,
+		counts:  make(map[string]int),
+	}
+	r.client.Timeout = 30 * time.Second
+	r.run(ctx, requests, *speed, *concurrency)
+	r.printSummary()
+}
+
+func readAll(paths []string) ([]request, error) {
+	if len(paths) == 0 {
+		return read(os.Stdin)
+	}
+	var all []request
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		requests, err := read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		all = append(all, requests...)
+	}
+	// Logs of several services or replicas interleave by time
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	return all, nil
+}
+
+// read collects the access entries of a JSON log and the exchanges of a capture file,
+// skipping every other line.
+func read(r io.Reader) ([]request, error) {
+	var requests []request
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 4<<20)
+	for sc.Scan() {
+		if req, ok := parseAccess(sc.Bytes()); ok {
+			requests = append(requests, req)
+		} else if req, ok := parseExchange(sc.Bytes()); ok {
+			requests = append(requests, req)
+		}
+	}
+	return requests, sc.Err()
+}
+
+func parseAccess(line []byte) (request, bool) {
+	var entry struct {
+		Msg         string `json:"msg"`
+		TS          string `json:"ts"`
+		Method      string `json:"method"`
+		Path        string `json:"path"`
+		Query       string `json:"query"`
+		ContentType string `json:"content_type"`
+		Status      int    `json:"status"`
+	}
+	if json.Unmarshal(line, &entry) != nil || entry.Msg != "access" || entry.Method == "" {
+		return request{}, false
+	}
+	t, err := time.Parse(logTimeLayout, entry.TS)
+	if err != nil {
+		return request{}, false
+	}
+	return request{
+		Time:        t,
+		Method:      entry.Method,
+		Path:        entry.Path,
+		Query:       entry.Query,
+		ContentType: entry.ContentType,
+		Status:      entry.Status,
+	}, true
+}
+
+func parseExchange(line []byte) (request, bool) {
+	var ex httpserver.Exchange
+	if json.Unmarshal(line, &ex) != nil || ex.Method == "" || ex.Time.IsZero() || ex.RequestHeaders == nil {
+		return request{}, false
+	}
+	return request{
+		Time:    ex.Time,
+		Method:  ex.Method,
+		Path:    ex.Path,
+		Query:   ex.Query,
+		Headers: ex.RequestHeaders,
+		Body:    ex.RequestBody,
+		Status:  ex.Status,
+		TraceID: ex.TraceID,
+	}, true
+}
+
+type replayer struct {
+	target  string
+	client  *http.Client
+	verbose bool
+
+	mu      sync.Mutex
+	counts  map[string]int
+	changed int
+}
+
+// run sends the requests, keeping their original spacing divided by speed.
+func (r *replayer) run(ctx context.Context, requests []request, speed float64, concurrency int) {
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	start, first := time.Now(), requests[0].Time
+
+	for _, req := range requests {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(req.Time.Sub(first)) / speed))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-ctx.Done():
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(req request) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r.send(ctx, req)
+		}(req)
+	}
+	wg.Wait()
+}
+
+func (r *replayer) send(ctx context.Context, req request) {
+	ctx = telemetry.WithReplay(ctx)
+	ctx, span := otel.Tracer("replay").Start(ctx, "Replay Request",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.Path),
+			attribute.String("replay.original_time", req.Time.Format(time.RFC3339Nano)),
+			attribute.Int("replay.original_status", req.Status),
+		))
+	defer span.End()
+	if req.TraceID != "" {
+		span.SetAttributes(attribute.String("replay.original_trace_id", req.TraceID))
+	}
+	traceID := span.SpanContext().TraceID().String()
+
+	u := r.target + req.Path
+	if req.Query != "" {
+		u += "?" + req.Query
+	}
+	var body io.Reader
+	if req.Body != "" {
+		body = strings.NewReader(req.Body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, u, body)
+	if err != nil {
+		r.record(req, 0, traceID, err)
+		return
+	}
+	for k, values := range req.Headers {
+		if skippedHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		for _, v := range values {
+			// Credentials were masked when captured
+			if v != "****" {
+				httpReq.Header.Add(k, v)
+			}
+		}
+	}
+	if req.ContentType != "" {
+		httpReq.Header.Set("Content-Type", req.ContentType)
+	}
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		r.record(req, 0, traceID, err)
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	r.record(req, resp.StatusCode, traceID, nil)
+}
+
+func (r *replayer) record(req request, status int, traceID string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outcome := fmt.Sprint(status)
+	if err != nil {
+		outcome = "error"
+	}
+	r.counts[outcome]++
+
+	// A different answer than the original is worth a look even without -v
+	changed := err != nil || (req.Status != 0 && req.Status != status)
+	if changed {
+		r.changed++
+	}
+	if !r.verbose && !changed {
+		return
+	}
+	line := fmt.Sprintf("%s %s -> %s (was %d) trace %s", req.Method, req.Path, outcome, req.Status, traceID)
+	if req.TraceID != "" {
+		line += ", original " + req.TraceID
+	}
+	if err != nil {
+		line += ": " + err.Error()
+	}
+	fmt.Println(line)
+}
+
+func (r *replayer) printSummary() {
+	outcomes := make([]string, 0, len(r.counts))
+	total := 0
+	for o, n := range r.counts {
+		outcomes = append(outcomes, fmt.Sprintf("%s=%d", o, n))
+		total += n
+	}
+	sort.Strings(outcomes)
+	fmt.Printf("replayed %d requests, %d answered differently: %s\n", total, r.changed, strings.Join(outcomes, " "))
+}
@@ -0,0 +1,110 @@
+// scenario plays a scripted demo incident: it sends load to a service and switches
+// chaos settings through the controlplane phase by phase, as a scenario file describes:
+//
+//	scenario [-target url] [-controlplane url] [-otlp host:port] [-report 1m] <scenario.yaml>
+//
+// Interrupting it still runs the scenario's reset commands.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/httpclient"
+	"github.com/daanielsharon/observability-go/shared/loadgen"
+	"github.com/daanielsharon/observability-go/shared/scenario"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+)
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "base URL the load is sent to")
+	controlplane := flag.String("controlplane", "http://localhost:8083", "controlplane base URL the chaos commands are sent to")
+	otlp := flag.String("otlp", "localhost:4318", "OTLP/HTTP endpoint the load traces are exported to")
+	report := flag.Duration("report", time.Minute, "how often to print the current request rate; 0 disables")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: scenario [flags] <scenario-file>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	s, err := scenario.LoadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "scenario:", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	shutdown, err := telemetry.InitTracer(ctx, telemetry.ConfigFromEnv("scenario", *otlp, "http"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "scenario: tracing disabled:", err)
+	}
+	defer shutdown()
+
+	client := httpclient.New()
+	client.Timeout = 30 * time.Second
+	gen := loadgen.New(strings.TrimRight(*target, "/"), client)
+	loadCtx, stopLoad := context.WithCancel(context.Background())
+	loadDone := make(chan struct{})
+	go func() {
+		defer close(loadDone)
+		gen.Run(loadCtx)
+	}()
+	if *report > 0 {
+		go reportRate(loadCtx, gen, *report)
+	}
+
+	runner := &scenario.Runner{
+		Controlplane: strings.TrimRight(*controlplane, "/"),
+		Client:       client,
+		Load:         gen,
+		OnPhase: func(i int, p scenario.Phase) {
+			fmt.Printf("%s phase %d/%d: %s for %s\n",
+				time.Now().Format(time.TimeOnly), i+1, len(s.Phases), p.Name, time.Duration(p.Duration))
+		},
+	}
+	fmt.Printf("running %s (%s)\n", s.Name, s.Total())
+	err = runner.Run(ctx, s)
+	stopLoad()
+	<-loadDone
+	printSummary(gen.Counts())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "scenario:", err)
+		os.Exit(1)
+	}
+}
+
+func reportRate(ctx context.Context, gen *loadgen.Generator, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Printf("%s rate %.1f rps\n", time.Now().Format(time.TimeOnly), gen.Rate())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func printSummary(counts map[string]int) {
+	outcomes := make([]string, 0, len(counts))
+	total := 0
+	for o, n := range counts {
+		outcomes = append(outcomes, fmt.Sprintf("%s=%d", o, n))
+		total += n
+	}
+	sort.Strings(outcomes)
+	fmt.Printf("sent %d requests: %s\n", total, strings.Join(outcomes, " "))
+}
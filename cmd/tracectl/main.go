@@ -0,0 +1,105 @@
+// tracectl prints the spans of a trace from Tempo merged with its logs from Loki:
+//
+//	tracectl [-tempo url] [-loki url] [-since 1h] [-json] <trace-id>
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/tracequery"
+)
+
+func main() {
+	tempo := flag.String("tempo", envOr("TEMPO_URL", "http://localhost:3200"), "Tempo HTTP API base URL")
+	loki := flag.String("loki", envOr("LOKI_URL", "http://localhost:3100"), "Loki HTTP API base URL")
+	since := flag.Duration("since", time.Hour, "how far back to search for logs")
+	asJSON := flag.Bool("json", false, "print the timeline as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: tracectl [flags] <trace-id>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client := &tracequery.Client{
+		TempoURL: strings.TrimRight(*tempo, "/"),
+		LokiURL:  strings.TrimRight(*loki, "/"),
+		HTTP:     &http.Client{Timeout: 20 * time.Second},
+	}
+	t, err := client.Timeline(ctx, flag.Arg(0), *since)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tracectl:", err)
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(t)
+		return
+	}
+	printTimeline(t)
+}
+
+func printTimeline(t *tracequery.Timeline) {
+	fmt.Printf("trace %s: %d spans, %d logs\n", t.TraceID, t.Spans, t.Logs)
+	for _, w := range t.Warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+	fmt.Println()
+
+	for _, e := range t.Events {
+		indent := strings.Repeat("  ", e.Depth)
+		offset := fmt.Sprintf("+%s", e.Offset.Round(time.Millisecond))
+		switch {
+		case e.Span != nil:
+			s := e.Span
+			status := ""
+			if s.Error {
+				status = "  ERROR " + s.StatusMessage
+			}
+			fmt.Printf("%-10s %-16s %sSPAN %s (%s)%s\n", offset, s.Service, indent, s.Name, s.Duration.Round(time.Millisecond), status)
+		case e.Log != nil:
+			l := e.Log
+			fmt.Printf("%-10s %-16s %sLOG  %-5s %s%s\n", offset, l.Service, indent, l.Level, l.Message, formatFields(l.Fields))
+		}
+	}
+}
+
+func formatFields(fields map[string]any) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, fields[k])
+	}
+	return b.String()
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
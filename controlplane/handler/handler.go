@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/httpclient"
+	"github.com/daanielsharon/observability-go/shared/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+var commandsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "controlplane_commands_total",
+	Help: "Commands delivered to service instances, by command, target and outcome (ok, rejected, error).",
+}, []string{"command", "target", "outcome"})
+
+// commandPaths maps each command to the admin endpoint that applies it; the args are PUT as its body.
+var commandPaths = map[string]string{
+	"log_level":    "/admin/log-level",    // {"level":"debug"}
+	"flags":        "/admin/flags",        // {"chaos":false}
+	"failure_mode": "/admin/failure-mode", // {"mode":"error","every":3}
+	"chaos":        "/admin/chaos",        // {"scenario_id":"spike-1","mode":"latency","latency":"2s","duration":"3m"} or {"mode":"error","rate":0.8,...}
+}
+
+// Command is a runtime change fanned out to services.
+type Command struct {
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args"`
+	// Targets are service names; empty means every service.
+	Targets []string `json:"targets,omitempty"`
+}
+
+// Result is the outcome of a command on one service instance.
+type Result struct {
+	Target   string `json:"target"`
+	Instance string `json:"instance"`
+	Status   int    `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DefaultTargets are the admin base URLs of the services in docker-compose: each
+// one's ops server on METRICS_PORT.
+const DefaultTargets = "app=http://app:9100,app-2=http://app-2:9100,app-2-canary=http://app-2-canary:9100," +
+	"payments=http://payments:9100,consumer-1=http://consumer-1:9100,consumer-2=http://consumer-2:9100," +
+	"order-worker=http://order-worker:9100,notification=http://notification:9100,gateway=http://gateway:9100"
+
+// ParseTargets reads a comma-separated list of name=baseURL.
+func ParseTargets(s string) (map[string]string, error) {
+	targets := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, base, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid target %q, want name=url", item)
+		}
+		if _, err := url.Parse(base); err != nil {
+			return nil, fmt.Errorf("invalid target %q: %w", item, err)
+		}
+		targets[name] = strings.TrimRight(base, "/")
+	}
+	return targets, nil
+}
+
+func RegisterRoutes(app *fiber.App, log *zap.Logger) {
+	tracer := otel.Tracer("controlplane")
+	client := httpclient.New()
+
+	spec := os.Getenv("CONTROLPLANE_TARGETS")
+	if spec == "" {
+		spec = DefaultTargets
+	}
+	targets, err := ParseTargets(spec)
+	if err != nil {
+		log.Fatal("invalid CONTROLPLANE_TARGETS", zap.Error(err))
+	}
+
+	app.Get("/targets", func(c *fiber.Ctx) error {
+		return c.JSON(targets)
+	})
+
+	app.Post("/commands", func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		ctx, span := tracer.Start(ctx, "POST /commands")
+		defer span.End()
+		traceLogger := logger.WithTrace(ctx, span.SpanContext().SpanID().String())
+
+		var cmd Command
+		if err := c.BodyParser(&cmd); err != nil {
+			appErr := apperr.New(apperr.InvalidInput, "invalid command body", err)
+			shared.RecordError(ctx, appErr, "")
+			return appErr
+		}
+		path, ok := commandPaths[cmd.Command]
+		if !ok {
+			appErr := apperr.New(apperr.InvalidInput, fmt.Sprintf("unknown command %q", cmd.Command), nil)
+			shared.RecordError(ctx, appErr, "")
+			return appErr
+		}
+		names := cmd.Targets
+		if len(names) == 0 {
+			for name := range targets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		for _, name := range names {
+			if _, ok := targets[name]; !ok {
+				appErr := apperr.New(apperr.InvalidInput, fmt.Sprintf("unknown target %q", name), nil)
+				shared.RecordError(ctx, appErr, "")
+				return appErr
+			}
+		}
+		span.SetAttributes(
+			attribute.String("command", cmd.Command),
+			attribute.StringSlice("command.targets", names),
+		)
+
+		results := fanOut(ctx, client, cmd, path, names, targets)
+		failed := 0
+		for _, r := range results {
+			if r.Error != "" {
+				failed++
+			}
+		}
+		span.SetAttributes(attribute.Int("command.instances", len(results)), attribute.Int("command.failed", failed))
+		traceLogger.Info("command sent",
+			zap.String("command", cmd.Command),
+			zap.Strings("targets", names),
+			zap.Int("instances", len(results)),
+			zap.Int("failed", failed),
+		)
+		return c.JSON(fiber.Map{"command": cmd.Command, "failed": failed, "results": results})
+	})
+}
+
+// fanOut sends the command to every instance of every target concurrently.
+func fanOut(ctx context.Context, client *http.Client, cmd Command, path string, names []string, targets map[string]string) []Result {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []Result
+	)
+	for _, name := range names {
+		for _, base := range instances(ctx, targets[name]) {
+			wg.Add(1)
+			go func(name, base string) {
+				defer wg.Done()
+				r := send(ctx, client, cmd, name, base+path)
+				mu.Lock()
+				results = append(results, r)
+				mu.Unlock()
+			}(name, base)
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Target != results[j].Target {
+			return results[i].Target < results[j].Target
+		}
+		return results[i].Instance < results[j].Instance
+	})
+	return results
+}
+
+// instances expands a base URL to one per address its host resolves to, so every
+// replica behind a compose service name gets the command.
+func instances(ctx context.Context, base string) []string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return []string{base}
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return []string{base}
+	}
+	bases := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		v := *u
+		v.Host = net.JoinHostPort(addr, u.Port())
+		bases = append(bases, v.String())
+	}
+	return bases
+}
+
+func send(ctx context.Context, client *http.Client, cmd Command, target, endpoint string) Result {
+	r := Result{Target: target, Instance: endpoint}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(cmd.Args))
+	if err != nil {
+		r.Error = err.Error()
+		commandsSent.WithLabelValues(cmd.Command, target, "error").Inc()
+		return r
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		r.Error = err.Error()
+		commandsSent.WithLabelValues(cmd.Command, target, "error").Inc()
+		return r
+	}
+	defer resp.Body.Close()
+
+	r.Status = resp.StatusCode
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		r.Error = strings.TrimSpace(string(body))
+		if r.Error == "" {
+			r.Error = resp.Status
+		}
+		commandsSent.WithLabelValues(cmd.Command, target, "rejected").Inc()
+		return r
+	}
+	commandsSent.WithLabelValues(cmd.Command, target, "ok").Inc()
+	return r
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/daanielsharon/observability-go/controlplane/handler"
+	"github.com/daanielsharon/observability-go/profiles"
+	"github.com/daanielsharon/observability-go/shared/bootstrap"
+)
+
+func main() {
+	// Spans go to Tempo over OTLP gRPC unless the profile or environment says otherwise
+	svc := bootstrap.New(bootstrap.Config{Profiles: profiles.FS, TraceEndpoint: "tempo:4317", TraceProtocol: "grpc"})
+	svc.HTTP()
+	handler.RegisterRoutes(svc.App, svc.Log)
+	svc.Serve()
+}
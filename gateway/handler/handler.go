@@ -0,0 +1,334 @@
+// Package handler is a GraphQL gateway in front of the app and app-2 REST endpoints.
+// Each field resolver runs under its own span, so the fan-out of one operation shows
+// up in the trace.
+//
+// The schema is built in code with graphql-go rather than generated with gqlgen: the
+// schema is six fields, every resolver needs the same span and metrics wrapper, and
+// resolve applies it in one place, where gqlgen would add a generate step and a
+// generated package to keep in sync for no gain at this size.
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/httpclient"
+	"github.com/daanielsharon/observability-go/shared/httpserver"
+	"github.com/daanielsharon/observability-go/shared/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	operationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_operations_total",
+		Help: "GraphQL operations executed, by operation type and outcome (ok, error).",
+	}, []string{"type", "outcome"})
+	resolverDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "graphql_resolver_duration_seconds",
+		Help: "Time spent in each field resolver, including its upstream call.",
+	}, []string{"field"})
+	fieldErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_field_errors_total",
+		Help: "Field resolvers that returned an error, by field.",
+	}, []string{"field"})
+)
+
+// Upstreams are the REST services fields are resolved from.
+type Upstreams struct {
+	App  string
+	App2 string
+}
+
+// UpstreamsFromEnv reads APP_URL (default http://app:8080) and APP2_URL (default
+// http://app-2:8081).
+func UpstreamsFromEnv() Upstreams {
+	up := Upstreams{App: "http://app:8080", App2: "http://app-2:8081"}
+	if v := os.Getenv("APP_URL"); v != "" {
+		up.App = v
+	}
+	if v := os.Getenv("APP2_URL"); v != "" {
+		up.App2 = v
+	}
+	return up
+}
+
+type gateway struct {
+	client *http.Client
+	// reads is client with hedging, for the fields that only read from app
+	reads  *http.Client
+	up     Upstreams
+	tracer trace.Tracer
+}
+
+// A read from app that takes longer than the p95 of recent ones (250ms until there
+// are enough) is sent again, and the first answer wins.
+const (
+	readHedgePercentile = 0.95
+	readHedgeFallback   = 250 * time.Millisecond
+)
+
+// request is the body of POST /graphql.
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+func RegisterRoutes(app *fiber.App, log *zap.Logger) {
+	gw := &gateway{
+		client: httpclient.New(),
+		reads:  httpclient.New(httpclient.WithHedging(readHedgePercentile, readHedgeFallback)),
+		up:     UpstreamsFromEnv(),
+		tracer: otel.Tracer("graphql"),
+	}
+	schema, err := gw.schema()
+	if err != nil {
+		log.Fatal("invalid GraphQL schema", zap.Error(err))
+	}
+
+	app.Post("/graphql", func(c *fiber.Ctx) error {
+		var req request
+		if err := json.Unmarshal(c.Body(), &req); err != nil {
+			return apperr.New(apperr.InvalidInput, "Invalid GraphQL request", err)
+		}
+		return c.JSON(gw.execute(c.UserContext(), schema, req))
+	})
+}
+
+// execute runs one operation under a span named after it. Field errors are part of
+// the result, as GraphQL wants, and mark the span failed.
+func (g *gateway) execute(ctx context.Context, schema graphql.Schema, req request) *graphql.Result {
+	opType, opName := operation(req.Query, req.OperationName)
+	name := opType
+	if opName != "" {
+		name += " " + opName
+	}
+	ctx, span := g.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("graphql.operation.type", opType),
+		attribute.String("graphql.operation.name", opName),
+		attribute.String("graphql.document", req.Query),
+	))
+	defer span.End()
+
+	result := graphql.Do(graphql.Params{
+		Schema:         schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+
+	outcome := "ok"
+	if result.HasErrors() {
+		outcome = "error"
+		span.SetStatus(codes.Error, result.Errors[0].Message)
+		for _, e := range result.Errors {
+			span.AddEvent("graphql.error", trace.WithAttributes(attribute.String("message", e.Message)))
+		}
+		logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Warn("GraphQL operation failed",
+			zap.String("operation", name), zap.Int("errors", len(result.Errors)))
+	}
+	operationsTotal.WithLabelValues(opType, outcome).Inc()
+	return result
+}
+
+// operation finds the type and name of the operation a document will run.
+func operation(query, name string) (opType, opName string) {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return "invalid", ""
+	}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if op.Name != nil {
+			opName = op.Name.Value
+		}
+		if name == "" || name == opName {
+			return op.Operation, opName
+		}
+	}
+	return "invalid", ""
+}
+
+func (g *gateway) schema() (graphql.Schema, error) {
+	order := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Order",
+		Fields: graphql.Fields{
+			"id":     &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"status": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"hello": &graphql.Field{
+				Type: graphql.String,
+				Resolve: g.resolve(func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+					return g.field(ctx, g.reads, http.MethodGet, g.up.App+"/hello", "message")
+				}),
+			},
+			"delay": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Milliseconds app waited on /random-delay.",
+				Resolve: g.resolve(func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+					return g.field(ctx, g.reads, http.MethodGet, g.up.App+"/random-delay", "delay_ms")
+				}),
+			},
+			"chain": &graphql.Field{
+				Type: graphql.String,
+				Resolve: g.resolve(func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+					return g.field(ctx, g.reads, http.MethodGet, g.up.App+"/chain", "message")
+				}),
+			},
+			"app2": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Goes through app to app-2, so the trace shows two hops.",
+				Resolve: g.resolve(func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+					// Not hedged: each call publishes a message through app-2
+					return g.field(ctx, g.client, http.MethodGet, g.up.App+"/call-app2", "message")
+				}),
+			},
+			"order": &graphql.Field{
+				Type: order,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: g.resolve(func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+					return g.order(ctx, http.MethodGet, g.up.App2+"/orders/"+url.PathEscape(p.Args["id"].(string)))
+				}),
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"placeOrder": &graphql.Field{
+				Type: order,
+				Resolve: g.resolve(func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+					return g.order(ctx, http.MethodPost, g.up.App2+"/orders")
+				}),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// resolve wraps a resolver so it runs under its own span, in the background: it hands
+// the executor a thunk, letting sibling fields call their upstreams in parallel, which
+// is what the fan-out looks like in the trace.
+func (g *gateway) resolve(fn func(ctx context.Context, p graphql.ResolveParams) (any, error)) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		field := p.Info.ParentType.Name() + "." + p.Info.FieldName
+		ctx, span := g.tracer.Start(p.Context, "resolve "+field, trace.WithAttributes(
+			attribute.String("graphql.field.name", p.Info.FieldName),
+			attribute.String("graphql.field.path", fieldPath(p.Info.Path)),
+			attribute.String("graphql.field.parent", p.Info.ParentType.Name()),
+		))
+
+		type result struct {
+			value any
+			err   error
+		}
+		done := make(chan result, 1)
+		go func() {
+			defer span.End()
+			start := time.Now()
+			v, err := fn(ctx, p)
+			resolverDuration.WithLabelValues(field).Observe(time.Since(start).Seconds())
+			if err != nil {
+				fieldErrors.WithLabelValues(field).Inc()
+				shared.RecordError(ctx, err, "resolve "+field)
+			}
+			done <- result{v, err}
+		}()
+
+		return func() (any, error) {
+			r := <-done
+			return r.value, r.err
+		}, nil
+	}
+}
+
+// fieldPath renders a response path as dotted segments, e.g. orders.0.status.
+func fieldPath(p *graphql.ResponsePath) string {
+	var parts []string
+	for _, seg := range p.AsArray() {
+		parts = append(parts, fmt.Sprint(seg))
+	}
+	return strings.Join(parts, ".")
+}
+
+// field calls an upstream endpoint with client and returns one field of its JSON answer.
+func (g *gateway) field(ctx context.Context, client *http.Client, method, url, key string) (any, error) {
+	var body map[string]any
+	if err := g.call(ctx, client, method, url, &body); err != nil {
+		return nil, err
+	}
+	return body[key], nil
+}
+
+// order calls an app-2 order endpoint and maps its answer to the Order type.
+func (g *gateway) order(ctx context.Context, method, url string) (any, error) {
+	var body struct {
+		OrderID string `json:"order_id"`
+		Status  string `json:"status"`
+	}
+	if err := g.call(ctx, g.client, method, url, &body); err != nil {
+		return nil, err
+	}
+	return map[string]any{"id": body.OrderID, "status": body.Status}, nil
+}
+
+// call sends a request upstream with client and decodes the JSON answer into out.
+// Upstream errors keep the message the service gave.
+func (g *gateway) call(ctx context.Context, client *http.Client, method, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return apperr.New(apperr.Upstream, "upstream unreachable", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return apperr.New(apperr.Upstream, "failed to read upstream answer", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e httpserver.ErrorResponse
+		_ = json.Unmarshal(data, &e)
+		if e.Message == "" {
+			e.Message = resp.Status
+		}
+		return apperr.New(apperr.Upstream, fmt.Sprintf("%s %s: %s", method, req.URL.Path, e.Message), nil)
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/testkit"
+
+	"github.com/graphql-go/graphql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// upstream is a fake app and app-2: routes maps "METHOD /path" to a status and JSON body.
+type upstream struct {
+	mu     sync.Mutex
+	calls  []string
+	routes map[string]func(w http.ResponseWriter, r *http.Request)
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Method + " " + r.URL.EscapedPath()
+	u.mu.Lock()
+	u.calls = append(u.calls, key)
+	u.mu.Unlock()
+	route, ok := u.routes[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	route(w, r)
+}
+
+func reply(status int, body string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+// newTestGateway builds the gateway and its schema against up, serving both app and app-2.
+func newTestGateway(t *testing.T, up *upstream) (*gateway, graphql.Schema, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := testkit.RecordSpans(t)
+	srv := httptest.NewServer(up)
+	t.Cleanup(srv.Close)
+
+	gw := &gateway{
+		client: srv.Client(),
+		reads:  srv.Client(),
+		up:     Upstreams{App: srv.URL, App2: srv.URL},
+		tracer: otel.Tracer("graphql"),
+	}
+	schema, err := gw.schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gw, schema, exporter
+}
+
+// data round-trips the result's data through JSON, as the client would see it.
+func data(t *testing.T, result *graphql.Result) map[string]any {
+	t.Helper()
+	b, err := json.Marshal(result.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestOperation(t *testing.T) {
+	for _, tt := range []struct {
+		name, query, opName string
+		wantType, wantName  string
+	}{
+		{name: "shorthand query", query: "{ hello }", wantType: "query"},
+		{name: "named query", query: "query Greeting { hello }", wantType: "query", wantName: "Greeting"},
+		{name: "mutation", query: "mutation Place { placeOrder { id } }", wantType: "mutation", wantName: "Place"},
+		{name: "picks the named operation", query: "query A { hello } mutation B { placeOrder { id } }", opName: "B", wantType: "mutation", wantName: "B"},
+		{name: "unknown operation name", query: "query A { hello }", opName: "B", wantType: "invalid"},
+		{name: "syntax error", query: "query {", wantType: "invalid"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opType, opName := operation(tt.query, tt.opName)
+			if opType != tt.wantType || opName != tt.wantName {
+				t.Errorf("operation(%q, %q) = %q, %q; want %q, %q", tt.query, tt.opName, opType, opName, tt.wantType, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestExecuteQueryFields(t *testing.T) {
+	up := &upstream{routes: map[string]func(http.ResponseWriter, *http.Request){
+		"GET /hello":        reply(http.StatusOK, `{"message":"Hello from app"}`),
+		"GET /random-delay": reply(http.StatusOK, `{"delay_ms":42}`),
+		"GET /orders/o%2F1": reply(http.StatusOK, `{"order_id":"o/1","status":"reserved"}`),
+	}}
+	gw, schema, exporter := newTestGateway(t, up)
+
+	result := gw.execute(context.Background(), schema, request{
+		Query:     `query Home($id: ID!) { hello delay order(id: $id) { id status } }`,
+		Variables: map[string]any{"id": "o/1"},
+	})
+	if result.HasErrors() {
+		t.Fatalf("errors: %v", result.Errors)
+	}
+	got := data(t, result)
+	if got["hello"] != "Hello from app" || got["delay"] != float64(42) {
+		t.Errorf("data = %v", got)
+	}
+	if order, _ := got["order"].(map[string]any); order["id"] != "o/1" || order["status"] != "reserved" {
+		t.Errorf("order = %v, want o/1 reserved", got["order"])
+	}
+
+	op := testkit.FindSpan(t, exporter, "query Home")
+	for key, want := range map[attribute.Key]string{"graphql.operation.type": "query", "graphql.operation.name": "Home"} {
+		if v, _ := testkit.Attr(op, key); v.AsString() != want {
+			t.Errorf("operation %s = %q, want %q", key, v.AsString(), want)
+		}
+	}
+	// One span per resolver, each a child of the operation span
+	for field, path := range map[string]string{"Query.hello": "hello", "Query.delay": "delay", "Query.order": "order"} {
+		s := testkit.FindSpan(t, exporter, "resolve "+field)
+		if s.Parent.SpanID() != op.SpanContext.SpanID() {
+			t.Errorf("resolve %s is not a child of the operation span", field)
+		}
+		for key, want := range map[attribute.Key]string{"graphql.field.path": path, "graphql.field.parent": "Query"} {
+			if v, _ := testkit.Attr(s, key); v.AsString() != want {
+				t.Errorf("resolve %s %s = %q, want %q", field, key, v.AsString(), want)
+			}
+		}
+	}
+}
+
+func TestExecuteMutation(t *testing.T) {
+	up := &upstream{routes: map[string]func(http.ResponseWriter, *http.Request){
+		"POST /orders": reply(http.StatusCreated, `{"order_id":"o-9","status":"reserved"}`),
+	}}
+	gw, schema, exporter := newTestGateway(t, up)
+
+	result := gw.execute(context.Background(), schema, request{Query: `mutation { placeOrder { id status } }`})
+	if result.HasErrors() {
+		t.Fatalf("errors: %v", result.Errors)
+	}
+	if order, _ := data(t, result)["placeOrder"].(map[string]any); order["id"] != "o-9" {
+		t.Errorf("placeOrder = %v, want o-9", order)
+	}
+	if len(up.calls) != 1 || up.calls[0] != "POST /orders" {
+		t.Errorf("upstream calls = %v, want [POST /orders]", up.calls)
+	}
+	testkit.FindSpan(t, exporter, "resolve Mutation.placeOrder")
+}
+
+func TestExecuteFieldError(t *testing.T) {
+	up := &upstream{routes: map[string]func(http.ResponseWriter, *http.Request){
+		"GET /hello": reply(http.StatusOK, `{"message":"Hello from app"}`),
+		"GET /chain": reply(http.StatusServiceUnavailable, `{"code":"unavailable","message":"chain is down"}`),
+	}}
+	gw, schema, exporter := newTestGateway(t, up)
+
+	result := gw.execute(context.Background(), schema, request{Query: `{ hello chain }`})
+
+	// The failed field is null with an error; its sibling still resolves
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Message, "GET /chain: chain is down") {
+		t.Fatalf("errors = %v, want one for GET /chain", result.Errors)
+	}
+	got := data(t, result)
+	if got["hello"] != "Hello from app" || got["chain"] != nil {
+		t.Errorf("data = %v, want hello set and chain null", got)
+	}
+
+	chain := testkit.FindSpan(t, exporter, "resolve Query.chain")
+	if chain.Status.Code != codes.Error {
+		t.Errorf("resolve Query.chain status = %v, want Error", chain.Status.Code)
+	}
+	if v, _ := testkit.Attr(chain, "error.code"); v.AsString() != string(apperr.Upstream) {
+		t.Errorf("error.code = %q, want %s", v.AsString(), apperr.Upstream)
+	}
+	if hello := testkit.FindSpan(t, exporter, "resolve Query.hello"); hello.Status.Code == codes.Error {
+		t.Errorf("resolve Query.hello failed")
+	}
+	op := testkit.FindSpan(t, exporter, "query")
+	if op.Status.Code != codes.Error {
+		t.Errorf("operation span status = %v, want Error", op.Status.Code)
+	}
+	if len(op.Events) != 1 || op.Events[0].Name != "graphql.error" {
+		t.Errorf("operation span events = %v, want one graphql.error", op.Events)
+	}
+}
+
+func TestExecuteFansOut(t *testing.T) {
+	// Each upstream call waits for the other to arrive, so the operation only completes
+	// if sibling resolvers run in parallel.
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	both := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(both)
+	}()
+	wait := func(body string) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			arrived.Done()
+			select {
+			case <-both:
+				reply(http.StatusOK, body)(w, r)
+			case <-time.After(5 * time.Second):
+				reply(http.StatusGatewayTimeout, `{"message":"sibling never arrived"}`)(w, r)
+			}
+		}
+	}
+	up := &upstream{routes: map[string]func(http.ResponseWriter, *http.Request){
+		"GET /hello": wait(`{"message":"hi"}`),
+		"GET /chain": wait(`{"message":"chained"}`),
+	}}
+	gw, schema, exporter := newTestGateway(t, up)
+
+	result := gw.execute(context.Background(), schema, request{Query: `{ hello chain }`})
+	if result.HasErrors() {
+		t.Fatalf("errors: %v", result.Errors)
+	}
+
+	hello := testkit.FindSpan(t, exporter, "resolve Query.hello")
+	chain := testkit.FindSpan(t, exporter, "resolve Query.chain")
+	if hello.StartTime.After(chain.EndTime) || chain.StartTime.After(hello.EndTime) {
+		t.Errorf("resolver spans do not overlap")
+	}
+}
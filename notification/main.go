@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/daanielsharon/observability-go/profiles"
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/amqp"
+	"github.com/daanielsharon/observability-go/shared/bootstrap"
+	"github.com/daanielsharon/observability-go/shared/consumer"
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/grpchealth"
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"github.com/daanielsharon/observability-go/shared/notify"
+	"github.com/daanielsharon/observability-go/shared/random"
+	"github.com/daanielsharon/observability-go/shared/runner"
+	"github.com/daanielsharon/observability-go/shared/tasks"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var notificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "notifications_sent_total",
+	Help: "Notifications \"sent\", by channel (email, sms), event type and outcome.",
+}, []string{"channel", "event", "outcome"})
+
+//go:embed event.schema.json
+var eventSchemaJSON []byte
+
+// eventSchema is what notify.Event bodies must look like; anything else is dead-lettered unhandled.
+var eventSchema = consumer.MustCompileSchema("event.schema.json", eventSchemaJSON)
+
+// channelsFor picks how a user hears about the event: always email, SMS only for orders.
+func channelsFor(event notify.Event) []string {
+	if strings.HasPrefix(event.Type, "order.") {
+		return []string{"email", "sms"}
+	}
+	return []string{"email"}
+}
+
+// send pretends to deliver the notification over channel; nothing leaves the process but a log line.
+func send(ctx context.Context, channel string, event notify.Event) error {
+	ctx, span := otel.Tracer("notification").Start(ctx, "send "+channel, oteltrace.WithAttributes(
+		attribute.String("notification.channel", channel),
+		attribute.String("notification.event", event.Type),
+		attribute.String("notification.subject", event.Subject),
+	))
+	defer span.End()
+
+	time.Sleep(time.Duration(random.Default.Intn(200)) * time.Millisecond)
+	if random.Default.Intn(20) == 0 {
+		err := fmt.Errorf("%s gateway rejected the message", channel)
+		shared.RecordError(ctx, err, "")
+		notificationsSent.WithLabelValues(channel, event.Type, "error").Inc()
+		return err
+	}
+
+	logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("[Notification] sent",
+		zap.String("channel", channel),
+		zap.String("event", event.Type),
+		zap.String("subject", event.Subject),
+	)
+	notificationsSent.WithLabelValues(channel, event.Type, "ok").Inc()
+	return nil
+}
+
+// handleEvent sends the notifications for one event. Failed sends are logged and
+// recorded but not retried; malformed events are dead-lettered.
+func handleEvent(ctx context.Context, d amqp091.Delivery) error {
+	span := oteltrace.SpanFromContext(ctx)
+	traceLogger := logger.WithTrace(ctx, span.SpanContext().SpanID().String())
+
+	var event notify.Event
+	if err := json.Unmarshal(d.Body, &event); err != nil {
+		return consumer.Reject(fmt.Errorf("malformed event: %w", err))
+	}
+	span.SetAttributes(
+		attribute.String("notification.event", event.Type),
+		attribute.String("notification.subject", event.Subject),
+	)
+
+	for _, channel := range channelsFor(event) {
+		if err := send(ctx, channel, event); err != nil {
+			traceLogger.Error("[Notification] Failed to send", zap.String("channel", channel), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// topology is the notifications queue and the dead-letter queue for messages that
+// can't be processed, both of the given type.
+func topology(queueType amqp.QueueType) amqp.Topology {
+	return amqp.Topology{Queues: []amqp.Queue{
+		{Name: notify.Queue + ".dlq", Type: queueType},
+		{Name: notify.Queue, Type: queueType, DeadLetter: notify.Queue + ".dlq"},
+	}}
+}
+
+// setupRabbitMQ connects to the broker at url and declares the topology with queues of
+// type queueType.
+func setupRabbitMQ(log *zap.Logger, url string, queueType amqp.QueueType) (*amqp.Connection, *amqp091.Channel, error) {
+	conn, err := amqp.Dial(url, os.Getenv("SERVICE_NAME"), amqp.WithLogger(log))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+
+	// Declare what the service needs on the broker; drift from what is there is logged
+	t := topology(queueType)
+	diagnostics.RegisterConfig("topology", t)
+	if err := t.Apply(conn); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to declare the RabbitMQ topology: %w", err)
+	}
+	return conn, ch, nil
+}
+
+func main() {
+	// Spans go to Tempo over OTLP HTTP unless the profile or environment says otherwise
+	svc := bootstrap.New(bootstrap.Config{Profiles: profiles.FS, TraceEndpoint: "tempo:4318", TraceProtocol: "http"})
+	zapLogger, r := svc.Log, svc.Runner
+
+	// Hold startup until the broker accepts connections; unlike traces it is not optional
+	amqpURL, err := amqp.URLFromEnv()
+	if err != nil {
+		zapLogger.Fatal("invalid RabbitMQ config", zap.Error(err))
+	}
+	queueType, err := amqp.QueueTypeFromEnv()
+	if err != nil {
+		zapLogger.Fatal("invalid RabbitMQ config", zap.Error(err))
+	}
+	r.WaitFor("rabbitmq", runner.TCPCheck(amqpURL))
+
+	var (
+		conn *amqp.Connection
+		ch   *amqp091.Channel
+	)
+	r.Add("rabbitmq", runner.Hook{
+		OnStart: func(ctx context.Context) (err error) {
+			conn, ch, err = setupRabbitMQ(zapLogger, amqpURL, queueType)
+			return err
+		},
+		OnStop: func(ctx context.Context) error {
+			return errors.Join(ch.Close(), conn.Close())
+		},
+	})
+
+	// Consumes the queue once RabbitMQ is up; pause, resume and resize it at runtime
+	// through /admin/consumer (CONSUMER_PREFETCH and CONSUMER_WORKERS set the start)
+	loopCfg := consumer.LoopConfigFromEnv()
+	diagnostics.RegisterConfig("consumer", loopCfg)
+	loop := consumer.NewLoop(notify.Queue, "notification", zapLogger)
+
+	// Expose metrics for Prometheus, plus the debug and admin endpoints every service has
+	svc.ServeMetrics(map[string]http.Handler{
+		"/admin/consumer": loop.Handler(),
+	})
+
+	// grpc.health.v1 for probes: SERVING once the consumer is up, NOT_SERVING from the start of shutdown
+	healthServer := grpchealth.New(fmt.Sprintf(":%s", os.Getenv("GRPC_HEALTH_PORT")), zapLogger)
+	r.Add("grpc-health", healthServer)
+
+	// Heartbeat and stall detection for a consumer that is up but no longer taking deliveries
+	hbCfg := consumer.HeartbeatConfigFromEnv()
+	diagnostics.RegisterConfig("heartbeat", hbCfg)
+	heartbeat := consumer.NewHeartbeat(notify.Queue, zapLogger, hbCfg)
+
+	stopping := make(chan struct{})
+	r.Add("consumer", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			handler := consumer.Chain(
+				consumer.HandlerFunc(handleEvent),
+				heartbeat.Middleware(),
+				consumer.Metrics(notify.Queue),
+				consumer.Tracing(otel.Tracer("notification"), "Send Notifications"),
+				consumer.Recover(zapLogger),
+				consumer.Logging(zapLogger),
+				consumer.Validate(notify.Queue, eventSchema),
+				consumer.Watchdog(svc.Watchdog, "Send Notifications"),
+				consumer.Dedup(10*time.Minute),
+			)
+
+			if err := loop.Start(ch, handler, loopCfg); err != nil {
+				return err
+			}
+			zapLogger.Info("[Notification] Waiting for messages. To exit press CTRL+C")
+			// Losing the connection, the channel or the consumer ends deliveries; fail
+			// with the reason so the process restarts and reconnects
+			go func() {
+				select {
+				case <-stopping:
+				case err := <-conn.Lost():
+					r.Fail("consumer", err)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			// Stop deliveries and let the message in hand finish
+			close(stopping)
+			if err := loop.Stop(ctx); err != nil {
+				return err
+			}
+			// Let background work started by handled messages finish too
+			return tasks.Wait(ctx)
+		},
+	}, "rabbitmq", "metrics", "watchdog")
+
+	r.Add("heartbeat", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			return heartbeat.Start(ch)
+		},
+		OnStop: heartbeat.Stop,
+	}, "consumer")
+	r.Add("ready", healthServer.Serving(""), "consumer")
+
+	svc.Run()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/daanielsharon/observability-go/profiles"
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/amqp"
+	"github.com/daanielsharon/observability-go/shared/bootstrap"
+	"github.com/daanielsharon/observability-go/shared/clock"
+	"github.com/daanielsharon/observability-go/shared/consumer"
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/grpchealth"
+	"github.com/daanielsharon/observability-go/shared/httpclient"
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"github.com/daanielsharon/observability-go/shared/notify"
+	"github.com/daanielsharon/observability-go/shared/random"
+	"github.com/daanielsharon/observability-go/shared/runner"
+	"github.com/daanielsharon/observability-go/shared/tasks"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+//go:embed order.schema.json
+var orderSchemaJSON []byte
+
+// orderSchema is what orders app-2 hands off must look like; anything else is dead-lettered unhandled.
+var orderSchema = consumer.MustCompileSchema("order.schema.json", orderSchemaJSON)
+
+// handleOrder runs the saga steps for one order. A failed step is a normal saga outcome
+// and still acks the message; malformed orders are dead-lettered.
+func handleOrder(ctx context.Context, clk clock.Clock, rnd random.Source, ch *amqp091.Channel, client *http.Client, d amqp091.Delivery) error {
+	span := oteltrace.SpanFromContext(ctx)
+	traceLogger := logger.WithTrace(ctx, span.SpanContext().SpanID().String())
+
+	var order Order
+	if err := json.Unmarshal(d.Body, &order); err != nil {
+		return consumer.Reject(fmt.Errorf("malformed order: %w", err))
+	}
+	span.SetAttributes(attribute.String("saga.order_id", order.ID))
+	traceLogger.Info("[Order Worker] Received an order", zap.String("order_id", order.ID))
+
+	event, err := processOrder(ctx, clk, rnd, client, order)
+	if err != nil {
+		shared.RecordError(ctx, err, "")
+		traceLogger.Error("[Order Worker] Failed to report order outcome", zap.Error(err))
+	}
+	if err := notify.Publish(ctx, ch, event, order.ID); err != nil {
+		traceLogger.Error("[Order Worker] Failed to publish order event", zap.Error(err))
+	}
+	return nil
+}
+
+// topology is orders and the dead-letter queue for messages that can't be processed,
+// both of the given type.
+func topology(queueType amqp.QueueType) amqp.Topology {
+	return amqp.Topology{Queues: []amqp.Queue{
+		{Name: "orders.dlq", Type: queueType},
+		{Name: "orders", Type: queueType, DeadLetter: "orders.dlq"},
+	}}
+}
+
+// setupRabbitMQ connects to the broker at url and declares the topology with queues of
+// type queueType.
+func setupRabbitMQ(log *zap.Logger, url string, queueType amqp.QueueType) (*amqp.Connection, *amqp091.Channel, error) {
+	conn, err := amqp.Dial(url, os.Getenv("SERVICE_NAME"), amqp.WithLogger(log))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+
+	// Declare what the service needs on the broker; drift from what is there is logged
+	t := topology(queueType)
+	diagnostics.RegisterConfig("topology", t)
+	if err := t.Apply(conn); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to declare the RabbitMQ topology: %w", err)
+	}
+	return conn, ch, nil
+}
+func main() {
+	// Spans go to Tempo over OTLP HTTP unless the profile or environment says otherwise
+	svc := bootstrap.New(bootstrap.Config{Profiles: profiles.FS, TraceEndpoint: "tempo:4318", TraceProtocol: "http"})
+	zapLogger, r := svc.Log, svc.Runner
+
+	// Hold startup until the broker accepts connections; unlike traces it is not optional
+	amqpURL, err := amqp.URLFromEnv()
+	if err != nil {
+		zapLogger.Fatal("invalid RabbitMQ config", zap.Error(err))
+	}
+	queueType, err := amqp.QueueTypeFromEnv()
+	if err != nil {
+		zapLogger.Fatal("invalid RabbitMQ config", zap.Error(err))
+	}
+	r.WaitFor("rabbitmq", runner.TCPCheck(amqpURL))
+
+	var (
+		conn *amqp.Connection
+		ch   *amqp091.Channel
+	)
+	r.Add("rabbitmq", runner.Hook{
+		OnStart: func(ctx context.Context) (err error) {
+			conn, ch, err = setupRabbitMQ(zapLogger, amqpURL, queueType)
+			return err
+		},
+		OnStop: func(ctx context.Context) error {
+			return errors.Join(ch.Close(), conn.Close())
+		},
+	})
+
+	// Consumes the queue once RabbitMQ is up; pause, resume and resize it at runtime
+	// through /admin/consumer (CONSUMER_PREFETCH and CONSUMER_WORKERS set the start)
+	loopCfg := consumer.LoopConfigFromEnv()
+	diagnostics.RegisterConfig("consumer", loopCfg)
+	loop := consumer.NewLoop("orders", "order-worker", zapLogger)
+
+	// Expose metrics for Prometheus, plus the debug and admin endpoints every service has
+	svc.ServeMetrics(map[string]http.Handler{
+		"/admin/consumer": loop.Handler(),
+	})
+
+	// grpc.health.v1 for probes: SERVING once the consumer is up, NOT_SERVING from the start of shutdown
+	healthServer := grpchealth.New(fmt.Sprintf(":%s", os.Getenv("GRPC_HEALTH_PORT")), zapLogger)
+	r.Add("grpc-health", healthServer)
+
+	// HTTP client for reporting saga outcomes back to app-2
+	client := httpclient.New()
+
+	// Heartbeat and stall detection for a consumer that is up but no longer taking deliveries
+	hbCfg := consumer.HeartbeatConfigFromEnv()
+	diagnostics.RegisterConfig("heartbeat", hbCfg)
+	heartbeat := consumer.NewHeartbeat("orders", zapLogger, hbCfg)
+
+	stopping := make(chan struct{})
+	r.Add("consumer", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			handler := consumer.Chain(
+				consumer.HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+					return handleOrder(ctx, clock.Real, random.Default, ch, client, d)
+				}),
+				heartbeat.Middleware(),
+				consumer.Metrics("orders"),
+				consumer.Tracing(otel.Tracer("order-worker"), "Process Order"),
+				consumer.Recover(zapLogger),
+				consumer.Logging(zapLogger),
+				consumer.Validate("orders", orderSchema),
+				consumer.Watchdog(svc.Watchdog, "Process Order"),
+				consumer.Dedup(10*time.Minute),
+			)
+
+			if err := loop.Start(ch, handler, loopCfg); err != nil {
+				return err
+			}
+			zapLogger.Info("[Order Worker] Waiting for messages. To exit press CTRL+C")
+			// Losing the connection, the channel or the consumer ends deliveries; fail
+			// with the reason so the process restarts and reconnects
+			go func() {
+				select {
+				case <-stopping:
+				case err := <-conn.Lost():
+					r.Fail("consumer", err)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			// Stop deliveries and let the message in hand finish
+			close(stopping)
+			if err := loop.Stop(ctx); err != nil {
+				return err
+			}
+			// Let background work started by handled messages finish too
+			return tasks.Wait(ctx)
+		},
+	}, "rabbitmq", "metrics", "watchdog")
+
+	r.Add("heartbeat", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			return heartbeat.Start(ch)
+		},
+		OnStop: heartbeat.Stop,
+	}, "consumer")
+	r.Add("ready", healthServer.Serving(""), "consumer")
+
+	svc.Run()
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/clock"
+	"github.com/daanielsharon/observability-go/shared/httpclient"
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"github.com/daanielsharon/observability-go/shared/notify"
+	"github.com/daanielsharon/observability-go/shared/random"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Order is the saga message published by app-2 after it reserved the stock.
+type Order struct {
+	ID     string  `json:"order_id"`
+	Item   string  `json:"item"`
+	Amount float64 `json:"amount"`
+}
+
+// chargeTimeout bounds a charge including retries, so a hanging payments service fails the step.
+const chargeTimeout = 5 * time.Second
+
+// app2URL is where the reservation owner listens for the saga outcome.
+func app2URL() string {
+	if u := os.Getenv("APP2_URL"); u != "" {
+		return u
+	}
+	return "http://app-2:8081"
+}
+
+func paymentsURL() string {
+	if u := os.Getenv("PAYMENTS_URL"); u != "" {
+		return u
+	}
+	return "http://payments:8082"
+}
+
+// processOrder runs the worker's saga steps (charge → ship). When a step fails, the
+// completed steps are compensated in reverse order, ending with app-2 releasing the
+// reservation; otherwise app-2 is told the order is complete.
+// It returns the notification event describing the outcome. The simulated steps are
+// timed on clk and fail as drawn from rnd.
+func processOrder(ctx context.Context, clk clock.Clock, rnd random.Source, client *http.Client, order Order) (string, error) {
+	chargeID, err := charge(ctx, client, order)
+	if err != nil {
+		// A charge that timed out may still have been captured
+		refundOrder(ctx, client, order)
+		return notify.OrderCancelled, finishOrder(ctx, client, order, "release", "charge failed")
+	}
+
+	if err := sagaStep(ctx, clk, rnd, "ship", order, 5); err != nil {
+		refund(ctx, client, order, chargeID)
+		return notify.OrderCancelled, finishOrder(ctx, client, order, "release", "ship failed")
+	}
+
+	return notify.OrderCompleted, finishOrder(ctx, client, order, "complete", "")
+}
+
+// charge is the payment step, done by the payments service.
+func charge(ctx context.Context, client *http.Client, order Order) (string, error) {
+	ctx, span := otel.Tracer("order-worker").Start(ctx, "saga charge", oteltrace.WithAttributes(
+		attribute.String("saga.order_id", order.ID),
+		attribute.String("saga.step", "charge"),
+		attribute.Float64("saga.amount", order.Amount),
+	))
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, chargeTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]any{"order_id": order.ID, "amount": order.Amount})
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpclient.DoWithRetry(ctx, client, httpclient.DefaultRetryPolicy(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, paymentsURL()+"/charges", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		// One charge per order however often it is retried
+		req.Header.Set(httpclient.IdempotencyKeyHeader, order.ID)
+		return req, nil
+	})
+	if err != nil {
+		shared.RecordError(ctx, err, "charge request failed")
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		err := fmt.Errorf("payments returned status %d", resp.StatusCode)
+		shared.RecordError(ctx, err, "")
+		return "", err
+	}
+
+	var result struct {
+		ChargeID string `json:"charge_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		shared.RecordError(ctx, err, "malformed charge response")
+		return "", err
+	}
+	span.SetAttributes(attribute.String("payments.charge_id", result.ChargeID))
+	span.AddEvent("saga.step.completed")
+	return result.ChargeID, nil
+}
+
+// sagaStep simulates one step of the saga, taking a time drawn from rnd on clk; it fails
+// once in failureOdds runs.
+func sagaStep(ctx context.Context, clk clock.Clock, rnd random.Source, step string, order Order, failureOdds int) error {
+	ctx, span := otel.Tracer("order-worker").Start(ctx, "saga "+step, oteltrace.WithAttributes(
+		attribute.String("saga.order_id", order.ID),
+		attribute.String("saga.step", step),
+		attribute.Float64("saga.amount", order.Amount),
+	))
+	defer span.End()
+
+	if err := clock.Sleep(ctx, clk, time.Duration(rnd.Intn(300))*time.Millisecond); err != nil {
+		shared.RecordError(ctx, err, "")
+		return err
+	}
+	if rnd.Intn(failureOdds) == 0 {
+		err := fmt.Errorf("%s failed for order %s", step, order.ID)
+		shared.RecordError(ctx, err, "")
+		return err
+	}
+	span.AddEvent("saga.step.completed")
+	return nil
+}
+
+// refund compensates the charge step through the payments service.
+func refund(ctx context.Context, client *http.Client, order Order, chargeID string) {
+	oteltrace.SpanFromContext(ctx).AddEvent("saga.compensation", oteltrace.WithAttributes(
+		attribute.String("saga.order_id", order.ID),
+		attribute.String("saga.step", "charge"),
+	))
+
+	ctx, span := otel.Tracer("order-worker").Start(ctx, "saga refund", oteltrace.WithAttributes(
+		attribute.String("saga.order_id", order.ID),
+		attribute.Float64("saga.amount", order.Amount),
+		attribute.String("payments.charge_id", chargeID),
+	))
+	defer span.End()
+
+	traceLogger := logger.WithTrace(ctx, span.SpanContext().SpanID().String())
+	resp, err := httpclient.DoWithRetry(ctx, client, httpclient.DefaultRetryPolicy(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, paymentsURL()+"/charges/"+url.PathEscape(chargeID)+"/refund", nil)
+		if err != nil {
+			return nil, err
+		}
+		// Refunding twice leaves the charge refunded
+		req.Header.Set(httpclient.IdempotencyKeyHeader, "refund-"+chargeID)
+		return req, nil
+	})
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("payments returned status %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		// Left for manual reconciliation; the reservation is still released
+		shared.RecordError(ctx, err, "refund failed")
+		traceLogger.Error("refund failed", zap.String("order_id", order.ID), zap.String("charge_id", chargeID), zap.Error(err))
+		return
+	}
+	traceLogger.Warn("charge refunded", zap.String("order_id", order.ID), zap.String("charge_id", chargeID))
+}
+
+// refundOrder compensates a charge whose outcome is unknown: payments refunds whatever
+// it captured for the order and refuses a charge for it that is still on its way.
+func refundOrder(ctx context.Context, client *http.Client, order Order) {
+	oteltrace.SpanFromContext(ctx).AddEvent("saga.compensation", oteltrace.WithAttributes(
+		attribute.String("saga.order_id", order.ID),
+		attribute.String("saga.step", "charge"),
+	))
+
+	ctx, span := otel.Tracer("order-worker").Start(ctx, "saga refund order", oteltrace.WithAttributes(
+		attribute.String("saga.order_id", order.ID),
+		attribute.Float64("saga.amount", order.Amount),
+	))
+	defer span.End()
+
+	traceLogger := logger.WithTrace(ctx, span.SpanContext().SpanID().String())
+	resp, err := httpclient.DoWithRetry(ctx, client, httpclient.DefaultRetryPolicy(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, paymentsURL()+"/charges/refund?order_id="+url.QueryEscape(order.ID), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(httpclient.IdempotencyKeyHeader, "refund-order-"+order.ID)
+		return req, nil
+	})
+	var refunded []struct {
+		ChargeID string `json:"charge_id"`
+	}
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("payments returned status %d", resp.StatusCode)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&refunded)
+		}
+	}
+	if err != nil {
+		// Left for manual reconciliation; the reservation is still released
+		shared.RecordError(ctx, err, "refund failed")
+		traceLogger.Error("refund of unconfirmed charge failed", zap.String("order_id", order.ID), zap.Error(err))
+		return
+	}
+	span.SetAttributes(attribute.Int("payments.refunded", len(refunded)))
+	if len(refunded) > 0 {
+		traceLogger.Warn("unconfirmed charge refunded", zap.String("order_id", order.ID), zap.Int("charges", len(refunded)))
+	}
+}
+
+// finishOrder reports the outcome to app-2: "complete", or "release" to compensate the reservation.
+func finishOrder(ctx context.Context, client *http.Client, order Order, action, reason string) error {
+	if action == "release" {
+		oteltrace.SpanFromContext(ctx).AddEvent("saga.compensation", oteltrace.WithAttributes(
+			attribute.String("saga.order_id", order.ID),
+			attribute.String("saga.step", "reserve"),
+			attribute.String("saga.reason", reason),
+		))
+	}
+
+	target := fmt.Sprintf("%s/orders/%s/%s?reason=%s", app2URL(), url.PathEscape(order.ID), action, url.QueryEscape(reason))
+	resp, err := httpclient.DoWithRetry(ctx, client, httpclient.DefaultRetryPolicy(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		// Completing or releasing an order twice leaves it in the same state
+		req.Header.Set(httpclient.IdempotencyKeyHeader, order.ID+"-"+action)
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to %s order %s: %w", action, order.ID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("app-2 returned status %d for %s", resp.StatusCode, action)
+	}
+	return nil
+}
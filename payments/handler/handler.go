@@ -0,0 +1,390 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/attrs"
+	"github.com/daanielsharon/observability-go/shared/clock"
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Failure modes; faults are injected deterministically so a chaos scenario behaves the same on every run.
+const (
+	ModeNone     = "none"
+	ModeError    = "error"     // every Nth charge answers 503
+	ModeTimeout  = "timeout"   // every Nth charge hangs for Hang before answering
+	ModeSlowRamp = "slow-ramp" // each charge is RampStep slower than the previous one, up to RampMax
+)
+
+// FailureConfig selects the fault injected into charge requests.
+type FailureConfig struct {
+	Mode     string   `json:"mode"`
+	Every    int      `json:"every"`
+	Hang     duration `json:"hang"`
+	RampStep duration `json:"ramp_step"`
+	RampMax  duration `json:"ramp_max"`
+}
+
+// duration is a time.Duration written as "250ms" in JSON.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// FailureConfigFromEnv reads PAYMENTS_FAILURE_MODE (default none), PAYMENTS_FAILURE_EVERY (default 1),
+// PAYMENTS_HANG (default 10s), PAYMENTS_RAMP_STEP (default 50ms) and PAYMENTS_RAMP_MAX (default 5s).
+func FailureConfigFromEnv() FailureConfig {
+	cfg := FailureConfig{
+		Mode:     os.Getenv("PAYMENTS_FAILURE_MODE"),
+		Every:    1,
+		Hang:     duration(10 * time.Second),
+		RampStep: duration(50 * time.Millisecond),
+		RampMax:  duration(5 * time.Second),
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = ModeNone
+	}
+	if v, err := strconv.Atoi(os.Getenv("PAYMENTS_FAILURE_EVERY")); err == nil && v > 0 {
+		cfg.Every = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("PAYMENTS_HANG")); err == nil {
+		cfg.Hang = duration(v)
+	}
+	if v, err := time.ParseDuration(os.Getenv("PAYMENTS_RAMP_STEP")); err == nil {
+		cfg.RampStep = duration(v)
+	}
+	if v, err := time.ParseDuration(os.Getenv("PAYMENTS_RAMP_MAX")); err == nil {
+		cfg.RampMax = duration(v)
+	}
+	return cfg
+}
+
+func (c FailureConfig) validate() error {
+	switch c.Mode {
+	case ModeNone, ModeError, ModeTimeout, ModeSlowRamp:
+	default:
+		return fmt.Errorf("unknown failure mode %q", c.Mode)
+	}
+	if c.Every < 1 {
+		return fmt.Errorf("every must be at least 1")
+	}
+	return nil
+}
+
+// faults decides per charge request which fault to inject. The request counter
+// restarts whenever the configuration changes. Injected delays are timed on clock.
+type faults struct {
+	clock clock.Clock
+
+	mu    sync.Mutex
+	cfg   FailureConfig
+	count int
+}
+
+func (f *faults) config() FailureConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cfg
+}
+
+func (f *faults) set(cfg FailureConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cfg = cfg
+	f.count = 0
+}
+
+// next returns the delay to add and whether the request should fail.
+func (f *faults) next() (time.Duration, bool, FailureConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count++
+
+	cfg := f.cfg
+	switch cfg.Mode {
+	case ModeError:
+		return 0, f.count%cfg.Every == 0, cfg
+	case ModeTimeout:
+		if f.count%cfg.Every == 0 {
+			return time.Duration(cfg.Hang), false, cfg
+		}
+	case ModeSlowRamp:
+		return min(time.Duration(f.count)*time.Duration(cfg.RampStep), time.Duration(cfg.RampMax)), false, cfg
+	}
+	return 0, false, cfg
+}
+
+type charge struct {
+	ID      string  `json:"charge_id"`
+	OrderID string  `json:"order_id"`
+	Amount  float64 `json:"amount"`
+	Status  string  `json:"status"`
+}
+
+// idempotencyKeyHeader names the key a retried charge is recognised by.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// ledger holds the charges. A charge made with an Idempotency-Key is kept under it, so
+// a retry gets the first charge back instead of a second one; an order refunded as a
+// whole is voided, so a charge for it that lands late is refused.
+type ledger struct {
+	mu      sync.Mutex
+	byID    map[string]*charge
+	byKey   map[string]*charge
+	byOrder map[string][]*charge
+	voided  map[string]bool
+}
+
+func newLedger() *ledger {
+	return &ledger{
+		byID:    make(map[string]*charge),
+		byKey:   make(map[string]*charge),
+		byOrder: make(map[string][]*charge),
+		voided:  make(map[string]bool),
+	}
+}
+
+// capture records a charge, or returns the one key already made (replayed). A replay
+// of a charge since refunded is refused, so the caller doesn't take it as paid.
+func (l *ledger) capture(key, orderID string, amount float64) (ch charge, replayed bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if prev, ok := l.byKey[key]; ok && key != "" {
+		if prev.OrderID != orderID || prev.Amount != amount {
+			return charge{}, false, apperr.New(apperr.Conflict, "Idempotency-Key was used for a different charge", nil)
+		}
+		if prev.Status != "captured" || l.voided[orderID] {
+			return charge{}, false, apperr.New(apperr.Conflict, "Charge was refunded, replay refused", nil)
+		}
+		return *prev, true, nil
+	}
+	if l.voided[orderID] {
+		return charge{}, false, apperr.New(apperr.Conflict, "Order was refunded, charge refused", nil)
+	}
+
+	c := &charge{ID: uuid.NewString(), OrderID: orderID, Amount: amount, Status: "captured"}
+	l.byID[c.ID] = c
+	l.byOrder[orderID] = append(l.byOrder[orderID], c)
+	if key != "" {
+		l.byKey[key] = c
+	}
+	return *c, false, nil
+}
+
+func (l *ledger) refund(id string) (charge, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.byID[id]
+	if !ok {
+		return charge{}, false
+	}
+	c.Status = "refunded"
+	return *c, true
+}
+
+// refundOrder refunds every charge of orderID and voids the order.
+func (l *ledger) refundOrder(orderID string) []charge {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.voided[orderID] = true
+	refunded := make([]charge, 0, len(l.byOrder[orderID]))
+	for _, c := range l.byOrder[orderID] {
+		c.Status = "refunded"
+		refunded = append(refunded, *c)
+	}
+	return refunded
+}
+
+func (l *ledger) forOrder(orderID string) []charge {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	found := make([]charge, 0, len(l.byOrder[orderID]))
+	for _, c := range l.byOrder[orderID] {
+		found = append(found, *c)
+	}
+	return found
+}
+
+// RegisterRoutes adds the payments routes to app and the failure mode handler through
+// admin, which serves it on the ops port. Injected faults wait on clk; nil is the real clock.
+func RegisterRoutes(app *fiber.App, admin func(pattern string, h http.Handler), log *zap.Logger, clk clock.Clock) {
+	tracer := otel.Tracer("payments")
+	injector := &faults{clock: clock.Or(clk), cfg: FailureConfigFromEnv()}
+	diagnostics.RegisterConfig("failure_mode", func() any { return injector.config() })
+	log.Info("payments failure mode", zap.Any("config", injector.config()))
+
+	charges := newLedger()
+
+	// Send an Idempotency-Key (the order ID, say) to make retries safe: a repeated key
+	// returns the first charge instead of capturing again
+	app.Post("/charges", func(c *fiber.Ctx) error {
+		ctx, span := tracer.Start(c.UserContext(), "POST /charges")
+		defer span.End()
+		currentSpanId := span.SpanContext().SpanID().String()
+
+		var req struct {
+			OrderID string  `json:"order_id"`
+			Amount  float64 `json:"amount"`
+		}
+		if err := c.BodyParser(&req); err != nil || req.OrderID == "" || req.Amount <= 0 {
+			return apperr.New(apperr.InvalidInput, "order_id and a positive amount are required", err)
+		}
+		key := c.Get(idempotencyKeyHeader)
+		span.SetAttributes(
+			attribute.String("payments.order_id", req.OrderID),
+			attribute.Float64("payments.amount", req.Amount),
+			attribute.String("payments.idempotency_key", key),
+		)
+
+		if err := injectFault(ctx, injector); err != nil {
+			shared.RecordError(ctx, err, "")
+			logger.WithTrace(ctx, currentSpanId).Error("charge failed", zap.String("order_id", req.OrderID), zap.Error(err))
+			return err
+		}
+
+		ch, replayed, err := charges.capture(key, req.OrderID, req.Amount)
+		if err != nil {
+			logger.WithTrace(ctx, currentSpanId).Warn("charge refused", zap.String("order_id", req.OrderID), zap.Error(err))
+			return err
+		}
+		span.SetAttributes(
+			attribute.String("payments.charge_id", ch.ID),
+			attribute.Bool("payments.replayed", replayed),
+		)
+		if replayed {
+			logger.WithTrace(ctx, currentSpanId).Info("charge replayed", zap.String("order_id", req.OrderID), zap.String("charge_id", ch.ID))
+			c.Set("Idempotent-Replayed", "true")
+			return c.Status(fiber.StatusCreated).JSON(ch)
+		}
+
+		logger.WithTrace(ctx, currentSpanId).Info("charge captured", zap.String("order_id", req.OrderID), zap.String("charge_id", ch.ID))
+		return c.Status(fiber.StatusCreated).JSON(ch)
+	})
+
+	// The charges of one order, for callers that don't know whether their charge landed
+	app.Get("/charges", func(c *fiber.Ctx) error {
+		orderID := c.Query("order_id")
+		if orderID == "" {
+			return apperr.New(apperr.InvalidInput, "order_id is required", nil)
+		}
+		return c.JSON(charges.forOrder(orderID))
+	})
+
+	// Refunds every charge of an order and refuses charges for it that arrive later, for
+	// a caller that gave up on a charge whose outcome it doesn't know
+	app.Post("/charges/refund", func(c *fiber.Ctx) error {
+		ctx, span := tracer.Start(c.UserContext(), "POST /charges/refund")
+		defer span.End()
+
+		orderID := c.Query("order_id")
+		if orderID == "" {
+			return apperr.New(apperr.InvalidInput, "order_id is required", nil)
+		}
+		refunded := charges.refundOrder(orderID)
+		span.SetAttributes(
+			attribute.String("payments.order_id", orderID),
+			attribute.Int("payments.refunded", len(refunded)),
+		)
+
+		logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("order refunded",
+			zap.String("order_id", orderID), zap.Int("charges", len(refunded)))
+		return c.JSON(refunded)
+	})
+
+	app.Post("/charges/:id/refund", func(c *fiber.Ctx) error {
+		ctx, span := tracer.Start(c.UserContext(), "POST /charges/:id/refund")
+		defer span.End()
+
+		ch, ok := charges.refund(c.Params("id"))
+		if !ok {
+			return apperr.New(apperr.NotFound, "Charge not found", nil)
+		}
+		span.SetAttributes(attribute.String("payments.charge_id", ch.ID))
+
+		logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Info("charge refunded", zap.String("charge_id", ch.ID))
+		return c.JSON(ch)
+	})
+
+	// Chaos scenarios switch the failure mode at runtime, through the ops port
+	admin("/admin/failure-mode", failureModeHandler(injector, log))
+}
+
+// failureModeHandler serves the failure mode as JSON on GET and changes it from a JSON
+// body on PUT; fields the body leaves out keep their current value.
+func failureModeHandler(injector *faults, log *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := injector.config()
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&cfg)
+			if err == nil {
+				err = cfg.validate()
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			injector.set(cfg)
+			log.Info("payments failure mode changed", zap.Any("config", cfg))
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(cfg)
+	})
+}
+
+// injectFault applies the configured fault to the current charge and records it on the span.
+func injectFault(ctx context.Context, injector *faults) error {
+	delay, fail, cfg := injector.next()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("payments.failure_mode", cfg.Mode))
+
+	if delay > 0 {
+		span.AddEvent("payments.fault_injected", trace.WithAttributes(
+			attribute.String("fault", cfg.Mode),
+			attrs.Delay(delay),
+		))
+		if err := clock.Sleep(ctx, injector.clock, delay); err != nil {
+			return apperr.New(apperr.Timeout, "Charge cancelled", err)
+		}
+	}
+	if fail {
+		span.AddEvent("payments.fault_injected", trace.WithAttributes(attribute.String("fault", cfg.Mode)))
+		return apperr.New(apperr.Unavailable, "Payment provider unavailable", nil)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+)
+
+func TestLedgerCapture(t *testing.T) {
+	type step struct {
+		key, orderID string
+		amount       float64
+		refund       bool // refund the first charge before capturing
+		refundOrder  bool // refund and void the order before capturing
+	}
+	for _, tt := range []struct {
+		name         string
+		first, retry step
+		wantReplayed bool
+		wantConflict bool
+	}{
+		{
+			name:         "repeated key replays the charge",
+			first:        step{key: "k", orderID: "o-1", amount: 10},
+			retry:        step{key: "k", orderID: "o-1", amount: 10},
+			wantReplayed: true,
+		},
+		{
+			name:  "no key captures again",
+			first: step{orderID: "o-1", amount: 10},
+			retry: step{orderID: "o-1", amount: 10},
+		},
+		{
+			name:         "key reused for a different charge",
+			first:        step{key: "k", orderID: "o-1", amount: 10},
+			retry:        step{key: "k", orderID: "o-1", amount: 20},
+			wantConflict: true,
+		},
+		{
+			name:         "replay of a refunded charge",
+			first:        step{key: "k", orderID: "o-1", amount: 10},
+			retry:        step{key: "k", orderID: "o-1", amount: 10, refund: true},
+			wantConflict: true,
+		},
+		{
+			name:         "replay for a refunded order",
+			first:        step{key: "k", orderID: "o-1", amount: 10},
+			retry:        step{key: "k", orderID: "o-1", amount: 10, refundOrder: true},
+			wantConflict: true,
+		},
+		{
+			name:         "late charge for a refunded order",
+			first:        step{key: "k", orderID: "o-1", amount: 10},
+			retry:        step{key: "other", orderID: "o-1", amount: 10, refundOrder: true},
+			wantConflict: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLedger()
+			first, replayed, err := l.capture(tt.first.key, tt.first.orderID, tt.first.amount)
+			if err != nil || replayed {
+				t.Fatalf("first capture = %v, replayed %v", err, replayed)
+			}
+			if tt.retry.refund {
+				l.refund(first.ID)
+			}
+			if tt.retry.refundOrder {
+				l.refundOrder(first.OrderID)
+			}
+
+			got, replayed, err := l.capture(tt.retry.key, tt.retry.orderID, tt.retry.amount)
+			if tt.wantConflict {
+				if apperr.From(err).Code != apperr.Conflict {
+					t.Fatalf("capture = %v, want a conflict", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("capture: %v", err)
+			}
+			if replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if sameID := got.ID == first.ID; sameID != tt.wantReplayed {
+				t.Errorf("charge %s, first %s: same = %v, want %v", got.ID, first.ID, sameID, tt.wantReplayed)
+			}
+			if got.Status != "captured" {
+				t.Errorf("status = %q, want captured", got.Status)
+			}
+		})
+	}
+}
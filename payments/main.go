@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/daanielsharon/observability-go/payments/handler"
+	"github.com/daanielsharon/observability-go/profiles"
+	"github.com/daanielsharon/observability-go/shared/bootstrap"
+	"github.com/daanielsharon/observability-go/shared/clock"
+)
+
+func main() {
+	// Spans go to Tempo over OTLP gRPC unless the profile or environment says otherwise
+	svc := bootstrap.New(bootstrap.Config{Profiles: profiles.FS, TraceEndpoint: "tempo:4317", TraceProtocol: "grpc"})
+	svc.HTTP()
+	handler.RegisterRoutes(svc.App, svc.Admin, svc.Log, clock.Real)
+	svc.Serve()
+}
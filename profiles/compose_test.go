@@ -0,0 +1,110 @@
+package profiles_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/daanielsharon/observability-go/profiles"
+	"github.com/daanielsharon/observability-go/shared/egress"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// dials lists, per service with an egress allowlist, the variables holding the
+// addresses it connects to, and the kind of connection.
+var dials = map[string]map[string]string{
+	"consumer-1":   {"RABBITMQ_URL": egress.AMQP},
+	"consumer-2":   {"RABBITMQ_URL": egress.AMQP},
+	"notification": {"RABBITMQ_URL": egress.AMQP},
+	"order-worker": {"RABBITMQ_URL": egress.AMQP, "APP2_URL": egress.HTTP, "PAYMENTS_URL": egress.HTTP},
+}
+
+// composeEnv reads the environment of every service in docker-compose.yml.
+func composeEnv(t *testing.T) map[string]map[string]string {
+	t.Helper()
+	data, err := os.ReadFile("../docker-compose.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compose struct {
+		Services map[string]struct {
+			Environment []string `yaml:"environment"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		t.Fatal(err)
+	}
+	envs := make(map[string]map[string]string, len(compose.Services))
+	for name, svc := range compose.Services {
+		env := make(map[string]string, len(svc.Environment))
+		for _, kv := range svc.Environment {
+			k, v, _ := strings.Cut(kv, "=")
+			env[k] = v
+		}
+		envs[name] = env
+	}
+	return envs
+}
+
+// profileEnv reads the variables of the named profile.
+func profileEnv(t *testing.T, name string) map[string]string {
+	t.Helper()
+	data, err := profiles.FS.ReadFile(name + ".env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, _ := strings.Cut(line, "=")
+		env[k] = v
+	}
+	return env
+}
+
+// TestComposeEgressAllowsDialedHosts checks that each service's EGRESS_ALLOW in
+// docker-compose.yml lets it reach the hosts its profile and environment point it at.
+func TestComposeEgressAllowsDialedHosts(t *testing.T) {
+	for name, env := range composeEnv(t) {
+		allow, ok := env["EGRESS_ALLOW"]
+		if !ok {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			vars, ok := dials[name]
+			if !ok {
+				t.Fatalf("%s has an egress allowlist but no entry in dials", name)
+			}
+			resolved := profileEnv(t, env["APP_PROFILE"])
+			for k, v := range env {
+				resolved[k] = v
+			}
+
+			t.Setenv("EGRESS_ALLOW", allow)
+			t.Setenv("EGRESS_MODE", resolved["EGRESS_MODE"])
+			egress.Configure(egress.PolicyFromEnv(), zap.NewNop())
+			t.Cleanup(func() { egress.Configure(egress.Policy{}, zap.NewNop()) })
+
+			for v, kind := range vars {
+				u, err := url.Parse(resolved[v])
+				if err != nil || u.Hostname() == "" {
+					t.Errorf("%s = %q is not a URL", v, resolved[v])
+					continue
+				}
+				if err := egress.Check(context.Background(), kind, u.Hostname()); err != nil {
+					t.Errorf("%s (%s): %v", v, u.Hostname(), err)
+				}
+			}
+		})
+	}
+}
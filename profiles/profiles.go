@@ -0,0 +1,11 @@
+// Package profiles holds this deployment's settings per environment: the broker,
+// database and upstream addresses and where traces and logs go under compose, in
+// Kubernetes and from the source tree. Services pass FS to profile.Load.
+package profiles
+
+import "embed"
+
+// FS holds local.env, docker.env and k8s.env.
+//
+//go:embed *.env
+var FS embed.FS
@@ -0,0 +1,53 @@
+package profiles_test
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/daanielsharon/observability-go/profiles"
+	"github.com/daanielsharon/observability-go/shared/profile"
+)
+
+// endpoints are the settings no service guesses, so every profile must set them.
+var endpoints = []string{
+	"TRACE_EXPORTER", "LOG_DIR", "RABBITMQ_URL", "DATABASE_DSN", "REDIS_ADDR",
+	"APP_URL", "APP2_URL", "PAYMENTS_URL", "TEMPO_URL", "LOKI_URL",
+}
+
+// optional are the other settings profiles may carry.
+var optional = []string{"TRACE_ENDPOINT", "TRACE_PROTOCOL", "DEPLOYMENT_ENVIRONMENT"}
+
+func TestProfilesSetEndpoints(t *testing.T) {
+	names := profile.Names(profiles.FS)
+	if len(names) != 3 {
+		t.Errorf("profiles = %v, want docker, k8s and local", names)
+	}
+	all := slices.Concat(endpoints, optional)
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			// Start from an environment without them; Setenv restores it afterwards
+			for _, key := range all {
+				t.Setenv(key, "")
+				os.Unsetenv(key)
+			}
+			p, err := profile.Apply(profiles.FS, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(p.Overridden) != 0 {
+				t.Errorf("overridden = %v, want none", p.Overridden)
+			}
+			for _, key := range p.Applied {
+				if !slices.Contains(all, key) {
+					t.Errorf("%s.env sets %s, which this test doesn't know about", name, key)
+				}
+			}
+			for _, key := range endpoints {
+				if os.Getenv(key) == "" {
+					t.Errorf("%s.env doesn't set %s", name, key)
+				}
+			}
+		})
+	}
+}
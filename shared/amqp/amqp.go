@@ -0,0 +1,163 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/daanielsharon/observability-go/shared/egress"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+var (
+	connectionUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rabbitmq_connection_up",
+		Help: "1 while the RabbitMQ connection is open, 0 once it is closed or failed to dial.",
+	}, []string{"connection"})
+	channelsOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rabbitmq_channels_open",
+		Help: "Channels currently open on the RabbitMQ connection.",
+	}, []string{"connection"})
+	connectionBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_connection_blocked_total",
+		Help: "connection.blocked notifications from the broker, sent when it throttles publishers.",
+	}, []string{"connection"})
+	connectionUnblocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_connection_unblocked_total",
+		Help: "connection.unblocked notifications from the broker.",
+	}, []string{"connection"})
+	failuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_failures_total",
+		Help: "Connections and channels closed by the broker or the network, and consumers cancelled by the broker, by kind (connection, channel, consumer_cancel).",
+	}, []string{"connection", "kind"})
+)
+
+// Failure kinds, the kind label of rabbitmq_failures_total.
+const (
+	FailureConnection     = "connection"
+	FailureChannel        = "channel"
+	FailureConsumerCancel = "consumer_cancel"
+)
+
+// URLFromEnv reads RABBITMQ_URL, which must be set.
+func URLFromEnv() (string, error) {
+	v := os.Getenv("RABBITMQ_URL")
+	if v == "" {
+		return "", errors.New("RABBITMQ_URL is not set")
+	}
+	return v, nil
+}
+
+// Connection is an amqp091 connection whose state and channels are exported as metrics
+// labelled with its name.
+type Connection struct {
+	*amqp091.Connection
+	name string
+	log  *zap.Logger
+	lost chan error
+}
+
+// Option configures a Connection.
+type Option func(*Connection)
+
+// WithLogger logs why the connection or its channels were lost; by default nothing is logged.
+func WithLogger(log *zap.Logger) Option {
+	return func(c *Connection) { c.log = log }
+}
+
+// Dial connects to url, if the egress allowlist lets it, and watches the connection for
+// close and blocked notifications.
+func Dial(url, name string, opts ...Option) (*Connection, error) {
+	uri, err := amqp091.ParseURI(url)
+	if err == nil {
+		err = egress.Check(context.Background(), egress.AMQP, uri.Host)
+	}
+	var conn *amqp091.Connection
+	if err == nil {
+		conn, err = amqp091.Dial(url)
+	}
+	if err != nil {
+		connectionUp.WithLabelValues(name).Set(0)
+		return nil, err
+	}
+	connectionUp.WithLabelValues(name).Set(1)
+
+	c := &Connection{Connection: conn, name: name, log: zap.NewNop(), lost: make(chan error, 1)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.log = c.log.With(zap.String("connection", name))
+
+	closed := conn.NotifyClose(make(chan *amqp091.Error, 1))
+	blocked := conn.NotifyBlocked(make(chan amqp091.Blocking, 1))
+	go func() {
+		// The library closes the blocked channel when the connection shuts down
+		for b := range blocked {
+			if b.Active {
+				connectionBlocked.WithLabelValues(name).Inc()
+			} else {
+				connectionUnblocked.WithLabelValues(name).Inc()
+			}
+		}
+	}()
+	go func() {
+		// A nil error means Close was called
+		if err := <-closed; err != nil {
+			c.fail(FailureConnection, fmt.Errorf("connection closed: %w", err), zap.Int("code", err.Code), zap.Bool("server", err.Server))
+		}
+		connectionUp.WithLabelValues(name).Set(0)
+	}()
+
+	return c, nil
+}
+
+// Lost receives the first unexpected failure: the broker or the network closing the
+// connection or one of its channels, or the broker cancelling a consumer, as happens
+// when its queue is deleted. Whatever consumes from the connection has stopped getting
+// deliveries by then, so the caller should treat it as fatal and reconnect. Closes and
+// cancels the process asks for itself are not failures.
+func (c *Connection) Lost() <-chan error {
+	return c.lost
+}
+
+// fail logs and counts a failure and hands it to Lost, unless an earlier one is waiting there.
+func (c *Connection) fail(kind string, err error, fields ...zap.Field) {
+	failuresTotal.WithLabelValues(c.name, kind).Inc()
+	c.log.Error("RabbitMQ failure", append(fields, zap.String("kind", kind), zap.Error(err))...)
+	select {
+	case c.lost <- err:
+	default:
+	}
+}
+
+// Channel opens a channel and counts it in rabbitmq_channels_open until it is closed.
+// The broker closing it or cancelling one of its consumers is reported on Lost.
+func (c *Connection) Channel() (*amqp091.Channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	channelsOpen.WithLabelValues(c.name).Inc()
+
+	closed := ch.NotifyClose(make(chan *amqp091.Error, 1))
+	cancelled := ch.NotifyCancel(make(chan string, 1))
+	go func() {
+		// The library closes both channels when the channel shuts down
+		for tag := range cancelled {
+			c.fail(FailureConsumerCancel, fmt.Errorf("consumer %q cancelled by the broker", tag), zap.String("consumer_tag", tag))
+		}
+	}()
+	go func() {
+		// The connection's own failure is reported once, not again for each of its channels
+		if err := <-closed; err != nil && !c.IsClosed() {
+			c.fail(FailureChannel, fmt.Errorf("channel closed: %w", err), zap.Int("code", err.Code), zap.Bool("server", err.Server))
+		}
+		channelsOpen.WithLabelValues(c.name).Dec()
+	}()
+	return ch, nil
+}
@@ -0,0 +1,109 @@
+package amqp
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	desiredWorkers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscale_desired_workers",
+		Help: "Consumers the queue needs to keep up with arrivals and drain its backlog within the target time. Meant for KEDA or an HPA external metric.",
+	}, []string{"queue"})
+	processingRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscale_processing_rate",
+		Help: "Messages per second one consumer handled over the last sample interval.",
+	}, []string{"queue"})
+	arrivalRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscale_arrival_rate",
+		Help: "Estimated messages per second published to the queue over the last sample interval.",
+	}, []string{"queue"})
+)
+
+// AutoscaleConfig bounds the worker count DesiredWorkers recommends.
+type AutoscaleConfig struct {
+	// TargetDrain is how soon the current backlog should be worked off.
+	TargetDrain time.Duration `json:"target_drain"`
+	MinWorkers  int           `json:"min_workers"`
+	MaxWorkers  int           `json:"max_workers"`
+}
+
+// AutoscaleConfigFromEnv reads AUTOSCALE_TARGET_DRAIN (default 1m),
+// AUTOSCALE_MIN_WORKERS (default 1) and AUTOSCALE_MAX_WORKERS (default 10).
+func AutoscaleConfigFromEnv() AutoscaleConfig {
+	cfg := AutoscaleConfig{TargetDrain: time.Minute, MinWorkers: 1, MaxWorkers: 10}
+	if v, err := time.ParseDuration(os.Getenv("AUTOSCALE_TARGET_DRAIN")); err == nil && v > 0 {
+		cfg.TargetDrain = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("AUTOSCALE_MIN_WORKERS")); err == nil && v >= 0 {
+		cfg.MinWorkers = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("AUTOSCALE_MAX_WORKERS")); err == nil && v > 0 {
+		cfg.MaxWorkers = v
+	}
+	return cfg
+}
+
+// DesiredWorkers is how many consumers, each handling perWorker messages a second,
+// keep up with arrival messages a second and also clear depth waiting messages within
+// cfg.TargetDrain, clamped to [MinWorkers, MaxWorkers]. An idle queue needs MinWorkers;
+// otherwise, without a processing rate to go on, it keeps current.
+func DesiredWorkers(depth int, arrival, perWorker float64, current int, cfg AutoscaleConfig) int {
+	n := current
+	switch {
+	case depth == 0 && arrival == 0:
+		n = cfg.MinWorkers
+	case perWorker > 0:
+		need := arrival + float64(depth)/cfg.TargetDrain.Seconds()
+		n = int(math.Ceil(need / perWorker))
+	}
+	return max(cfg.MinWorkers, min(n, cfg.MaxWorkers))
+}
+
+// Autoscaler turns periodic samples of a queue into autoscale_desired_workers.
+type Autoscaler struct {
+	queue string
+	cfg   AutoscaleConfig
+
+	last     time.Time
+	depth    int
+	handled  uint64
+	previous bool
+}
+
+func NewAutoscaler(queue string, cfg AutoscaleConfig) *Autoscaler {
+	return &Autoscaler{queue: queue, cfg: cfg}
+}
+
+// Observe takes one sample: the queue's depth and consumer count as the broker reports
+// them, and how many messages this process has handled in total. Rates come from the
+// change since the previous sample; each replica runs its own consumer, so the rate
+// seen here stands for every consumer's. Observe returns the desired worker count and
+// is not safe for concurrent use.
+func (a *Autoscaler) Observe(depth, consumers int, handled uint64, now time.Time) int {
+	defer func() {
+		a.last, a.depth, a.handled, a.previous = now, depth, handled, true
+	}()
+	current := max(consumers, 1)
+	if !a.previous {
+		desired := DesiredWorkers(depth, 0, 0, current, a.cfg)
+		desiredWorkers.WithLabelValues(a.queue).Set(float64(desired))
+		return desired
+	}
+
+	elapsed := now.Sub(a.last).Seconds()
+	perWorker := float64(handled-a.handled) / elapsed
+	// What was published is what all consumers took plus what the backlog grew by
+	arrival := max(perWorker*float64(current)+float64(depth-a.depth)/elapsed, 0)
+
+	desired := DesiredWorkers(depth, arrival, perWorker, current, a.cfg)
+	processingRate.WithLabelValues(a.queue).Set(perWorker)
+	arrivalRate.WithLabelValues(a.queue).Set(arrival)
+	desiredWorkers.WithLabelValues(a.queue).Set(float64(desired))
+	return desired
+}
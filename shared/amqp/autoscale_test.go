@@ -0,0 +1,65 @@
+package amqp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDesiredWorkers(t *testing.T) {
+	cfg := AutoscaleConfig{TargetDrain: time.Minute, MinWorkers: 1, MaxWorkers: 10}
+	for _, tt := range []struct {
+		name      string
+		depth     int
+		arrival   float64
+		perWorker float64
+		current   int
+		cfg       AutoscaleConfig
+		want      int
+	}{
+		{name: "idle queue needs the minimum", current: 5, cfg: cfg, want: 1},
+		{name: "idle queue may scale to zero", current: 5, cfg: AutoscaleConfig{TargetDrain: time.Minute, MaxWorkers: 10}, want: 0},
+		{name: "no processing rate keeps current", depth: 100, current: 3, cfg: cfg, want: 3},
+		{name: "keeps up with arrivals", arrival: 10, perWorker: 5, current: 1, cfg: cfg, want: 2},
+		{name: "rounds up", arrival: 11, perWorker: 5, current: 1, cfg: cfg, want: 3},
+		{name: "drains the backlog in time", depth: 600, perWorker: 5, current: 1, cfg: cfg, want: 2},
+		{name: "arrivals and backlog", depth: 600, arrival: 10, perWorker: 5, current: 1, cfg: cfg, want: 4},
+		{name: "clamped to the maximum", depth: 6000, perWorker: 1, current: 1, cfg: cfg, want: 10},
+		{name: "clamped to the minimum", arrival: 0.1, perWorker: 5, current: 4, cfg: AutoscaleConfig{TargetDrain: time.Minute, MinWorkers: 2, MaxWorkers: 10}, want: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DesiredWorkers(tt.depth, tt.arrival, tt.perWorker, tt.current, tt.cfg); got != tt.want {
+				t.Errorf("DesiredWorkers(%d, %v, %v, %d) = %d, want %d", tt.depth, tt.arrival, tt.perWorker, tt.current, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoscalerObserve(t *testing.T) {
+	a := NewAutoscaler("task_queue", AutoscaleConfig{TargetDrain: time.Minute, MinWorkers: 1, MaxWorkers: 10})
+	start := time.Unix(0, 0)
+
+	// The first sample has no rates to go on and keeps the current consumers
+	if got := a.Observe(120, 2, 1000, start); got != 2 {
+		t.Errorf("first sample = %d, want 2", got)
+	}
+	// 100 handled in 10s is 10/s per consumer; two consumers took 200 while the
+	// backlog grew by 480, so 68/s arrived. Keeping up and draining 600 in a minute
+	// needs 78/s, 8 consumers.
+	if got := a.Observe(600, 2, 1100, start.Add(10*time.Second)); got != 8 {
+		t.Errorf("growing backlog = %d, want 8", got)
+	}
+	// Drained and nothing arriving
+	if got := a.Observe(0, 8, 1100, start.Add(20*time.Second)); got != 1 {
+		t.Errorf("idle = %d, want 1", got)
+	}
+}
+
+func TestAutoscaleConfigFromEnv(t *testing.T) {
+	t.Setenv("AUTOSCALE_TARGET_DRAIN", "30s")
+	t.Setenv("AUTOSCALE_MIN_WORKERS", "0")
+	t.Setenv("AUTOSCALE_MAX_WORKERS", "-1")
+	want := AutoscaleConfig{TargetDrain: 30 * time.Second, MinWorkers: 0, MaxWorkers: 10}
+	if got := AutoscaleConfigFromEnv(); got != want {
+		t.Errorf("AutoscaleConfigFromEnv() = %+v, want %+v", got, want)
+	}
+}
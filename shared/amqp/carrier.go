@@ -0,0 +1,25 @@
+package amqp
+
+import "github.com/rabbitmq/amqp091-go"
+
+// HeaderCarrier adapts message headers to a propagation.TextMapCarrier.
+type HeaderCarrier amqp091.Table
+
+func (c HeaderCarrier) Get(key string) string {
+	if v, ok := c[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (c HeaderCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
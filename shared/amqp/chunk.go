@@ -0,0 +1,298 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/clock"
+	"github.com/daanielsharon/observability-go/shared/depmap"
+	"github.com/daanielsharon/observability-go/shared/id"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ChunkIDHeader    = "x-chunk-id"
+	ChunkIndexHeader = "x-chunk-index"
+	ChunkTotalHeader = "x-chunk-total"
+
+	// DefaultChunkSize is the largest body published as a single message.
+	DefaultChunkSize = 64 << 10
+)
+
+var chunkedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rabbitmq_chunked_messages_total",
+	Help: "Messages split into chunks, by outcome (published, reassembled, dead_lettered, expired).",
+}, []string{"outcome"})
+
+// PublishChunked publishes msg with the trace context of ctx. A body larger than size is
+// split into chunks carrying the chunk ID, index and total; each chunk is published under
+// its own span, all children of one span covering the whole message. size <= 0 disables chunking.
+func PublishChunked(ctx context.Context, ch *amqp091.Channel, exchange, key string, msg amqp091.Publishing, size int) error {
+	if size <= 0 || len(msg.Body) <= size {
+		return Publish(ctx, ch, exchange, key, msg)
+	}
+
+	tracer := otel.Tracer("amqp")
+	total := (len(msg.Body) + size - 1) / size
+	digest := Digest(msg.Body)
+	ctx, span := tracer.Start(ctx, "Publish Chunked Message",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(telemetry.MessagingAttributes(telemetry.MessagingSend, key, "", len(msg.Body))...),
+		trace.WithAttributes(attribute.Int("messaging.chunk.total", total), PayloadDigest.String(digest)))
+	defer span.End()
+
+	// Every chunk carries the whole body's digest, checked once it is reassembled
+	headers := make(amqp091.Table, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[PayloadDigestHeader] = digest
+	msg.Headers = headers
+
+	chunkID := id.New()
+	for i := 0; i < total; i++ {
+		end := min((i+1)*size, len(msg.Body))
+		if err := publishChunk(ctx, ch, exchange, key, msg, chunkID, i, total, msg.Body[i*size:end]); err != nil {
+			span.RecordError(err)
+			err = fmt.Errorf("publish chunk %d/%d: %w", i+1, total, err)
+			depmap.Record(depmap.Publish, target(exchange, key), err)
+			return err
+		}
+	}
+	chunkedMessages.WithLabelValues("published").Inc()
+	depmap.Record(depmap.Publish, target(exchange, key), nil)
+	return nil
+}
+
+func publishChunk(ctx context.Context, ch *amqp091.Channel, exchange, key string, msg amqp091.Publishing, id string, index, total int, body []byte) error {
+	ctx, span := otel.Tracer("amqp").Start(ctx, "Publish Chunk",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.Int("messaging.chunk.index", index)))
+	defer span.End()
+
+	headers := getTable()
+	defer putTable(headers)
+	headers[ChunkIDHeader] = id
+	headers[ChunkIndexHeader] = int32(index)
+	headers[ChunkTotalHeader] = int32(total)
+	msg.Body = body
+	return publishWith(ctx, ch, exchange, key, msg, headers)
+}
+
+// IsChunk reports whether d is one chunk of a larger message.
+func IsChunk(d amqp091.Delivery) bool {
+	_, ok := d.Headers[ChunkIDHeader].(string)
+	return ok
+}
+
+// ChunkedMessage is a message put back together from its chunks.
+type ChunkedMessage struct {
+	ID   string
+	Body []byte
+	// Links point at the producer span of every chunk.
+	Links []trace.Link
+}
+
+type partialMessage struct {
+	chunks [][]byte
+	links  []trace.Link
+	// held are the unsettled deliveries of the chunks buffered so far, by index
+	held     []amqp091.Delivery
+	received int
+	started  time.Time
+}
+
+// Reassembler collects chunks until their message is complete. The chunks stay unacked
+// while they are buffered, so a restart loses nothing: the broker redelivers them.
+// Messages that don't complete within ttl are dead-lettered and counted as expired, by
+// the next Add or by the sweep Start runs, whichever comes first.
+//
+// All the chunks of a message must reach the same Reassembler: run a single consumer on
+// the queue, and a prefetch (CONSUMER_PREFETCH) of 0 or larger than the chunks of the
+// biggest message, or the consumer stalls holding a partial message.
+type Reassembler struct {
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu      sync.Mutex
+	pending map[string]*partialMessage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewReassembler(ttl time.Duration) *Reassembler {
+	return &Reassembler{ttl: ttl, clock: clock.Real, pending: make(map[string]*partialMessage)}
+}
+
+// WithClock makes r time its window on c instead of real time, for tests.
+func (r *Reassembler) WithClock(c clock.Clock) *Reassembler {
+	r.clock = c
+	return r
+}
+
+// Start sweeps out expired messages every half ttl until Stop, so the held chunks of a
+// message whose other chunks never arrive don't pin the prefetch window while no new
+// chunk comes in.
+func (r *Reassembler) Start() error {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	ticker := r.clock.NewTicker(max(r.ttl/2, time.Second))
+
+	go func() {
+		defer close(r.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C():
+				r.mu.Lock()
+				r.expire()
+				r.mu.Unlock()
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Reassembler) Stop(ctx context.Context) error {
+	if r.stop == nil {
+		return nil
+	}
+	close(r.stop)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Add stores the chunk in d and returns the whole message once all its chunks are in,
+// or nil while some are missing. A chunk that doesn't complete the message is held: its
+// delivery is settled by Done, DeadLetter or expiry, never by the caller. The chunk that
+// completes it is the caller's to settle. The message stays buffered until Done, so a
+// final chunk that is requeued after a failure completes it again.
+func (r *Reassembler) Add(ctx context.Context, d amqp091.Delivery) (*ChunkedMessage, error) {
+	id, _ := d.Headers[ChunkIDHeader].(string)
+	index, ok1 := headerInt(d.Headers[ChunkIndexHeader])
+	total, ok2 := headerInt(d.Headers[ChunkTotalHeader])
+	if id == "" || !ok1 || !ok2 || total < 1 || index < 0 || index >= total {
+		return nil, fmt.Errorf("invalid chunk headers: id=%q index=%v total=%v", id, d.Headers[ChunkIndexHeader], d.Headers[ChunkTotalHeader])
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+
+	p, ok := r.pending[id]
+	if !ok {
+		p = &partialMessage{
+			chunks:  make([][]byte, total),
+			links:   make([]trace.Link, total),
+			held:    make([]amqp091.Delivery, total),
+			started: r.clock.Now(),
+		}
+		r.pending[id] = p
+	}
+	if len(p.chunks) != total {
+		return nil, fmt.Errorf("chunk %s: total changed from %d to %d", id, len(p.chunks), total)
+	}
+	if p.chunks[index] == nil {
+		p.received++
+	}
+	// A duplicate replaces the copy held before it, which is no longer needed
+	if held := p.held[index]; held.Acknowledger != nil {
+		_ = held.Ack(false)
+		p.held[index] = amqp091.Delivery{}
+	}
+	p.chunks[index] = d.Body
+	p.links[index] = trace.Link{SpanContext: trace.SpanContextFromContext(ctx)}
+	if p.received < total {
+		p.held[index] = d
+		return nil, nil
+	}
+
+	size := 0
+	for _, c := range p.chunks {
+		size += len(c)
+	}
+	body := make([]byte, 0, size)
+	for _, c := range p.chunks {
+		body = append(body, c...)
+	}
+	return &ChunkedMessage{ID: id, Body: body, Links: p.links}, nil
+}
+
+// Done acks the held chunks of a reassembled message once it has been handled, and
+// forgets it.
+func (r *Reassembler) Done(id string) {
+	r.settle(id, "reassembled", func(d amqp091.Delivery) error { return d.Ack(false) })
+}
+
+// DeadLetter dead-letters the held chunks of a message that can't be handled, and
+// forgets it.
+func (r *Reassembler) DeadLetter(id string) {
+	r.settle(id, "dead_lettered", func(d amqp091.Delivery) error { return d.Nack(false, false) })
+}
+
+func (r *Reassembler) settle(id, outcome string, settle func(amqp091.Delivery) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pending[id]
+	if !ok {
+		return
+	}
+	delete(r.pending, id)
+	p.settle(settle)
+	chunkedMessages.WithLabelValues(outcome).Inc()
+}
+
+// expire dead-letters messages older than the ttl; r.mu must be held.
+func (r *Reassembler) expire() {
+	for id, p := range r.pending {
+		if r.clock.Since(p.started) > r.ttl {
+			delete(r.pending, id)
+			p.settle(func(d amqp091.Delivery) error { return d.Nack(false, false) })
+			chunkedMessages.WithLabelValues("expired").Inc()
+		}
+	}
+}
+
+// settle settles every held chunk of p. Errors are ignored: a delivery from a closed
+// channel is redelivered by the broker anyway.
+func (p *partialMessage) settle(settle func(amqp091.Delivery) error) {
+	for i, d := range p.held {
+		if d.Acknowledger != nil {
+			_ = settle(d)
+			p.held[i] = amqp091.Delivery{}
+		}
+	}
+}
+
+// headerInt reads an integer header, whichever integer type the broker decoded it as.
+func headerInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int8:
+		return int(n), true
+	case int16:
+		return int(n), true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,156 @@
+package amqp
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/clock"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// acks records how each delivery tag was settled.
+type acks struct {
+	mu      sync.Mutex
+	settled map[uint64]string
+}
+
+func (a *acks) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.settled[tag] = "ack"
+	return nil
+}
+
+func (a *acks) Nack(tag uint64, multiple, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if requeue {
+		a.settled[tag] = "requeue"
+	} else {
+		a.settled[tag] = "dead-letter"
+	}
+	return nil
+}
+
+func (a *acks) get(tag uint64) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.settled[tag]
+}
+
+func (a *acks) Reject(tag uint64, requeue bool) error { return a.Nack(tag, false, requeue) }
+
+func chunk(a *acks, tag uint64, id string, index, total int, body string) amqp091.Delivery {
+	return amqp091.Delivery{
+		Acknowledger: a,
+		DeliveryTag:  tag,
+		Headers:      amqp091.Table{ChunkIDHeader: id, ChunkIndexHeader: int32(index), ChunkTotalHeader: int32(total)},
+		Body:         []byte(body),
+	}
+}
+
+func TestReassemblerHoldsChunks(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name   string
+		settle func(r *Reassembler, id string)
+		want   string
+	}{
+		{name: "done acks", settle: (*Reassembler).Done, want: "ack"},
+		{name: "dead letter", settle: (*Reassembler).DeadLetter, want: "dead-letter"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &acks{settled: map[uint64]string{}}
+			r := NewReassembler(time.Minute)
+
+			for i, part := range []string{"he", "ll"} {
+				msg, err := r.Add(ctx, chunk(a, uint64(i+1), "m", i, 3, part))
+				if msg != nil || err != nil {
+					t.Fatalf("chunk %d: got %v, %v; want it held", i, msg, err)
+				}
+			}
+			if len(a.settled) != 0 {
+				t.Fatalf("held chunks were settled early: %v", a.settled)
+			}
+
+			msg, err := r.Add(ctx, chunk(a, 3, "m", 2, 3, "o"))
+			if err != nil || msg == nil || string(msg.Body) != "hello" {
+				t.Fatalf("final chunk: got %v, %v; want hello", msg, err)
+			}
+			tt.settle(r, msg.ID)
+			// The final chunk is the caller's to settle
+			want := map[uint64]string{1: tt.want, 2: tt.want}
+			if !maps.Equal(a.settled, want) {
+				t.Errorf("settled = %v, want %v", a.settled, want)
+			}
+		})
+	}
+}
+
+func TestReassemblerDuplicateChunk(t *testing.T) {
+	ctx := context.Background()
+	a := &acks{settled: map[uint64]string{}}
+	r := NewReassembler(time.Minute)
+
+	_, _ = r.Add(ctx, chunk(a, 1, "m", 0, 2, "a"))
+	_, _ = r.Add(ctx, chunk(a, 2, "m", 0, 2, "a"))
+	if a.settled[1] != "ack" || len(a.settled) != 1 {
+		t.Errorf("settled = %v, want the replaced copy acked", a.settled)
+	}
+	msg, _ := r.Add(ctx, chunk(a, 3, "m", 1, 2, "b"))
+	r.Done(msg.ID)
+	if a.settled[2] != "ack" {
+		t.Errorf("held duplicate not acked on Done: %v", a.settled)
+	}
+}
+
+func TestReassemblerExpiry(t *testing.T) {
+	ctx := context.Background()
+	a := &acks{settled: map[uint64]string{}}
+	c := clock.NewFake(time.Unix(0, 0))
+	r := NewReassembler(time.Minute).WithClock(c)
+
+	_, _ = r.Add(ctx, chunk(a, 1, "old", 0, 2, "a"))
+	c.Advance(2 * time.Minute)
+	// Any later chunk sweeps the expired message
+	_, _ = r.Add(ctx, chunk(a, 2, "new", 0, 2, "a"))
+
+	want := map[uint64]string{1: "dead-letter"}
+	if !maps.Equal(a.settled, want) {
+		t.Errorf("settled = %v, want %v", a.settled, want)
+	}
+	if msg, _ := r.Add(ctx, chunk(a, 3, "old", 1, 2, "b")); msg != nil {
+		t.Errorf("expired message completed: %q", msg.Body)
+	}
+}
+
+func TestReassemblerSweep(t *testing.T) {
+	ctx := context.Background()
+	a := &acks{settled: map[uint64]string{}}
+	c := clock.NewFake(time.Unix(0, 0))
+	r := NewReassembler(time.Minute).WithClock(c)
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop(ctx)
+
+	_, _ = r.Add(ctx, chunk(a, 1, "stuck", 0, 2, "a"))
+	// No other chunk arrives; the sweep alone dead-letters the held one
+	c.Advance(30 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if got := a.get(1); got != "" {
+		t.Fatalf("chunk settled as %q before the ttl", got)
+	}
+	c.Advance(31 * time.Second)
+	deadline := time.Now().Add(time.Second)
+	for a.get(1) == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := a.get(1); got != "dead-letter" {
+		t.Errorf("held chunk settled as %q, want dead-letter", got)
+	}
+}
@@ -0,0 +1,29 @@
+package amqp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// PayloadDigestHeader carries the SHA-256 digest of the whole message body as
+// published, so every consumer can check it got the same bytes. Chunks carry the
+// digest of the reassembled body.
+const PayloadDigestHeader = "x-payload-digest"
+
+// PayloadDigest is the span attribute holding a body's digest.
+const PayloadDigest attribute.Key = "messaging.message.body.digest"
+
+// Digest is the digest of body as it goes in PayloadDigestHeader: "sha256:" and hex.
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// PublishedDigest returns the digest d was published with, if any.
+func PublishedDigest(d amqp091.Delivery) (string, bool) {
+	v, ok := d.Headers[PayloadDigestHeader].(string)
+	return v, ok && v != ""
+}
@@ -0,0 +1,66 @@
+package amqp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestDigest(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		want string
+	}{
+		{body: "", want: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{body: "hello", want: "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	} {
+		if got := Digest([]byte(tt.body)); got != tt.want {
+			t.Errorf("Digest(%q) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestPublishedDigest(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		headers amqp091.Table
+		want    string
+		wantOK  bool
+	}{
+		{name: "none", headers: nil},
+		{name: "empty", headers: amqp091.Table{PayloadDigestHeader: ""}},
+		{name: "not a string", headers: amqp091.Table{PayloadDigestHeader: int32(1)}},
+		{name: "set", headers: amqp091.Table{PayloadDigestHeader: "sha256:ab"}, want: "sha256:ab", wantOK: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := PublishedDigest(amqp091.Delivery{Headers: tt.headers})
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("PublishedDigest = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestWithHeadersDigest(t *testing.T) {
+	body := []byte("hello")
+
+	t.Run("added from the body", func(t *testing.T) {
+		msg := amqp091.Publishing{Headers: amqp091.Table{"x-tenant": "a"}, Body: body}
+		got := withHeaders(context.Background(), msg, amqp091.Table{})
+		if got.Headers[PayloadDigestHeader] != Digest(body) {
+			t.Errorf("digest header = %v, want %s", got.Headers[PayloadDigestHeader], Digest(body))
+		}
+		if _, ok := msg.Headers[PayloadDigestHeader]; ok {
+			t.Error("msg.Headers was modified")
+		}
+	})
+
+	t.Run("a chunk keeps the whole message's", func(t *testing.T) {
+		msg := amqp091.Publishing{Headers: amqp091.Table{PayloadDigestHeader: Digest([]byte("hello world"))}, Body: body}
+		got := withHeaders(context.Background(), msg, amqp091.Table{})
+		if got.Headers[PayloadDigestHeader] != Digest([]byte("hello world")) {
+			t.Errorf("digest header = %v, want the whole message's", got.Headers[PayloadDigestHeader])
+		}
+	})
+}
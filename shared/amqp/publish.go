@@ -0,0 +1,75 @@
+package amqp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/daanielsharon/observability-go/shared/depmap"
+	"github.com/daanielsharon/observability-go/shared/id"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tables holds header tables between publishes; the client encodes the headers into the
+// frame before Publish returns, so a table can be reused as soon as the call is done.
+var tables = sync.Pool{
+	New: func() any { return make(amqp091.Table, 8) },
+}
+
+func getTable() amqp091.Table {
+	return tables.Get().(amqp091.Table)
+}
+
+func putTable(t amqp091.Table) {
+	clear(t)
+	tables.Put(t)
+}
+
+// Publish publishes msg with the trace context of ctx in its headers. The headers are
+// built in a pooled table, so msg.Headers is copied rather than modified. A message
+// without an ID gets a random one, which consumer.Dedup keys on, and every message
+// carries the digest of its body in PayloadDigestHeader.
+func Publish(ctx context.Context, ch *amqp091.Channel, exchange, key string, msg amqp091.Publishing) error {
+	headers := getTable()
+	defer putTable(headers)
+	err := publishWith(ctx, ch, exchange, key, msg, headers)
+	depmap.Record(depmap.Publish, target(exchange, key), err)
+	return err
+}
+
+// target names where a message goes for the dependency map: the queue for the default
+// exchange, exchange/key otherwise.
+func target(exchange, key string) string {
+	if exchange == "" {
+		return key
+	}
+	return exchange + "/" + key
+}
+
+// publishWith adds msg.Headers and the trace context of ctx to headers and publishes msg
+// with them.
+func publishWith(ctx context.Context, ch *amqp091.Channel, exchange, key string, msg amqp091.Publishing, headers amqp091.Table) error {
+	return ch.PublishWithContext(ctx, exchange, key, false, false, withHeaders(ctx, msg, headers))
+}
+
+// withHeaders fills headers with msg.Headers and the trace context of ctx and returns msg
+// carrying them and an ID. Unless the headers already carry a digest, the body's is
+// added and put on the span in ctx.
+func withHeaders(ctx context.Context, msg amqp091.Publishing, headers amqp091.Table) amqp091.Publishing {
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	if _, ok := headers[PayloadDigestHeader]; !ok {
+		digest := Digest(msg.Body)
+		headers[PayloadDigestHeader] = digest
+		trace.SpanFromContext(ctx).SetAttributes(PayloadDigest.String(digest))
+	}
+	otel.GetTextMapPropagator().Inject(ctx, HeaderCarrier(headers))
+	msg.Headers = headers
+	if msg.MessageId == "" {
+		msg.MessageId = id.New()
+	}
+	return msg
+}
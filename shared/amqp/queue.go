@@ -0,0 +1,90 @@
+package amqp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var queueInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "rabbitmq_queue_info",
+	Help: "1 for every queue this process declared, by queue and type (classic, quorum, lazy); join on queue to split other metrics by type.",
+}, []string{"queue", "type"})
+
+// QueueType is how the broker stores a queue's messages.
+type QueueType string
+
+const (
+	// QueueClassic keeps messages in memory where it can, on a single node.
+	QueueClassic QueueType = "classic"
+	// QueueQuorum replicates messages across nodes with Raft; it survives a node
+	// failure at the cost of latency and throughput.
+	QueueQuorum QueueType = "quorum"
+	// QueueLazy is a classic queue that moves messages to disk as early as possible.
+	// RabbitMQ 3.12 and later ignore the mode, since classic queues behave this way anyway.
+	QueueLazy QueueType = "lazy"
+)
+
+// QueueTypeAttribute is the span attribute carrying the QueueType of the queue a
+// message was consumed from.
+const QueueTypeAttribute attribute.Key = "messaging.rabbitmq.queue.type"
+
+// ParseQueueType reads "classic", "quorum" or "lazy"; "" is classic.
+func ParseQueueType(s string) (QueueType, error) {
+	switch t := QueueType(strings.ToLower(strings.TrimSpace(s))); t {
+	case "":
+		return QueueClassic, nil
+	case QueueClassic, QueueQuorum, QueueLazy:
+		return t, nil
+	}
+	return "", fmt.Errorf("invalid queue type %q, want classic, quorum or lazy", s)
+}
+
+// QueueTypeFromEnv reads QUEUE_TYPE, classic (the default), quorum or lazy; anything
+// else is an error. Every service must run with the same value, and the broker refuses
+// to redeclare an existing queue with another type: delete the queues (docker compose
+// down -v) when switching.
+func QueueTypeFromEnv() (QueueType, error) {
+	t, err := ParseQueueType(os.Getenv("QUEUE_TYPE"))
+	if err != nil {
+		return "", fmt.Errorf("QUEUE_TYPE: %w", err)
+	}
+	return t, nil
+}
+
+// arguments are the x-arguments that make a queue of type t. Classic is the broker's
+// default and gets none, so queues declared before types existed still match.
+func (t QueueType) arguments() amqp091.Table {
+	switch t {
+	case QueueQuorum:
+		return amqp091.Table{"x-queue-type": "quorum"}
+	case QueueLazy:
+		return amqp091.Table{"x-queue-mode": "lazy"}
+	}
+	return amqp091.Table{}
+}
+
+// declaredTypes maps the queues this process declared to their type.
+var declaredTypes sync.Map
+
+// recordQueueType remembers that queue was declared as t, for QueueTypeOf and
+// rabbitmq_queue_info.
+func recordQueueType(queue string, t QueueType) {
+	declaredTypes.Store(queue, t)
+	queueInfo.WithLabelValues(queue, string(t)).Set(1)
+}
+
+// QueueTypeOf is the type queue was declared with by this process, if it was.
+func QueueTypeOf(queue string) (QueueType, bool) {
+	t, ok := declaredTypes.Load(queue)
+	if !ok {
+		return "", false
+	}
+	return t.(QueueType), true
+}
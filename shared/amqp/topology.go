@@ -0,0 +1,164 @@
+package amqp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+var topologyDrift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "rabbitmq_topology_drift",
+	Help: "1 while an exchange or queue on the broker differs from the service's declared topology, by kind (exchange, queue) and name.",
+}, []string{"kind", "name"})
+
+// Exchange is a durable exchange to declare.
+type Exchange struct {
+	Name string `json:"name"`
+	// Kind is direct, fanout, topic or headers; empty is direct.
+	Kind string `json:"kind,omitempty"`
+}
+
+// Queue is a durable queue to declare.
+type Queue struct {
+	Name string    `json:"name"`
+	Type QueueType `json:"type,omitempty"`
+	// DeadLetter is the routing key rejected and expired messages are republished with
+	// to DeadLetterExchange, or the queue they go to when that is the default exchange.
+	// Empty drops them.
+	DeadLetter         string `json:"dead_letter,omitempty"`
+	DeadLetterExchange string `json:"dead_letter_exchange,omitempty"`
+	// MessageTTL expires messages that wait longer; zero keeps them.
+	MessageTTL time.Duration `json:"message_ttl,omitempty"`
+	// MaxLength drops (or dead-letters) the oldest messages beyond it; zero is unbounded.
+	MaxLength int `json:"max_length,omitempty"`
+}
+
+// arguments are the x-arguments q is declared with.
+func (q Queue) arguments() amqp091.Table {
+	args := q.Type.arguments()
+	if q.DeadLetter != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+		args["x-dead-letter-routing-key"] = q.DeadLetter
+	}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL.Milliseconds()
+	}
+	if q.MaxLength > 0 {
+		args["x-max-length"] = int64(q.MaxLength)
+	}
+	return args
+}
+
+// Binding routes messages published to Exchange with Key to Queue.
+type Binding struct {
+	Queue    string `json:"queue"`
+	Exchange string `json:"exchange"`
+	Key      string `json:"key"`
+}
+
+// Topology is what a service needs on the broker. Apply declares it in order:
+// exchanges, then queues, then bindings, so list dead-letter queues before the queues
+// that use them.
+type Topology struct {
+	Exchanges []Exchange `json:"exchanges,omitempty"`
+	Queues    []Queue    `json:"queues,omitempty"`
+	Bindings  []Binding  `json:"bindings,omitempty"`
+}
+
+// Apply declares t on conn. Declaring is idempotent, so every replica applies it at
+// startup. An exchange or queue that already exists with other settings is drift: the
+// broker refuses the declaration, and Apply logs its reason, sets
+// rabbitmq_topology_drift and carries on with the object as it is rather than fail.
+// Apply uses channels of its own, so a refusal is not reported on Lost.
+func (t Topology) Apply(conn *Connection) error {
+	a := &applier{conn: conn}
+	defer a.close()
+
+	for _, e := range t.Exchanges {
+		kind := e.Kind
+		if kind == "" {
+			kind = amqp091.ExchangeDirect
+		}
+		_, err := a.declare("exchange", e.Name, func(ch *amqp091.Channel) error {
+			return ch.ExchangeDeclare(e.Name, kind, true, false, false, false, nil)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, q := range t.Queues {
+		if q.Type == "" {
+			q.Type = QueueClassic
+		}
+		drifted, err := a.declare("queue", q.Name, func(ch *amqp091.Channel) error {
+			_, err := ch.QueueDeclare(q.Name, true, false, false, false, q.arguments())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !drifted {
+			recordQueueType(q.Name, q.Type)
+		}
+	}
+	for _, b := range t.Bindings {
+		ch, err := a.channel()
+		if err != nil {
+			return err
+		}
+		if err := ch.QueueBind(b.Queue, b.Key, b.Exchange, false, nil); err != nil {
+			return fmt.Errorf("bind queue %s to exchange %s with key %q: %w", b.Queue, b.Exchange, b.Key, err)
+		}
+	}
+	return nil
+}
+
+// applier holds the channel Apply declares on; the broker closes it on every refusal.
+type applier struct {
+	conn *Connection
+	ch   *amqp091.Channel
+}
+
+func (a *applier) channel() (*amqp091.Channel, error) {
+	if a.ch == nil {
+		ch, err := a.conn.Connection.Channel()
+		if err != nil {
+			return nil, fmt.Errorf("open channel for topology: %w", err)
+		}
+		a.ch = ch
+	}
+	return a.ch, nil
+}
+
+// declare runs fn and reports a PRECONDITION_FAILED refusal as drift.
+func (a *applier) declare(kind, name string, fn func(ch *amqp091.Channel) error) (drifted bool, err error) {
+	ch, err := a.channel()
+	if err != nil {
+		return false, err
+	}
+	err = fn(ch)
+	var amqpErr *amqp091.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.PreconditionFailed {
+		a.ch = nil
+		topologyDrift.WithLabelValues(kind, name).Set(1)
+		a.conn.log.Warn("RabbitMQ topology drift: declared settings differ from the broker's",
+			zap.String("kind", kind), zap.String("name", name), zap.String("reason", amqpErr.Reason))
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("declare %s %s: %w", kind, name, err)
+	}
+	topologyDrift.WithLabelValues(kind, name).Set(0)
+	return false, nil
+}
+
+func (a *applier) close() {
+	if a.ch != nil {
+		_ = a.ch.Close()
+	}
+}
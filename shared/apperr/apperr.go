@@ -0,0 +1,135 @@
+package apperr
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type Code string
+
+const (
+	Internal     Code = "internal"
+	InvalidInput Code = "invalid_input"
+	Unauthorized Code = "unauthorized"
+	NotFound     Code = "not_found"
+	NotAllowed   Code = "method_not_allowed"
+	Conflict     Code = "conflict"
+	RateLimited  Code = "rate_limited"
+	Unavailable  Code = "unavailable"
+	Timeout      Code = "timeout"
+	Upstream     Code = "upstream_failure"
+)
+
+type codeInfo struct {
+	status    int
+	retryable bool
+}
+
+var codes = map[Code]codeInfo{
+	Internal:     {http.StatusInternalServerError, false},
+	InvalidInput: {http.StatusBadRequest, false},
+	Unauthorized: {http.StatusUnauthorized, false},
+	NotFound:     {http.StatusNotFound, false},
+	NotAllowed:   {http.StatusMethodNotAllowed, false},
+	Conflict:     {http.StatusConflict, false},
+	RateLimited:  {http.StatusTooManyRequests, true},
+	Unavailable:  {http.StatusServiceUnavailable, true},
+	Timeout:      {http.StatusGatewayTimeout, true},
+	Upstream:     {http.StatusBadGateway, true},
+}
+
+var errorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "errors_total",
+	Help: "Application errors returned to clients, by error code.",
+}, []string{"code"})
+
+// Error is an application error with a stable code and a message that is safe to show to clients.
+// The underlying cause is kept for logs and traces only.
+type Error struct {
+	Code      Code
+	Message   string
+	Status    int
+	Retryable bool
+	Cause     error
+}
+
+func New(code Code, message string, cause error) *Error {
+	info, ok := codes[code]
+	if !ok {
+		info = codes[Internal]
+	}
+	return &Error{
+		Code:      code,
+		Message:   message,
+		Status:    info.status,
+		Retryable: info.retryable,
+		Cause:     cause,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// From returns err as an *Error, wrapping unknown errors as Internal with a generic message.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return New(Internal, "internal error", err)
+}
+
+// statusCodes are the codes for statuses no code is answered with, such as the 408, 413
+// and 431 a server's limits produce.
+var statusCodes = map[int]Code{
+	http.StatusForbidden:                   Unauthorized,
+	http.StatusRequestTimeout:              Timeout,
+	http.StatusGone:                        NotFound,
+	http.StatusRequestEntityTooLarge:       InvalidInput,
+	http.StatusUnsupportedMediaType:        InvalidInput,
+	http.StatusUnprocessableEntity:         InvalidInput,
+	http.StatusRequestHeaderFieldsTooLarge: InvalidInput,
+}
+
+// FromStatus builds an *Error for a bare HTTP status, e.g. the 404/405 produced by the
+// router. The status is kept; one no code matches is InvalidInput when it is a 4xx and
+// Internal otherwise.
+func FromStatus(status int, message string) *Error {
+	for code, info := range codes {
+		if info.status == status {
+			return New(code, message, nil)
+		}
+	}
+	code, ok := statusCodes[status]
+	if !ok {
+		code = Internal
+		if status >= 400 && status < 500 {
+			code = InvalidInput
+		}
+	}
+	e := New(code, message, nil)
+	e.Status = status
+	return e
+}
+
+// IsRetryable reports whether err is an *Error marked as retryable.
+func IsRetryable(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Retryable
+}
+
+// Count increments errors_total for e's code.
+func Count(e *Error) {
+	errorsTotal.WithLabelValues(string(e.Code)).Inc()
+}
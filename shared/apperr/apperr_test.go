@@ -0,0 +1,31 @@
+package apperr
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFromStatus(t *testing.T) {
+	for _, tt := range []struct {
+		status    int
+		code      Code
+		retryable bool
+	}{
+		{status: http.StatusNotFound, code: NotFound},
+		{status: http.StatusMethodNotAllowed, code: NotAllowed},
+		{status: http.StatusTooManyRequests, code: RateLimited, retryable: true},
+		{status: http.StatusServiceUnavailable, code: Unavailable, retryable: true},
+		{status: http.StatusForbidden, code: Unauthorized},
+		{status: http.StatusRequestTimeout, code: Timeout, retryable: true},
+		{status: http.StatusRequestEntityTooLarge, code: InvalidInput},
+		{status: http.StatusRequestHeaderFieldsTooLarge, code: InvalidInput},
+		{status: http.StatusTeapot, code: InvalidInput},
+		{status: http.StatusNotImplemented, code: Internal},
+	} {
+		e := FromStatus(tt.status, "message")
+		if e.Code != tt.code || e.Status != tt.status || e.Retryable != tt.retryable {
+			t.Errorf("FromStatus(%d) = %s %d retryable=%v, want %s %d retryable=%v",
+				tt.status, e.Code, e.Status, e.Retryable, tt.code, tt.status, tt.retryable)
+		}
+	}
+}
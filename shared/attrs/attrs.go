@@ -0,0 +1,82 @@
+// Package attrs names the domain span attributes shared by the services, so the same
+// thing carries the same key in every service's spans and a test can check for strays.
+package attrs
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys.
+const (
+	// MessageID is the ID of the message a span handles.
+	MessageID attribute.Key = "message_id"
+	// Queue is the queue a message is consumed from or published to.
+	Queue attribute.Key = "queue"
+	// DelayMS is a delay added on purpose, in milliseconds: simulated work or an injected fault.
+	DelayMS attribute.Key = "delay_ms"
+	// Processor is the service that processed a forwarded request.
+	Processor attribute.Key = "processor"
+	// RequestID is the X-Request-ID the request arrived with.
+	RequestID attribute.Key = "request.id"
+	// TenantID is the tenant the work is done for.
+	TenantID attribute.Key = "tenant_id"
+	// RUMEvent is the kind of browser beacon a span was built from: page_load, fetch or error.
+	RUMEvent attribute.Key = "rum.event"
+	// Page is the browser page a beacon was sent from.
+	Page attribute.Key = "rum.page"
+	// SessionID is the browser session a beacon belongs to.
+	SessionID attribute.Key = "session.id"
+	// UserID is the ID of the user record a span reads or changes.
+	UserID attribute.Key = "user.id"
+	// ClientID is the API client a request was made by, as named by its key.
+	ClientID attribute.Key = "client.id"
+	// PipelineStage is the stage of the request pipeline a service runs: ingest, process,
+	// forward or final.
+	PipelineStage attribute.Key = "pipeline.stage"
+)
+
+// Keys lists every key above.
+var Keys = []attribute.Key{MessageID, Queue, DelayMS, Processor, RequestID, TenantID, RUMEvent, Page, SessionID, UserID, ClientID, PipelineStage}
+
+// Known reports whether key is one of Keys.
+func Known(key attribute.Key) bool {
+	for _, k := range Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay is the DelayMS attribute for d.
+func Delay(d time.Duration) attribute.KeyValue {
+	return DelayMS.Int64(d.Milliseconds())
+}
+
+// Set adds the attributes to the span in ctx.
+func Set(ctx context.Context, kv ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(kv...)
+}
+
+// SetMessage records the message a span handles and its queue.
+func SetMessage(ctx context.Context, queue, messageID string) {
+	Set(ctx, Queue.String(queue), MessageID.String(messageID))
+}
+
+// SetRequestID records the request ID, if there is one.
+func SetRequestID(ctx context.Context, id string) {
+	if id != "" {
+		Set(ctx, RequestID.String(id))
+	}
+}
+
+// SetTenant records the tenant, if there is one.
+func SetTenant(ctx context.Context, tenant string) {
+	if tenant != "" {
+		Set(ctx, TenantID.String(tenant))
+	}
+}
@@ -0,0 +1,210 @@
+// Package bootstrap is the startup every service in the repository shares: the
+// profile, logger and egress policy, then a runner holding the tracer, watchdog,
+// summary and diagnostics components. HTTP services add the Fiber app with the
+// standard middleware and admin routes through HTTP and Serve; consumers add their
+// metrics server through ServeMetrics and Run.
+//
+// A main calls New, adds its own components and routes, and ends with Serve or Run.
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/daanielsharon/observability-go/shared/depmap"
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/egress"
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"github.com/daanielsharon/observability-go/shared/metrics"
+	"github.com/daanielsharon/observability-go/shared/profile"
+	"github.com/daanielsharon/observability-go/shared/runner"
+	"github.com/daanielsharon/observability-go/shared/tasks"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+	"github.com/daanielsharon/observability-go/shared/watchdog"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// Config is what New needs from the service.
+type Config struct {
+	// Profiles holds the NAME.env profiles APP_PROFILE picks from.
+	Profiles fs.FS
+	// TraceEndpoint and TraceProtocol are where spans go over OTLP, e.g. tempo:4317 and
+	// grpc; TRACE_ENDPOINT and TRACE_PROTOCOL override them.
+	TraceEndpoint string
+	TraceProtocol string
+}
+
+// Service is a service being started. Log, Runner and Watchdog are ready after New;
+// App after HTTP.
+type Service struct {
+	// Name is SERVICE_NAME.
+	Name     string
+	Log      *zap.Logger
+	Runner   *runner.Runner
+	Watchdog *watchdog.Watchdog
+	// PathFilter holds the paths kept out of traces and RED metrics (/metrics, /healthz, ...).
+	PathFilter *telemetry.PathFilter
+	// RoutePolicies are the per-route sampling, log level and metrics overrides.
+	RoutePolicies *telemetry.RoutePolicies
+	App           *fiber.App
+
+	// components Serve's listener waits for besides the service's own
+	baseDeps []string
+	// handlers added through Admin, for the ops server
+	admin map[string]http.Handler
+}
+
+// New applies the profile, builds the logger and the runner, and registers the tracer,
+// watchdog, summary and diagnostics components. Configuration errors are fatal.
+func New(cfg Config) *Service {
+	// Settings bundled per environment (APP_PROFILE); the environment overrides them
+	prof, profileErr := profile.Load(cfg.Profiles)
+	s := &Service{Name: os.Getenv("SERVICE_NAME")}
+	s.Log = logger.New(os.Getenv("LOG_FILE"), logger.WithName(s.Name))
+	if profileErr != nil {
+		s.Log.Fatal("invalid APP_PROFILE", zap.Error(profileErr))
+	}
+	diagnostics.RegisterConfig("profile", prof)
+
+	// Outbound allowlist (EGRESS_ALLOW) for the HTTP client and the RabbitMQ dialer; denials go to the audit log
+	egressPolicy := egress.PolicyFromEnv()
+	diagnostics.RegisterConfig("egress", egressPolicy)
+	egress.Configure(egressPolicy, s.Log)
+
+	if err := metrics.TrackRestarts(os.Getenv("PROCESS_STATE_FILE")); err != nil {
+		s.Log.Warn("failed to track restarts", zap.Error(err))
+	}
+	telemetry.IdentityFromEnv().PublishInfo()
+
+	s.PathFilter = telemetry.PathFilterFromEnv()
+	var err error
+	if s.RoutePolicies, err = telemetry.RoutePoliciesFromEnv(); err != nil {
+		s.Log.Fatal("failed to load route policies", zap.Error(err))
+	}
+
+	s.Runner = runner.New(s.Log)
+
+	traceCfg := telemetry.ConfigFromEnv(s.Name, cfg.TraceEndpoint, cfg.TraceProtocol)
+	traceCfg.Filter = s.PathFilter
+	traceCfg.Policies = s.RoutePolicies
+	diagnostics.RegisterConfig("telemetry", traceCfg)
+
+	// Hold startup until the trace backend accepts connections (docker-compose starts
+	// everything at once); traces are optional
+	if addr := traceCfg.Collector(); addr != "" {
+		s.Runner.WaitForOptional("tempo", runner.TCPCheck(addr))
+	}
+
+	var shutdownTracer func()
+	s.Runner.Add("tracer", runner.Hook{
+		OnStart: func(ctx context.Context) (err error) {
+			shutdownTracer, err = telemetry.InitTracer(ctx, traceCfg)
+			return err
+		},
+		OnStop: func(ctx context.Context) error {
+			shutdownTracer()
+			return nil
+		},
+	})
+
+	// Watchdog for scheduler stalls and long-running handlers
+	s.Watchdog = watchdog.New(s.Log, watchdog.DefaultConfig())
+	var stopWatchdog func()
+	s.Runner.Add("watchdog", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			stopWatchdog = s.Watchdog.Start()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			stopWatchdog()
+			return nil
+		},
+	})
+
+	// One-line summary of traffic and errors every minute (SUMMARY_INTERVAL), for when Grafana is down
+	s.Runner.Add("summary", metrics.NewReporter(s.Log, metrics.DefaultSummaryInterval))
+
+	// Dump stacks, config and in-flight work on SIGQUIT (docker kill -s QUIT)
+	var stopDiagnostics func()
+	s.Runner.Add("diagnostics", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			stopDiagnostics = diagnostics.WatchSignal(s.Log)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			stopDiagnostics()
+			return nil
+		},
+	})
+
+	s.baseDeps = []string{"tracer", "watchdog"}
+	return s
+}
+
+// DebugHandlers are the debug and admin endpoints every service serves: background
+// tasks, expvar, recent errors and traces, the telemetry pipeline, dependencies, the
+// resolved config, the log level and profile snapshots.
+func (s *Service) DebugHandlers() map[string]http.Handler {
+	return map[string]http.Handler{
+		"/debug/tasks":         tasks.Handler(),
+		"/debug/vars":          diagnostics.VarsHandler(),
+		"/debug/errors":        logger.ErrorsHandler(),
+		"/debug/recent-traces": telemetry.RecentTracesHandler(),
+		"/debug/telemetry":     diagnostics.TelemetryHandler(),
+		"/debug/dependencies":  depmap.Handler(),
+		"/admin/config":        diagnostics.ConfigHandler(),
+		"/admin/log-level":     logger.LevelHandler(),
+		"/admin/snapshot":      diagnostics.SnapshotHandler(s.Log),
+	}
+}
+
+// Admin serves h on the ops server (METRICS_PORT) next to metrics, health and the
+// debug handlers, never on the public listener. pattern is an http.ServeMux pattern.
+// Call it before Serve or ServeMetrics.
+func (s *Service) Admin(pattern string, h http.Handler) {
+	if s.admin == nil {
+		s.admin = make(map[string]http.Handler)
+	}
+	s.admin[pattern] = h
+}
+
+// opsHandlers are the debug handlers and those added through Admin, plus extra.
+func (s *Service) opsHandlers(extra map[string]http.Handler) map[string]http.Handler {
+	handlers := s.DebugHandlers()
+	for pattern, h := range s.admin {
+		handlers[pattern] = h
+	}
+	for pattern, h := range extra {
+		handlers[pattern] = h
+	}
+	return handlers
+}
+
+// ServeMetrics adds the "metrics" component: /metrics, the debug handlers and those
+// added through Admin on METRICS_PORT, plus extra.
+func (s *Service) ServeMetrics(extra map[string]http.Handler) {
+	handlers := s.opsHandlers(extra)
+	var srv *http.Server
+	s.Runner.Add("metrics", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			srv = metrics.Serve(fmt.Sprintf(":%s", os.Getenv("METRICS_PORT")), s.Log, handlers)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return srv.Shutdown(ctx)
+		},
+	})
+}
+
+// Run starts the components and blocks until the service stops; a failure is fatal.
+func (s *Service) Run() {
+	defer s.Log.Sync()
+	if err := s.Runner.Run(context.Background()); err != nil {
+		s.Log.Fatal("service stopped with error", zap.Error(err))
+	}
+}
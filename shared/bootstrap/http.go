@@ -0,0 +1,222 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/errreport"
+	"github.com/daanielsharon/observability-go/shared/httpserver"
+	"github.com/daanielsharon/observability-go/shared/id"
+	"github.com/daanielsharon/observability-go/shared/metrics"
+	"github.com/daanielsharon/observability-go/shared/recovery"
+	"github.com/daanielsharon/observability-go/shared/runner"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "http_request_duration_seconds",
+	Help: "Duration of HTTP requests.",
+}, []string{"method", "path", "status"})
+
+// HTTPOption configures the Fiber app HTTP builds.
+type HTTPOption func(*httpOptions)
+
+type httpOptions struct {
+	limits     bool
+	cors       bool
+	middleware []fiber.Handler
+}
+
+// WithLimits applies the timeouts, body and header sizes and concurrency bound of
+// HTTP_* (see httpserver.LimitsFromEnv).
+func WithLimits() HTTPOption {
+	return func(o *httpOptions) { o.limits = true }
+}
+
+// WithCORS answers browsers calling in directly (see httpserver.CORSFromEnv).
+func WithCORS() HTTPOption {
+	return func(o *httpOptions) { o.cors = true }
+}
+
+// WithMiddleware runs handlers after the logging middleware and before traffic capture
+// and the RED metrics, so what they reject is logged but neither captured nor timed.
+func WithMiddleware(handlers ...fiber.Handler) HTTPOption {
+	return func(o *httpOptions) { o.middleware = append(o.middleware, handlers...) }
+}
+
+// HTTP builds s.App with the middleware every HTTP service runs, in order: request
+// IDs, tracing, compression, pprof, panic recovery, the watchdog, in-flight and route
+// policies, logging, WithMiddleware's handlers, traffic capture, then RED metrics. It also serves /healthz
+// and /metrics, and registers the "errreport" component. The debug and admin handlers
+// are served by the ops server Serve adds, not by the app.
+func (s *Service) HTTP(opts ...HTTPOption) *fiber.App {
+	var o httpOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	flushErrors := func() {}
+	s.Runner.Add("errreport", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			flush, err := errreport.Init(os.Getenv("SENTRY_DSN"), s.Name)
+			if err != nil {
+				// Error reporting is optional; keep running without it
+				s.Log.Error("failed to init error reporting", zap.Error(err))
+				return nil
+			}
+			flushErrors = flush
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			flushErrors()
+			return nil
+		},
+	})
+	s.baseDeps = append(s.baseDeps, "errreport")
+
+	fiberCfg := fiber.Config{ErrorHandler: httpserver.ErrorHandler(s.Log)}
+	var limits httpserver.Limits
+	if o.limits {
+		// Timeouts, body/header size and concurrency bounds; refusals are counted in http_requests_rejected_total
+		limits = httpserver.LimitsFromEnv()
+		diagnostics.RegisterConfig("http", limits)
+		fiberCfg = limits.Apply(fiberCfg)
+	}
+	app := fiber.New(fiberCfg)
+	s.App = app
+
+	// Time-ordered request IDs, sortable like the logs they appear in
+	app.Use(requestid.New(requestid.Config{Generator: id.New}))
+
+	// Server span continuing the caller's trace
+	app.Use(httpserver.Tracing(otel.Tracer("http")))
+
+	if o.cors {
+		// Browsers may call in directly and send their traceparent along
+		corsConfig := httpserver.CORSFromEnv()
+		diagnostics.RegisterConfig("cors", corsConfig)
+		app.Use(httpserver.CORS(corsConfig))
+	}
+
+	// brotli/gzip responses, savings counted in http_compression_*
+	app.Use(httpserver.Compression(httpserver.CompressionFromEnv()))
+
+	app.Use(pprof.New(pprof.Config{Prefix: "/debug/pprof"}))
+	app.Use(recovery.Fiber(s.Log))
+	if o.limits {
+		app.Use(limits.Concurrency())
+	}
+	app.Use(s.Watchdog.Fiber())
+
+	app.Use(metrics.InFlight())
+	app.Use(httpserver.RoutePolicies(s.RoutePolicies))
+	app.Use(httpserver.Logger(s.Log))
+	app.Use(httpserver.AccessLog(s.PathFilter))
+
+	for _, h := range o.middleware {
+		app.Use(h)
+	}
+
+	// Sampled request/response pairs for replay and offline analysis (CAPTURE_FILE, off by default)
+	capture, err := httpserver.Capture(httpserver.CaptureFromEnv(), s.PathFilter)
+	if err != nil {
+		s.Log.Fatal("failed to start traffic capture", zap.Error(err))
+	}
+	app.Use(capture)
+
+	app.Use(s.requestMetrics)
+
+	// Liveness probe
+	app.Get("/healthz", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
+	app.Get("/metrics", adaptor.HTTPHandler(metrics.Handler()))
+	return app
+}
+
+// requestMetrics feeds http_request_duration_seconds, labelled with the route pattern
+// rather than the raw path.
+func (s *Service) requestMetrics(c *fiber.Ctx) error {
+	if s.PathFilter.Match(c.Path()) || !s.RoutePolicies.MetricsEnabled(c.Path()) {
+		return c.Next()
+	}
+
+	start := time.Now()
+	err := c.Next()
+
+	path := c.Route().Path
+	if httpserver.Unmatched(c) {
+		path = httpserver.UnmatchedPath
+	}
+	requestDuration.WithLabelValues(
+		c.Method(),
+		path,
+		strconv.Itoa(httpserver.StatusCode(c, err)),
+	).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Serve adds the ops server and the listener on PORT, which starts after the base
+// components and deps, then runs the service until it stops. Routes must all be
+// registered before Serve.
+//
+// The ops server on METRICS_PORT serves metrics, health, readiness and drain, the debug
+// handlers and those added through Admin. It is meant for operators and Prometheus;
+// clients only ever reach PORT.
+//
+// Rolling-deploy drain: POST /admin/drain on METRICS_PORT turns /readyz to 503, lets
+// in-flight requests finish and stops the listener on PORT. Metrics, health and
+// readiness stay up on METRICS_PORT throughout.
+func (s *Service) Serve(deps ...string) {
+	app := s.App
+
+	// Must stay last: only requests that matched no route reach it
+	app.Use(httpserver.NotFound)
+
+	drainer := httpserver.NewDrainer(app.ShutdownWithContext, s.Log)
+	diagnostics.RegisterConfig("drain", map[string]string{"timeout": drainer.Timeout.String()})
+	handlers := s.opsHandlers(map[string]http.Handler{
+		"/healthz":     drainer.HealthHandler(),
+		"/readyz":      drainer.ReadyHandler(),
+		"/admin/drain": drainer.Handler(),
+	})
+	var opsServer *http.Server
+	s.Runner.Add("ops", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			opsServer = metrics.Serve(fmt.Sprintf(":%s", os.Getenv("METRICS_PORT")), s.Log, handlers)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return opsServer.Shutdown(ctx)
+		},
+	})
+
+	addr := fmt.Sprintf(":%s", os.Getenv("PORT"))
+	s.Runner.Add("http", runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.Log.Info("starting server on " + addr)
+			go func() {
+				if err := app.Listen(addr); err != nil {
+					s.Runner.Fail("http", err)
+				}
+			}()
+			return nil
+		},
+		OnStop: app.ShutdownWithContext,
+	}, append([]string{"ops"}, append(s.baseDeps, deps...)...)...)
+
+	s.Run()
+}
@@ -0,0 +1,99 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	inUse = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bulkhead_in_use",
+		Help: "Concurrent calls currently holding a bulkhead slot.",
+	}, []string{"dependency"})
+	capacity = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bulkhead_capacity",
+		Help: "Maximum concurrent calls allowed by the bulkhead.",
+	}, []string{"dependency"})
+	waitSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bulkhead_wait_seconds",
+		Help:    "Time spent waiting for a bulkhead slot.",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"dependency"})
+	rejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bulkhead_rejected_total",
+		Help: "Calls rejected because no bulkhead slot freed up in time.",
+	}, []string{"dependency"})
+)
+
+var ErrFull = errors.New("bulkhead full")
+
+// Bulkhead limits concurrent calls to a single downstream dependency.
+type Bulkhead struct {
+	dependency string
+	slots      chan struct{}
+	maxWait    time.Duration
+}
+
+func New(dependency string, limit int, maxWait time.Duration) *Bulkhead {
+	capacity.WithLabelValues(dependency).Set(float64(limit))
+	inUse.WithLabelValues(dependency).Set(0)
+	return &Bulkhead{
+		dependency: dependency,
+		slots:      make(chan struct{}, limit),
+		maxWait:    maxWait,
+	}
+}
+
+// Acquire takes a slot, waiting up to maxWait for one to free up.
+// Waiting and rejection are recorded as events on the span in ctx.
+// The returned release func must be called once the call is done.
+func (b *Bulkhead) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case b.slots <- struct{}{}:
+		waitSeconds.WithLabelValues(b.dependency).Observe(0)
+		return b.acquired(), nil
+	default:
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("bulkhead.wait", trace.WithAttributes(attribute.String("bulkhead.dependency", b.dependency)))
+
+	start := time.Now()
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+
+	select {
+	case b.slots <- struct{}{}:
+		waited := time.Since(start)
+		waitSeconds.WithLabelValues(b.dependency).Observe(waited.Seconds())
+		span.AddEvent("bulkhead.acquired", trace.WithAttributes(
+			attribute.String("bulkhead.dependency", b.dependency),
+			attribute.Int64("bulkhead.wait_ms", waited.Milliseconds()),
+		))
+		return b.acquired(), nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	waitSeconds.WithLabelValues(b.dependency).Observe(time.Since(start).Seconds())
+	rejectedTotal.WithLabelValues(b.dependency).Inc()
+	span.AddEvent("bulkhead.rejected", trace.WithAttributes(
+		attribute.String("bulkhead.dependency", b.dependency),
+		attribute.Int64("bulkhead.wait_ms", time.Since(start).Milliseconds()),
+	))
+	return nil, ErrFull
+}
+
+func (b *Bulkhead) acquired() func() {
+	inUse.WithLabelValues(b.dependency).Inc()
+	return func() {
+		<-b.slots
+		inUse.WithLabelValues(b.dependency).Dec()
+	}
+}
@@ -0,0 +1,217 @@
+// Package cache connects to Redis with every command traced and timed, and builds a
+// read-through cache on it that lets concurrent misses for a key share one load, so a
+// popular key expiring doesn't send a stampede to the database.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "redis_command_duration_seconds",
+		Help:    "Time spent in Redis commands, by command and outcome (ok, error).",
+		Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}, []string{"command", "outcome"})
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Read-through cache lookups, by cache and result (hit, miss, error). Errors fall back to the loader.",
+	}, []string{"cache", "result"})
+	sharedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_singleflight_shared_total",
+		Help: "Cache misses that waited for another caller's load of the same key instead of loading it themselves.",
+	}, []string{"cache"})
+	fillDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cache_fill_duration_seconds",
+		Help:    "Time to load a missed key and store it, by cache and outcome (ok, error).",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"cache", "outcome"})
+)
+
+// Config says where Redis is and how long cached values live.
+type Config struct {
+	Addr string        `json:"addr"`
+	TTL  time.Duration `json:"ttl"`
+}
+
+// ConfigFromEnv reads REDIS_ADDR, which must be set, and CACHE_TTL (default 5m).
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Addr: os.Getenv("REDIS_ADDR"), TTL: 5 * time.Minute}
+	if cfg.Addr == "" {
+		return cfg, errors.New("REDIS_ADDR is not set")
+	}
+	if v, err := time.ParseDuration(os.Getenv("CACHE_TTL")); err == nil && v > 0 {
+		cfg.TTL = v
+	}
+	return cfg, nil
+}
+
+// NewClient returns a Redis client for cfg whose commands run under client spans and
+// feed redis_command_duration_seconds. It connects lazily.
+func NewClient(cfg Config) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: cfg.Addr})
+	client.AddHook(&hook{tracer: otel.Tracer("redis"), addr: cfg.Addr})
+	return client
+}
+
+// hook is a redis.Hook that traces and times commands.
+type hook struct {
+	tracer trace.Tracer
+	addr   string
+}
+
+func (h *hook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		name := strings.ToUpper(cmd.Name())
+		ctx, span := h.tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.String("db.operation", name),
+				attribute.String("server.address", h.addr),
+			))
+		defer span.End()
+
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.finish(span, name, start, err)
+		return err
+	}
+}
+
+func (h *hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := h.tracer.Start(ctx, "PIPELINE",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.String("db.operation", "PIPELINE"),
+				attribute.String("server.address", h.addr),
+				attribute.Int("db.redis.pipeline_length", len(cmds)),
+			))
+		defer span.End()
+
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.finish(span, "PIPELINE", start, err)
+		return err
+	}
+}
+
+// finish records a command's outcome. A missing key is an answer, not a failure.
+func (h *hook) finish(span trace.Span, name string, start time.Time, err error) {
+	outcome := "ok"
+	if err != nil && !errors.Is(err, redis.Nil) {
+		outcome = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	commandDuration.WithLabelValues(name, outcome).Observe(time.Since(start).Seconds())
+}
+
+// ReadThrough caches values of type T in Redis as JSON under name:key.
+type ReadThrough[T any] struct {
+	name   string
+	client *redis.Client
+	ttl    time.Duration
+	tracer trace.Tracer
+	group  singleflight.Group
+}
+
+// NewReadThrough returns a cache called name, which prefixes its keys and labels its metrics.
+func NewReadThrough[T any](name string, client *redis.Client, ttl time.Duration) *ReadThrough[T] {
+	return &ReadThrough[T]{name: name, client: client, ttl: ttl, tracer: otel.Tracer("cache")}
+}
+
+// Get returns the cached value for key or, on a miss, loads it with load and caches it.
+// Concurrent misses for the same key share one load. Redis being down makes every
+// lookup a load rather than an error; errors from load are returned and not cached.
+func (c *ReadThrough[T]) Get(ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	ctx, span := c.tracer.Start(ctx, "cache.get "+c.name, trace.WithAttributes(
+		attribute.String("cache.name", c.name),
+		attribute.String("cache.key", key),
+	))
+	defer span.End()
+
+	var v T
+	data, err := c.client.Get(ctx, c.redisKey(key)).Bytes()
+	switch {
+	case err == nil && json.Unmarshal(data, &v) == nil:
+		requestsTotal.WithLabelValues(c.name, "hit").Inc()
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return v, nil
+	case err == nil || errors.Is(err, redis.Nil):
+		// Missing, or written in a shape this version can't read
+		requestsTotal.WithLabelValues(c.name, "miss").Inc()
+	default:
+		requestsTotal.WithLabelValues(c.name, "error").Inc()
+		span.AddEvent("cache unavailable, loading", trace.WithAttributes(attribute.String("error.message", err.Error())))
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+
+	leader := false
+	res, err, _ := c.group.Do(key, func() (any, error) {
+		leader = true
+		// The load outlives this caller if it gives up: others may be waiting on it
+		return c.fill(context.WithoutCancel(ctx), key, load)
+	})
+	if !leader {
+		sharedTotal.WithLabelValues(c.name).Inc()
+		span.SetAttributes(attribute.Bool("cache.singleflight_shared", true))
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return v, err
+	}
+	return res.(T), nil
+}
+
+// fill loads key and stores it; failing to store it only costs the next caller a load.
+func (c *ReadThrough[T]) fill(ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	ctx, span := c.tracer.Start(ctx, "cache.fill "+c.name, trace.WithAttributes(
+		attribute.String("cache.name", c.name),
+		attribute.String("cache.key", key),
+	))
+	defer span.End()
+	start := time.Now()
+
+	v, err := load(ctx)
+	if err != nil {
+		fillDuration.WithLabelValues(c.name, "error").Observe(time.Since(start).Seconds())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return v, err
+	}
+	if data, err := json.Marshal(v); err == nil {
+		if err := c.client.Set(ctx, c.redisKey(key), data, c.ttl).Err(); err != nil {
+			span.AddEvent("cache store failed", trace.WithAttributes(attribute.String("error.message", err.Error())))
+		}
+	}
+	fillDuration.WithLabelValues(c.name, "ok").Observe(time.Since(start).Seconds())
+	return v, nil
+}
+
+// Invalidate drops key, so the next Get loads it again.
+func (c *ReadThrough[T]) Invalidate(ctx context.Context, key string) error {
+	return c.client.Del(ctx, c.redisKey(key)).Err()
+}
+
+func (c *ReadThrough[T]) redisKey(key string) string {
+	return c.name + ":" + key
+}
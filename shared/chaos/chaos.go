@@ -0,0 +1,246 @@
+// Package chaos injects faults for a time window set at runtime. The controlplane sends
+// the same window to several services, so their faults start and stop together and
+// every affected span carries the window's scenario ID.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/attrs"
+	"github.com/daanielsharon/observability-go/shared/clock"
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/random"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Fault modes.
+const (
+	ModeNone = "none"
+	// ModeLatency delays each affected request or message by Latency.
+	ModeLatency = "latency"
+	// ModeError fails the Rate share of affected requests and messages with ErrInjected.
+	ModeError = "error"
+)
+
+// DefaultErrorRate is the share of work an error window fails when it sets no rate.
+const DefaultErrorRate = 0.8
+
+// ErrInjected is the failure an error window injects.
+var ErrInjected = errors.New("chaos: injected failure")
+
+// Span attributes set on every span a window affects.
+const (
+	AttrScenarioID = "chaos.scenario_id"
+	AttrMode       = "chaos.mode"
+)
+
+var faultsInjected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "chaos_faults_injected_total",
+	Help: "Faults injected by a chaos window, by mode and scenario ID.",
+}, []string{"mode", "scenario_id"})
+
+// Window is a fault active from Start for Duration.
+type Window struct {
+	ScenarioID string   `json:"scenario_id"`
+	Mode       string   `json:"mode"`
+	Latency    Duration `json:"latency,omitempty"`
+	// Rate is the share of work an error window fails, DefaultErrorRate if unset.
+	Rate float64 `json:"rate,omitempty"`
+	// Start defaults to when the window is set.
+	Start    time.Time `json:"start,omitempty"`
+	Duration Duration  `json:"duration"`
+	// Seed, if set, gives the window its own random source, so an error window fails
+	// the same share of work in the same order every time it is replayed.
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// Duration is a time.Duration written as "250ms" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (w Window) validate() error {
+	switch w.Mode {
+	case ModeNone:
+		return nil
+	case ModeLatency:
+		if w.Latency <= 0 {
+			return fmt.Errorf("latency mode needs a positive latency")
+		}
+	case ModeError:
+		if w.Rate < 0 || w.Rate > 1 {
+			return fmt.Errorf("error rate must be between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("unknown chaos mode %q", w.Mode)
+	}
+	if w.ScenarioID == "" {
+		return fmt.Errorf("scenario_id is required")
+	}
+	if w.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	return nil
+}
+
+// End is when the window closes.
+func (w Window) End() time.Time {
+	return w.Start.Add(time.Duration(w.Duration))
+}
+
+var (
+	mu      sync.RWMutex
+	current = Window{Mode: ModeNone}
+	// source decides which work an error window fails
+	source random.Source = random.Default
+	// clk opens and closes windows and times latency faults
+	clk clock.Clock = clock.Real
+)
+
+func init() {
+	diagnostics.RegisterConfig("chaos", func() any { return Current() })
+}
+
+// SetClock makes windows open, close and delay work on c instead of real time, for
+// tests; nil restores the real clock.
+func SetClock(c clock.Clock) {
+	mu.Lock()
+	clk = clock.Or(c)
+	mu.Unlock()
+}
+
+// Set replaces the window; mode none clears it.
+func Set(w Window) error {
+	if err := w.validate(); err != nil {
+		return err
+	}
+	if w.Mode == ModeError && w.Rate == 0 {
+		w.Rate = DefaultErrorRate
+	}
+	mu.Lock()
+	if w.Mode == ModeNone {
+		w = Window{Mode: ModeNone}
+	} else if w.Start.IsZero() {
+		w.Start = clk.Now()
+	}
+	current = w
+	source = random.Default
+	if w.Seed != 0 {
+		source = random.New(w.Seed)
+	}
+	mu.Unlock()
+	return nil
+}
+
+// Current returns the window as last set, open or not.
+func Current() Window {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Active returns the window if it is open now, and tags the span in ctx with its
+// scenario ID and mode.
+func Active(ctx context.Context) (Window, bool) {
+	mu.RLock()
+	w, c := current, clk
+	mu.RUnlock()
+	if w.Mode == ModeNone {
+		return Window{}, false
+	}
+	if now := c.Now(); now.Before(w.Start) || !now.Before(w.End()) {
+		return Window{}, false
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String(AttrScenarioID, w.ScenarioID),
+		attribute.String(AttrMode, w.Mode),
+	)
+	return w, true
+}
+
+// Inject applies the open window's fault to the work in ctx, recording it on the span.
+// It returns ErrInjected when it fails the work, or ctx's error if ctx ends while it waits.
+func Inject(ctx context.Context) error {
+	w, ok := Active(ctx)
+	if !ok {
+		return nil
+	}
+	span := trace.SpanFromContext(ctx)
+
+	switch w.Mode {
+	case ModeError:
+		mu.RLock()
+		src := source
+		mu.RUnlock()
+		if src.Float64() >= w.Rate {
+			return nil
+		}
+		faultsInjected.WithLabelValues(w.Mode, w.ScenarioID).Inc()
+		span.AddEvent("chaos.fault_injected", trace.WithAttributes(attribute.String(AttrMode, w.Mode)))
+		return ErrInjected
+	case ModeLatency:
+		faultsInjected.WithLabelValues(w.Mode, w.ScenarioID).Inc()
+		span.AddEvent("chaos.fault_injected", trace.WithAttributes(
+			attribute.String(AttrMode, w.Mode),
+			attrs.Delay(time.Duration(w.Latency)),
+		))
+		mu.RLock()
+		c := clk
+		mu.RUnlock()
+		return clock.Sleep(ctx, c, time.Duration(w.Latency))
+	}
+	return nil
+}
+
+// Handler serves the window as JSON on GET and sets it from a JSON body on PUT.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+			if err == nil {
+				var win Window
+				if err = json.Unmarshal(b, &win); err == nil {
+					err = Set(win)
+				}
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Current())
+	})
+}
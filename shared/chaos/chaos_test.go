@@ -0,0 +1,105 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/clock"
+)
+
+// fakeClock times the package's windows on a Fake for the test.
+func fakeClock(t *testing.T) *clock.Fake {
+	t.Helper()
+	c := clock.NewFake(time.Unix(0, 0))
+	SetClock(c)
+	t.Cleanup(func() {
+		SetClock(nil)
+		_ = Set(Window{Mode: ModeNone})
+	})
+	return c
+}
+
+func TestWindowOpensAndCloses(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name  string
+		start time.Duration // from now; zero starts when set
+		at    time.Duration
+		want  bool
+	}{
+		{name: "open when set", at: 0, want: true},
+		{name: "open until the end", at: time.Minute - time.Nanosecond, want: true},
+		{name: "closed at the end", at: time.Minute, want: false},
+		{name: "not yet open", start: 10 * time.Second, at: 5 * time.Second, want: false},
+		{name: "opens at start", start: 10 * time.Second, at: 10 * time.Second, want: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fakeClock(t)
+			w := Window{ScenarioID: "s", Mode: ModeLatency, Latency: Duration(time.Second), Duration: Duration(time.Minute)}
+			if tt.start > 0 {
+				w.Start = c.Now().Add(tt.start)
+			}
+			if err := Set(w); err != nil {
+				t.Fatal(err)
+			}
+			c.Advance(tt.at)
+			if _, got := Active(ctx); got != tt.want {
+				t.Errorf("Active after %v = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectLatency(t *testing.T) {
+	c := fakeClock(t)
+	if err := Set(Window{ScenarioID: "s", Mode: ModeLatency, Latency: Duration(2 * time.Second), Duration: Duration(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("waits the latency", func(t *testing.T) {
+		done := make(chan error, 1)
+		go func() { done <- Inject(context.Background()) }()
+		if err := c.BlockUntil(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second)
+		select {
+		case err := <-done:
+			t.Fatalf("Inject returned %v before the latency", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		c.Advance(time.Second)
+		if err := <-done; err != nil {
+			t.Errorf("Inject = %v, want nil", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- Inject(ctx) }()
+		if err := c.BlockUntil(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("Inject = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestInjectError(t *testing.T) {
+	c := fakeClock(t)
+	if err := Set(Window{ScenarioID: "s", Mode: ModeError, Rate: 1, Duration: Duration(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Inject(context.Background()); !errors.Is(err, ErrInjected) {
+		t.Errorf("Inject in the window = %v, want ErrInjected", err)
+	}
+	c.Advance(time.Minute)
+	if err := Inject(context.Background()); err != nil {
+		t.Errorf("Inject after the window = %v, want nil", err)
+	}
+}
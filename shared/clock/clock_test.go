@@ -0,0 +1,132 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var epoch = time.Unix(0, 0)
+
+func TestFakeAdvanceFiresInDeadlineOrder(t *testing.T) {
+	f := NewFake(epoch)
+	late := f.After(3 * time.Second)
+	early := f.After(time.Second)
+	never := f.After(time.Hour)
+
+	f.Advance(5 * time.Second)
+	// Each wait fires at its own deadline, not at the end of the advance
+	if got := <-early; !got.Equal(epoch.Add(time.Second)) {
+		t.Errorf("early fired at %v, want %v", got, epoch.Add(time.Second))
+	}
+	if got := <-late; !got.Equal(epoch.Add(3 * time.Second)) {
+		t.Errorf("late fired at %v, want %v", got, epoch.Add(3*time.Second))
+	}
+	select {
+	case got := <-never:
+		t.Errorf("wait an hour out fired at %v", got)
+	default:
+	}
+	if got := f.Now(); !got.Equal(epoch.Add(5 * time.Second)) {
+		t.Errorf("Now = %v, want %v", got, epoch.Add(5*time.Second))
+	}
+	if n := f.Waiters(); n != 1 {
+		t.Errorf("Waiters = %d, want 1", n)
+	}
+}
+
+func TestFakeAfterNonPositive(t *testing.T) {
+	f := NewFake(epoch)
+	select {
+	case <-f.After(0):
+	default:
+		t.Error("After(0) did not fire at once")
+	}
+	if n := f.Waiters(); n != 0 {
+		t.Errorf("Waiters = %d, want 0", n)
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		advance []time.Duration
+		want    []time.Time // ticks read after each advance, zero for none
+	}{
+		{
+			name:    "one tick per period",
+			advance: []time.Duration{time.Second, time.Second, 500 * time.Millisecond},
+			want:    []time.Time{epoch.Add(time.Second), epoch.Add(2 * time.Second), {}},
+		},
+		{
+			// The channel holds one tick; the ones due while it is full are dropped
+			name:    "behind drops ticks",
+			advance: []time.Duration{3 * time.Second, time.Second},
+			want:    []time.Time{epoch.Add(time.Second), epoch.Add(4 * time.Second)},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFake(epoch)
+			ticker := f.NewTicker(time.Second)
+			defer ticker.Stop()
+			for i, d := range tt.advance {
+				f.Advance(d)
+				var got time.Time
+				select {
+				case got = <-ticker.C():
+				default:
+				}
+				if !got.Equal(tt.want[i]) {
+					t.Errorf("after advance %d: tick %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFakeTickerStop(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(time.Second)
+	ticker.Stop()
+	f.Advance(2 * time.Second)
+	select {
+	case got := <-ticker.C():
+		t.Errorf("stopped ticker ticked at %v", got)
+	default:
+	}
+	if n := f.Waiters(); n != 0 {
+		t.Errorf("Waiters = %d, want 0", n)
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan error, 1)
+	go func() { done <- Sleep(context.Background(), f, time.Second) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := f.BlockUntil(ctx, 1); err != nil {
+		t.Fatalf("BlockUntil: %v", err)
+	}
+	f.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("Sleep = %v, want nil", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.BlockUntil(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("BlockUntil with nothing waiting = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestSleepCancelled(t *testing.T) {
+	f := NewFake(epoch)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Sleep(ctx, f, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("Sleep = %v, want context.Canceled", err)
+	}
+}
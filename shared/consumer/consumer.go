@@ -0,0 +1,118 @@
+// Package consumer runs RabbitMQ deliveries through a Handler wrapped in composable
+// middleware, the way HTTP handlers are, so cross-cutting behaviour lives in one place
+// instead of in every consumer's delivery loop.
+package consumer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/amqp"
+	"github.com/daanielsharon/observability-go/shared/depmap"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ackLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "consumer_ack_latency_seconds",
+		Help:    "Time from taking a delivery off the channel to settling it, by queue and outcome (acked, requeued, rejected).",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"queue", "outcome"})
+	redeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_redeliveries_total",
+		Help: "Deliveries the broker flagged as redelivered: requeued by this or another consumer, or unacked when a consumer went away.",
+	}, []string{"queue"})
+)
+
+// Handler handles one delivery. Returning nil acks it; see Dispatch for errors.
+type Handler interface {
+	Handle(ctx context.Context, d amqp091.Delivery) error
+}
+
+// HandlerFunc adapts a func to a Handler.
+type HandlerFunc func(ctx context.Context, d amqp091.Delivery) error
+
+func (f HandlerFunc) Handle(ctx context.Context, d amqp091.Delivery) error {
+	return f(ctx, d)
+}
+
+// Middleware wraps a Handler with extra behaviour.
+type Middleware func(Handler) Handler
+
+// Chain wraps h in mw, the first middleware being the outermost.
+func Chain(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+type rejectedError struct{ err error }
+
+func (e *rejectedError) Error() string { return e.err.Error() }
+func (e *rejectedError) Unwrap() error { return e.err }
+
+// Reject marks err as permanent: the delivery is dead-lettered instead of requeued.
+func Reject(err error) error {
+	return &rejectedError{err: err}
+}
+
+// IsRejected reports whether err was marked by Reject.
+func IsRejected(err error) bool {
+	var r *rejectedError
+	return errors.As(err, &r)
+}
+
+// errHeld is returned by a handler that keeps d unsettled to settle it later itself, as
+// Reassemble does with the chunks of an incomplete message.
+var errHeld = errors.New("delivery held")
+
+// Dispatch runs h for d with the trace context from d's headers and settles d: it is
+// acked when h succeeds, dead-lettered when h fails with a Reject error, and requeued
+// on any other error. A delivery held by Reassemble is left alone. The time until d is settled goes to consumer_ack_latency_seconds,
+// and redeliveries are counted.
+func Dispatch(h Handler, d amqp091.Delivery) {
+	start := time.Now()
+	if d.Redelivered {
+		redeliveriesTotal.WithLabelValues(d.RoutingKey).Inc()
+	}
+
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), amqp.HeaderCarrier(d.Headers))
+	var outcome string
+	err := h.Handle(ctx, d)
+	switch {
+	case errors.Is(err, errHeld):
+		depmap.Record(depmap.Consume, d.RoutingKey, nil)
+		return
+	case err == nil:
+		outcome = "acked"
+		d.Ack(false)
+	case IsRejected(err):
+		outcome = "rejected"
+		d.Nack(false, false)
+	default:
+		outcome = "requeued"
+		d.Nack(false, true)
+	}
+	ackLatency.WithLabelValues(d.RoutingKey, outcome).Observe(time.Since(start).Seconds())
+	depmap.Record(depmap.Consume, d.RoutingKey, err)
+}
+
+type linksKey struct{}
+
+// WithLinks adds span links for the span Tracing starts, e.g. to the producers of
+// the chunks a message was reassembled from.
+func WithLinks(ctx context.Context, links ...trace.Link) context.Context {
+	return context.WithValue(ctx, linksKey{}, append(linksFromContext(ctx), links...))
+}
+
+func linksFromContext(ctx context.Context) []trace.Link {
+	links, _ := ctx.Value(linksKey{}).([]trace.Link)
+	return links
+}
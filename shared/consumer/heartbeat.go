@@ -0,0 +1,183 @@
+package consumer
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/amqp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+var (
+	heartbeatTime = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_heartbeat_timestamp_seconds",
+		Help: "Unix time of the consumer's last heartbeat; it stops moving when the process or its heartbeat loop is stuck.",
+	}, []string{"queue"})
+	lastAttemptTime = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_last_attempt_timestamp_seconds",
+		Help: "Unix time the consumer last started handling a delivery.",
+	}, []string{"queue"})
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_queue_depth",
+		Help: "Messages ready in the queue as of the last heartbeat.",
+	}, []string{"queue"})
+	stalled = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_stalled",
+		Help: "1 while the queue has messages ready but the consumer hasn't attempted one for longer than the stall threshold.",
+	}, []string{"queue"})
+	stallsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_stalls_total",
+		Help: "Times the consumer was found stalled: messages waiting and none attempted for longer than the stall threshold.",
+	}, []string{"queue"})
+)
+
+// HeartbeatConfig sets how often a Heartbeat checks in and when it calls a consumer stalled.
+type HeartbeatConfig struct {
+	// Interval is how often the heartbeat fires and the queue depth is read.
+	Interval time.Duration `json:"interval"`
+	// StallAfter is how long the consumer may go without attempting a delivery while
+	// messages are waiting before it is reported as stalled.
+	StallAfter time.Duration `json:"stall_after"`
+	// Autoscale bounds autoscale_desired_workers, worked out from each heartbeat's sample.
+	Autoscale amqp.AutoscaleConfig `json:"autoscale"`
+}
+
+// HeartbeatConfigFromEnv reads CONSUMER_HEARTBEAT_INTERVAL (default 30s),
+// CONSUMER_STALL_AFTER (default 5m) and the AUTOSCALE_* settings.
+func HeartbeatConfigFromEnv() HeartbeatConfig {
+	cfg := HeartbeatConfig{Interval: 30 * time.Second, StallAfter: 5 * time.Minute, Autoscale: amqp.AutoscaleConfigFromEnv()}
+	if v, err := time.ParseDuration(os.Getenv("CONSUMER_HEARTBEAT_INTERVAL")); err == nil && v > 0 {
+		cfg.Interval = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("CONSUMER_STALL_AFTER")); err == nil && v > 0 {
+		cfg.StallAfter = v
+	}
+	return cfg
+}
+
+// Heartbeat catches the silent dead consumer: a process that is up and connected but
+// no longer takes deliveries off its queue. Its middleware notes every delivery the
+// consumer starts on; on each heartbeat it reads the queue depth and reports a stall,
+// with an error log and consumer_stalled, when messages are waiting and none has been
+// attempted for StallAfter. The same sample feeds the autoscaling signal.
+type Heartbeat struct {
+	queue      string
+	log        *zap.Logger
+	cfg        HeartbeatConfig
+	autoscaler *amqp.Autoscaler
+
+	ch          atomic.Pointer[amqp091.Channel]
+	lastAttempt atomic.Int64
+	handled     atomic.Uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewHeartbeat(queue string, log *zap.Logger, cfg HeartbeatConfig) *Heartbeat {
+	return &Heartbeat{
+		queue:      queue,
+		log:        log.With(zap.String("queue", queue)),
+		cfg:        cfg,
+		autoscaler: amqp.NewAutoscaler(queue, cfg.Autoscale),
+	}
+}
+
+// Middleware records that a delivery was attempted and, once it returns, handled. Put it
+// first in the chain so every delivery counts, including ones that are skipped or fail.
+func (h *Heartbeat) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			now := time.Now()
+			h.lastAttempt.Store(now.UnixNano())
+			lastAttemptTime.WithLabelValues(h.queue).Set(float64(now.Unix()))
+			defer h.handled.Add(1)
+			return next.Handle(ctx, d)
+		})
+	}
+}
+
+// Start runs the heartbeat until Stop, reading the queue depth through ch. The stall
+// clock starts now, so a consumer that never gets a delivery is caught too.
+func (h *Heartbeat) Start(ch *amqp091.Channel) error {
+	h.ch.Store(ch)
+	h.lastAttempt.CompareAndSwap(0, time.Now().UnixNano())
+	stalled.WithLabelValues(h.queue).Set(0)
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+
+	go func() {
+		defer close(h.done)
+		ticker := time.NewTicker(h.cfg.Interval)
+		defer ticker.Stop()
+
+		var isStalled bool
+		for {
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+				isStalled = h.beat(h.ch.Load(), isStalled)
+			}
+		}
+	}()
+	return nil
+}
+
+// beat emits one heartbeat and reports whether the consumer is stalled now, logging
+// when that changes from wasStalled.
+func (h *Heartbeat) beat(ch *amqp091.Channel, wasStalled bool) bool {
+	now := time.Now()
+	heartbeatTime.WithLabelValues(h.queue).Set(float64(now.Unix()))
+	idle := now.Sub(time.Unix(0, h.lastAttempt.Load()))
+
+	q, err := ch.QueueDeclarePassive(h.queue, false, false, false, false, nil)
+	if err != nil {
+		// Without the depth there is nothing to compare against; keep the last verdict
+		h.log.Warn("consumer heartbeat: failed to read queue depth", zap.Error(err))
+		return wasStalled
+	}
+	queueDepth.WithLabelValues(h.queue).Set(float64(q.Messages))
+	desired := h.autoscaler.Observe(q.Messages, q.Consumers, h.handled.Load(), now)
+	h.log.Debug("consumer heartbeat", zap.Int("depth", q.Messages), zap.Duration("idle", idle),
+		zap.Int("consumers", q.Consumers), zap.Int("desired_workers", desired))
+
+	// A consumer paused through the admin API is idle on purpose
+	isStalled := q.Messages > 0 && idle > h.cfg.StallAfter && !isPaused(h.queue)
+	switch {
+	case isStalled && !wasStalled:
+		stalled.WithLabelValues(h.queue).Set(1)
+		stallsTotal.WithLabelValues(h.queue).Inc()
+		h.log.Error("consumer stalled: messages are waiting but none has been attempted",
+			zap.Int("depth", q.Messages), zap.Duration("idle", idle), zap.Duration("stall_after", h.cfg.StallAfter))
+	case !isStalled && wasStalled:
+		stalled.WithLabelValues(h.queue).Set(0)
+		h.log.Info("consumer recovered from stall", zap.Int("depth", q.Messages), zap.Duration("idle", idle))
+	}
+	return isStalled
+}
+
+// SetChannel reads the queue depth through ch from the next heartbeat on, after a
+// reconnect.
+func (h *Heartbeat) SetChannel(ch *amqp091.Channel) {
+	h.ch.Store(ch)
+}
+
+func (h *Heartbeat) Stop(ctx context.Context) error {
+	if h.stop == nil {
+		return nil
+	}
+	close(h.stop)
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/daanielsharon/observability-go/shared/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	pausedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_paused",
+		Help: "1 while consumption from the queue is paused through the admin API.",
+	}, []string{"queue"})
+	prefetchGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_prefetch",
+		Help: "Unacknowledged deliveries the broker may send the consumer at once; 0 is unlimited.",
+	}, []string{"queue"})
+)
+
+// pausedQueues holds the queues whose Loop is paused, so a Heartbeat doesn't report
+// a deliberately paused consumer as stalled.
+var pausedQueues sync.Map
+
+func isPaused(queue string) bool {
+	_, ok := pausedQueues.Load(queue)
+	return ok
+}
+
+// LoopConfig is how a Loop starts; both can be changed at runtime through its Handler.
+type LoopConfig struct {
+	// Prefetch is the consumer's QoS prefetch count; 0 leaves it unlimited.
+	Prefetch int `json:"prefetch"`
+	// Workers is how many deliveries are handled at once.
+	Workers int `json:"workers"`
+}
+
+// LoopConfigFromEnv reads CONSUMER_PREFETCH (default 0, unlimited) and
+// CONSUMER_WORKERS (default 1).
+func LoopConfigFromEnv() LoopConfig {
+	cfg := LoopConfig{Workers: 1}
+	if v, err := strconv.Atoi(os.Getenv("CONSUMER_PREFETCH")); err == nil && v >= 0 {
+		cfg.Prefetch = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CONSUMER_WORKERS")); err == nil && v > 0 {
+		cfg.Workers = v
+	}
+	return cfg
+}
+
+// LoopState is what a Loop is doing, as served by its Handler.
+type LoopState struct {
+	Queue    string `json:"queue"`
+	Running  bool   `json:"running"`
+	Paused   bool   `json:"paused"`
+	Prefetch int    `json:"prefetch"`
+	Workers  int    `json:"workers"`
+}
+
+// Loop consumes a queue and Dispatches its deliveries to a pool of workers. It can be
+// paused, resumed and resized while running. Losing the channel or the consumer is
+// reported on the Connection's Lost, not by the Loop; after reconnecting, SetChannel
+// resumes it on the new channel.
+type Loop struct {
+	ch      *amqp091.Channel
+	queue   string
+	tag     string
+	handler Handler
+	log     *zap.Logger
+
+	mu       sync.Mutex
+	running  bool
+	paused   bool
+	prefetch int
+	quit     []chan struct{}
+
+	work    chan amqp091.Delivery
+	pumps   sync.WaitGroup
+	workers sync.WaitGroup
+}
+
+// NewLoop returns a Loop that will consume queue as tag. Its Handler can be served
+// before Start, answering updates with an error until then.
+func NewLoop(queue, tag string, log *zap.Logger) *Loop {
+	return &Loop{
+		queue: queue,
+		tag:   tag,
+		log:   log.With(zap.String("queue", queue), zap.String("consumer_tag", tag)),
+		work:  make(chan amqp091.Delivery),
+	}
+}
+
+// Start sets the prefetch on ch, starts the workers and registers the consumer, whose
+// deliveries go to h.
+func (l *Loop) Start(ch *amqp091.Channel, h Handler, cfg LoopConfig) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ch, l.handler = ch, h
+	if err := l.setPrefetch(cfg.Prefetch); err != nil {
+		return err
+	}
+	l.setWorkers(max(cfg.Workers, 1))
+	pausedGauge.WithLabelValues(l.queue).Set(0)
+	if err := l.consume(); err != nil {
+		return err
+	}
+	l.running = true
+	return nil
+}
+
+// consume registers the consumer and feeds its deliveries to the workers until the
+// broker or Cancel ends them; l.mu must be held.
+func (l *Loop) consume() error {
+	msgs, err := l.ch.Consume(l.queue, l.tag, false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %w", err)
+	}
+	l.pumps.Add(1)
+	go func() {
+		defer l.pumps.Done()
+		for d := range msgs {
+			l.work <- d
+		}
+	}()
+	return nil
+}
+
+// cancel stops deliveries; ones the broker already sent are still handled. l.mu must be held.
+func (l *Loop) cancel() error {
+	if err := l.ch.Cancel(l.tag, false); err != nil {
+		return fmt.Errorf("failed to cancel the consumer: %w", err)
+	}
+	return nil
+}
+
+// Pause stops taking deliveries off the queue until Resume.
+func (l *Loop) Pause() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.running || l.paused {
+		return nil
+	}
+	if err := l.cancel(); err != nil {
+		return err
+	}
+	l.paused = true
+	pausedQueues.Store(l.queue, struct{}{})
+	pausedGauge.WithLabelValues(l.queue).Set(1)
+	return nil
+}
+
+// Resume takes deliveries again after Pause.
+func (l *Loop) Resume() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.running || !l.paused {
+		return nil
+	}
+	if err := l.consume(); err != nil {
+		return err
+	}
+	l.paused = false
+	pausedQueues.Delete(l.queue)
+	pausedGauge.WithLabelValues(l.queue).Set(0)
+	return nil
+}
+
+// SetPrefetch changes the prefetch count. The broker applies it to consumers registered
+// afterwards, so a running consumer is re-registered.
+func (l *Loop) SetPrefetch(n int) error {
+	if n < 0 {
+		return fmt.Errorf("prefetch must be >= 0, got %d", n)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.setPrefetch(n); err != nil {
+		return err
+	}
+	if !l.running || l.paused {
+		return nil
+	}
+	if err := l.cancel(); err != nil {
+		return err
+	}
+	return l.consume()
+}
+
+func (l *Loop) setPrefetch(n int) error {
+	if err := l.ch.Qos(n, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch: %w", err)
+	}
+	l.prefetch = n
+	prefetchGauge.WithLabelValues(l.queue).Set(float64(n))
+	return nil
+}
+
+// SetWorkers changes how many deliveries are handled at once. Workers let go finish the
+// delivery in hand first.
+func (l *Loop) SetWorkers(n int) error {
+	if n < 1 {
+		return fmt.Errorf("workers must be >= 1, got %d", n)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.setWorkers(n)
+	return nil
+}
+
+func (l *Loop) setWorkers(n int) {
+	for len(l.quit) < n {
+		quit := make(chan struct{})
+		l.quit = append(l.quit, quit)
+		l.workers.Add(1)
+		go l.worker(quit)
+	}
+	for len(l.quit) > n {
+		close(l.quit[len(l.quit)-1])
+		l.quit = l.quit[:len(l.quit)-1]
+	}
+	metrics.SetWorkers(l.queue, n)
+}
+
+func (l *Loop) worker(quit <-chan struct{}) {
+	defer l.workers.Done()
+	for {
+		select {
+		case <-quit:
+			return
+		case d, ok := <-l.work:
+			if !ok {
+				return
+			}
+			Dispatch(l.handler, d)
+		}
+	}
+}
+
+// SetChannel moves the Loop to ch, typically after the old one was lost: a running,
+// unpaused Loop registers its consumer there with the same prefetch. The workers keep
+// going; deliveries they hold from the old channel can no longer be settled, and the
+// broker redelivers them.
+func (l *Loop) SetChannel(ch *amqp091.Channel) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ch = ch
+	if !l.running {
+		return nil
+	}
+	if err := l.setPrefetch(l.prefetch); err != nil {
+		return err
+	}
+	if l.paused {
+		return nil
+	}
+	return l.consume()
+}
+
+// State reports what the Loop is doing.
+func (l *Loop) State() LoopState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LoopState{Queue: l.queue, Running: l.running, Paused: l.paused, Prefetch: l.prefetch, Workers: len(l.quit)}
+}
+
+// Stop cancels the consumer and waits, until ctx is done, for the deliveries in hand.
+func (l *Loop) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	var err error
+	if l.running && !l.paused {
+		err = l.cancel()
+	}
+	l.running = false
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.pumps.Wait()
+		close(l.work)
+		l.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LoopUpdate is a change to a Loop; fields left out stay as they are.
+type LoopUpdate struct {
+	Paused   *bool `json:"paused,omitempty"`
+	Prefetch *int  `json:"prefetch,omitempty"`
+	Workers  *int  `json:"workers,omitempty"`
+}
+
+var (
+	// errInvalidUpdate marks a LoopUpdate that asks for something impossible.
+	errInvalidUpdate = errors.New("invalid consumer update")
+	errNotRunning    = errors.New("consumer is not running")
+)
+
+// Update applies u under an admin span in ctx, logging every change. Nothing is applied
+// if any field is out of range.
+func (l *Loop) Update(ctx context.Context, u LoopUpdate) (err error) {
+	_, span := otel.Tracer("consumer").Start(ctx, "Consumer Admin", trace.WithAttributes(
+		attribute.String("messaging.destination.name", l.queue),
+		attribute.String("messaging.consumer.tag", l.tag),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	log := l.log.With(zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	before := l.State()
+	if !before.Running {
+		return errNotRunning
+	}
+	if u.Workers != nil && *u.Workers < 1 {
+		return fmt.Errorf("%w: workers must be >= 1, got %d", errInvalidUpdate, *u.Workers)
+	}
+	if u.Prefetch != nil && *u.Prefetch < 0 {
+		return fmt.Errorf("%w: prefetch must be >= 0, got %d", errInvalidUpdate, *u.Prefetch)
+	}
+
+	if u.Workers != nil {
+		span.SetAttributes(attribute.Int("consumer.workers", *u.Workers))
+		if err := l.SetWorkers(*u.Workers); err != nil {
+			return err
+		}
+		log.Info("consumer workers changed", zap.Int("from", before.Workers), zap.Int("to", *u.Workers))
+	}
+	if u.Prefetch != nil {
+		span.SetAttributes(attribute.Int("consumer.prefetch", *u.Prefetch))
+		if err := l.SetPrefetch(*u.Prefetch); err != nil {
+			return err
+		}
+		log.Info("consumer prefetch changed", zap.Int("from", before.Prefetch), zap.Int("to", *u.Prefetch))
+	}
+	if u.Paused != nil {
+		span.SetAttributes(attribute.Bool("consumer.paused", *u.Paused))
+		if *u.Paused {
+			err = l.Pause()
+		} else {
+			err = l.Resume()
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case *u.Paused && !before.Paused:
+			log.Info("consumer paused")
+		case !*u.Paused && before.Paused:
+			log.Info("consumer resumed")
+		}
+	}
+	return nil
+}
+
+// Handler serves the Loop's state as JSON on GET and applies a LoopUpdate from a JSON
+// body on PUT, e.g. {"paused": true} or {"workers": 4, "prefetch": 8}.
+func (l *Loop) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+			var u LoopUpdate
+			if err == nil {
+				err = json.Unmarshal(b, &u)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			if err := l.Update(ctx, u); err != nil {
+				status := http.StatusInternalServerError
+				switch {
+				case errors.Is(err, errInvalidUpdate):
+					status = http.StatusBadRequest
+				case errors.Is(err, errNotRunning):
+					status = http.StatusServiceUnavailable
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(l.State())
+	})
+}
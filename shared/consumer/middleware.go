@@ -0,0 +1,336 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/amqp"
+	"github.com/daanielsharon/observability-go/shared/chaos"
+	"github.com/daanielsharon/observability-go/shared/clock"
+	"github.com/daanielsharon/observability-go/shared/flags"
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"github.com/daanielsharon/observability-go/shared/metrics"
+	"github.com/daanielsharon/observability-go/shared/random"
+	"github.com/daanielsharon/observability-go/shared/recovery"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+	"github.com/daanielsharon/observability-go/shared/watchdog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	messagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_messages_total",
+		Help: "Deliveries handled, by queue and outcome (acked, requeued, rejected, held).",
+	}, []string{"queue", "outcome"})
+	retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_message_retries_total",
+		Help: "In-process retries of failed deliveries.",
+	}, []string{"queue"})
+	duplicatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_duplicate_messages_total",
+		Help: "Deliveries skipped because their message ID was already handled.",
+	}, []string{"queue"})
+	digestMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_digest_mismatches_total",
+		Help: "Deliveries whose body doesn't match the digest it was published with, by routing key.",
+	}, []string{"queue"})
+)
+
+// Metrics tracks the delivery as in flight on queue and counts its outcome.
+func Metrics(queue string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			defer metrics.TrackMessage(queue)()
+			err := next.Handle(ctx, d)
+			outcome := "acked"
+			switch {
+			case errors.Is(err, errHeld):
+				outcome = "held"
+			case IsRejected(err):
+				outcome = "rejected"
+			case err != nil:
+				outcome = "requeued"
+			}
+			messagesTotal.WithLabelValues(queue, outcome).Inc()
+			return err
+		})
+	}
+}
+
+// Tracing handles the delivery under a consumer span, a child of the producer's trace
+// context. The span carries the body's digest, checked against the one it was published
+// with, and the type of the queue when this process declared it. The error it fails
+// with goes to shared.RecordError.
+func Tracing(tracer trace.Tracer, spanName string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			ctx, span := tracer.Start(ctx, spanName,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithLinks(linksFromContext(ctx)...),
+				trace.WithAttributes(telemetry.MessagingAttributes(telemetry.MessagingProcess, d.RoutingKey, d.MessageId, len(d.Body))...),
+			)
+			defer span.End()
+			if t, ok := amqp.QueueTypeOf(d.RoutingKey); ok {
+				span.SetAttributes(amqp.QueueTypeAttribute.String(string(t)))
+			}
+			ctx = checkDigest(ctx, d)
+
+			err := next.Handle(ctx, d)
+			shared.RecordError(ctx, err, "")
+			return err
+		})
+	}
+}
+
+// Logging stores a message-scoped logger, carrying the routing key, delivery tag and,
+// under Tracing, the payload digest, for logger.FromContext, and logs the error the
+// delivery fails with.
+func Logging(log *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			fields := []zap.Field{
+				zap.String("routing_key", d.RoutingKey),
+				zap.Uint64("delivery_tag", d.DeliveryTag),
+			}
+			if digest, ok := ctx.Value(digestKey{}).(string); ok {
+				fields = append(fields, zap.String("payload_digest", digest))
+			}
+			ctx = logger.IntoContext(ctx, log.With(fields...))
+			err := next.Handle(ctx, d)
+			if err != nil {
+				logger.WithTrace(ctx, trace.SpanFromContext(ctx).SpanContext().SpanID().String()).Error(
+					"failed to handle message", zap.Bool("requeued", !IsRejected(err)), zap.Error(err))
+			}
+			return err
+		})
+	}
+}
+
+type digestKey struct{}
+
+// checkDigest puts the digest of d's body on the span in ctx and in the returned ctx for
+// Logging. A body that differs from what was published is counted and logged; it is
+// still handled, since the handler may be the better judge of what to do with it.
+func checkDigest(ctx context.Context, d amqp091.Delivery) context.Context {
+	digest := amqp.Digest(d.Body)
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(amqp.PayloadDigest.String(digest))
+	if published, ok := amqp.PublishedDigest(d); ok && published != digest {
+		digestMismatches.WithLabelValues(d.RoutingKey).Inc()
+		span.AddEvent("message.digest_mismatch", trace.WithAttributes(
+			attribute.String("digest.published", published),
+			attribute.String("digest.received", digest),
+		))
+		logger.WithTrace(ctx, span.SpanContext().SpanID().String()).Warn("message body doesn't match its published digest",
+			zap.String("routing_key", d.RoutingKey), zap.String("message_id", d.MessageId),
+			zap.String("published_digest", published), zap.String("payload_digest", digest))
+	}
+	return context.WithValue(ctx, digestKey{}, digest)
+}
+
+// Recover turns a panic into a rejected delivery, so the message is dead-lettered
+// instead of crashing the consumer; the panic goes to recovery.Handle.
+func Recover(log *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					recovery.Handle(ctx, log, "consumer", r)
+					err = Reject(fmt.Errorf("panic: %v", r))
+				}
+			}()
+			return next.Handle(ctx, d)
+		})
+	}
+}
+
+// Watchdog reports handling that runs longer than the watchdog allows.
+func Watchdog(wd *watchdog.Watchdog, name string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			defer wd.Track(ctx, name)()
+			return next.Handle(ctx, d)
+		})
+	}
+}
+
+// Option configures the middleware that keeps time or draws random numbers.
+type Option func(*options)
+
+type options struct {
+	clock clock.Clock
+	rand  random.Source
+}
+
+// WithClock sets the clock Retry waits on and Dedup measures its window with, so tests
+// can advance time instead of sleeping.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) { o.clock = c }
+}
+
+// WithRand sets the source Chaos draws from, so tests can pick which deliveries fail.
+func WithRand(r random.Source) Option {
+	return func(o *options) { o.rand = r }
+}
+
+func newOptions(opts []Option) options {
+	o := options{clock: clock.Real, rand: random.Default}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Retry handles a failed delivery again, up to attempts times in all, waiting backoff
+// times the attempt number in between. Rejected deliveries are not retried.
+func Retry(attempts int, backoff time.Duration, opts ...Option) Middleware {
+	o := newOptions(opts)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			for attempt := 1; ; attempt++ {
+				err := next.Handle(ctx, d)
+				if err == nil || IsRejected(err) || attempt >= attempts {
+					return err
+				}
+				retriesTotal.WithLabelValues(d.RoutingKey).Inc()
+				trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+					attribute.Int("retry.attempt", attempt),
+					attribute.String("retry.error", err.Error()),
+				))
+				if clock.Sleep(ctx, o.clock, backoff*time.Duration(attempt)) != nil {
+					return err
+				}
+			}
+		})
+	}
+}
+
+// Dedup acks deliveries whose message ID was handled successfully within ttl without
+// handling them again. Deliveries without a message ID always go through.
+func Dedup(ttl time.Duration, opts ...Option) Middleware {
+	o := newOptions(opts)
+	var (
+		mu        sync.Mutex
+		seen      = make(map[string]time.Time)
+		lastSweep = o.clock.Now()
+	)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			if d.MessageId == "" {
+				return next.Handle(ctx, d)
+			}
+
+			mu.Lock()
+			now := o.clock.Now()
+			if now.Sub(lastSweep) > ttl {
+				for id, t := range seen {
+					if now.Sub(t) > ttl {
+						delete(seen, id)
+					}
+				}
+				lastSweep = now
+			}
+			t, dup := seen[d.MessageId]
+			mu.Unlock()
+			if dup && now.Sub(t) <= ttl {
+				duplicatesTotal.WithLabelValues(d.RoutingKey).Inc()
+				trace.SpanFromContext(ctx).AddEvent("duplicate message skipped")
+				return nil
+			}
+
+			err := next.Handle(ctx, d)
+			if err == nil {
+				mu.Lock()
+				seen[d.MessageId] = o.clock.Now()
+				mu.Unlock()
+			}
+			return err
+		})
+	}
+}
+
+// ErrChaos is the failure Chaos injects.
+var ErrChaos = errors.New("chaos: injected message failure")
+
+// Chaos fails the given share of deliveries with ErrChaos, so they are requeued,
+// while the chaos flag is on.
+func Chaos(rate float64, opts ...Option) Middleware {
+	o := newOptions(opts)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			if flags.Enabled(ctx, flags.Chaos) && o.rand.Float64() < rate {
+				return ErrChaos
+			}
+			return next.Handle(ctx, d)
+		})
+	}
+}
+
+// ChaosWindow applies the open chaos window, if any, to each delivery; it has to run
+// inside Tracing for the consumer span to carry the window's scenario ID. Deliveries an
+// error window fails are dead-lettered, so a storm shows up in the DLQ.
+func ChaosWindow() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			if err := chaos.Inject(ctx); err != nil {
+				if errors.Is(err, chaos.ErrInjected) {
+					return Reject(err)
+				}
+				return err
+			}
+			return next.Handle(ctx, d)
+		})
+	}
+}
+
+// Reassemble buffers chunks until their message is complete, each under a short span of
+// its own, and hands the whole message on with links to the chunks' producer spans.
+// The chunks of an incomplete message are held unacked; they are acked once the message
+// is handled, and dead-lettered with it when the handler rejects it or it expires, so
+// a restart or a failure loses nothing. Invalid chunks are rejected. See
+// amqp.Reassembler for the prefetch and the single consumer this needs.
+func Reassemble(r *amqp.Reassembler, tracer trace.Tracer) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			if !amqp.IsChunk(d) {
+				return next.Handle(ctx, d)
+			}
+
+			chunkCtx, span := tracer.Start(ctx, "Receive Chunk", trace.WithSpanKind(trace.SpanKindConsumer))
+			msg, err := r.Add(chunkCtx, d)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				logger.WithTrace(chunkCtx, span.SpanContext().SpanID().String()).Error("invalid chunk", zap.Error(err))
+			}
+			span.End()
+			if err != nil {
+				return Reject(err)
+			}
+			if msg == nil {
+				return errHeld
+			}
+
+			d.Body = msg.Body
+			if err := next.Handle(WithLinks(ctx, msg.Links...), d); err != nil {
+				if IsRejected(err) {
+					r.DeadLetter(msg.ID)
+				}
+				return err
+			}
+			r.Done(msg.ID)
+			return nil
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daanielsharon/observability-go/shared/amqp"
+
+	"github.com/rabbitmq/amqp091-go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingChecksDigest(t *testing.T) {
+	body := []byte(`{"order_id":"o-1"}`)
+	for _, tt := range []struct {
+		name         string
+		published    string
+		wantMismatch bool
+	}{
+		{name: "matches", published: amqp.Digest(body)},
+		{name: "not published", published: ""},
+		{name: "differs", published: amqp.Digest([]byte("something else")), wantMismatch: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			defer tp.Shutdown(context.Background())
+
+			var logged string
+			h := Chain(HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+				logged, _ = ctx.Value(digestKey{}).(string)
+				return nil
+			}), Tracing(tp.Tracer("test"), "process"))
+			d := amqp091.Delivery{RoutingKey: "orders", Body: body, Headers: amqp091.Table{}}
+			if tt.published != "" {
+				d.Headers[amqp.PayloadDigestHeader] = tt.published
+			}
+			if err := h.Handle(context.Background(), d); err != nil {
+				t.Fatal(err)
+			}
+
+			if logged != amqp.Digest(body) {
+				t.Errorf("digest for Logging = %q, want %q", logged, amqp.Digest(body))
+			}
+			span := exporter.GetSpans()[0]
+			var attr string
+			for _, kv := range span.Attributes {
+				if kv.Key == amqp.PayloadDigest {
+					attr = kv.Value.AsString()
+				}
+			}
+			if attr != amqp.Digest(body) {
+				t.Errorf("span digest = %q, want the received body's", attr)
+			}
+			mismatch := false
+			for _, e := range span.Events {
+				mismatch = mismatch || e.Name == "message.digest_mismatch"
+			}
+			if mismatch != tt.wantMismatch {
+				t.Errorf("digest_mismatch event = %v, want %v", mismatch, tt.wantMismatch)
+			}
+		})
+	}
+}
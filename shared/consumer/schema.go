@@ -0,0 +1,112 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+var validationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "message_validation_failures_total",
+	Help: "Deliveries dead-lettered because their body didn't match the queue's JSON Schema, by queue and schema.",
+}, []string{"queue", "schema"})
+
+var errorPrinter = message.NewPrinter(language.English)
+
+// Schema is a compiled JSON Schema that message bodies are checked against.
+type Schema struct {
+	name   string
+	schema *jsonschema.Schema
+}
+
+// CompileSchema compiles a JSON Schema document; name identifies it in metrics and spans.
+func CompileSchema(name string, src []byte) (*Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", name, err)
+	}
+	c := jsonschema.NewCompiler()
+	c.AssertFormat()
+	if err := c.AddResource(name, doc); err != nil {
+		return nil, fmt.Errorf("schema %s: %w", name, err)
+	}
+	s, err := c.Compile(name)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", name, err)
+	}
+	return &Schema{name: name, schema: s}, nil
+}
+
+// MustCompileSchema is CompileSchema for schemas embedded in the binary, panicking on error.
+func MustCompileSchema(name string, src []byte) *Schema {
+	s, err := CompileSchema(name, src)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Check reports why body is not a JSON document matching s, or nil if it is.
+func (s *Schema) Check(body []byte) error {
+	v, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("malformed JSON: %w", err)
+	}
+	if err := s.schema.Validate(v); err != nil {
+		var ve *jsonschema.ValidationError
+		if errors.As(err, &ve) {
+			return errors.New(summarize(ve))
+		}
+		return err
+	}
+	return nil
+}
+
+// summarize flattens a validation error tree into one line, one entry per failing leaf.
+func summarize(ve *jsonschema.ValidationError) string {
+	var leaves []string
+	var walk func(*jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			leaves = append(leaves, fmt.Sprintf("at /%s: %s", strings.Join(e.InstanceLocation, "/"), e.ErrorKind.LocalizedString(errorPrinter)))
+			return
+		}
+		for _, c := range e.Causes {
+			walk(c)
+		}
+	}
+	walk(ve)
+	return strings.Join(leaves, "; ")
+}
+
+// Validate checks each delivery's body against schema before the handler runs. Bodies
+// that don't match are dead-lettered without reaching it, counted, and the reason is
+// added to the span as a message.validation_failed event.
+func Validate(queue string, schema *Schema) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+			err := schema.Check(d.Body)
+			if err == nil {
+				return next.Handle(ctx, d)
+			}
+
+			validationFailures.WithLabelValues(queue, schema.name).Inc()
+			trace.SpanFromContext(ctx).AddEvent("message.validation_failed", trace.WithAttributes(
+				attribute.String("schema", schema.name),
+				attribute.String("error.message", err.Error()),
+			))
+			return Reject(fmt.Errorf("invalid message for schema %s: %w", schema.name, err))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package consumer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const orderSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "required": ["order_id", "amount"],
+  "properties": {
+    "order_id": {"type": "string", "minLength": 1},
+    "amount": {"type": "number", "exclusiveMinimum": 0},
+    "email": {"type": "string", "format": "email"}
+  }
+}`
+
+func TestSchemaCheck(t *testing.T) {
+	s := MustCompileSchema("order.schema.json", []byte(orderSchema))
+	for _, tt := range []struct {
+		name string
+		body string
+		want []string // substrings of the error, none for a valid body
+	}{
+		{name: "valid", body: `{"order_id":"o-1","amount":10}`},
+		{name: "malformed", body: `{"order_id":`, want: []string{"malformed JSON"}},
+		{name: "missing field", body: `{"order_id":"o-1"}`, want: []string{"at /:", "amount"}},
+		{name: "wrong type", body: `{"order_id":1,"amount":10}`, want: []string{"at /order_id:"}},
+		{name: "format asserted", body: `{"order_id":"o-1","amount":10,"email":"nope"}`, want: []string{"at /email:"}},
+		{
+			name: "one entry per failing leaf",
+			body: `{"order_id":"","amount":0}`,
+			want: []string{"at /order_id:", "; ", "at /amount:"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Check([]byte(tt.body))
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Check(%s) = %v, want nil", tt.body, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Check(%s) = nil, want an error", tt.body)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("Check(%s) = %q, want it to contain %q", tt.body, err, w)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileSchemaInvalid(t *testing.T) {
+	for _, src := range []string{`{`, `{"type": 5}`} {
+		if _, err := CompileSchema("bad.json", []byte(src)); err == nil || !strings.Contains(err.Error(), "bad.json") {
+			t.Errorf("CompileSchema(%s) = %v, want an error naming the schema", src, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := MustCompileSchema("order.schema.json", []byte(orderSchema))
+	for _, tt := range []struct {
+		name       string
+		body       string
+		wantCalled bool
+	}{
+		{name: "valid reaches the handler", body: `{"order_id":"o-1","amount":10}`, wantCalled: true},
+		{name: "invalid is rejected", body: `{"order_id":"o-1"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := Chain(HandlerFunc(func(ctx context.Context, d amqp091.Delivery) error {
+				called = true
+				return nil
+			}), Validate("orders", s))
+
+			err := h.Handle(context.Background(), amqp091.Delivery{Body: []byte(tt.body)})
+			if called != tt.wantCalled {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCalled)
+			}
+			if tt.wantCalled {
+				if err != nil {
+					t.Errorf("Handle = %v, want nil", err)
+				}
+				return
+			}
+			if !IsRejected(err) {
+				t.Errorf("Handle = %v, want a rejection", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Package cron runs jobs on a fixed interval. A job with a lock runs on only one replica
+// per tick: the others find the lock taken and skip it, which is counted rather than
+// logged so contention is visible without noise.
+package cron
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/lock"
+	"github.com/daanielsharon/observability-go/shared/recovery"
+	"github.com/daanielsharon/observability-go/shared/runner"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	runsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cron_runs_total",
+		Help: "Scheduled job ticks, by job and outcome (ok, error, panic, skipped). Skipped means another replica held the lock.",
+	}, []string{"job", "outcome"})
+	runDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cron_run_duration_seconds",
+		Help: "Duration of scheduled job runs that took the lock, by job.",
+	}, []string{"job"})
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cron_last_success_timestamp_seconds",
+		Help: "When the job last succeeded in this process.",
+	}, []string{"job"})
+)
+
+// Job is work run every Every.
+type Job struct {
+	Name  string
+	Every time.Duration
+	// Lock keeps the job to one replica per tick; nil runs it everywhere.
+	Lock *lock.Lock
+	// Run gets a context that is cancelled if the lock is lost or the job is stopped.
+	Run func(ctx context.Context) error
+}
+
+// Schedule returns a runner component that runs job every job.Every, starting one
+// interval after start. Stopping it waits for a run in progress.
+func Schedule(log *zap.Logger, job Job) runner.Hook {
+	var (
+		stop = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	tracer := otel.Tracer("cron")
+	return runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ticker := time.NewTicker(job.Every)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-stop:
+						return
+					case <-ticker.C:
+						tick(tracer, log, job, stop)
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+			done := make(chan struct{})
+			go func() { wg.Wait(); close(done) }()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+// tick runs job once if it can take the lock. Each tick is its own trace.
+func tick(tracer trace.Tracer, log *zap.Logger, job Job, stop <-chan struct{}) {
+	ctx, span := tracer.Start(context.Background(), "cron "+job.Name, trace.WithAttributes(
+		attribute.String("cron.job", job.Name),
+	))
+	defer span.End()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if job.Lock != nil {
+		lease, err := job.Lock.TryAcquire(ctx)
+		if err != nil {
+			// Without Redis nobody can take the lock, so no replica runs the job
+			runsTotal.WithLabelValues(job.Name, "error").Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "lock unavailable")
+			log.Warn("cron job skipped: lock unavailable", zap.String("job", job.Name), zap.Error(err))
+			return
+		}
+		if lease == nil {
+			runsTotal.WithLabelValues(job.Name, "skipped").Inc()
+			span.SetAttributes(attribute.Bool("cron.skipped", true))
+			return
+		}
+		defer func() {
+			if err := lease.Release(context.WithoutCancel(ctx)); err != nil {
+				log.Warn("failed to release cron lock", zap.String("job", job.Name), zap.Error(err))
+			}
+		}()
+		leaseCtx := lease.Context()
+		go func() {
+			select {
+			case <-leaseCtx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	start := time.Now()
+	outcome := "ok"
+	defer func() {
+		if r := recover(); r != nil {
+			outcome = "panic"
+			recovery.Handle(ctx, log, "cron", r)
+		}
+		runsTotal.WithLabelValues(job.Name, outcome).Inc()
+		runDuration.WithLabelValues(job.Name).Observe(time.Since(start).Seconds())
+		if outcome == "ok" {
+			lastSuccess.WithLabelValues(job.Name).SetToCurrentTime()
+		}
+	}()
+	if err := job.Run(ctx); err != nil {
+		outcome = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Error("cron job failed", zap.String("job", job.Name), zap.Error(err))
+	}
+}
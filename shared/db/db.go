@@ -0,0 +1,181 @@
+// Package db opens a Postgres connection pool whose every query runs under a client
+// span and feeds db_query_duration_seconds, and maps database errors to apperr codes.
+package db
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Time spent in database queries, by operation (SELECT, INSERT, ...) and outcome (ok, error).",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"operation", "outcome"})
+
+// Span attribute keys beyond the OpenTelemetry database conventions.
+const (
+	// RowCount is how many rows a query returned or changed.
+	RowCount attribute.Key = "db.row_count"
+)
+
+// Config says where the database is.
+type Config struct {
+	// DSN is a postgres:// URL or key=value connection string.
+	DSN string `json:"dsn"`
+	// MaxConns caps the pool; 0 keeps the pgx default.
+	MaxConns int32 `json:"max_conns"`
+}
+
+// ConfigFromEnv reads DATABASE_DSN, which must be set, and DATABASE_MAX_CONNS.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{DSN: os.Getenv("DATABASE_DSN")}
+	if cfg.DSN == "" {
+		return cfg, errors.New("DATABASE_DSN is not set")
+	}
+	if v, err := strconv.Atoi(os.Getenv("DATABASE_MAX_CONNS")); err == nil && v > 0 {
+		cfg.MaxConns = int32(v)
+	}
+	return cfg, nil
+}
+
+// Querier runs queries; *pgxpool.Pool is one, and tests can pass a fake.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Open returns a traced pool for cfg. It connects lazily, so it succeeds while the
+// database is still down.
+func Open(cfg Config) (*pgxpool.Pool, error) {
+	poolCfg, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	poolCfg.ConnConfig.Tracer = &tracer{
+		tracer: otel.Tracer("db"),
+		attrs: []attribute.KeyValue{
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.name", poolCfg.ConnConfig.Database),
+			attribute.String("server.address", poolCfg.ConnConfig.Host),
+			attribute.Int("server.port", int(poolCfg.ConnConfig.Port)),
+		},
+		dbName: poolCfg.ConnConfig.Database,
+	}
+	return pgxpool.NewWithConfig(context.Background(), poolCfg)
+}
+
+// Addr is the host:port pool connects to, e.g. for runner.TCPCheck.
+func Addr(pool *pgxpool.Pool) string {
+	cc := pool.Config().ConnConfig
+	return net.JoinHostPort(cc.Host, strconv.Itoa(int(cc.Port)))
+}
+
+// tracer is a pgx.QueryTracer that puts each query under a client span.
+type tracer struct {
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue
+	dbName string
+}
+
+type queryStart struct {
+	operation string
+	start     time.Time
+}
+
+type queryStartKey struct{}
+
+func (t *tracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	op := operation(data.SQL)
+	ctx, _ = t.tracer.Start(ctx, op+" "+t.dbName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.attrs...),
+		trace.WithAttributes(
+			attribute.String("db.operation", op),
+			// Arguments are sent apart from the statement and stay out of the span
+			attribute.String("db.statement", data.SQL),
+		))
+	return context.WithValue(ctx, queryStartKey{}, queryStart{operation: op, start: time.Now()})
+}
+
+func (t *tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	outcome := "ok"
+	if data.Err != nil {
+		outcome = "error"
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+		var pgErr *pgconn.PgError
+		if errors.As(data.Err, &pgErr) {
+			span.SetAttributes(attribute.String("db.response.status_code", pgErr.Code))
+		}
+	} else {
+		span.SetAttributes(RowCount.Int64(data.CommandTag.RowsAffected()))
+	}
+	if qs, ok := ctx.Value(queryStartKey{}).(queryStart); ok {
+		queryDuration.WithLabelValues(qs.operation, outcome).Observe(time.Since(qs.start).Seconds())
+	}
+}
+
+// operation is the SQL command a statement starts with, e.g. SELECT.
+func operation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// Postgres error codes mapped by Error.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// Error maps a database error to the apperr code a client should see: no rows is
+// NotFound, a unique or foreign key violation is Conflict, a timed out query is Timeout
+// and a failed connection is Unavailable. entity names what was looked up, e.g. "User".
+func Error(err error, entity string) error {
+	if err == nil {
+		return nil
+	}
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return apperr.New(apperr.NotFound, entity+" not found", err)
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		return apperr.New(apperr.Conflict, entity+" already exists", err)
+	case errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation:
+		return apperr.New(apperr.Conflict, entity+" is still referenced", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return apperr.New(apperr.Timeout, "Database query timed out", err)
+	case errors.As(err, &pgErr):
+		return apperr.New(apperr.Internal, "Database error", err)
+	default:
+		// No answer from Postgres at all: it is down or unreachable
+		return apperr.New(apperr.Unavailable, "Database unavailable", err)
+	}
+}
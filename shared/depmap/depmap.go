@@ -0,0 +1,86 @@
+// Package depmap records the downstream dependencies a process actually talks to
+// (HTTP hosts it calls, queues it publishes to and consumes from) with call counts
+// and the last error, and serves them at /debug/dependencies. It is the in-process
+// complement to Tempo's service graph: live, unsampled, and available without Tempo.
+package depmap
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dependency kinds
+const (
+	HTTP    = "http"
+	Publish = "publish"
+	Consume = "consume"
+)
+
+// Dependency is one observed downstream target.
+type Dependency struct {
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	Calls     uint64    `json:"calls"`
+	Errors    uint64    `json:"errors"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// LastError and LastErrorAt describe the most recent failed call, if any.
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type key struct{ kind, target string }
+
+var (
+	mu   sync.Mutex
+	deps = make(map[key]*Dependency)
+)
+
+// Record counts one call of the given kind to target; a non-nil err counts as a failure.
+func Record(kind, target string, err error) {
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+	d, ok := deps[key{kind, target}]
+	if !ok {
+		d = &Dependency{Kind: kind, Target: target, FirstSeen: now}
+		deps[key{kind, target}] = d
+	}
+	d.Calls++
+	d.LastSeen = now
+	if err != nil {
+		d.Errors++
+		d.LastError = err.Error()
+		d.LastErrorAt = &now
+	}
+}
+
+// Snapshot returns every dependency seen so far, sorted by kind and target.
+func Snapshot() []Dependency {
+	mu.Lock()
+	list := make([]Dependency, 0, len(deps))
+	for _, d := range deps {
+		list = append(list, *d)
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind < list[j].Kind
+		}
+		return list[i].Target < list[j].Target
+	})
+	return list
+}
+
+// Handler serves Snapshot as JSON.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Snapshot())
+	})
+}
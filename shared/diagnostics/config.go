@@ -0,0 +1,77 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+var (
+	sectionsMu sync.Mutex
+	sections   = make(map[string]any)
+)
+
+// RegisterConfig adds a named section to the resolved configuration served by ConfigHandler,
+// typically the config struct a component was built with after env and defaults were applied.
+// value may be a func() any for settings that change at runtime.
+func RegisterConfig(section string, value any) {
+	sectionsMu.Lock()
+	defer sectionsMu.Unlock()
+	sections[section] = value
+}
+
+// ResolvedConfig returns the environment and every registered section, with secrets masked.
+func ResolvedConfig() map[string]any {
+	sectionsMu.Lock()
+	defer sectionsMu.Unlock()
+
+	resolved := map[string]any{"env": Config()}
+	for name, value := range sections {
+		if f, ok := value.(func() any); ok {
+			value = f()
+		}
+		resolved[name] = maskValue(name, value)
+	}
+	return resolved
+}
+
+// ConfigHandler serves ResolvedConfig as JSON.
+func ConfigHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(ResolvedConfig())
+	})
+}
+
+// maskValue round-trips value through JSON and masks string fields whose key looks secret.
+func maskValue(key string, value any) any {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err.Error()
+	}
+	var generic any
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return err.Error()
+	}
+	return maskTree(key, generic)
+}
+
+func maskTree(key string, v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			t[k] = maskTree(k, child)
+		}
+		return t
+	case []any:
+		for i, child := range t {
+			t[i] = maskTree(key, child)
+		}
+		return t
+	case string:
+		return Mask(key, t)
+	}
+	return v
+}
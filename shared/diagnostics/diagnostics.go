@@ -0,0 +1,129 @@
+package diagnostics
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/metrics"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const maxRecentErrors = 20
+
+// ErrorRecord is an error kept for the diagnostics dump, with the trace it happened in.
+type ErrorRecord struct {
+	Time    time.Time `json:"time"`
+	TraceID string    `json:"trace_id,omitempty"`
+	SpanID  string    `json:"span_id,omitempty"`
+	Error   string    `json:"error"`
+}
+
+var (
+	mu     sync.Mutex
+	recent []ErrorRecord
+)
+
+// RecordError remembers err among the last few errors shown in the dump.
+func RecordError(ctx context.Context, err error) {
+	rec := ErrorRecord{Time: time.Now(), Error: err.Error()}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		rec.TraceID = sc.TraceID().String()
+		rec.SpanID = sc.SpanID().String()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(recent) == maxRecentErrors {
+		recent = recent[1:]
+	}
+	recent = append(recent, rec)
+}
+
+// RecentErrors returns the recorded errors, oldest first.
+func RecentErrors() []ErrorRecord {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]ErrorRecord(nil), recent...)
+}
+
+// Dump logs goroutine stacks, the service's environment (secrets masked), recent errors
+// and in-flight request/message counts as one structured entry.
+func Dump(log *zap.Logger) {
+	log.Warn("diagnostics dump",
+		zap.Int("goroutine_count", runtime.NumGoroutine()),
+		zap.Int64("in_flight_requests", metrics.InFlightRequests()),
+		zap.Int64("in_flight_messages", metrics.InFlightMessages()),
+		zap.Any("config", Config()),
+		zap.Any("recent_errors", RecentErrors()),
+		zap.String("goroutines", stacks()),
+	)
+}
+
+// WatchSignal dumps diagnostics on every SIGQUIT instead of the runtime's dump-and-exit.
+// The returned func restores the default behaviour.
+func WatchSignal(log *zap.Logger) func() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGQUIT)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sig:
+				Dump(log)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
+
+var secretMarkers = []string{"SECRET", "PASSWORD", "TOKEN", "DSN", "KEY"}
+
+// Config returns the process environment with values of secret-looking keys masked.
+func Config() map[string]string {
+	cfg := make(map[string]string)
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		cfg[k] = Mask(k, v)
+	}
+	return cfg
+}
+
+// Mask hides v when key looks like it holds a credential.
+func Mask(key, v string) string {
+	if v == "" {
+		return v
+	}
+	upper := strings.ToUpper(key)
+	for _, m := range secretMarkers {
+		if strings.Contains(upper, m) {
+			return "****"
+		}
+	}
+	return v
+}
+
+func stacks() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,57 @@
+package diagnostics
+
+import (
+	"expvar"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/daanielsharon/observability-go/shared/metrics"
+)
+
+var publishOnce sync.Once
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = bi.Main.Path
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// VarsHandler serves expvar's /debug/vars, with the masked config, queue stats,
+// in-flight counts and build info published next to the standard memstats and cmdline.
+func VarsHandler() http.Handler {
+	publishOnce.Do(func() {
+		expvar.Publish("config", expvar.Func(func() any { return Config() }))
+		expvar.Publish("queues", expvar.Func(func() any { return metrics.Queues() }))
+		expvar.Publish("in_flight", expvar.Func(func() any {
+			return map[string]int64{
+				"requests": metrics.InFlightRequests(),
+				"messages": metrics.InFlightMessages(),
+			}
+		}))
+		expvar.Publish("build", expvar.Func(func() any { return buildInfo() }))
+		expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	})
+	return expvar.Handler()
+}
@@ -0,0 +1,158 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultSnapshotDir is where snapshots are written unless SNAPSHOT_DIR says otherwise.
+	DefaultSnapshotDir = "/var/log/snapshots"
+	// MaxProfileDuration bounds the CPU profile a single request can ask for.
+	MaxProfileDuration = time.Minute
+)
+
+// SnapshotKinds are the snapshots Capture knows, "profile" being a CPU profile.
+var SnapshotKinds = []string{"heap", "goroutine", "profile"}
+
+// ErrUnknownSnapshotKind is returned for kinds not in SnapshotKinds.
+var ErrUnknownSnapshotKind = errors.New("unknown snapshot kind")
+
+// Snapshot is one profile written to disk.
+type Snapshot struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+}
+
+// Capture writes each kind of snapshot to dir as <service>-<kind>-<UTC timestamp>.pb.gz.
+// A CPU profile runs for d, or until ctx is done.
+func Capture(ctx context.Context, dir, service string, kinds []string, d time.Duration) ([]Snapshot, error) {
+	for _, kind := range kinds {
+		if !slices.Contains(SnapshotKinds, kind) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownSnapshotKind, kind)
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create snapshot dir: %w", err)
+	}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	var snapshots []Snapshot
+	for _, kind := range kinds {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s-%s.pb.gz", service, kind, stamp))
+		if err := writeSnapshot(ctx, path, kind, d); err != nil {
+			return snapshots, fmt.Errorf("%s snapshot: %w", kind, err)
+		}
+		snapshots = append(snapshots, Snapshot{Kind: kind, Path: path})
+	}
+	return snapshots, nil
+}
+
+func writeSnapshot(ctx context.Context, path, kind string, d time.Duration) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if kind == "profile" {
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+		}
+		pprof.StopCPUProfile()
+		return f.Close()
+	}
+
+	if err := pprof.Lookup(kind).WriteTo(f, 0); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// SnapshotHandler captures snapshots on POST into SNAPSHOT_DIR (default DefaultSnapshotDir)
+// and logs where they went along with the trace of the request. The kinds query parameter
+// takes a comma-separated subset of SnapshotKinds (default heap,goroutine); seconds sets the
+// CPU profile length (default 10).
+func SnapshotHandler(log *zap.Logger) http.Handler {
+	dir := os.Getenv("SNAPSHOT_DIR")
+	if dir == "" {
+		dir = DefaultSnapshotDir
+	}
+	service := os.Getenv("SERVICE_NAME")
+	if service == "" {
+		service, _ = os.Hostname()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		kinds := []string{"heap", "goroutine"}
+		if v := r.URL.Query().Get("kinds"); v != "" {
+			kinds = strings.Split(v, ",")
+		}
+		d := 10 * time.Second
+		if v := r.URL.Query().Get("seconds"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "invalid seconds", http.StatusBadRequest)
+				return
+			}
+			d = min(time.Duration(n)*time.Second, MaxProfileDuration)
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer("diagnostics").Start(ctx, "Capture Snapshot",
+			trace.WithAttributes(attribute.StringSlice("snapshot.kinds", kinds)))
+		defer span.End()
+
+		sc := span.SpanContext()
+		l := log.With(zap.String("trace_id", sc.TraceID().String()), zap.String("span_id", sc.SpanID().String()))
+
+		snapshots, err := Capture(ctx, dir, service, kinds, d)
+		for _, s := range snapshots {
+			l.Info("snapshot written", zap.String("kind", s.Kind), zap.String("path", s.Path))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			l.Error("snapshot failed", zap.Error(err))
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrUnknownSnapshotKind) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"trace_id":  sc.TraceID().String(),
+			"snapshots": snapshots,
+		})
+	})
+}
@@ -0,0 +1,68 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/logsink"
+	"github.com/daanielsharon/observability-go/shared/metrics"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+)
+
+// TelemetryState is the observability plumbing's own health: where spans, logs and
+// metrics stand on their way out of the process.
+type TelemetryState struct {
+	// Status is "ok" or "degraded"; Problems says why.
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+	// Traces is nil when no tracer provider was installed.
+	Traces *telemetry.SpanExportStats `json:"traces"`
+	// Logs are the async buffers in front of stdout and the log file promtail ships to Loki.
+	Logs    []logsink.Stats     `json:"logs"`
+	Metrics metrics.ScrapeStats `json:"metrics"`
+}
+
+// Telemetry collects the current TelemetryState.
+func Telemetry() TelemetryState {
+	st := TelemetryState{Status: "ok", Logs: logsink.All(), Metrics: metrics.Scrapes()}
+	if spans, ok := telemetry.ExportStats(); ok {
+		st.Traces = &spans
+		if failing(spans.LastErrorAt, spans.LastExport) {
+			st.Problems = append(st.Problems, "last span export failed: "+spans.LastError)
+		}
+		if spans.QueueSize >= spans.QueueCapacity*9/10 {
+			st.Problems = append(st.Problems, "span export queue nearly full")
+		}
+	}
+	for _, l := range st.Logs {
+		if failing(l.LastErrorAt, l.LastFlush) {
+			st.Problems = append(st.Problems, "last write to "+l.Sink+" log sink failed: "+l.LastError)
+		}
+		if l.Buffered >= l.Capacity*9/10 {
+			st.Problems = append(st.Problems, l.Sink+" log buffer nearly full")
+		}
+	}
+	if failing(st.Metrics.LastErrorAt, st.Metrics.LastScrape) {
+		st.Problems = append(st.Problems, "last metrics scrape had gather errors: "+st.Metrics.LastError)
+	}
+	if len(st.Problems) > 0 {
+		st.Status = "degraded"
+	}
+	return st
+}
+
+// failing reports whether the last error came after the last success.
+func failing(lastError, lastOK *time.Time) bool {
+	return lastError != nil && (lastOK == nil || lastError.After(*lastOK))
+}
+
+// TelemetryHandler serves Telemetry as JSON.
+func TelemetryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(Telemetry())
+	})
+}
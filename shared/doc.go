@@ -0,0 +1,17 @@
+// Package shared is the observability kit used by the services in this repository. It
+// is a module of its own so the services build against it the way an outside
+// application would:
+//
+//	go get github.com/daanielsharon/observability-go/shared
+//
+// It has no API stability guarantee yet; it changes together with the services.
+//
+// telemetry sets up tracing from a Config, metrics serves Prometheus and runtime
+// counters, amqp wraps RabbitMQ connections with trace propagation, logger builds the
+// zap logger with trace-aware helpers, and logsink provides non-blocking log writers.
+// Some subpackages, such as chaos, scenario and loadgen, exist to drive the demo.
+//
+// Connections are made to the addresses the caller gives: amqp.Dial takes a URL,
+// db.Open and cache.NewClient a Config. The XFromEnv helpers read those from the
+// environment and return an error when they are unset rather than guessing a host.
+package shared
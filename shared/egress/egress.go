@@ -0,0 +1,144 @@
+// Package egress is the process-wide outbound allowlist. The HTTP client and the AMQP
+// dialer check every destination against it; a destination that isn't listed is
+// blocked (or, in audit mode, only reported), written to the audit log and counted.
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Destination kinds
+const (
+	HTTP = "http"
+	AMQP = "amqp"
+)
+
+// Modes
+const (
+	// Enforce blocks destinations that aren't allowed.
+	Enforce = "enforce"
+	// Audit reports them but lets the connection through, for trying out an allowlist.
+	Audit = "audit"
+)
+
+// ErrDenied is what a blocked destination fails with.
+var ErrDenied = errors.New("egress denied")
+
+var (
+	checksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "egress_checks_total",
+		Help: "Outbound destinations checked against the egress allowlist, by kind (http, amqp) and decision (allowed, denied, audited).",
+	}, []string{"kind", "decision"})
+	deniedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "egress_denied_total",
+		Help: "Outbound destinations not on the egress allowlist, by kind and host; in audit mode they were let through.",
+	}, []string{"kind", "host"})
+)
+
+// Policy lists the hosts a process may connect to.
+type Policy struct {
+	// Allow holds host names, "*.domain" suffixes or "*". Empty allows everything.
+	Allow []string `json:"allow"`
+	Mode  string   `json:"mode"`
+}
+
+// PolicyFromEnv reads EGRESS_ALLOW (comma separated; unset allows everything) and
+// EGRESS_MODE (enforce, the default, or audit).
+func PolicyFromEnv() Policy {
+	p := Policy{Mode: Enforce}
+	for _, host := range strings.Split(os.Getenv("EGRESS_ALLOW"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			p.Allow = append(p.Allow, host)
+		}
+	}
+	if os.Getenv("EGRESS_MODE") == Audit {
+		p.Mode = Audit
+	}
+	return p
+}
+
+// allows reports whether host is on the list.
+func (p Policy) allows(host string) bool {
+	if len(p.Allow) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, a := range p.Allow {
+		switch {
+		case a == "*", a == host:
+			return true
+		case strings.HasPrefix(a, "*.") && strings.HasSuffix(host, a[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	mu     sync.RWMutex
+	policy Policy
+	audit  = zap.NewNop()
+)
+
+// Configure installs p for the process. Denials go to log with "audit" added to its
+// name, so they can be picked out of the log stream.
+func Configure(p Policy, log *zap.Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	policy = p
+	audit = log.Named("audit")
+}
+
+// Check reports whether the process may connect to host for kind. A denied host is
+// counted, added to the span in ctx as an egress.denied event and logged to the audit
+// log; in enforce mode Check then fails with ErrDenied.
+func Check(ctx context.Context, kind, host string) error {
+	mu.RLock()
+	p, log := policy, audit
+	mu.RUnlock()
+
+	if p.allows(host) {
+		checksTotal.WithLabelValues(kind, "allowed").Inc()
+		return nil
+	}
+	enforced := p.Mode != Audit
+	decision := "audited"
+	if enforced {
+		decision = "denied"
+	}
+	checksTotal.WithLabelValues(kind, decision).Inc()
+	deniedTotal.WithLabelValues(kind, host).Inc()
+
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("egress.denied", trace.WithAttributes(
+		attribute.String("egress.kind", kind),
+		attribute.String("server.address", host),
+		attribute.Bool("egress.enforced", enforced),
+	))
+	fields := []zap.Field{
+		zap.String("event", "egress_denied"),
+		zap.String("kind", kind),
+		zap.String("host", host),
+		zap.String("mode", p.Mode),
+	}
+	if sc := span.SpanContext(); sc.IsValid() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+	}
+	log.Warn("outbound destination not on the egress allowlist", fields...)
+
+	if !enforced {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s", ErrDenied, kind, host)
+}
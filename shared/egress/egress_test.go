@@ -0,0 +1,89 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		allow []string
+		host  string
+		want  bool
+	}{
+		{name: "empty list allows everything", host: "anything", want: true},
+		{name: "listed host", allow: []string{"rabbitmq", "payments"}, host: "payments", want: true},
+		{name: "unlisted host", allow: []string{"rabbitmq", "payments"}, host: "app-2", want: false},
+		{name: "case-insensitive", allow: []string{"payments"}, host: "Payments", want: true},
+		{name: "wildcard", allow: []string{"*"}, host: "anything", want: true},
+		{name: "suffix", allow: []string{"*.internal"}, host: "tempo.internal", want: true},
+		{name: "suffix needs a subdomain", allow: []string{"*.internal"}, host: "internal", want: false},
+		{name: "suffix is not a substring match", allow: []string{"*.internal"}, host: "evilinternal", want: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Policy{Allow: tt.allow}).allows(tt.host); got != tt.want {
+				t.Errorf("allows(%q) with %v = %v, want %v", tt.host, tt.allow, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		allow string
+		mode  string
+		want  Policy
+	}{
+		{name: "unset", want: Policy{Mode: Enforce}},
+		{name: "list", allow: " RabbitMQ, payments,,app-2 ", want: Policy{Allow: []string{"rabbitmq", "payments", "app-2"}, Mode: Enforce}},
+		{name: "audit", allow: "payments", mode: "audit", want: Policy{Allow: []string{"payments"}, Mode: Audit}},
+		{name: "unknown mode enforces", allow: "payments", mode: "off", want: Policy{Allow: []string{"payments"}, Mode: Enforce}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("EGRESS_ALLOW", tt.allow)
+			t.Setenv("EGRESS_MODE", tt.mode)
+			if got := PolicyFromEnv(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PolicyFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		mode       string
+		host       string
+		wantDenied bool
+		wantAudit  bool
+	}{
+		{name: "allowed", mode: Enforce, host: "payments"},
+		{name: "denied", mode: Enforce, host: "app-2", wantDenied: true, wantAudit: true},
+		{name: "audited", mode: Audit, host: "app-2", wantAudit: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zap.WarnLevel)
+			Configure(Policy{Allow: []string{"payments"}, Mode: tt.mode}, zap.New(core))
+			t.Cleanup(func() { Configure(Policy{}, zap.NewNop()) })
+
+			err := Check(context.Background(), HTTP, tt.host)
+			if got := errors.Is(err, ErrDenied); got != tt.wantDenied {
+				t.Errorf("Check(%q) = %v, want denied %v", tt.host, err, tt.wantDenied)
+			}
+			entries := logs.All()
+			if got := len(entries) > 0; got != tt.wantAudit {
+				t.Fatalf("audit log entries = %d, want some %v", len(entries), tt.wantAudit)
+			}
+			if tt.wantAudit && entries[0].LoggerName != "audit" {
+				t.Errorf("logged to %q, want the audit logger", entries[0].LoggerName)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package shared
+
+import (
+	"context"
+	"errors"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/errreport"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecordError marks the active span as failed, forwards err to the error tracker
+// and keeps it for the diagnostics dump.
+// If description is empty, err.Error() is used as the span status description.
+func RecordError(ctx context.Context, err error, description string) {
+	if err == nil {
+		return
+	}
+	if description == "" {
+		description = err.Error()
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, description)
+
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		span.SetAttributes(
+			attribute.String("error.code", string(appErr.Code)),
+			attribute.Bool("error.retryable", appErr.Retryable),
+		)
+	}
+
+	errreport.Capture(ctx, err)
+	diagnostics.RecordError(ctx, err)
+}
@@ -0,0 +1,71 @@
+package errreport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var enabled bool
+
+// Init configures reporting to a Sentry-compatible endpoint (Sentry, GlitchTip).
+// Reporting stays disabled when dsn is empty, so every call below becomes a no-op.
+func Init(dsn, serviceName string) (func(), error) {
+	if dsn == "" {
+		return func() {}, nil
+	}
+
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: os.Getenv("SENTRY_ENVIRONMENT"),
+		ServerName:  serviceName,
+	})
+	if err != nil {
+		return func() {}, err
+	}
+	enabled = true
+
+	return func() { sentry.Flush(2 * time.Second) }, nil
+}
+
+// Capture sends err as an error event tagged with the trace context found in ctx.
+func Capture(ctx context.Context, err error) {
+	if !enabled || err == nil {
+		return
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		setTraceTags(ctx, scope)
+		hub.CaptureException(err)
+	})
+}
+
+// CapturePanic sends a recovered panic value as an error event tagged with the trace context found in ctx.
+func CapturePanic(ctx context.Context, recovered any) {
+	if !enabled || recovered == nil {
+		return
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		setTraceTags(ctx, scope)
+		scope.SetLevel(sentry.LevelFatal)
+		if err, ok := recovered.(error); ok {
+			hub.CaptureException(err)
+			return
+		}
+		hub.CaptureException(fmt.Errorf("panic: %v", recovered))
+	})
+}
+
+func setTraceTags(ctx context.Context, scope *sentry.Scope) {
+	sc := trace.SpanFromContext(ctx).SpanContext()
+	if !sc.IsValid() {
+		return
+	}
+	scope.SetTag("trace_id", sc.TraceID().String())
+	scope.SetTag("span_id", sc.SpanID().String())
+}
@@ -0,0 +1,185 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Flags toggling demo behaviour.
+const (
+	// Chaos enables the simulated random failures.
+	Chaos = "chaos"
+	// Forwarding lets consumer-1 forward messages to consumer-2.
+	Forwarding = "forwarding"
+	// SlowMode adds latency to request and message handling.
+	SlowMode = "slow_mode"
+)
+
+var flagEnabled = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "feature_flag_enabled",
+	Help: "1 while the feature flag is on, 0 while it is off.",
+}, []string{"flag"})
+
+var (
+	mu     sync.RWMutex
+	values = map[string]bool{
+		Chaos:      true,
+		Forwarding: true,
+		SlowMode:   false,
+	}
+)
+
+func init() {
+	for name, v := range values {
+		publish(name, v)
+	}
+	diagnostics.RegisterConfig("flags", func() any { return All() })
+}
+
+// Enabled reports whether the flag is on and records the evaluation on the span in ctx,
+// so a change in behaviour shows up in the trace. Unknown flags are off.
+func Enabled(ctx context.Context, name string) bool {
+	mu.RLock()
+	v := values[name]
+	mu.RUnlock()
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Bool("feature_flag."+name, v))
+	span.AddEvent("feature_flag", trace.WithAttributes(
+		attribute.String("feature_flag.key", name),
+		attribute.String("feature_flag.variant", strconv.FormatBool(v)),
+	))
+	return v
+}
+
+// Set turns a known flag on or off.
+func Set(name string, v bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := values[name]; !ok {
+		return fmt.Errorf("unknown flag %q", name)
+	}
+	values[name] = v
+	publish(name, v)
+	return nil
+}
+
+// All returns a snapshot of every flag.
+func All() map[string]bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	snapshot := make(map[string]bool, len(values))
+	for name, v := range values {
+		snapshot[name] = v
+	}
+	return snapshot
+}
+
+func names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]string, 0, len(values))
+	for name := range values {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func publish(name string, v bool) {
+	g := 0.0
+	if v {
+		g = 1
+	}
+	flagEnabled.WithLabelValues(name).Set(g)
+}
+
+// Load applies the JSON object in FLAGS_FILE (e.g. {"chaos": false}), then
+// FLAG_<NAME> variables such as FLAG_SLOW_MODE=true, which win over the file.
+func Load() error {
+	if path := os.Getenv("FLAGS_FILE"); path != "" {
+		if err := LoadFile(path); err != nil {
+			return err
+		}
+	}
+	for _, name := range names() {
+		s := os.Getenv("FLAG_" + strings.ToUpper(name))
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("FLAG_%s: %w", strings.ToUpper(name), err)
+		}
+		if err := Set(name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFile applies the flags in a JSON object file.
+func LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read flags file: %w", err)
+	}
+	return apply(b)
+}
+
+func apply(b []byte) error {
+	var update map[string]bool
+	if err := json.Unmarshal(b, &update); err != nil {
+		return fmt.Errorf("invalid flags: %w", err)
+	}
+	// Reject the whole update if any flag is unknown
+	known := All()
+	for name := range update {
+		if _, ok := known[name]; !ok {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+	}
+	for name, v := range update {
+		_ = Set(name, v)
+	}
+	return nil
+}
+
+// Handler serves the flags as JSON on GET and applies a JSON object of flags on PUT.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+			if err == nil {
+				err = apply(b)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(All())
+	})
+}
@@ -0,0 +1,116 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"github.com/daanielsharon/observability-go/shared/recovery"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	goroutinesActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "detached_goroutines_active",
+		Help: "Goroutines started with shared.Go that are still running, by name.",
+	}, []string{"name"})
+	goroutineDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "detached_goroutine_duration_seconds",
+		Help: "Duration of goroutines started with shared.Go, by name and outcome (ok, error, panic, cancelled).",
+	}, []string{"name", "outcome"})
+)
+
+var (
+	goroutines sync.WaitGroup
+	// stopGoroutines is cancelled when Shutdown runs out of time
+	goroutinesCtx, stopGoroutines = context.WithCancel(context.Background())
+)
+
+// Go runs fn in a new goroutine that outlives the request or message in ctx. fn gets
+// ctx's values but not its cancellation, and a span of its own: the root of a new
+// trace, linked to the span in ctx, which in turn gets a goroutine.spawned event
+// naming that trace. A returned error is recorded and logged, a panic is recovered,
+// and the goroutine's context is cancelled if Shutdown runs out of time waiting for it.
+//
+// The new trace keeps the sampling decision of the span in ctx (see telemetry.SpawnedBy),
+// so a sampled request or message is followed into the goroutines it starts; follow
+// the link to get from one trace to the other.
+func Go(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(goroutinesCtx, cancel)
+
+	parent := trace.SpanFromContext(ctx)
+	ctx, span := otel.Tracer("goroutine").Start(ctx, name,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{
+			SpanContext: parent.SpanContext(),
+			Attributes:  []attribute.KeyValue{telemetry.SpawnedBy},
+		}),
+		trace.WithAttributes(attribute.String("goroutine.name", name)),
+	)
+	parent.AddEvent("goroutine.spawned", trace.WithAttributes(
+		attribute.String("goroutine.name", name),
+		attribute.String("goroutine.trace_id", span.SpanContext().TraceID().String()),
+	))
+
+	log := logger.WithTrace(ctx, span.SpanContext().SpanID().String())
+	goroutinesActive.WithLabelValues(name).Inc()
+	goroutines.Add(1)
+	start := time.Now()
+
+	go func() {
+		outcome := "ok"
+		defer func() {
+			if r := recover(); r != nil {
+				outcome = "panic"
+				recovery.Handle(ctx, log, "goroutine", r)
+			}
+			stop()
+			cancel()
+			span.End()
+			goroutineDuration.WithLabelValues(name, outcome).Observe(time.Since(start).Seconds())
+			goroutinesActive.WithLabelValues(name).Dec()
+			goroutines.Done()
+		}()
+
+		if err := fn(ctx); err != nil {
+			outcome = "error"
+			if errors.Is(err, context.Canceled) && goroutinesCtx.Err() != nil {
+				outcome = "cancelled"
+			}
+			RecordError(ctx, err, "")
+			log.Error("goroutine failed", zap.String("goroutine", name), zap.Error(err))
+		}
+	}()
+}
+
+// Shutdown waits for the goroutines started with Go. If ctx ends first it cancels
+// their contexts, waits a moment for them to stop and returns ctx's error.
+func Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		goroutines.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	stopGoroutines()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,134 @@
+// Package grpchealth serves the gRPC health-checking protocol (grpc.health.v1) as a
+// sidecar for processes without a gRPC API of their own, so orchestrators and probes
+// such as grpc_health_probe can check them the same way as a gRPC service.
+package grpchealth
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/daanielsharon/observability-go/shared/runner"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	transitionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_health_transitions_total",
+		Help: "Health status changes reported over grpc.health.v1, by service (empty for the whole process) and new status.",
+	}, []string{"service", "status"})
+	serving = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "grpc_health_serving",
+		Help: "1 while the service reports SERVING over grpc.health.v1, 0 otherwise.",
+	}, []string{"service"})
+)
+
+// Server answers grpc.health.v1 Check and Watch calls on its own listener. The empty
+// service name stands for the whole process.
+type Server struct {
+	addr   string
+	log    *zap.Logger
+	health *health.Server
+	grpc   *grpc.Server
+
+	mu       sync.Mutex
+	statuses map[string]healthpb.HealthCheckResponse_ServingStatus
+}
+
+// New returns a Server that will listen on addr once started.
+func New(addr string, log *zap.Logger) *Server {
+	s := &Server{
+		addr:     addr,
+		log:      log,
+		health:   health.NewServer(),
+		grpc:     grpc.NewServer(),
+		statuses: make(map[string]healthpb.HealthCheckResponse_ServingStatus),
+	}
+	healthpb.RegisterHealthServer(s.grpc, s.health)
+	// health.NewServer starts the process out as SERVING; it isn't until Start
+	s.set("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return s
+}
+
+// SetServing reports service as serving or not. Changes are logged and counted.
+func (s *Server) SetServing(service string, ok bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if ok {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	s.set(service, status)
+}
+
+func (s *Server) set(service string, status healthpb.HealthCheckResponse_ServingStatus) {
+	s.mu.Lock()
+	prev, known := s.statuses[service]
+	s.statuses[service] = status
+	s.mu.Unlock()
+
+	s.health.SetServingStatus(service, status)
+	v := 0.0
+	if status == healthpb.HealthCheckResponse_SERVING {
+		v = 1
+	}
+	serving.WithLabelValues(service).Set(v)
+	if known && prev == status {
+		return
+	}
+	transitionsTotal.WithLabelValues(service, status.String()).Inc()
+	if known {
+		s.log.Info("health status changed", zap.String("service", service),
+			zap.Stringer("from", prev), zap.Stringer("to", status))
+	}
+}
+
+// Serving is a runner component that reports service as serving while it runs. Make it
+// depend on what the service needs, so probes see SERVING only once that is up and
+// NOT_SERVING again as soon as shutdown begins.
+func (s *Server) Serving(service string) runner.Hook {
+	return runner.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.SetServing(service, true)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			s.SetServing(service, false)
+			return nil
+		},
+	}
+}
+
+// Start listens on addr. Everything reports NOT_SERVING until set otherwise.
+func (s *Server) Start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := s.grpc.Serve(lis); err != nil {
+			s.log.Error("gRPC health server stopped", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Stop reports every service as not serving and closes the server.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	services := make([]string, 0, len(s.statuses))
+	for service := range s.statuses {
+		services = append(services, service)
+	}
+	s.mu.Unlock()
+	for _, service := range services {
+		s.SetServing(service, false)
+	}
+	// Watch streams never end on their own, so there is nothing to wait for
+	s.grpc.Stop()
+	return nil
+}
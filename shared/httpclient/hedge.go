@@ -0,0 +1,189 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var hedgedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_client_hedged_requests_total",
+	Help: "Outbound requests by hedging outcome (not_hedged, primary_won, hedge_won).",
+}, []string{"host", "outcome"})
+
+const (
+	hedgeSamples    = 128
+	hedgeMinSamples = 20
+)
+
+// hedgeTransport fires a second attempt when the first one is slower than the
+// configured latency percentile and returns whichever response arrives first; an
+// attempt that fails while the other may still succeed doesn't end the race.
+type hedgeTransport struct {
+	next       http.RoundTripper
+	percentile float64
+	fallback   time.Duration
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	pos       int
+}
+
+type hedgeAttempt struct {
+	name   string
+	span   trace.Span
+	cancel context.CancelFunc
+}
+
+type hedgeResult struct {
+	attempt *hedgeAttempt
+	resp    *http.Response
+	err     error
+	elapsed time.Duration
+}
+
+// threshold is the observed latency percentile, or the fallback delay until enough samples exist.
+func (t *hedgeTransport) threshold() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.latencies) < hedgeMinSamples {
+		return t.fallback
+	}
+	sorted := append([]time.Duration(nil), t.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(t.percentile*float64(len(sorted)-1))]
+}
+
+func (t *hedgeTransport) observe(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.latencies) < hedgeSamples {
+		t.latencies = append(t.latencies, d)
+		return
+	}
+	t.latencies[t.pos] = d
+	t.pos = (t.pos + 1) % hedgeSamples
+}
+
+func (t *hedgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A second copy of a request with side effects would apply them twice, and a body
+	// that can't be replayed can't be sent twice at all
+	if !safeToHedge(req) || (req.Body != nil && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+
+	results := make(chan hedgeResult, 2)
+	launch := func(name string) *hedgeAttempt {
+		ctx, cancel := context.WithCancel(req.Context())
+		ctx, span := otel.Tracer("github.com/daanielsharon/observability-go/shared/httpclient").Start(ctx, "hedge "+name)
+		span.SetAttributes(attribute.String("hedge.attempt", name))
+		a := &hedgeAttempt{name: name, span: span, cancel: cancel}
+
+		go func() {
+			start := time.Now()
+			r := req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					results <- hedgeResult{attempt: a, err: err}
+					return
+				}
+				r.Body = body
+			}
+			resp, err := t.next.RoundTrip(r)
+			results <- hedgeResult{attempt: a, resp: resp, err: err, elapsed: time.Since(start)}
+		}()
+		return a
+	}
+
+	timer := time.NewTimer(t.threshold())
+	defer timer.Stop()
+
+	// The first response wins. An error only wins once no other attempt can still
+	// succeed: the hedge hasn't been launched yet, or every attempt has failed.
+	pending := []*hedgeAttempt{launch("primary")}
+	var failed []hedgeResult
+	hedged := false
+	var winner hedgeResult
+wait:
+	for {
+		select {
+		case <-timer.C:
+			pending = append(pending, launch("hedge"))
+			hedged = true
+		case r := <-results:
+			pending = slices.DeleteFunc(pending, func(a *hedgeAttempt) bool { return a == r.attempt })
+			if r.err == nil || len(pending) == 0 {
+				winner = r
+				break wait
+			}
+			failed = append(failed, r)
+		}
+	}
+
+	outcome := "not_hedged"
+	if hedged {
+		outcome = winner.attempt.name + "_won"
+	}
+	hedgedRequests.WithLabelValues(req.URL.Host, outcome).Inc()
+	if winner.err == nil {
+		t.observe(winner.elapsed)
+	}
+
+	for _, r := range failed {
+		r.attempt.span.RecordError(r.err)
+		r.attempt.span.SetStatus(codes.Error, r.err.Error())
+		r.attempt.span.SetAttributes(attribute.Bool("hedge.won", false))
+		r.attempt.span.End()
+		r.attempt.cancel()
+	}
+	// Cancel and drain the losing attempt in the background
+	for _, a := range pending {
+		a.cancel()
+		go func(a *hedgeAttempt) {
+			r := <-results
+			if r.resp != nil {
+				r.resp.Body.Close()
+			}
+			a.span.SetAttributes(attribute.Bool("hedge.won", false))
+			a.span.End()
+		}(a)
+	}
+
+	span := winner.attempt.span
+	span.SetAttributes(attribute.Bool("hedge.won", true))
+	if winner.err != nil {
+		span.RecordError(winner.err)
+		span.SetStatus(codes.Error, winner.err.Error())
+		span.End()
+		winner.attempt.cancel()
+		return nil, winner.err
+	}
+	span.End()
+
+	// The winning attempt's context must outlive RoundTrip until the body is closed
+	winner.resp.Body = &cancelOnClose{ReadCloser: winner.resp.Body, cancel: winner.attempt.cancel}
+	return winner.resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
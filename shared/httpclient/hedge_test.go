@@ -0,0 +1,174 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// attempts is a RoundTripper whose nth call runs the nth behaviour.
+type attempts struct {
+	mu        sync.Mutex
+	behaviour []func(req *http.Request) (*http.Response, error)
+	calls     int
+	cancelled chan int
+}
+
+func (a *attempts) RoundTrip(req *http.Request) (*http.Response, error) {
+	a.mu.Lock()
+	n := a.calls
+	a.calls++
+	a.mu.Unlock()
+	resp, err := a.behaviour[n](req)
+	if err != nil && errors.Is(err, req.Context().Err()) {
+		a.cancelled <- n
+	}
+	return resp, err
+}
+
+func (a *attempts) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls
+}
+
+func answer(body string) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+	}
+}
+
+// hang waits until the attempt is cancelled.
+func hang(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+// failAfter fails after d.
+func failAfter(d time.Duration) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		time.Sleep(d)
+		return nil, errors.New("connection reset")
+	}
+}
+
+// answerAfter answers after d.
+func answerAfter(d time.Duration, body string) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		time.Sleep(d)
+		return answer(body)(req)
+	}
+}
+
+func TestHedgeTransport(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		method        string
+		key           bool
+		delay         time.Duration
+		behaviour     []func(req *http.Request) (*http.Response, error)
+		want          string
+		wantErr       bool
+		wantCalls     int
+		wantCancelled int // the attempt whose context is cancelled, -1 for none
+	}{
+		{
+			name:          "fast primary is not hedged",
+			method:        http.MethodGet,
+			delay:         time.Hour,
+			behaviour:     []func(*http.Request) (*http.Response, error){answer("primary")},
+			want:          "primary",
+			wantCalls:     1,
+			wantCancelled: -1,
+		},
+		{
+			name:          "slow primary is hedged and cancelled",
+			method:        http.MethodGet,
+			delay:         10 * time.Millisecond,
+			behaviour:     []func(*http.Request) (*http.Response, error){hang, answer("hedge")},
+			want:          "hedge",
+			wantCalls:     2,
+			wantCancelled: 0,
+		},
+		{
+			name:          "late primary error doesn't beat the hedge",
+			method:        http.MethodGet,
+			delay:         10 * time.Millisecond,
+			behaviour:     []func(*http.Request) (*http.Response, error){failAfter(30 * time.Millisecond), answerAfter(60*time.Millisecond, "hedge")},
+			want:          "hedge",
+			wantCalls:     2,
+			wantCancelled: -1,
+		},
+		{
+			name:          "both fail",
+			method:        http.MethodGet,
+			delay:         10 * time.Millisecond,
+			behaviour:     []func(*http.Request) (*http.Response, error){failAfter(30 * time.Millisecond), failAfter(30 * time.Millisecond)},
+			wantErr:       true,
+			wantCalls:     2,
+			wantCancelled: -1,
+		},
+		{
+			name:          "POST is sent once",
+			method:        http.MethodPost,
+			delay:         time.Millisecond,
+			behaviour:     []func(*http.Request) (*http.Response, error){answerAfter(30*time.Millisecond, "primary")},
+			want:          "primary",
+			wantCalls:     1,
+			wantCancelled: -1,
+		},
+		{
+			name:          "POST with an Idempotency-Key is hedged",
+			method:        http.MethodPost,
+			key:           true,
+			delay:         10 * time.Millisecond,
+			behaviour:     []func(*http.Request) (*http.Response, error){hang, answer("hedge")},
+			want:          "hedge",
+			wantCalls:     2,
+			wantCancelled: 0,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &attempts{behaviour: tt.behaviour, cancelled: make(chan int, 2)}
+			h := &hedgeTransport{next: next, percentile: 0.95, fallback: tt.delay}
+
+			req, _ := http.NewRequest(tt.method, "http://upstream/", nil)
+			if tt.key {
+				req.Header.Set(IdempotencyKeyHeader, "order-1")
+			}
+			resp, err := h.RoundTrip(req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("RoundTrip succeeded, want an error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("RoundTrip: %v", err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if string(body) != tt.want {
+					t.Errorf("answer = %q, want %q", body, tt.want)
+				}
+			}
+			if got := next.count(); got != tt.wantCalls {
+				t.Errorf("attempts = %d, want %d", got, tt.wantCalls)
+			}
+			if tt.wantCancelled < 0 {
+				return
+			}
+			select {
+			case n := <-next.cancelled:
+				if n != tt.wantCancelled {
+					t.Errorf("attempt %d cancelled, want %d", n, tt.wantCancelled)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("losing attempt %d was not cancelled", tt.wantCancelled)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/depmap"
+	"github.com/daanielsharon/observability-go/shared/egress"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	phaseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_phase_duration_seconds",
+		Help:    "Duration of outbound HTTP request phases (dns, connect, tls, ttfb).",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"host", "phase"})
+	connsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_connections_total",
+		Help: "Connections handed out by the pool, by whether they were reused and idle.",
+	}, []string{"host", "reused", "was_idle"})
+	connIdleTime = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "http_client_connection_idle_seconds",
+		Help: "How long reused connections sat idle in the pool.",
+	}, []string{"host"})
+)
+
+type options struct {
+	hedgePercentile float64
+	hedgeFallback   time.Duration
+	routes          map[string][]Backend
+}
+
+type Option func(*options)
+
+// WithHedging sends a second attempt when the first is slower than the given latency
+// percentile (0-1) of recent requests; fallback is used until enough samples exist.
+// Only GET, HEAD and OPTIONS requests and requests carrying an Idempotency-Key are
+// hedged; the rest are sent once.
+func WithHedging(percentile float64, fallback time.Duration) Option {
+	return func(o *options) {
+		o.hedgePercentile = percentile
+		o.hedgeFallback = fallback
+	}
+}
+
+// New returns a client whose requests get an otelhttp client span carrying
+// span events for the DNS, connect, TLS and time-to-first-byte phases.
+func New(opts ...Option) *http.Client {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var transport http.RoundTripper = &phaseTransport{base: http.DefaultTransport}
+	if o.hedgePercentile > 0 {
+		transport = &hedgeTransport{
+			next:       transport,
+			percentile: o.hedgePercentile,
+			fallback:   o.hedgeFallback,
+		}
+	}
+	if len(o.routes) > 0 {
+		transport = &routingTransport{next: transport, routes: o.routes}
+	}
+
+	return &http.Client{
+		Transport: otelhttp.NewTransport(transport),
+	}
+}
+
+// phaseTransport sits below otelhttp so the client span is already in the request context.
+// It is also where requests are checked against the egress allowlist.
+type phaseTransport struct {
+	base http.RoundTripper
+}
+
+func (t *phaseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := &phases{
+		span:  trace.SpanFromContext(req.Context()),
+		host:  req.URL.Host,
+		start: time.Now(),
+	}
+	if err := egress.Check(req.Context(), egress.HTTP, req.URL.Hostname()); err != nil {
+		depmap.Record(depmap.HTTP, req.URL.Scheme+"://"+req.URL.Host, err)
+		return nil, err
+	}
+	ctx := httptrace.WithClientTrace(req.Context(), p.clientTrace())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+
+	// For the dependency map a 5xx is the target failing, as much as a transport error is
+	depErr := err
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		depErr = errors.New(resp.Status)
+	}
+	depmap.Record(depmap.HTTP, req.URL.Scheme+"://"+req.URL.Host, depErr)
+	return resp, err
+}
+
+// phases collects timings for one request; callbacks may fire concurrently (dual-stack dialing).
+type phases struct {
+	span  trace.Span
+	host  string
+	start time.Time
+
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+}
+
+func (p *phases) observe(phase string, since time.Time, attrs ...attribute.KeyValue) {
+	elapsed := time.Since(since)
+	phaseDuration.WithLabelValues(p.host, phase).Observe(elapsed.Seconds())
+	attrs = append(attrs, attribute.Int64("duration_us", elapsed.Microseconds()))
+	p.span.AddEvent("http."+phase, trace.WithAttributes(attrs...))
+}
+
+func (p *phases) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			connsTotal.WithLabelValues(p.host, strconv.FormatBool(info.Reused), strconv.FormatBool(info.WasIdle)).Inc()
+			if info.WasIdle {
+				connIdleTime.WithLabelValues(p.host).Observe(info.IdleTime.Seconds())
+			}
+			p.span.AddEvent("http.got_conn", trace.WithAttributes(
+				attribute.Bool("reused", info.Reused),
+				attribute.Bool("was_idle", info.WasIdle),
+				attribute.Int64("idle_time_ms", info.IdleTime.Milliseconds()),
+			))
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			p.mu.Lock()
+			p.dnsStart = time.Now()
+			p.mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.observe("dns", p.dnsStart, attribute.Int("addrs", len(info.Addrs)), attribute.Bool("error", info.Err != nil))
+		},
+		ConnectStart: func(network, addr string) {
+			p.mu.Lock()
+			p.connectStart = time.Now()
+			p.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.observe("connect", p.connectStart, attribute.String("addr", addr), attribute.Bool("error", err != nil))
+		},
+		TLSHandshakeStart: func() {
+			p.mu.Lock()
+			p.tlsStart = time.Now()
+			p.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.observe("tls", p.tlsStart, attribute.Bool("error", err != nil))
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			p.mu.Lock()
+			p.wroteRequest = time.Now()
+			p.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			since := p.wroteRequest
+			if since.IsZero() {
+				since = p.start
+			}
+			p.observe("ttfb", since)
+		},
+	}
+}
@@ -0,0 +1,33 @@
+package httpclient
+
+import "net/http"
+
+// IdempotencyKeyHeader carries a key the receiver dedupes on, so a request with side
+// effects can be sent more than once and still take effect once.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// hasIdempotencyKey reports whether req was explicitly marked safe to repeat.
+func hasIdempotencyKey(req *http.Request) bool {
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// safeToHedge reports whether req may be in flight twice at once: its method is safe
+// (GET, HEAD, OPTIONS) or it carries an Idempotency-Key.
+func safeToHedge(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return hasIdempotencyKey(req)
+}
+
+// safeToRetry reports whether req may be sent again after a failure whose effect is
+// unknown: its method is idempotent (GET, HEAD, OPTIONS, TRACE, PUT, DELETE) or it
+// carries an Idempotency-Key.
+func safeToRetry(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return hasIdempotencyKey(req)
+}
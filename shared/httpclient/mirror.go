@@ -0,0 +1,81 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/daanielsharon/observability-go/shared/tasks"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var mirroredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_client_mirrored_requests_total",
+	Help: "Requests copied to a shadow backend, by target and outcome (ok, error).",
+}, []string{"target", "outcome"})
+
+// Mirror copies a share of requests to a shadow backend in the background and discards
+// the responses, so a canary can be compared on real traffic without affecting callers.
+// Mirrored spans are tagged shadow=true in every service the copy reaches.
+type Mirror struct {
+	client  *http.Client
+	target  string
+	percent float64
+	log     *zap.Logger
+}
+
+// NewMirror sends percent (0-100) of the requests passed to Send to the target base URL.
+func NewMirror(client *http.Client, log *zap.Logger, target string, percent float64) *Mirror {
+	return &Mirror{client: client, target: target, percent: percent, log: log}
+}
+
+// MirrorFromEnv reads MIRROR_TARGET and MIRROR_PERCENT; it returns nil, which mirrors
+// nothing, when either is unset.
+func MirrorFromEnv(client *http.Client, log *zap.Logger) *Mirror {
+	target := os.Getenv("MIRROR_TARGET")
+	percent, err := strconv.ParseFloat(os.Getenv("MIRROR_PERCENT"), 64)
+	if target == "" || err != nil || percent <= 0 {
+		return nil
+	}
+	return NewMirror(client, log, target, percent)
+}
+
+// Send maybe mirrors a request for path to the shadow backend. It never blocks the caller.
+func (m *Mirror) Send(ctx context.Context, method, path string, header http.Header) {
+	if m == nil || rand.Float64()*100 >= m.percent {
+		return
+	}
+
+	header = header.Clone()
+	tasks.Go(telemetry.WithShadow(ctx), m.log, "mirror "+method+" "+path, func(ctx context.Context) error {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("mirror.target", m.target))
+
+		req, err := http.NewRequestWithContext(ctx, method, m.target+path, nil)
+		if err != nil {
+			return err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := m.client.Do(req)
+		if err != nil {
+			mirroredTotal.WithLabelValues(m.target, "error").Inc()
+			return err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		mirroredTotal.WithLabelValues(m.target, "ok").Inc()
+		return nil
+	})
+}
@@ -0,0 +1,126 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/clock"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var retryAttempts = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "retry_attempts",
+	Help:    "Number of attempts made per outbound HTTP call.",
+	Buckets: []float64{1, 2, 3, 4, 5, 8},
+}, []string{"host", "outcome"})
+
+// RetryPolicy bounds the retries of DoWithRetry. Whatever the policy, only requests
+// that are safe to repeat are retried: an idempotent method (GET, HEAD, OPTIONS, TRACE,
+// PUT, DELETE) or an Idempotency-Key header the receiver dedupes on. A POST without a
+// key is sent once, since a failure may come after its side effects.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Clock times the backoff; nil uses real time.
+	Clock clock.Clock
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+	}
+}
+
+// backoff returns the delay before the given attempt (1-based): exponential with full jitter.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if attempt <= 1 {
+		return 0
+	}
+	d := p.BaseDelay << (attempt - 2)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// Doer sends HTTP requests; *http.Client is one, and tests can pass a fake.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoWithRetry sends the request built by newRequest, retrying transport errors and 5xx
+// responses of requests that are safe to repeat (see RetryPolicy).
+// Every attempt runs in its own child span carrying the attempt number, backoff delay and outcome.
+// newRequest is called once per attempt with the attempt's context.
+func DoWithRetry(ctx context.Context, client Doer, policy RetryPolicy, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	tracer := otel.Tracer("github.com/daanielsharon/observability-go/shared/httpclient")
+	clk := clock.Or(policy.Clock)
+	host := ""
+
+	for attempt := 1; ; attempt++ {
+		delay := policy.backoff(attempt)
+		if delay > 0 {
+			if err := clock.Sleep(ctx, clk, delay); err != nil {
+				return nil, err
+			}
+		}
+
+		attemptCtx, span := tracer.Start(ctx, fmt.Sprintf("attempt %d", attempt))
+		span.SetAttributes(
+			attribute.Int("retry.attempt", attempt),
+			attribute.Int64("retry.backoff_ms", delay.Milliseconds()),
+		)
+
+		req, err := newRequest(attemptCtx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to build request")
+			span.SetAttributes(attribute.String("retry.outcome", "invalid_request"))
+			span.End()
+			return nil, err
+		}
+		host = req.URL.Host
+
+		resp, err := client.Do(req)
+		outcome := "success"
+		switch {
+		case err != nil:
+			outcome = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		case resp.StatusCode >= http.StatusInternalServerError:
+			outcome = "server_error"
+			span.SetStatus(codes.Error, "status "+strconv.Itoa(resp.StatusCode))
+		}
+		replayable := safeToRetry(req)
+		span.SetAttributes(
+			attribute.String("retry.outcome", outcome),
+			attribute.Bool("retry.replayable", replayable),
+		)
+		span.End()
+
+		if outcome == "success" || attempt >= policy.MaxAttempts || !replayable {
+			retryAttempts.WithLabelValues(host, outcome).Observe(float64(attempt))
+			return resp, err
+		}
+
+		// Drain the failed response so the connection goes back to the pool
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package httpclient
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	backendRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_backend_requests_total",
+		Help: "Requests routed to a weighted backend, by logical host, backend version and outcome (ok, error, 5xx).",
+	}, []string{"host", "version", "outcome"})
+	backendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "http_client_backend_request_duration_seconds",
+		Help: "Latency of requests routed to a weighted backend, by logical host and backend version.",
+	}, []string{"host", "version"})
+)
+
+// Backend is one version of a service that takes Weight shares of its traffic.
+type Backend struct {
+	Version string
+	Host    string
+	Weight  int
+}
+
+// ParseBackends reads a comma-separated list of version=host:port:weight,
+// e.g. "v1=app-2:8081:90,v2=app-2-canary:8081:10". An empty string means no backends.
+func ParseBackends(s string) ([]Backend, error) {
+	var backends []Backend
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		version, rest, ok := strings.Cut(item, "=")
+		i := strings.LastIndex(rest, ":")
+		if !ok || i < 0 {
+			return nil, fmt.Errorf("invalid backend %q, want version=host:port:weight", item)
+		}
+		weight, err := strconv.Atoi(rest[i+1:])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight in backend %q", item)
+		}
+		backends = append(backends, Backend{Version: version, Host: rest[:i], Weight: weight})
+	}
+	return backends, nil
+}
+
+// WithWeightedRouting splits requests addressed to host between backends by weight.
+// The client span and the backend metrics carry the chosen version.
+func WithWeightedRouting(host string, backends []Backend) Option {
+	return func(o *options) {
+		if o.routes == nil {
+			o.routes = make(map[string][]Backend)
+		}
+		o.routes[host] = backends
+	}
+}
+
+// routingTransport sits below otelhttp, so it can tag the client span with the backend it picked.
+type routingTransport struct {
+	next   http.RoundTripper
+	routes map[string][]Backend
+}
+
+func (t *routingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	b, ok := pickBackend(t.routes[host])
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Host = b.Host
+	req.Host = b.Host
+	trace.SpanFromContext(req.Context()).SetAttributes(
+		attribute.String("backend.version", b.Version),
+		attribute.String("backend.host", b.Host),
+	)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	backendDuration.WithLabelValues(host, b.Version).Observe(time.Since(start).Seconds())
+
+	outcome := "ok"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case resp.StatusCode >= http.StatusInternalServerError:
+		outcome = "5xx"
+	}
+	backendRequests.WithLabelValues(host, b.Version, outcome).Inc()
+	return resp, err
+}
+
+func pickBackend(backends []Backend) (Backend, bool) {
+	total := 0
+	for _, b := range backends {
+		total += b.Weight
+	}
+	if total == 0 {
+		return Backend{}, false
+	}
+
+	n := rand.Intn(total)
+	for _, b := range backends {
+		if n < b.Weight {
+			return b, true
+		}
+		n -= b.Weight
+	}
+	return Backend{}, false
+}
@@ -0,0 +1,162 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultCaptureMaxBody is how much of each body is kept unless CAPTURE_MAX_BODY says otherwise.
+const DefaultCaptureMaxBody = 4 << 10
+
+var capturedExchanges = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_capture_exchanges_total",
+	Help: "Request/response pairs recorded by traffic capture, by outcome (written, failed).",
+}, []string{"outcome"})
+
+// redactedHeaders never reach the capture file, whatever diagnostics.Mask thinks of them.
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// CaptureConfig controls traffic capture.
+type CaptureConfig struct {
+	// File is the JSONL file exchanges are appended to; empty disables capture.
+	File string `json:"file"`
+	// SampleRatio is the share of requests recorded.
+	SampleRatio float64 `json:"sample_ratio"`
+	// MaxBody is how many bytes of each body are kept.
+	MaxBody int `json:"max_body"`
+}
+
+// CaptureFromEnv reads CAPTURE_FILE, CAPTURE_SAMPLE_RATIO (default 0.01) and
+// CAPTURE_MAX_BODY (default DefaultCaptureMaxBody).
+func CaptureFromEnv() CaptureConfig {
+	cfg := CaptureConfig{
+		File:        os.Getenv("CAPTURE_FILE"),
+		SampleRatio: 0.01,
+		MaxBody:     DefaultCaptureMaxBody,
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("CAPTURE_SAMPLE_RATIO"), 64); err == nil && v >= 0 && v <= 1 {
+		cfg.SampleRatio = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CAPTURE_MAX_BODY")); err == nil && v >= 0 {
+		cfg.MaxBody = v
+	}
+	return cfg
+}
+
+// Exchange is one captured request/response pair, a line of the capture file.
+type Exchange struct {
+	// TraceID is the trace the request was handled in, so the line can be matched with Tempo.
+	TraceID  string        `json:"trace_id,omitempty"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+
+	Method           string              `json:"method"`
+	Path             string              `json:"path"`
+	Query            string              `json:"query,omitempty"`
+	RequestHeaders   map[string][]string `json:"request_headers"`
+	RequestBody      string              `json:"request_body,omitempty"`
+	RequestTruncated bool                `json:"request_truncated,omitempty"`
+
+	Status            int                 `json:"status"`
+	ResponseHeaders   map[string][]string `json:"response_headers"`
+	ResponseBody      string              `json:"response_body,omitempty"`
+	ResponseTruncated bool                `json:"response_truncated,omitempty"`
+}
+
+// Capture records a sample of requests outside filter, with their responses, to cfg.File.
+// It does nothing unless cfg.File is set. Errors of recorded requests are handled here by
+// the app's error handler, so the response is complete when it is captured.
+func Capture(cfg CaptureConfig, filter *telemetry.PathFilter) (fiber.Handler, error) {
+	diagnostics.RegisterConfig("capture", cfg)
+	if cfg.File == "" || cfg.SampleRatio <= 0 {
+		return func(c *fiber.Ctx) error { return c.Next() }, nil
+	}
+	f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open capture file: %w", err)
+	}
+	var mu sync.Mutex
+
+	return func(c *fiber.Ctx) error {
+		if (filter != nil && filter.Match(c.Path())) || rand.Float64() >= cfg.SampleRatio {
+			return c.Next()
+		}
+
+		ctx, traceID := telemetry.WatchTrace(c.UserContext())
+		c.SetUserContext(ctx)
+		start := time.Now()
+
+		if err := c.Next(); err != nil {
+			if err := c.App().Config().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		ex := Exchange{
+			Time:           start,
+			Duration:       time.Since(start),
+			Method:         c.Method(),
+			Path:           c.Path(),
+			Query:          string(c.Request().URI().QueryString()),
+			RequestHeaders: captureHeaders(c.GetReqHeaders()),
+			Status:         c.Response().StatusCode(),
+		}
+		ex.ResponseHeaders = captureHeaders(c.GetRespHeaders())
+		ex.RequestBody, ex.RequestTruncated = truncate(c.Body(), cfg.MaxBody)
+		ex.ResponseBody, ex.ResponseTruncated = truncate(c.Response().Body(), cfg.MaxBody)
+		// Requests arriving with a trace context may not start a span of their own here
+		id := traceID()
+		if !id.IsValid() {
+			id = trace.SpanContextFromContext(ctx).TraceID()
+		}
+		if id.IsValid() {
+			ex.TraceID = id.String()
+		}
+
+		line, err := json.Marshal(ex)
+		if err == nil {
+			mu.Lock()
+			_, err = f.Write(append(line, '\n'))
+			mu.Unlock()
+		}
+		if err != nil {
+			capturedExchanges.WithLabelValues("failed").Inc()
+		} else {
+			capturedExchanges.WithLabelValues("written").Inc()
+		}
+		return nil
+	}, nil
+}
+
+// captureHeaders masks credentials in place.
+func captureHeaders(headers map[string][]string) map[string][]string {
+	for k := range headers {
+		if slices.ContainsFunc(redactedHeaders, func(r string) bool { return strings.EqualFold(k, r) }) ||
+			diagnostics.Mask(k, "-") != "-" {
+			headers[k] = []string{"****"}
+		}
+	}
+	return headers
+}
+
+func truncate(b []byte, max int) (string, bool) {
+	if len(b) > max {
+		return string(b[:max]), true
+	}
+	return string(b), false
+}
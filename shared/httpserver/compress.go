@@ -0,0 +1,85 @@
+package httpserver
+
+import (
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	compressionBytesIn = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_compression_bytes_in_total",
+		Help: "Response bytes before compression, by encoding (gzip, br, deflate, identity when left uncompressed).",
+	}, []string{"encoding"})
+	compressionBytesOut = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_compression_bytes_out_total",
+		Help: "Response bytes sent after compression, by encoding.",
+	}, []string{"encoding"})
+	compressionRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_compression_ratio",
+		Help:    "Compressed size over original size of compressed responses, by encoding.",
+		Buckets: []float64{.05, .1, .2, .3, .4, .5, .6, .8, 1},
+	}, []string{"encoding"})
+)
+
+// CompressionFromEnv reads HTTP_COMPRESSION: off, speed, default (the default) or best.
+func CompressionFromEnv() compress.Level {
+	switch os.Getenv("HTTP_COMPRESSION") {
+	case "off":
+		return compress.LevelDisabled
+	case "speed":
+		return compress.LevelBestSpeed
+	case "best":
+		return compress.LevelBestCompression
+	}
+	return compress.LevelDefault
+}
+
+// Compression compresses responses with brotli or gzip, whichever the client accepts,
+// and records the bytes saved. fasthttp leaves small and non-text bodies alone; those
+// count as identity. Register it after Tracing so the encoding lands on the server span.
+func Compression(level compress.Level) fiber.Handler {
+	var brLevel, gzipLevel int
+	switch level {
+	case compress.LevelDisabled:
+		return func(c *fiber.Ctx) error { return c.Next() }
+	case compress.LevelBestSpeed:
+		brLevel, gzipLevel = fasthttp.CompressBrotliBestSpeed, fasthttp.CompressBestSpeed
+	case compress.LevelBestCompression:
+		brLevel, gzipLevel = fasthttp.CompressBrotliBestCompression, fasthttp.CompressBestCompression
+	default:
+		brLevel, gzipLevel = fasthttp.CompressBrotliDefaultCompression, fasthttp.CompressDefaultCompression
+	}
+	compressor := fasthttp.CompressHandlerBrotliLevel(func(*fasthttp.RequestCtx) {}, brLevel, gzipLevel)
+
+	return func(c *fiber.Ctx) error {
+		// Errors are rendered by the error handler afterwards, past this middleware
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		before := len(c.Response().Body())
+		compressor(c.Context())
+		after := len(c.Response().Body())
+
+		encoding := string(c.Response().Header.Peek(fiber.HeaderContentEncoding))
+		if encoding == "" {
+			encoding = "identity"
+		}
+		compressionBytesIn.WithLabelValues(encoding).Add(float64(before))
+		compressionBytesOut.WithLabelValues(encoding).Add(float64(after))
+		if encoding != "identity" && before > 0 {
+			compressionRatio.WithLabelValues(encoding).Observe(float64(after) / float64(before))
+			trace.SpanFromContext(c.UserContext()).SetAttributes(
+				attribute.StringSlice("http.response.header.content-encoding", []string{encoding}),
+			)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,67 @@
+package httpserver
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// traceHeaders are the W3C propagation headers a browser needs to send for its trace
+// to continue into the backend.
+var traceHeaders = []string{"traceparent", "tracestate", "baggage"}
+
+// CORSConfig controls which browser origins may call the service.
+type CORSConfig struct {
+	// AllowOrigins lists the allowed origins; "*" allows any.
+	AllowOrigins []string `json:"allow_origins"`
+	// AllowHeaders are accepted on top of the trace headers.
+	AllowHeaders []string `json:"allow_headers"`
+	// MaxAge is how long, in seconds, browsers may cache a preflight answer.
+	MaxAge int `json:"max_age"`
+}
+
+// CORSFromEnv reads CORS_ALLOW_ORIGINS (comma separated, default "*"),
+// CORS_ALLOW_HEADERS (comma separated) and CORS_MAX_AGE (default 600).
+func CORSFromEnv() CORSConfig {
+	cfg := CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowHeaders: []string{"Content-Type", "Accept", fiber.HeaderXRequestID, "X-API-Key"},
+		MaxAge:       600,
+	}
+	if v := splitList(os.Getenv("CORS_ALLOW_ORIGINS")); len(v) > 0 {
+		cfg.AllowOrigins = v
+	}
+	if v := splitList(os.Getenv("CORS_ALLOW_HEADERS")); len(v) > 0 {
+		cfg.AllowHeaders = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CORS_MAX_AGE")); err == nil && v >= 0 {
+		cfg.MaxAge = v
+	}
+	return cfg
+}
+
+// CORS answers preflights and sets the CORS headers, always allowing the trace headers so
+// spans started in the browser are continued by Tracing. Register it before Tracing so
+// preflights don't produce spans of their own.
+func CORS(cfg CORSConfig) fiber.Handler {
+	return cors.New(cors.Config{
+		AllowOrigins:  strings.Join(cfg.AllowOrigins, ","),
+		AllowMethods:  "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders:  strings.Join(append(append([]string(nil), traceHeaders...), cfg.AllowHeaders...), ","),
+		ExposeHeaders: fiber.HeaderXRequestID,
+		MaxAge:        cfg.MaxAge,
+	})
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
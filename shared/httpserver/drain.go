@@ -0,0 +1,229 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// DrainState is where a server is in being taken out of rotation.
+type DrainState string
+
+const (
+	// Serving is ready and accepting connections.
+	Serving DrainState = "serving"
+	// Draining is not ready but still accepting connections while in-flight requests finish.
+	Draining DrainState = "draining"
+	// Drained has stopped accepting connections.
+	Drained DrainState = "drained"
+)
+
+var drainState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "http_drain_state",
+	Help: "1 for the state the HTTP server is in (serving, draining, drained), 0 for the others.",
+}, []string{"state"})
+
+// drainPoll is how often Drain checks whether in-flight requests have finished.
+const drainPoll = 50 * time.Millisecond
+
+// DrainTimeoutFromEnv reads DRAIN_TIMEOUT (default 30s).
+func DrainTimeoutFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DRAIN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+// DrainStatus is what the drain endpoints report.
+type DrainStatus struct {
+	State    DrainState `json:"state"`
+	Since    time.Time  `json:"since"`
+	InFlight int64      `json:"in_flight"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Drainer takes a server out of rotation the way a rolling deploy does: readiness goes
+// false, in-flight requests get Timeout to finish, then the listener is shut down.
+// Serve its handlers from a listener of their own (metrics.Serve) so readiness, health
+// and metrics stay up once the server is drained.
+type Drainer struct {
+	// Timeout bounds both the wait for in-flight requests and the shutdown after it.
+	Timeout time.Duration
+
+	shutdown func(ctx context.Context) error
+	log      *zap.Logger
+
+	mu    sync.Mutex
+	state DrainState
+	since time.Time
+	err   error
+	done  chan struct{}
+}
+
+// NewDrainer returns a Serving Drainer that stops the server with shutdown, such as
+// fiber's App.ShutdownWithContext.
+func NewDrainer(shutdown func(ctx context.Context) error, log *zap.Logger) *Drainer {
+	d := &Drainer{
+		Timeout:  DrainTimeoutFromEnv(),
+		shutdown: shutdown,
+		log:      log,
+		done:     make(chan struct{}),
+	}
+	d.set(Serving)
+	return d
+}
+
+// set moves d to state; d.mu must be held or d not yet shared.
+func (d *Drainer) set(state DrainState) {
+	d.state = state
+	d.since = time.Now()
+	for _, s := range []DrainState{Serving, Draining, Drained} {
+		v := 0.0
+		if s == state {
+			v = 1
+		}
+		drainState.WithLabelValues(string(s)).Set(v)
+	}
+}
+
+// Ready reports whether the server should get new traffic.
+func (d *Drainer) Ready() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state == Serving
+}
+
+// Status is d's state, when it was entered and the requests in flight.
+func (d *Drainer) Status() DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := DrainStatus{State: d.state, Since: d.since, InFlight: metrics.InFlightRequests()}
+	if d.err != nil {
+		s.Error = d.err.Error()
+	}
+	return s
+}
+
+// Done is closed once the server is drained.
+func (d *Drainer) Done() <-chan struct{} {
+	return d.done
+}
+
+// Drain starts draining in the background and reports whether this call started it;
+// a second call leaves the drain already under way alone.
+func (d *Drainer) Drain(ctx context.Context) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state != Serving {
+		return false
+	}
+	d.set(Draining)
+	go d.run(context.WithoutCancel(ctx))
+	return true
+}
+
+func (d *Drainer) run(ctx context.Context) {
+	start := time.Now()
+	inFlight := metrics.InFlightRequests()
+	ctx, span := otel.Tracer("http").Start(ctx, "HTTP Drain", trace.WithAttributes(
+		attribute.Int64("http.drain.in_flight", inFlight),
+		attribute.String("http.drain.timeout", d.Timeout.String()),
+	))
+	defer span.End()
+	d.log.Info("draining: readiness off, waiting for in-flight requests",
+		zap.Int64("in_flight", inFlight), zap.Duration("timeout", d.Timeout))
+
+	deadline := time.Now().Add(d.Timeout)
+	ticker := time.NewTicker(drainPoll)
+	for metrics.InFlightRequests() > 0 && time.Now().Before(deadline) {
+		<-ticker.C
+	}
+	ticker.Stop()
+	left := metrics.InFlightRequests()
+	span.AddEvent("drain.in_flight_settled", trace.WithAttributes(attribute.Int64("http.drain.in_flight", left)))
+	if left > 0 {
+		d.log.Warn("drain timeout reached with requests still in flight", zap.Int64("in_flight", left))
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, d.Timeout)
+	err := d.shutdown(shutdownCtx)
+	cancel()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "shutdown failed")
+		d.log.Error("failed to stop listener while draining", zap.Error(err))
+	}
+
+	d.mu.Lock()
+	d.err = err
+	d.set(Drained)
+	d.mu.Unlock()
+	close(d.done)
+	span.AddEvent("drain.drained")
+	d.log.Info("drained: listener stopped", zap.Duration("duration", time.Since(start)))
+}
+
+// HealthHandler answers 200 in every state, for liveness probes: a drained server is
+// meant to be left alone until it is stopped, not restarted.
+func (d *Drainer) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "drain": string(d.Status().State)})
+	})
+}
+
+// ReadyHandler answers 200 while serving and 503 once draining, for readiness probes.
+func (d *Drainer) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := d.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if s.State != Serving {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]DrainState{"status": s.State})
+	})
+}
+
+// Handler serves GET for the drain status and POST to start draining: 202 when the
+// POST started it, 200 when it was already under way. POST ?wait=true answers once
+// the server is drained.
+func (d *Drainer) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if d.Drain(r.Context()) {
+				status = http.StatusAccepted
+			}
+			if r.URL.Query().Get("wait") == "true" {
+				select {
+				case <-d.Done():
+					status = http.StatusOK
+				case <-r.Context().Done():
+					return
+				}
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(d.Status())
+	})
+}
@@ -0,0 +1,171 @@
+package httpserver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// UnmatchedPath is the path label used for requests that matched no route,
+// so scanners and typos don't explode the cardinality of per-path metrics.
+const UnmatchedPath = "unmatched"
+
+var unmatchedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_unmatched_requests_total",
+	Help: "Requests that matched no route, by status (404/405) and first path segment.",
+}, []string{"status", "prefix"})
+
+type unmatchedKey struct{}
+
+// NotFound must be registered last (app.Use) so it only runs for requests that fell through every route.
+// It marks the request as unmatched and lets Fiber answer with 404, or 405 when another method matches the path.
+func NotFound(c *fiber.Ctx) error {
+	c.Locals(unmatchedKey{}, true)
+	return c.Next()
+}
+
+// Unmatched reports whether the request reached NotFound.
+func Unmatched(c *fiber.Ctx) bool {
+	unmatched, _ := c.Locals(unmatchedKey{}).(bool)
+	return unmatched
+}
+
+// StatusCode is the status the response will end up with once err reaches the error handler.
+func StatusCode(c *fiber.Ctx, err error) int {
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		return appErr.Status
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	if err != nil {
+		return fiber.StatusInternalServerError
+	}
+	return c.Response().StatusCode()
+}
+
+// ErrorHandler converts errors returned by handlers into ErrorResponses, see WriteError.
+// *apperr.Error values keep their code, status and client-safe message; anything else becomes an internal error.
+// Every error is counted in errors_total; 404/405s for unmatched routes and requests refused by
+// the server limits are logged and counted separately.
+func ErrorHandler(log *zap.Logger) fiber.ErrorHandler {
+	var (
+		once     sync.Once
+		prefixes map[string]struct{}
+	)
+
+	return func(c *fiber.Ctx, err error) error {
+		appErr := asAppError(err)
+		apperr.Count(appErr)
+
+		if (appErr.Status == fiber.StatusNotFound || appErr.Status == fiber.StatusMethodNotAllowed) && Unmatched(c) {
+			once.Do(func() { prefixes = routePrefixes(c.App()) })
+			recordUnmatched(c, log, appErr.Status, boundedPrefix(c.Path(), prefixes))
+		}
+
+		if reason := rejection(c, appErr.Status); reason != "" {
+			recordRejected(c, log, reason, appErr.Status)
+		} else if appErr.Status >= fiber.StatusInternalServerError {
+			span := trace.SpanFromContext(c.UserContext())
+			span.SetAttributes(attribute.String("error.code", string(appErr.Code)))
+			span.SetStatus(codes.Error, appErr.Message)
+
+			fields := []zap.Field{
+				zap.String("code", string(appErr.Code)),
+				zap.Int("status", appErr.Status),
+				zap.Bool("retryable", appErr.Retryable),
+				zap.String("method", c.Method()),
+				zap.String("path", c.Path()),
+				zap.String("request_id", c.GetRespHeader(fiber.HeaderXRequestID)),
+				zap.Error(err),
+			}
+			if sc := span.SpanContext(); sc.IsValid() {
+				fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+			}
+			log.Error("request failed", fields...)
+		}
+
+		return WriteError(c, appErr)
+	}
+}
+
+// asAppError is the *apperr.Error the client gets for err: err itself, one built from
+// a *fiber.Error's status, or an internal error.
+func asAppError(err error) *apperr.Error {
+	var appErr *apperr.Error
+	var fe *fiber.Error
+	if !errors.As(err, &appErr) && errors.As(err, &fe) {
+		return apperr.FromStatus(fe.Code, fe.Message)
+	}
+	return apperr.From(err)
+}
+
+func recordUnmatched(c *fiber.Ctx, log *zap.Logger, code int, prefix string) {
+	unmatchedTotal.WithLabelValues(strconv.Itoa(code), prefix).Inc()
+
+	ctx := c.UserContext()
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		_, span = otel.Tracer("http").Start(ctx, c.Method()+" "+UnmatchedPath)
+		defer span.End()
+	}
+	// 4xx are client errors, so the span status is left unset
+	span.SetAttributes(telemetry.HTTPResponse(UnmatchedPath, code)...)
+	span.SetAttributes(attribute.String("url.path", strings.Clone(c.Path())))
+
+	fields := []zap.Field{
+		zap.Int("status", code),
+		zap.String("method", c.Method()),
+		zap.String("path", c.Path()),
+	}
+	if sc := span.SpanContext(); sc.IsValid() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+	}
+	log.Warn("request matched no route", fields...)
+}
+
+// routePrefixes collects the first path segment of every registered route.
+func routePrefixes(app *fiber.App) map[string]struct{} {
+	prefixes := make(map[string]struct{})
+	for _, r := range app.GetRoutes(true) {
+		if p := firstSegment(r.Path); p != "" && !strings.ContainsAny(p, ":*+") {
+			prefixes[p] = struct{}{}
+		}
+	}
+	return prefixes
+}
+
+// boundedPrefix maps a path to a known route prefix, or "other" for anything never registered.
+func boundedPrefix(path string, known map[string]struct{}) string {
+	p := firstSegment(path)
+	if p == "" {
+		return "/"
+	}
+	if _, ok := known[p]; ok {
+		return "/" + p
+	}
+	return "other"
+}
+
+func firstSegment(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
@@ -0,0 +1,147 @@
+package httpserver
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Rejection reasons, the reason label of http_requests_rejected_total.
+const (
+	RejectTimeout        = "timeout"
+	RejectBodyTooLarge   = "body_too_large"
+	RejectHeaderTooLarge = "header_too_large"
+	RejectConcurrency    = "concurrency"
+)
+
+var rejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_requests_rejected_total",
+	Help: "Requests refused by the server limits, by reason (timeout, body_too_large, header_too_large, concurrency, quota).",
+}, []string{"reason"})
+
+// Limits bounds what a single client can make the server hold on to.
+type Limits struct {
+	// ReadTimeout is how long a client may take to send a full request, so slow-loris connections are cut.
+	ReadTimeout time.Duration `json:"read_timeout"`
+	// WriteTimeout is how long writing the response may take.
+	WriteTimeout time.Duration `json:"write_timeout"`
+	// IdleTimeout is how long a keep-alive connection may wait for its next request.
+	IdleTimeout time.Duration `json:"idle_timeout"`
+	// BodyLimit is the largest request body accepted, in bytes.
+	BodyLimit int `json:"body_limit"`
+	// HeaderLimit is the largest request line plus headers accepted, in bytes.
+	HeaderLimit int `json:"header_limit"`
+	// MaxInFlight is how many requests are handled at once before new ones get a 503; 0 means no limit.
+	MaxInFlight int `json:"max_in_flight"`
+}
+
+// LimitsFromEnv reads HTTP_READ_TIMEOUT (default 10s), HTTP_WRITE_TIMEOUT (default 30s),
+// HTTP_IDLE_TIMEOUT (default 60s), HTTP_BODY_LIMIT (default 4 MiB), HTTP_HEADER_LIMIT
+// (default 8 KiB) and HTTP_MAX_IN_FLIGHT (default 512).
+func LimitsFromEnv() Limits {
+	l := Limits{
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  60 * time.Second,
+		BodyLimit:    fiber.DefaultBodyLimit,
+		HeaderLimit:  8 << 10,
+		MaxInFlight:  512,
+	}
+	for env, d := range map[string]*time.Duration{
+		"HTTP_READ_TIMEOUT":  &l.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT": &l.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":  &l.IdleTimeout,
+	} {
+		if v, err := time.ParseDuration(os.Getenv(env)); err == nil && v > 0 {
+			*d = v
+		}
+	}
+	for env, n := range map[string]*int{
+		"HTTP_BODY_LIMIT":    &l.BodyLimit,
+		"HTTP_HEADER_LIMIT":  &l.HeaderLimit,
+		"HTTP_MAX_IN_FLIGHT": &l.MaxInFlight,
+	} {
+		if v, err := strconv.Atoi(os.Getenv(env)); err == nil && v >= 0 {
+			*n = v
+		}
+	}
+	return l
+}
+
+// Apply copies the server-level limits into cfg. Requests fasthttp refuses (slow or
+// oversized) reach cfg.ErrorHandler as 408/413/431 and are counted there.
+func (l Limits) Apply(cfg fiber.Config) fiber.Config {
+	cfg.ReadTimeout = l.ReadTimeout
+	cfg.WriteTimeout = l.WriteTimeout
+	cfg.IdleTimeout = l.IdleTimeout
+	cfg.BodyLimit = l.BodyLimit
+	cfg.ReadBufferSize = l.HeaderLimit
+	return cfg
+}
+
+type rejectedKey struct{}
+
+// Concurrency answers 503 to requests beyond MaxInFlight instead of letting them queue.
+// It should run right after Tracing so refused requests still get a span.
+func (l Limits) Concurrency() fiber.Handler {
+	if l.MaxInFlight <= 0 {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+	var inFlight atomic.Int64
+	limit := int64(l.MaxInFlight)
+	return func(c *fiber.Ctx) error {
+		if inFlight.Add(1) > limit {
+			inFlight.Add(-1)
+			c.Locals(rejectedKey{}, RejectConcurrency)
+			return apperr.New(apperr.Unavailable, "server is at capacity", nil)
+		}
+		defer inFlight.Add(-1)
+		return c.Next()
+	}
+}
+
+// rejection returns why the server refused the request, or "" if it didn't.
+func rejection(c *fiber.Ctx, status int) string {
+	if reason, ok := c.Locals(rejectedKey{}).(string); ok {
+		return reason
+	}
+	switch status {
+	case fiber.StatusRequestTimeout:
+		return RejectTimeout
+	case fiber.StatusRequestEntityTooLarge:
+		return RejectBodyTooLarge
+	case fiber.StatusRequestHeaderFieldsTooLarge:
+		return RejectHeaderTooLarge
+	}
+	return ""
+}
+
+func recordRejected(c *fiber.Ctx, log *zap.Logger, reason string, status int) {
+	rejectedTotal.WithLabelValues(reason).Inc()
+
+	span := trace.SpanFromContext(c.UserContext())
+	span.SetAttributes(attribute.String("http.rejected", reason))
+
+	fields := []zap.Field{
+		zap.String("reason", reason),
+		zap.Int("status", status),
+		zap.String("method", c.Method()),
+		zap.String("path", c.Path()),
+		zap.String("remote_ip", c.IP()),
+		zap.Int("content_length", c.Request().Header.ContentLength()),
+	}
+	if sc := span.SpanContext(); sc.IsValid() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+	}
+	log.Warn("request rejected", fields...)
+}
@@ -0,0 +1,52 @@
+package httpserver
+
+import (
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/logger"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// Logger stores a request-scoped logger, carrying the request ID, method and path,
+// in the user context for logger.FromContext. It must run after requestid and after
+// any middleware that replaces the user context.
+func Logger(log *zap.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		l := log.With(
+			zap.String("request_id", c.GetRespHeader(fiber.HeaderXRequestID)),
+			zap.String("method", c.Method()),
+			zap.String("path", c.Path()),
+		)
+		c.SetUserContext(logger.IntoContext(c.UserContext(), l))
+		return c.Next()
+	}
+}
+
+// AccessLog writes an "access" entry for every request outside filter (nil logs all),
+// with what cmd/replay needs to send it again and, for failures, the error code. It must run after Logger.
+func AccessLog(filter *telemetry.PathFilter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if filter != nil && filter.Match(c.Path()) {
+			return c.Next()
+		}
+		start := time.Now()
+		err := c.Next()
+
+		fields := []zap.Field{
+			zap.String("query", string(c.Request().URI().QueryString())),
+			zap.String("content_type", c.Get(fiber.HeaderContentType)),
+			zap.Int("request_bytes", len(c.Body())),
+			zap.Int("status", StatusCode(c, err)),
+			zap.Duration("duration", time.Since(start)),
+		}
+		if err != nil {
+			// The code of the ErrorResponse the client gets
+			fields = append(fields, zap.String("code", string(asAppError(err).Code)))
+		}
+		logger.FromContext(c.UserContext()).Info("access", fields...)
+		return err
+	}
+}
@@ -0,0 +1,102 @@
+package httpserver
+
+import (
+	"fmt"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var validationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_request_validation_failures_total",
+	Help: "Requests answered 400 because they didn't match the OpenAPI spec, by operation.",
+}, []string{"operation"})
+
+func init() {
+	// Validation errors go back to the client; leave out the schema and value dumps
+	openapi3.SchemaErrorDetailsDisabled = true
+}
+
+// Operation is an OpenAPI operation mounted as a Fiber route. The openapi-gen
+// generated code lists one per operation in the spec.
+type Operation struct {
+	// ID is the operationId.
+	ID     string
+	Method string
+	// Path is the path in the spec, e.g. /orders/{id}.
+	Path string
+	// Route is the Fiber route, e.g. /orders/:id.
+	Route string
+}
+
+// API is a loaded OpenAPI spec that requests can be validated against.
+type API struct {
+	doc *openapi3.T
+}
+
+// LoadAPI parses spec and checks that it is a valid OpenAPI 3 document.
+func LoadAPI(spec []byte) (*API, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("load OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	return &API{doc: doc}, nil
+}
+
+// Validate is route middleware for op. It tags the server span with the operation ID and
+// answers 400 to requests whose parameters or body the spec doesn't allow, counting them
+// and adding the reason to the span as a request.validation_failed event. It panics if
+// op is not in the spec, which means the generated code is out of date.
+func (a *API) Validate(op Operation) fiber.Handler {
+	item := a.doc.Paths.Value(op.Path)
+	if item == nil || item.GetOperation(op.Method) == nil {
+		panic(fmt.Sprintf("httpserver: %s %s (%s) is not in the OpenAPI spec; regenerate the handlers", op.Method, op.Path, op.ID))
+	}
+	route := &routers.Route{
+		Spec:      a.doc,
+		Path:      op.Path,
+		PathItem:  item,
+		Method:    op.Method,
+		Operation: item.GetOperation(op.Method),
+	}
+	options := &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}
+
+	return func(c *fiber.Ctx) error {
+		span := trace.SpanFromContext(c.UserContext())
+		span.SetAttributes(attribute.String("openapi.operation_id", op.ID))
+
+		req, err := adaptor.ConvertRequest(c, false)
+		if err != nil {
+			return err
+		}
+		err = openapi3filter.ValidateRequest(c.UserContext(), &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: c.AllParams(),
+			Route:      route,
+			Options:    options,
+		})
+		if err == nil {
+			return c.Next()
+		}
+
+		validationFailures.WithLabelValues(op.ID).Inc()
+		span.AddEvent("request.validation_failed", trace.WithAttributes(
+			attribute.String("openapi.operation_id", op.ID),
+			attribute.String("error.message", err.Error()),
+		))
+		return apperr.New(apperr.InvalidInput, "Request does not match the API: "+err.Error(), err)
+	}
+}
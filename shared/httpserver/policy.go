@@ -0,0 +1,19 @@
+package httpserver
+
+import (
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RoutePolicies stores the policy matching the request path in the user context,
+// where request-scoped loggers pick up its log level. It must run after any
+// middleware that replaces the user context.
+func RoutePolicies(policies *telemetry.RoutePolicies) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if p, ok := policies.Lookup(c.Path()); ok {
+			c.SetUserContext(telemetry.ContextWithRoutePolicy(c.UserContext(), p))
+		}
+		return c.Next()
+	}
+}
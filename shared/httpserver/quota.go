@@ -0,0 +1,222 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/attrs"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RejectQuota is the http_requests_rejected_total reason for clients over their quota.
+const RejectQuota = "quota"
+
+// Client names for requests that carry no usable API key. Together with the configured
+// client names they bound the client label.
+const (
+	ClientAnonymous = "anonymous"
+	ClientInvalid   = "invalid"
+)
+
+var (
+	clientRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_requests_total",
+		Help: "Requests by API client and status class (2xx, 4xx, ...).",
+	}, []string{"client", "status_class"})
+	clientDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "client_request_duration_seconds",
+		Help: "Duration of requests by API client.",
+	}, []string{"client"})
+	quotaUsed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "quota_used_ratio",
+		Help: "Share of the client's quota used in the current window, as of its last request.",
+	}, []string{"client"})
+	quotaRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "quota_rejections_total",
+		Help: "Requests refused with 429 because the client was over its quota.",
+	}, []string{"client"})
+	quotaStoreErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "quota_store_errors_total",
+		Help: "Quota counter updates that failed; the request is let through uncounted.",
+	})
+)
+
+// QuotaConfig identifies API clients by key and caps how many requests each may make
+// per window.
+type QuotaConfig struct {
+	// Keys maps an API key to the client it identifies. Keys stay out of diagnostics.
+	Keys map[string]string `json:"-"`
+	// Clients lists the configured client names.
+	Clients []string `json:"clients"`
+	// Limit is how many requests a client may make per Window; 0 means no limit.
+	Limit int64 `json:"limit"`
+	// Window is the fixed window quotas are counted over.
+	Window time.Duration `json:"window"`
+	// RequireKey refuses requests without a key instead of serving them as anonymous.
+	RequireKey bool `json:"require_key"`
+}
+
+// QuotaFromEnv reads API_KEYS (comma-separated client=key pairs), QUOTA_LIMIT (default
+// 600), QUOTA_WINDOW (default 1m) and API_KEY_REQUIRED (default false).
+func QuotaFromEnv() QuotaConfig {
+	cfg := QuotaConfig{Keys: make(map[string]string), Limit: 600, Window: time.Minute}
+	for _, pair := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		client, key, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || client == "" || key == "" {
+			continue
+		}
+		cfg.Keys[key] = client
+		cfg.Clients = append(cfg.Clients, client)
+	}
+	sort.Strings(cfg.Clients)
+	if v, err := strconv.ParseInt(os.Getenv("QUOTA_LIMIT"), 10, 64); err == nil && v >= 0 {
+		cfg.Limit = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("QUOTA_WINDOW")); err == nil && v > 0 {
+		cfg.Window = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("API_KEY_REQUIRED")); err == nil {
+		cfg.RequireKey = v
+	}
+	return cfg
+}
+
+// client returns the client key names, or ClientInvalid for a key nobody was given.
+func (q QuotaConfig) client(key string) string {
+	for k, client := range q.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return client
+		}
+	}
+	return ClientInvalid
+}
+
+// QuotaStore counts requests per client and window.
+type QuotaStore interface {
+	// Incr counts one request by client and returns its count in the current window
+	// and when that window ends.
+	Incr(ctx context.Context, client string, window time.Duration) (int64, time.Time, error)
+}
+
+// RedisQuotaStore keeps the counters in Redis, so every replica enforces the same quota.
+func RedisQuotaStore(client *redis.Client) QuotaStore {
+	return redisQuotaStore{client}
+}
+
+type redisQuotaStore struct{ client *redis.Client }
+
+func (s redisQuotaStore) Incr(ctx context.Context, client string, window time.Duration) (int64, time.Time, error) {
+	start := time.Now().Truncate(window)
+	key := "quota:" + client + ":" + strconv.FormatInt(start.Unix(), 10)
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, time.Time{}, err
+	}
+	return incr.Val(), start.Add(window), nil
+}
+
+// MemoryQuotaStore keeps the counters in this process, so each replica counts alone.
+func MemoryQuotaStore() QuotaStore {
+	return &memoryQuotaStore{counts: make(map[string]int64)}
+}
+
+type memoryQuotaStore struct {
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int64
+}
+
+func (s *memoryQuotaStore) Incr(ctx context.Context, client string, window time.Duration) (int64, time.Time, error) {
+	start := time.Now().Truncate(window)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !start.Equal(s.start) {
+		s.start = start
+		clear(s.counts)
+	}
+	s.counts[client]++
+	return s.counts[client], start.Add(window), nil
+}
+
+// Quota identifies the client by its X-API-Key header, records its requests in
+// client_requests_total and client_request_duration_seconds, and answers 429 once it
+// is over its quota. A failing store lets requests through rather than refusing
+// everyone. skip exempts paths such as probes and /metrics. It should run after
+// Tracing and Logger so the client shows on the span and rejections are logged.
+func Quota(cfg QuotaConfig, store QuotaStore, skip func(path string) bool) fiber.Handler {
+	limit := strconv.FormatInt(cfg.Limit, 10)
+	return func(c *fiber.Ctx) error {
+		if skip != nil && skip(c.Path()) {
+			return c.Next()
+		}
+		ctx := c.UserContext()
+		span := trace.SpanFromContext(ctx)
+
+		client := ClientAnonymous
+		if key := c.Get("X-API-Key"); key != "" {
+			client = cfg.client(key)
+		}
+		attrs.Set(ctx, attrs.ClientID.String(client))
+
+		start := time.Now()
+		err := func() error {
+			switch {
+			case client == ClientInvalid:
+				return apperr.New(apperr.Unauthorized, "unknown API key", nil)
+			case client == ClientAnonymous && cfg.RequireKey:
+				return apperr.New(apperr.Unauthorized, "API key required", nil)
+			case client == ClientAnonymous || cfg.Limit == 0:
+				return c.Next()
+			}
+
+			used, reset, err := store.Incr(ctx, client, cfg.Window)
+			if err != nil {
+				quotaStoreErrors.Inc()
+				span.AddEvent("quota store unavailable", trace.WithAttributes(attribute.String("error.message", err.Error())))
+				return c.Next()
+			}
+			remaining := max(cfg.Limit-used, 0)
+			quotaUsed.WithLabelValues(client).Set(float64(used) / float64(cfg.Limit))
+			span.SetAttributes(
+				attribute.Int64("quota.limit", cfg.Limit),
+				attribute.Int64("quota.used", used),
+				attribute.Int64("quota.remaining", remaining),
+			)
+			c.Set("X-RateLimit-Limit", limit)
+			c.Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+			c.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			if used > cfg.Limit {
+				retryAfter := max(int(time.Until(reset).Seconds()+0.5), 1)
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+				quotaRejections.WithLabelValues(client).Inc()
+				span.AddEvent("quota.exceeded", trace.WithAttributes(
+					attrs.ClientID.String(client),
+					attribute.Int64("quota.limit", cfg.Limit),
+					attribute.Int64("quota.used", used),
+				))
+				c.Locals(rejectedKey{}, RejectQuota)
+				return apperr.New(apperr.RateLimited, "quota exceeded", nil)
+			}
+			return c.Next()
+		}()
+
+		clientDuration.WithLabelValues(client).Observe(time.Since(start).Seconds())
+		clientRequests.WithLabelValues(client, strconv.Itoa(StatusCode(c, err)/100)+"xx").Inc()
+		return err
+	}
+}
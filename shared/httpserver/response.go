@@ -0,0 +1,66 @@
+package httpserver
+
+import (
+	"strings"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorResponse is the body of every failed request. Code is the apperr code, the same
+// one errors_total and the request's log line carry, so a failure seen by a client can
+// be found in Loki by code, trace ID or request ID.
+type ErrorResponse struct {
+	Code      apperr.Code `json:"code"`
+	Message   string      `json:"message"`
+	TraceID   string      `json:"trace_id,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// NewErrorResponse builds the response for e in the request c is handling.
+func NewErrorResponse(c *fiber.Ctx, e *apperr.Error) ErrorResponse {
+	resp := ErrorResponse{
+		Code:      e.Code,
+		Message:   e.Message,
+		RequestID: c.GetRespHeader(fiber.HeaderXRequestID),
+	}
+	if sc := trace.SpanContextFromContext(c.UserContext()); sc.IsValid() {
+		resp.TraceID = sc.TraceID().String()
+	}
+	return resp
+}
+
+// String renders r as one logfmt-style line, for clients that asked for text.
+func (r ErrorResponse) String() string {
+	var b strings.Builder
+	b.WriteString("code=" + string(r.Code))
+	b.WriteString(" message=" + quote(r.Message))
+	if r.TraceID != "" {
+		b.WriteString(" trace_id=" + r.TraceID)
+	}
+	if r.RequestID != "" {
+		b.WriteString(" request_id=" + r.RequestID)
+	}
+	return b.String()
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \"=") {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+	return s
+}
+
+// WriteError answers with e's status and an ErrorResponse, as JSON unless the Accept
+// header prefers plain text. Clients that accept neither still get JSON.
+func WriteError(c *fiber.Ctx, e *apperr.Error) error {
+	resp := NewErrorResponse(c, e)
+	c.Status(e.Status)
+	if c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextPlain) == fiber.MIMETextPlain {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(resp.String() + "\n")
+	}
+	return c.JSON(resp)
+}
@@ -0,0 +1,93 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+func TestWriteErrorNegotiation(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		accept   string
+		wantText bool
+	}{
+		{name: "no Accept", accept: ""},
+		{name: "JSON", accept: "application/json"},
+		{name: "anything", accept: "*/*"},
+		{name: "text", accept: "text/plain", wantText: true},
+		{name: "text preferred", accept: "application/json;q=0.5, text/plain", wantText: true},
+		{name: "JSON preferred", accept: "text/plain;q=0.5, application/json"},
+		{name: "neither", accept: "image/png"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(zap.NewNop())})
+			app.Use(func(c *fiber.Ctx) error {
+				c.Set(fiber.HeaderXRequestID, "req-1")
+				return c.Next()
+			})
+			app.Get("/", func(c *fiber.Ctx) error {
+				return apperr.New(apperr.NotFound, "no such user", nil)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != fiber.StatusNotFound {
+				t.Errorf("status = %d, want 404", resp.StatusCode)
+			}
+			contentType := resp.Header.Get("Content-Type")
+			if tt.wantText {
+				if !strings.HasPrefix(contentType, "text/plain") {
+					t.Errorf("Content-Type = %q, want text/plain", contentType)
+				}
+				if want := `code=not_found message="no such user" request_id=req-1` + "\n"; string(body) != want {
+					t.Errorf("body = %q, want %q", body, want)
+				}
+				return
+			}
+			if !strings.HasPrefix(contentType, "application/json") {
+				t.Errorf("Content-Type = %q, want application/json", contentType)
+			}
+			var got ErrorResponse
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("body %q: %v", body, err)
+			}
+			want := ErrorResponse{Code: apperr.NotFound, Message: "no such user", RequestID: "req-1"}
+			if got != want {
+				t.Errorf("body = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestErrorResponseString(t *testing.T) {
+	for _, tt := range []struct {
+		resp ErrorResponse
+		want string
+	}{
+		{resp: ErrorResponse{Code: apperr.Internal, Message: "boom"}, want: "code=internal message=boom"},
+		{resp: ErrorResponse{Code: apperr.Internal, Message: ""}, want: `code=internal message=""`},
+		{resp: ErrorResponse{Code: apperr.InvalidInput, Message: `bad "x"`}, want: `code=invalid_input message="bad \"x\""`},
+		{resp: ErrorResponse{Code: apperr.Timeout, Message: "a=b", TraceID: "t1", RequestID: "r1"}, want: `code=timeout message="a=b" trace_id=t1 request_id=r1`},
+	} {
+		if got := tt.resp.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
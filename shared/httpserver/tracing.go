@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing continues the caller's trace from the request headers and handles the request
+// under a server span with the current HTTP semantic-convention attributes, which is
+// what Tempo pairs with the caller's client span for the service graph. The span is
+// named "<method> <route>" once the route is known. Errors returned by the handlers are
+// turned into the response here, so the span records the final status code, is marked
+// failed on a 5xx and carries the code of an *apperr.Error as error.type.
+func Tracing(tracer trace.Tracer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), propagation.HeaderCarrier(c.GetReqHeaders()))
+
+		// Fiber's strings point into buffers reused after the request, and the span outlives it
+		req := telemetry.HTTPRequest{
+			Method:          c.Method(),
+			Scheme:          c.Protocol(),
+			Path:            strings.Clone(c.Path()),
+			Host:            string(c.Request().Host()),
+			UserAgent:       strings.Clone(c.Get(fiber.HeaderUserAgent)),
+			ClientAddress:   strings.Clone(c.IP()),
+			ProtocolVersion: strings.TrimPrefix(string(c.Request().Header.Protocol()), "HTTP/"),
+		}
+		ctx, span := tracer.Start(ctx, c.Method()+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(req.Attributes()...),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		// Run the error handler inside the span rather than after the chain unwinds, so the
+		// span is finished from the response the client actually gets
+		var appErr *apperr.Error
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+			errors.As(err, &appErr)
+		}
+
+		route := c.Route().Path
+		if Unmatched(c) {
+			route = UnmatchedPath
+		}
+		status := c.Response().StatusCode()
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(telemetry.HTTPResponse(route, status)...)
+		description := http.StatusText(status)
+		if appErr != nil {
+			span.SetAttributes(telemetry.ErrorType(string(appErr.Code)))
+			description = appErr.Message
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, description)
+		}
+		return nil
+	}
+}
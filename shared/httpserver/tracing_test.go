@@ -0,0 +1,76 @@
+package httpserver
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daanielsharon/observability-go/shared/apperr"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+func TestTracingStatusFromResponse(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		path        string
+		wantName    string
+		wantStatus  int64
+		wantCode    codes.Code
+		wantDesc    string
+		wantErrType string
+	}{
+		{name: "ok", path: "/users/1", wantName: "GET /users/:id", wantStatus: 200, wantCode: codes.Unset},
+		{name: "app error 5xx", path: "/fail", wantName: "GET /fail", wantStatus: 500, wantCode: codes.Error, wantDesc: "database down", wantErrType: "internal"},
+		{name: "app error 4xx", path: "/missing", wantName: "GET /missing", wantStatus: 404, wantCode: codes.Unset, wantErrType: "not_found"},
+		{name: "status set by the handler", path: "/busy", wantName: "GET /busy", wantStatus: 503, wantCode: codes.Error, wantDesc: "Service Unavailable", wantErrType: "503"},
+		{name: "unmatched", path: "/nope", wantName: "GET " + UnmatchedPath, wantStatus: 404, wantCode: codes.Unset},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			defer tp.Shutdown(context.Background())
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(zap.NewNop())})
+			app.Use(Tracing(tp.Tracer("test")))
+			app.Get("/users/:id", func(c *fiber.Ctx) error { return c.SendString("ok") })
+			app.Get("/fail", func(c *fiber.Ctx) error { return apperr.New(apperr.Internal, "database down", nil) })
+			app.Get("/missing", func(c *fiber.Ctx) error { return apperr.New(apperr.NotFound, "no such user", nil) })
+			app.Get("/busy", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusServiceUnavailable) })
+			app.Use(NotFound)
+
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			spans := exporter.GetSpans()
+			if len(spans) == 0 {
+				t.Fatal("no span recorded")
+			}
+			span := spans[len(spans)-1]
+			if span.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", span.Name, tt.wantName)
+			}
+			attrs := map[attribute.Key]attribute.Value{}
+			for _, kv := range span.Attributes {
+				attrs[kv.Key] = kv.Value
+			}
+			if got := attrs["http.response.status_code"].AsInt64(); got != tt.wantStatus {
+				t.Errorf("http.response.status_code = %d, want %d", got, tt.wantStatus)
+			}
+			if got := attrs["error.type"].AsString(); got != tt.wantErrType {
+				t.Errorf("error.type = %q, want %q", got, tt.wantErrType)
+			}
+			if span.Status.Code != tt.wantCode || (tt.wantDesc != "" && span.Status.Description != tt.wantDesc) {
+				t.Errorf("status = %v %q, want %v %q", span.Status.Code, span.Status.Description, tt.wantCode, tt.wantDesc)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Package id generates the identifiers given to requests and messages. They are
+// UUIDv7: time-ordered, so IDs sort like the logs they appear in and reveal when
+// the request or message was created.
+package id
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// New returns a new UUIDv7 string.
+func New() string {
+	u, err := uuid.NewV7()
+	if err != nil {
+		// Only fails when the random source does; a v4 is still unique
+		return uuid.NewString()
+	}
+	return u.String()
+}
+
+// Time returns when a UUIDv7 was generated, to the millisecond. ok is false for
+// anything that isn't a UUIDv7, such as IDs set by other producers.
+func Time(s string) (t time.Time, ok bool) {
+	u, err := uuid.Parse(s)
+	if err != nil || u.Version() != 7 {
+		return time.Time{}, false
+	}
+	sec, nsec := u.Time().UnixTime()
+	return time.Unix(sec, nsec), true
+}
@@ -0,0 +1,40 @@
+package ring
+
+import "sync"
+
+// Ring keeps the last n values added to it. It is safe for concurrent use.
+type Ring[T any] struct {
+	mu     sync.Mutex
+	values []T
+	next   int
+	full   bool
+}
+
+func New[T any](n int) *Ring[T] {
+	return &Ring[T]{values: make([]T, n)}
+}
+
+func (r *Ring[T]) Add(v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[r.next] = v
+	r.next = (r.next + 1) % len(r.values)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Snapshot returns the values, newest first.
+func (r *Ring[T]) Snapshot() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.values)
+	}
+	out := make([]T, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.values[(r.next-i+len(r.values))%len(r.values)])
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Curve gives the request rate to aim for at a point in time.
+type Curve interface {
+	Rate(t time.Time) float64
+}
+
+// Constant is a flat rate.
+type Constant float64
+
+func (c Constant) Rate(time.Time) float64 { return float64(c) }
+
+// Day is a day's traffic: a cosine from Low at the quietest hour, twelve hours from
+// PeakHour, up to Peak at PeakHour.
+type Day struct {
+	Low  float64 `json:"low"`
+	Peak float64 `json:"peak"`
+	// PeakHour is the busiest time of day, in hours since midnight, e.g. 14.5 for 2:30pm.
+	PeakHour float64 `json:"peak_hour"`
+}
+
+func (d Day) rate(hour float64) float64 {
+	// 1 at the peak, 0 twelve hours away from it
+	shape := (1 + math.Cos(2*math.Pi*(hour-d.PeakHour)/24)) / 2
+	return d.Low + (d.Peak-d.Low)*shape
+}
+
+// Burst multiplies the rate for a window every day, e.g. a lunchtime rush.
+type Burst struct {
+	// At is when the window opens, as "15:04".
+	At      string  `json:"at"`
+	Minutes float64 `json:"minutes"`
+	Factor  float64 `json:"factor"`
+}
+
+// Profile is a weekly traffic shape: a daily curve for weekdays, optionally a different
+// one for weekends, and bursts on top. Times are read in the location of the time passed
+// to Rate.
+type Profile struct {
+	Weekday Day `json:"weekday"`
+	// Weekend is used on Saturday and Sunday; nil means weekends look like weekdays.
+	Weekend *Day    `json:"weekend,omitempty"`
+	Bursts  []Burst `json:"bursts,omitempty"`
+}
+
+// Validate checks the rates and burst windows.
+func (p *Profile) Validate() error {
+	days := []Day{p.Weekday}
+	if p.Weekend != nil {
+		days = append(days, *p.Weekend)
+	}
+	for _, d := range days {
+		if d.Low < 0 || d.Peak < d.Low {
+			return fmt.Errorf("profile rates need 0 <= low <= peak, got low %v, peak %v", d.Low, d.Peak)
+		}
+		if d.PeakHour < 0 || d.PeakHour >= 24 {
+			return fmt.Errorf("profile peak_hour %v is not within a day", d.PeakHour)
+		}
+	}
+	for _, b := range p.Bursts {
+		if _, err := time.Parse("15:04", b.At); err != nil {
+			return fmt.Errorf("burst at %q: want a time such as 12:30", b.At)
+		}
+		if b.Minutes <= 0 || b.Factor < 0 {
+			return errors.New("bursts need positive minutes and a factor of at least 0")
+		}
+	}
+	return nil
+}
+
+func (p *Profile) Rate(t time.Time) float64 {
+	day := p.Weekday
+	if wd := t.Weekday(); p.Weekend != nil && (wd == time.Saturday || wd == time.Sunday) {
+		day = *p.Weekend
+	}
+	minute := float64(t.Hour()*60+t.Minute()) + float64(t.Second())/60
+	rate := day.rate(minute / 60)
+
+	for _, b := range p.Bursts {
+		at, err := time.Parse("15:04", b.At)
+		if err != nil {
+			continue
+		}
+		start := float64(at.Hour()*60 + at.Minute())
+		// Windows may run past midnight
+		if since := math.Mod(minute-start+24*60, 24*60); since < b.Minutes {
+			rate *= b.Factor
+		}
+	}
+	return rate
+}
+
+// Accelerate plays c faster than real time from start, e.g. 96 to go through a day in
+// fifteen minutes, so a demo shows a whole day's shape.
+func Accelerate(c Curve, start time.Time, factor float64) Curve {
+	return accelerated{curve: c, start: start, factor: factor}
+}
+
+type accelerated struct {
+	curve  Curve
+	start  time.Time
+	factor float64
+}
+
+func (a accelerated) Rate(t time.Time) float64 {
+	elapsed := t.Sub(a.start)
+	return a.curve.Rate(a.start.Add(time.Duration(float64(elapsed) * a.factor)))
+}
@@ -0,0 +1,165 @@
+// Package loadgen sends steady synthetic traffic to a service, at a rate that can be
+// changed while it runs. Every request starts its own trace.
+package loadgen
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaxInFlight caps concurrent requests; ticks beyond it are dropped rather than queued,
+// so a slow target sees the configured rate instead of a burst when it recovers.
+const MaxInFlight = 64
+
+// Generator sends GET requests to a target, cycling through its paths.
+type Generator struct {
+	target string
+	client *http.Client
+
+	mu     sync.Mutex
+	curve  Curve
+	paths  []string
+	attrs  []attribute.KeyValue
+	next   int
+	counts map[string]int
+}
+
+// New returns a Generator for the target base URL, e.g. http://app:8080. It sends
+// nothing until Set gives it a rate.
+func New(target string, client *http.Client) *Generator {
+	return &Generator{target: target, client: client, counts: make(map[string]int)}
+}
+
+// Set changes to a steady rate and the given paths. The attributes are added to the
+// span of every request sent from now on; rps <= 0 pauses the load.
+func (g *Generator) Set(rps float64, paths []string, attrs ...attribute.KeyValue) {
+	g.SetCurve(Constant(rps), paths, attrs...)
+}
+
+// SetCurve is Set with a rate that follows the curve.
+func (g *Generator) SetCurve(c Curve, paths []string, attrs ...attribute.KeyValue) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.curve = c
+	g.paths = paths
+	g.attrs = attrs
+}
+
+// Rate is the rate the generator is currently aiming for.
+func (g *Generator) Rate() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.curve == nil {
+		return 0
+	}
+	return g.curve.Rate(time.Now())
+}
+
+// Counts returns how many requests ended with each outcome: a status code, "error" or "dropped".
+func (g *Generator) Counts() map[string]int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	counts := make(map[string]int, len(g.counts))
+	for k, v := range g.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// Run sends requests until ctx is done, then waits for those in flight.
+func (g *Generator) Run(ctx context.Context) {
+	sem := make(chan struct{}, MaxInFlight)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		path, attrs, wait := g.tick()
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		if path == "" {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			g.record("dropped")
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			g.send(ctx, path, attrs)
+		}()
+	}
+}
+
+// tick picks the next path and how long to wait before sending it; an empty path
+// means the load is paused and the rate should be checked again after wait.
+func (g *Generator) tick() (string, []attribute.KeyValue, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var rps float64
+	if g.curve != nil {
+		rps = g.curve.Rate(time.Now())
+	}
+	if rps <= 0 || len(g.paths) == 0 {
+		return "", nil, 100 * time.Millisecond
+	}
+	path := g.paths[g.next%len(g.paths)]
+	g.next++
+	return path, g.attrs, time.Duration(float64(time.Second) / rps)
+}
+
+func (g *Generator) send(ctx context.Context, path string, attrs []attribute.KeyValue) {
+	ctx, span := otel.Tracer("loadgen").Start(ctx, "Load Request",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("http.request.method", http.MethodGet),
+			attribute.String("url.path", path),
+		),
+		trace.WithAttributes(attrs...))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.target+path, nil)
+	if err != nil {
+		g.record("error")
+		return
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		// Requests cut off by the end of the run aren't failures of the target
+		if ctx.Err() == nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			g.record("error")
+		}
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	g.record(strconv.Itoa(resp.StatusCode))
+}
+
+func (g *Generator) record(outcome string) {
+	g.mu.Lock()
+	g.counts[outcome]++
+	g.mu.Unlock()
+}
@@ -0,0 +1,191 @@
+// Package lock is a Redis lock for work that must run on one replica at a time. A held
+// lock is a lease that renews itself; if a renewal fails the lease is lost, its context
+// is cancelled and the loss is logged, since another replica may now take the lock.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	acquisitionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lock_acquisitions_total",
+		Help: "Lock acquisition attempts, by lock and result (acquired, contended, error).",
+	}, []string{"lock", "result"})
+	acquireDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lock_acquire_duration_seconds",
+		Help:    "Time to try for a lock, by lock.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}, []string{"lock"})
+	heldDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lock_held_seconds",
+		Help:    "How long a lock was held, by lock and how it ended (released, lost).",
+		Buckets: prometheus.ExponentialBuckets(.01, 4, 10),
+	}, []string{"lock", "end"})
+	lostTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lock_lost_total",
+		Help: "Held locks that could not be renewed and may have been taken by another replica.",
+	}, []string{"lock"})
+	held = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lock_held",
+		Help: "1 while this process holds the lock.",
+	}, []string{"lock"})
+)
+
+// Only the holder may renew or release: both compare the stored token first.
+var (
+	renewScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Lock is a named lock shared by every process using the same Redis.
+type Lock struct {
+	name   string
+	client *redis.Client
+	ttl    time.Duration
+	log    *zap.Logger
+	tracer trace.Tracer
+}
+
+// New returns the lock called name. A holder that stops renewing loses it after ttl.
+func New(name string, client *redis.Client, ttl time.Duration, log *zap.Logger) *Lock {
+	return &Lock{name: name, client: client, ttl: ttl, log: log, tracer: otel.Tracer("lock")}
+}
+
+// TryAcquire takes the lock if it is free. It returns a nil Lease, and no error, when
+// another holder has it.
+func (l *Lock) TryAcquire(ctx context.Context) (*Lease, error) {
+	// The lease outlives the acquire span; a loss is reported on the caller's span
+	parent := ctx
+	ctx, span := l.tracer.Start(ctx, "lock.acquire "+l.name, trace.WithAttributes(
+		attribute.String("lock.name", l.name),
+		attribute.Int64("lock.ttl_ms", l.ttl.Milliseconds()),
+	))
+	defer span.End()
+	start := time.Now()
+
+	token := newToken()
+	ok, err := l.client.SetNX(ctx, l.key(), token, l.ttl).Result()
+	acquireDuration.WithLabelValues(l.name).Observe(time.Since(start).Seconds())
+	switch {
+	case err != nil:
+		acquisitionsTotal.WithLabelValues(l.name, "error").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	case !ok:
+		acquisitionsTotal.WithLabelValues(l.name, "contended").Inc()
+		span.SetAttributes(attribute.Bool("lock.acquired", false))
+		return nil, nil
+	}
+	acquisitionsTotal.WithLabelValues(l.name, "acquired").Inc()
+	span.SetAttributes(attribute.Bool("lock.acquired", true))
+	held.WithLabelValues(l.name).Set(1)
+
+	leaseCtx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	lease := &Lease{lock: l, token: token, acquired: time.Now(), ctx: leaseCtx, cancel: cancel, done: make(chan struct{})}
+	go lease.renew()
+	return lease, nil
+}
+
+func (l *Lock) key() string {
+	return "lock:" + l.name
+}
+
+// Lease is a held lock.
+type Lease struct {
+	lock     *Lock
+	token    string
+	acquired time.Time
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	wasLost  atomic.Bool
+}
+
+// Context is cancelled when the lease is released or lost; work done under the lock
+// should use it so it stops once the lock is no longer ours.
+func (le *Lease) Context() context.Context {
+	return le.ctx
+}
+
+// renew extends the lease every third of the TTL until it is released or lost.
+func (le *Lease) renew() {
+	defer close(le.done)
+	l := le.lock
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-le.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		n, err := renewScript.Run(ctx, l.client, []string{l.key()}, le.token, l.ttl.Milliseconds()).Int()
+		cancel()
+		if err == nil && n == 1 {
+			continue
+		}
+		if err == nil {
+			err = errors.New("lock taken over or expired")
+		}
+		le.lost(err)
+		return
+	}
+}
+
+func (le *Lease) lost(err error) {
+	l := le.lock
+	lostTotal.WithLabelValues(l.name).Inc()
+	held.WithLabelValues(l.name).Set(0)
+	heldDuration.WithLabelValues(l.name, "lost").Observe(time.Since(le.acquired).Seconds())
+	trace.SpanFromContext(le.ctx).AddEvent("lock.lost", trace.WithAttributes(
+		attribute.String("lock.name", l.name),
+		attribute.String("error.message", err.Error()),
+	))
+	le.wasLost.Store(true)
+	l.log.Warn("lock lost; another replica may now hold it", zap.String("lock", l.name),
+		zap.Duration("held", time.Since(le.acquired)), zap.Error(err))
+	le.cancel()
+}
+
+// Release gives the lock up. Releasing a lost lease does nothing.
+func (le *Lease) Release(ctx context.Context) error {
+	le.cancel()
+	<-le.done
+	if le.wasLost.Load() {
+		return nil
+	}
+
+	l := le.lock
+	held.WithLabelValues(l.name).Set(0)
+	heldDuration.WithLabelValues(l.name, "released").Observe(time.Since(le.acquired).Seconds())
+	return releaseScript.Run(ctx, l.client, []string{l.key()}, le.token).Err()
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
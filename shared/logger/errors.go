@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/internal/ring"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultRecentErrors is how many error entries are kept unless LOG_RECENT_ERRORS says otherwise.
+const DefaultRecentErrors = 100
+
+// ErrorEntry is an error-level log entry kept for GET /debug/errors.
+type ErrorEntry struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Logger  string         `json:"logger,omitempty"`
+	Caller  string         `json:"caller,omitempty"`
+	Message string         `json:"message"`
+	TraceID string         `json:"trace_id,omitempty"`
+	SpanID  string         `json:"span_id,omitempty"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+var recentErrors = ring.New[ErrorEntry](recentErrorsSize())
+
+func recentErrorsSize() int {
+	if n, err := strconv.Atoi(os.Getenv("LOG_RECENT_ERRORS")); err == nil && n > 0 {
+		return n
+	}
+	return DefaultRecentErrors
+}
+
+// RecentErrors returns the last error log entries of this process, newest first.
+func RecentErrors() []ErrorEntry {
+	return recentErrors.Snapshot()
+}
+
+// ErrorsHandler serves RecentErrors as JSON.
+func ErrorsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(RecentErrors())
+	})
+}
+
+// errorCore is a zapcore.Core feeding error entries, with their fields, into the ring.
+type errorCore struct {
+	fields []zapcore.Field
+}
+
+func (c *errorCore) Enabled(l zapcore.Level) bool {
+	return l >= zapcore.ErrorLevel
+}
+
+func (c *errorCore) With(fields []zapcore.Field) zapcore.Core {
+	return &errorCore{fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *errorCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *errorCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	entry := ErrorEntry{
+		Time:    e.Time,
+		Level:   e.Level.String(),
+		Logger:  e.LoggerName,
+		Message: e.Message,
+		Fields:  enc.Fields,
+	}
+	if e.Caller.Defined {
+		entry.Caller = e.Caller.TrimmedPath()
+	}
+	entry.TraceID, _ = enc.Fields["trace_id"].(string)
+	entry.SpanID, _ = enc.Fields["span_id"].(string)
+	delete(enc.Fields, "trace_id")
+	delete(enc.Fields, "span_id")
+
+	recentErrors.Add(entry)
+	return nil
+}
+
+func (c *errorCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,238 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/logsink"
+	"github.com/daanielsharon/observability-go/shared/telemetry"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Logger is a configured logger with its own sinks and minimum level. Several can
+// live in one process; the one passed to SetGlobal (New does this) is the default.
+type Logger struct {
+	*zap.Logger
+	// level is the minimum level for every sink, adjustable at runtime through LevelHandler
+	level zap.AtomicLevel
+}
+
+// LevelHandler serves l's minimum log level on GET and changes it on PUT, e.g.
+// {"level":"warn"}; the file sink never goes below info.
+func (l *Logger) LevelHandler() http.Handler {
+	return l.level
+}
+
+var (
+	global atomic.Pointer[Logger]
+
+	fallbackOnce sync.Once
+	fallback     *Logger
+)
+
+// SetGlobal makes l the process logger: the one FromContext and WithTrace fall back to,
+// and the zap global.
+func SetGlobal(l *Logger) {
+	global.Store(l)
+	zap.ReplaceGlobals(l.Logger)
+}
+
+// Global returns the process logger. Before SetGlobal or New it is a stderr logger that
+// warns, once, that logging was used before it was set up, rather than dropping entries.
+func Global() *Logger {
+	if l := global.Load(); l != nil {
+		return l
+	}
+	fallbackOnce.Do(func() {
+		level := zap.NewAtomicLevelAt(zap.InfoLevel)
+		core := zapcore.NewCore(zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.Lock(os.Stderr), level)
+		fallback = &Logger{Logger: zap.New(core, zap.AddCaller()), level: level}
+		fallback.Warn("logger used before logger.New; writing to stderr")
+	})
+	return fallback
+}
+
+type options struct {
+	name string
+	dir  string
+}
+
+type Option func(*options)
+
+// WithName names the logger, e.g. after the service, so entries carry a "logger" field.
+func WithName(name string) Option {
+	return func(o *options) { o.name = name }
+}
+
+// WithDir sets the directory for the rotated log file (default LOG_DIR, or /var/log).
+func WithDir(dir string) Option {
+	return func(o *options) { o.dir = dir }
+}
+
+// New builds the process logger with Build and makes it the global, the zap global and
+// the logger WithTrace derives from. A second call replaces the global.
+func New(logFilename string, opts ...Option) *zap.Logger {
+	l := Build(logFilename, opts...)
+	SetGlobal(l)
+	return l.Logger
+}
+
+// Build makes a logger writing JSON to a rotated file under the log directory and
+// console output to stdout, both asynchronously. It leaves the global alone, so
+// components can have loggers of their own.
+func Build(logFilename string, opts ...Option) *Logger {
+	o := options{dir: "/var/log"}
+	if dir := os.Getenv("LOG_DIR"); dir != "" {
+		o.dir = dir
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Ensure log directory exists and compute log file path
+	logFile := filepath.Join(o.dir, logFilename)
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		panic(err)
+	}
+
+	config := zapcore.EncoderConfig{
+		TimeKey:        "ts",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		FunctionKey:    "",
+		MessageKey:     "msg",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     "\n",
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.MillisDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+
+	// Konfigurasi rotasi log
+	lumberjackLogger := &lumberjack.Logger{
+		Filename:   logFile,
+		MaxSize:    10,   // MB
+		MaxBackups: 3,    // Jumlah file backup
+		MaxAge:     28,   // Hari
+		Compress:   true, // Kompres file lama
+	}
+
+	// Write asynchronously so a slow disk or stdout doesn't block request handling
+	fileSink := logsink.NewAsync("file", zapcore.AddSync(lumberjackLogger), logsink.DefaultBufferSize, logsink.DefaultFlushInterval)
+	consoleSink := logsink.NewAsync("stdout", zapcore.AddSync(os.Stdout), logsink.DefaultBufferSize, logsink.DefaultFlushInterval)
+
+	level := zap.NewAtomicLevelAt(zap.DebugLevel)
+
+	// Buat core untuk file dan console
+	core := zapcore.NewTee(
+		// File output dengan format JSON
+		zapcore.NewCore(
+			zapcore.NewJSONEncoder(config),
+			fileSink,
+			zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+				return l >= zap.InfoLevel && level.Enabled(l)
+			}),
+		),
+		// Console output
+		zapcore.NewCore(
+			zapcore.NewConsoleEncoder(config),
+			consoleSink,
+			level,
+		),
+		// Last error entries for GET /debug/errors
+		&errorCore{},
+	)
+
+	// Buat logger dengan caller info dan stacktrace
+	id := telemetry.IdentityFromEnv()
+	logger := zap.New(
+		core,
+		zap.AddCaller(),
+		zap.AddStacktrace(zap.ErrorLevel),
+		zap.Fields(id.LogFields()...),
+		zap.Hooks(MetricsHook(id.ServiceName)),
+	)
+	if o.name != "" {
+		logger = logger.Named(o.name)
+	}
+
+	// Log startup message
+	logger.Info("Logger initialized",
+		zap.String("log_file", logFile),
+		zap.Time("startup_time", time.Now().UTC()),
+	)
+
+	return &Logger{Logger: logger, level: level}
+}
+
+// LevelHandler is the global logger's LevelHandler, looked up on every request so it
+// follows SetGlobal.
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Global().LevelHandler().ServeHTTP(w, r)
+	})
+}
+
+type ctxKey struct{}
+
+// IntoContext returns a copy of ctx carrying l as the request- or message-scoped logger.
+func IntoContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger stored by IntoContext, or the process logger if there
+// is none. A nil ctx is allowed.
+func FromContext(ctx context.Context) *zap.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok && l != nil {
+			return l
+		}
+	}
+	return Global().Logger
+}
+
+// WithTrace returns the logger from ctx with trace context fields.
+// If spanId is empty, the span_id field will be omitted from the log entry.
+// The fields are only built for entries that get written, so a logger obtained for
+// a disabled level, or never used, costs just the wrapping.
+func WithTrace(ctx context.Context, spanId string) *zap.Logger {
+	l := FromContext(ctx)
+	if ctx == nil {
+		return l
+	}
+	span := trace.SpanFromContext(ctx)
+	traced := span.SpanContext().IsValid()
+
+	// Route policies may raise the log level for noisy routes
+	p, ok := telemetry.RoutePolicyFromContext(ctx)
+	raise := ok && p.LogLevel != nil
+
+	switch {
+	case traced && raise:
+		return l.WithOptions(zap.IncreaseLevel(*p.LogLevel), traceOption(span, spanId))
+	case traced:
+		return l.WithOptions(traceOption(span, spanId))
+	case raise:
+		return l.WithOptions(zap.IncreaseLevel(*p.LogLevel))
+	}
+	return l
+}
+
+// traceOption wraps the core in a spanCore, which adds the trace fields and links
+// error entries to the span.
+func traceOption(span trace.Span, spanID string) zap.Option {
+	return zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &spanCore{Core: c, span: span, spanID: spanID}
+	})
+}
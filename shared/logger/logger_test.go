@@ -0,0 +1,257 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// resetGlobal clears the process logger for the test and restores it afterwards.
+func resetGlobal(t *testing.T) {
+	t.Helper()
+	prev := global.Load()
+	global.Store(nil)
+	t.Cleanup(func() { global.Store(prev) })
+}
+
+// observe swaps l's sinks for an observer, keeping its name and fields.
+func observe(l *zap.Logger) (*zap.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return l.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core { return core })), logs
+}
+
+// fileEntries reads the JSON entries of the file sink.
+func fileEntries(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []map[string]any
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("file sink line %q: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func messages(entries []map[string]any) map[string]map[string]any {
+	byMsg := make(map[string]map[string]any, len(entries))
+	for _, e := range entries {
+		byMsg[e["msg"].(string)] = e
+	}
+	return byMsg
+}
+
+func TestBuildNaming(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "unnamed", want: ""},
+		{name: "named", opts: []Option{WithName("consumer-1")}, want: "consumer-1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobal(t)
+			l := Build("test.log", append(tt.opts, WithDir(t.TempDir()))...)
+			obs, logs := observe(l.Logger)
+			obs.Info("hello")
+
+			entries := logs.All()
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			if entries[0].LoggerName != tt.want {
+				t.Errorf("logger name = %q, want %q", entries[0].LoggerName, tt.want)
+			}
+			// Build leaves the global alone
+			if global.Load() != nil {
+				t.Errorf("Build set the global logger")
+			}
+		})
+	}
+}
+
+func TestNewSetsGlobal(t *testing.T) {
+	resetGlobal(t)
+	prevZap := zap.L()
+	t.Cleanup(func() { zap.ReplaceGlobals(prevZap) })
+
+	l := New("test.log", WithName("app"), WithDir(t.TempDir()))
+	if Global().Logger != l {
+		t.Errorf("Global() is not the logger New returned")
+	}
+	if zap.L() != l {
+		t.Errorf("zap.L() is not the logger New returned")
+	}
+	if FromContext(context.Background()) != l {
+		t.Errorf("FromContext without a logger is not the global")
+	}
+}
+
+func TestFallbackWithoutGlobal(t *testing.T) {
+	resetGlobal(t)
+
+	fb := Global()
+	if fb == nil || fb.Logger == nil {
+		t.Fatal("Global() before New returned no logger")
+	}
+	if Global() != fb {
+		t.Errorf("Global() built a second fallback")
+	}
+	if !fb.Core().Enabled(zapcore.InfoLevel) || fb.Core().Enabled(zapcore.DebugLevel) {
+		t.Errorf("fallback should log at info and above")
+	}
+	//nolint:staticcheck // a nil context is documented as allowed
+	if FromContext(nil) != fb.Logger {
+		t.Errorf("FromContext(nil) is not the fallback")
+	}
+
+	// A logger in the context wins over the fallback, with or without a span
+	obs, logs := observe(zap.NewNop())
+	ctx := IntoContext(context.Background(), obs)
+	WithTrace(ctx, "").Info("from context")
+	WithTrace(tracedContext(obs), "0102030405060708").Info("traced")
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if fields := entries[1].ContextMap(); fields["trace_id"] != "0102030405060708090a0b0c0d0e0f10" || fields["span_id"] != "0102030405060708" {
+		t.Errorf("traced entry fields = %v, want trace_id and span_id", fields)
+	}
+}
+
+func TestBuildSinks(t *testing.T) {
+	resetGlobal(t)
+	dir := t.TempDir()
+	t.Setenv("LOG_DIR", dir)
+
+	l := Build("svc/app.log", WithName("svc"))
+	l.Debug("debug entry")
+	l.Info("info entry")
+	l.Error("error entry")
+	_ = l.Sync()
+
+	// LOG_DIR is the default directory, and subdirectories of the file name are created
+	byMsg := messages(fileEntries(t, filepath.Join(dir, "svc", "app.log")))
+	if _, ok := byMsg["debug entry"]; ok {
+		t.Errorf("file sink wrote a debug entry; it starts at info")
+	}
+	for _, msg := range []string{"Logger initialized", "info entry", "error entry"} {
+		e, ok := byMsg[msg]
+		if !ok {
+			t.Errorf("file sink is missing %q", msg)
+			continue
+		}
+		if e["logger"] != "svc" {
+			t.Errorf("%q logger = %v, want svc", msg, e["logger"])
+		}
+	}
+	if _, ok := byMsg["error entry"]["stacktrace"]; !ok {
+		t.Errorf("error entry has no stacktrace")
+	}
+
+	// WithDir overrides LOG_DIR
+	other := t.TempDir()
+	l = Build("app.log", WithDir(other))
+	l.Info("elsewhere")
+	_ = l.Sync()
+	if _, ok := messages(fileEntries(t, filepath.Join(other, "app.log")))["elsewhere"]; !ok {
+		t.Errorf("WithDir did not move the file sink")
+	}
+}
+
+func TestLevelFollowsLevelHandler(t *testing.T) {
+	resetGlobal(t)
+	dir := t.TempDir()
+	l := Build("app.log", WithDir(dir))
+
+	l.level.SetLevel(zapcore.WarnLevel)
+	l.Info("suppressed")
+	l.Warn("kept")
+	_ = l.Sync()
+
+	byMsg := messages(fileEntries(t, filepath.Join(dir, "app.log")))
+	if _, ok := byMsg["suppressed"]; ok {
+		t.Errorf("info entry written below the warn level")
+	}
+	if _, ok := byMsg["kept"]; !ok {
+		t.Errorf("warn entry missing")
+	}
+}
+
+// discardLogger has the sinks Build makes, a JSON and a console encoder, writing nowhere.
+func discardLogger(level zapcore.Level) *zap.Logger {
+	enc := zap.NewProductionEncoderConfig()
+	core := zapcore.NewTee(
+		zapcore.NewCore(zapcore.NewJSONEncoder(enc), zapcore.AddSync(io.Discard), level),
+		zapcore.NewCore(zapcore.NewConsoleEncoder(enc), zapcore.AddSync(io.Discard), level),
+	)
+	return zap.New(core, zap.Fields(zap.String("service", "bench")))
+}
+
+func tracedContext(l *zap.Logger) context.Context {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	})
+	return IntoContext(trace.ContextWithSpanContext(context.Background(), sc), l)
+}
+
+// BenchmarkWithTrace compares WithTrace, which adds the trace fields in the span core
+// when an entry is written, with cloning the logger through With as it used to.
+func BenchmarkWithTrace(b *testing.B) {
+	const spanID = "0102030405060708"
+
+	b.Run("lazy", func(b *testing.B) {
+		ctx := tracedContext(discardLogger(zapcore.InfoLevel))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			WithTrace(ctx, spanID).Info("handling request", zap.String("order_id", "o-1"))
+		}
+	})
+
+	b.Run("with", func(b *testing.B) {
+		ctx := tracedContext(discardLogger(zapcore.InfoLevel))
+		traceID := trace.SpanContextFromContext(ctx).TraceID().String()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			FromContext(ctx).With(zap.String("trace_id", traceID), zap.String("span_id", spanID)).
+				Info("handling request", zap.String("order_id", "o-1"))
+		}
+	})
+
+	b.Run("lazy_disabled", func(b *testing.B) {
+		ctx := tracedContext(discardLogger(zapcore.WarnLevel))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			WithTrace(ctx, spanID).Info("handling request", zap.String("order_id", "o-1"))
+		}
+	})
+
+	b.Run("with_disabled", func(b *testing.B) {
+		ctx := tracedContext(discardLogger(zapcore.WarnLevel))
+		traceID := trace.SpanContextFromContext(ctx).TraceID().String()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			FromContext(ctx).With(zap.String("trace_id", traceID), zap.String("span_id", spanID)).
+				Info("handling request", zap.String("order_id", "o-1"))
+		}
+	})
+}
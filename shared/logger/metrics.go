@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	logMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_messages_total",
+		Help: "Log entries written, by level and service.",
+	}, []string{"level", "service"})
+	logErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_errors_total",
+		Help: "Error-level log entries, by fingerprint of their message and call site.",
+	}, []string{"fingerprint"})
+)
+
+// MetricsHook counts every written entry in log_messages_total and error entries in
+// log_errors_total, so alerts can fire on log error rates for code paths without metrics.
+// Use it with zap.Hooks.
+func MetricsHook(service string) func(zapcore.Entry) error {
+	return func(e zapcore.Entry) error {
+		logMessages.WithLabelValues(e.Level.String(), service).Inc()
+		if e.Level >= zapcore.ErrorLevel {
+			logErrors.WithLabelValues(fingerprint(e)).Inc()
+		}
+		return nil
+	}
+}
+
+// fingerprint identifies an error by call site and message; both are fixed per log
+// statement as long as variable data goes into fields, which keeps the label bounded.
+func fingerprint(e zapcore.Entry) string {
+	h := fnv.New32a()
+	h.Write([]byte(e.Caller.TrimmedPath()))
+	h.Write([]byte(e.Message))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
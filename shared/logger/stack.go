@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxEventStack caps the stack trace copied into the span event.
+const maxEventStack = 4 << 10
+
+// spanCore adds trace_id and span_id to the entries it writes, computing them only
+// then. It also links error entries to the active span: the stacktrace block starts with
+// the trace and span IDs, and the span gets a log.error event with the (truncated)
+// stack, so a crash can be followed from Loki to Tempo and back.
+type spanCore struct {
+	zapcore.Core
+	span   trace.Span
+	spanID string
+}
+
+func (c *spanCore) With(fields []zapcore.Field) zapcore.Core {
+	return &spanCore{Core: c.Core.With(fields), span: c.span, spanID: c.spanID}
+}
+
+func (c *spanCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *spanCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	sc := c.span.SpanContext()
+	traceID := sc.TraceID().String()
+
+	// Trace fields go first, where logger.With would have put them
+	n := 1
+	if c.spanID != "" {
+		n++
+	}
+	all := make([]zapcore.Field, 0, n+len(fields))
+	all = append(all, zap.String("trace_id", traceID))
+	if c.spanID != "" {
+		all = append(all, zap.String("span_id", c.spanID))
+	}
+	all = append(all, fields...)
+
+	if e.Level >= zapcore.ErrorLevel {
+		c.linkError(&e, traceID, sc.SpanID().String())
+	}
+
+	// Re-check against the wrapped core so hooks and per-sink levels still apply
+	if ce := c.Core.Check(e, nil); ce != nil {
+		ce.Write(all...)
+	}
+	return nil
+}
+
+// linkError prefixes the stack with the trace and adds it to the span as an event.
+func (c *spanCore) linkError(e *zapcore.Entry, traceID, spanID string) {
+	if e.Stack != "" {
+		e.Stack = "trace_id=" + traceID + " span_id=" + spanID + "\n" + e.Stack
+	}
+
+	stack := e.Stack
+	if len(stack) > maxEventStack {
+		stack = stack[:maxEventStack]
+	}
+	c.span.AddEvent("log.error", trace.WithAttributes(
+		attribute.String("log.message", e.Message),
+		attribute.String("log.level", e.Level.String()),
+		attribute.String("exception.stacktrace", stack),
+	))
+}
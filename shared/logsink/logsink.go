@@ -0,0 +1,187 @@
+package logsink
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	droppedEntries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_entries_dropped_total",
+		Help: "Log entries dropped because the async log buffer was full.",
+	}, []string{"sink"})
+	writeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_sink_write_errors_total",
+		Help: "Batches of log entries the sink failed to write.",
+	}, []string{"sink"})
+	bufferedEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "log_buffer_entries",
+		Help: "Log entries waiting in the async log buffer.",
+	}, []string{"sink"})
+)
+
+const (
+	DefaultBufferSize    = 4096
+	DefaultFlushInterval = time.Second
+
+	// maxBatchBytes caps how much is written to the underlying sink in one call.
+	maxBatchBytes = 64 << 10
+)
+
+// AsyncWriter queues log entries in a bounded buffer and writes them to out from a
+// background goroutine, so logging never blocks the caller on disk or stdout.
+// When the buffer is full, entries are dropped and counted in log_entries_dropped_total.
+type AsyncWriter struct {
+	sink    string
+	out     zapcore.WriteSyncer
+	entries chan []byte
+	syncs   chan chan struct{}
+	dropped atomic.Uint64
+
+	mu          sync.Mutex
+	lastFlush   time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// Stats is the state of one async writer, for GET /debug/telemetry.
+type Stats struct {
+	Sink     string `json:"sink"`
+	Buffered int    `json:"buffered"`
+	Capacity int    `json:"capacity"`
+	Dropped  uint64 `json:"dropped"`
+	// LastFlush is when entries were last written out successfully.
+	LastFlush   *time.Time `json:"last_flush,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+var (
+	writersMu sync.Mutex
+	writers   []*AsyncWriter
+)
+
+// All reports every writer started by NewAsync.
+func All() []Stats {
+	writersMu.Lock()
+	defer writersMu.Unlock()
+	stats := make([]Stats, 0, len(writers))
+	for _, w := range writers {
+		stats = append(stats, w.Stats())
+	}
+	return stats
+}
+
+// Stats reports how full the buffer is and how the last writes went.
+func (w *AsyncWriter) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := Stats{
+		Sink:      w.sink,
+		Buffered:  len(w.entries),
+		Capacity:  cap(w.entries),
+		Dropped:   w.dropped.Load(),
+		LastError: w.lastError,
+	}
+	if !w.lastFlush.IsZero() {
+		t := w.lastFlush
+		st.LastFlush = &t
+	}
+	if !w.lastErrorAt.IsZero() {
+		t := w.lastErrorAt
+		st.LastErrorAt = &t
+	}
+	return st
+}
+
+// NewAsync starts a writer holding at most size pending entries and flushing out every flushInterval.
+// sink labels the drop counter, e.g. "file" or "stdout".
+func NewAsync(sink string, out zapcore.WriteSyncer, size int, flushInterval time.Duration) *AsyncWriter {
+	w := &AsyncWriter{
+		sink:    sink,
+		out:     out,
+		entries: make(chan []byte, size),
+		syncs:   make(chan chan struct{}),
+	}
+	droppedEntries.WithLabelValues(sink)
+	writersMu.Lock()
+	writers = append(writers, w)
+	writersMu.Unlock()
+	go w.run(flushInterval)
+	return w
+}
+
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	// zap reuses its buffer once Write returns
+	entry := append([]byte(nil), p...)
+	select {
+	case w.entries <- entry:
+	default:
+		w.dropped.Add(1)
+		droppedEntries.WithLabelValues(w.sink).Inc()
+	}
+	return len(p), nil
+}
+
+// Sync writes every queued entry and syncs the underlying sink.
+func (w *AsyncWriter) Sync() error {
+	done := make(chan struct{})
+	w.syncs <- done
+	<-done
+	return nil
+}
+
+func (w *AsyncWriter) run(flushInterval time.Duration) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch bytes.Buffer
+	flush := func() {
+		bufferedEntries.WithLabelValues(w.sink).Set(float64(len(w.entries)))
+		if batch.Len() == 0 {
+			return
+		}
+		_, err := w.out.Write(batch.Bytes())
+		batch.Reset()
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if err != nil {
+			// Nothing to log it to; the error is kept for /debug/telemetry instead
+			writeErrors.WithLabelValues(w.sink).Inc()
+			w.lastError, w.lastErrorAt = err.Error(), time.Now()
+			return
+		}
+		w.lastFlush = time.Now()
+	}
+
+	for {
+		select {
+		case p := <-w.entries:
+			batch.Write(p)
+			if batch.Len() >= maxBatchBytes {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case done := <-w.syncs:
+			for drained := false; !drained; {
+				select {
+				case p := <-w.entries:
+					batch.Write(p)
+				default:
+					drained = true
+				}
+			}
+			flush()
+			// stdout can't be synced; the error isn't worth surfacing
+			_ = w.out.Sync()
+			close(done)
+		}
+	}
+}
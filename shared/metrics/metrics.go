@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	httpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+	messagesInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_messages_in_flight",
+		Help: "Messages currently being handled by consumer workers.",
+	}, []string{"queue"})
+	workers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_workers",
+		Help: "Number of workers consuming from the queue.",
+	}, []string{"queue"})
+	workerBusySeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_worker_busy_seconds_total",
+		Help: "Time workers spent handling messages; rate() divided by consumer_workers gives utilization.",
+	}, []string{"queue"})
+)
+
+// Mirrors of the in-flight gauges, readable without going through the registry
+var inFlightRequests, inFlightMessages atomic.Int64
+
+// InFlight keeps http_requests_in_flight up to date.
+func InFlight() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		httpInFlight.Inc()
+		inFlightRequests.Add(1)
+		defer func() {
+			httpInFlight.Dec()
+			inFlightRequests.Add(-1)
+		}()
+		return c.Next()
+	}
+}
+
+// InFlightRequests returns the number of HTTP requests currently being served.
+func InFlightRequests() int64 {
+	return inFlightRequests.Load()
+}
+
+// InFlightMessages returns the number of messages currently being handled, across queues.
+func InFlightMessages() int64 {
+	return inFlightMessages.Load()
+}
+
+// QueueStats summarizes a queue's consumer for introspection endpoints.
+type QueueStats struct {
+	Workers     int     `json:"workers"`
+	InFlight    int64   `json:"in_flight"`
+	Handled     uint64  `json:"handled"`
+	BusySeconds float64 `json:"busy_seconds"`
+}
+
+var (
+	queuesMu sync.Mutex
+	queues   = make(map[string]*QueueStats)
+)
+
+func queueStats(queue string) *QueueStats {
+	q, ok := queues[queue]
+	if !ok {
+		q = &QueueStats{}
+		queues[queue] = q
+	}
+	return q
+}
+
+// Queues returns a snapshot of the stats of every queue this process consumes from.
+func Queues() map[string]QueueStats {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	snapshot := make(map[string]QueueStats, len(queues))
+	for name, q := range queues {
+		snapshot[name] = *q
+	}
+	return snapshot
+}
+
+// SetWorkers records how many workers consume from queue.
+func SetWorkers(queue string, n int) {
+	workers.WithLabelValues(queue).Set(float64(n))
+	queuesMu.Lock()
+	queueStats(queue).Workers = n
+	queuesMu.Unlock()
+}
+
+// TrackMessage marks a message as in flight until the returned func is called,
+// then adds the handling time to the worker busy counter.
+func TrackMessage(queue string) func() {
+	start := time.Now()
+	messagesInFlight.WithLabelValues(queue).Inc()
+	inFlightMessages.Add(1)
+	queuesMu.Lock()
+	queueStats(queue).InFlight++
+	queuesMu.Unlock()
+	return func() {
+		busy := time.Since(start).Seconds()
+		messagesInFlight.WithLabelValues(queue).Dec()
+		inFlightMessages.Add(-1)
+		workerBusySeconds.WithLabelValues(queue).Add(busy)
+
+		queuesMu.Lock()
+		q := queueStats(queue)
+		q.InFlight--
+		q.Handled++
+		q.BusySeconds += busy
+		queuesMu.Unlock()
+	}
+}
+
+// Serve exposes /metrics, plus any admin handlers keyed by path, on addr for services
+// without an HTTP server of their own. The returned server can be shut down for a graceful exit.
+func Serve(addr string, log *zap.Logger, handlers map[string]http.Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	for path, h := range handlers {
+		mux.Handle(path, h)
+	}
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		log.Info("serving metrics", zap.String("addr", addr))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error("metrics server failed", zap.Error(err))
+		}
+	}()
+	return srv
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// process_start_time_seconds itself comes from the default registry's process collector.
+
+var (
+	processStart = time.Now()
+	restarts     atomic.Int64
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "process_uptime_seconds",
+		Help: "Seconds since the process started.",
+	}, func() float64 { return time.Since(processStart).Seconds() })
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "process_restarts_total",
+		Help: "Times the service was started before this process, as persisted in its state file.",
+	}, func() float64 { return float64(restarts.Load()) })
+)
+
+// TrackRestarts counts this start in stateFile, which must survive container restarts
+// (e.g. on a volume), and exports the number of earlier starts as process_restarts_total.
+// An empty stateFile disables the counter.
+func TrackRestarts(stateFile string) error {
+	if stateFile == "" {
+		return nil
+	}
+
+	var starts int64
+	if b, err := os.ReadFile(stateFile); err == nil {
+		starts, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	restarts.Store(starts)
+	return os.WriteFile(stateFile, []byte(strconv.FormatInt(starts+1, 10)), 0644)
+}
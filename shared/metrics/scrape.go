@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ScrapeStats is how Prometheus has been collecting this process's metrics, for
+// GET /debug/telemetry. Metrics are pulled, so there is no export queue; a scrape that
+// stops arriving or fails to gather is how they get lost.
+type ScrapeStats struct {
+	Scrapes uint64 `json:"scrapes"`
+	// GatherErrors counts collectors that failed while building a scrape.
+	GatherErrors uint64     `json:"gather_errors"`
+	LastScrape   *time.Time `json:"last_scrape,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+}
+
+var (
+	scrapeMu     sync.Mutex
+	scrapes      uint64
+	gatherErrors uint64
+	lastScrape   time.Time
+	lastError    string
+	lastErrorAt  time.Time
+)
+
+// Handler serves /metrics like promhttp.Handler and records each scrape for Scrapes.
+func Handler() http.Handler {
+	h := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{ErrorLog: gatherLog{}}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scrapeMu.Lock()
+		scrapes++
+		lastScrape = time.Now()
+		scrapeMu.Unlock()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// gatherLog receives promhttp's gather and encoding errors.
+type gatherLog struct{}
+
+func (gatherLog) Println(v ...any) {
+	scrapeMu.Lock()
+	defer scrapeMu.Unlock()
+	gatherErrors++
+	lastError, lastErrorAt = fmt.Sprint(v...), time.Now()
+}
+
+// Scrapes reports the scrapes served by Handler.
+func Scrapes() ScrapeStats {
+	scrapeMu.Lock()
+	defer scrapeMu.Unlock()
+	st := ScrapeStats{Scrapes: scrapes, GatherErrors: gatherErrors, LastError: lastError}
+	if !lastScrape.IsZero() {
+		t := lastScrape
+		st.LastScrape = &t
+	}
+	if !lastErrorAt.IsZero() {
+		t := lastErrorAt
+		st.LastErrorAt = &t
+	}
+	return st
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// DefaultSummaryInterval is how often a Reporter logs its summary.
+const DefaultSummaryInterval = time.Minute
+
+// Reporter logs a one-line summary of the last interval (requests served, messages
+// handled, 5xx responses, error logs and p99 request latency), computed from the
+// in-process Prometheus registry, so a service can be checked without Grafana.
+// It is a runner.Service.
+type Reporter struct {
+	log      *zap.Logger
+	interval time.Duration
+	gatherer prometheus.Gatherer
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReporter reports every interval; SUMMARY_INTERVAL overrides it, and 0 disables the reporter.
+func NewReporter(log *zap.Logger, interval time.Duration) *Reporter {
+	if v, err := time.ParseDuration(os.Getenv("SUMMARY_INTERVAL")); err == nil {
+		interval = v
+	}
+	return &Reporter{log: log, interval: interval, gatherer: prometheus.DefaultGatherer}
+}
+
+func (r *Reporter) Start(ctx context.Context) error {
+	if r.interval <= 0 {
+		return nil
+	}
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		last := r.snapshot()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				now := r.snapshot()
+				r.report(last, now)
+				last = now
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Reporter) Stop(ctx context.Context) error {
+	if r.stop == nil {
+		return nil
+	}
+	close(r.stop)
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// summarySnapshot holds the cumulative values a summary is computed from.
+type summarySnapshot struct {
+	requests  uint64
+	http5xx   uint64
+	errorLogs float64
+	messages  uint64
+	// buckets are cumulative request counts by latency upper bound
+	buckets map[float64]uint64
+}
+
+func (r *Reporter) snapshot() summarySnapshot {
+	s := summarySnapshot{buckets: make(map[float64]uint64)}
+	for _, q := range Queues() {
+		s.messages += q.Handled
+	}
+
+	families, err := r.gatherer.Gather()
+	if err != nil {
+		r.log.Warn("summary: failed to gather metrics", zap.Error(err))
+	}
+	for _, f := range families {
+		switch f.GetName() {
+		case "http_request_duration_seconds":
+			for _, m := range f.GetMetric() {
+				h := m.GetHistogram()
+				s.requests += h.GetSampleCount()
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "status" {
+						if code, _ := strconv.Atoi(l.GetValue()); code >= 500 {
+							s.http5xx += h.GetSampleCount()
+						}
+					}
+				}
+				for _, b := range h.GetBucket() {
+					s.buckets[b.GetUpperBound()] += b.GetCumulativeCount()
+				}
+			}
+		case "log_errors_total":
+			for _, m := range f.GetMetric() {
+				s.errorLogs += m.GetCounter().GetValue()
+			}
+		}
+	}
+	return s
+}
+
+func (r *Reporter) report(last, now summarySnapshot) {
+	r.log.Info("summary",
+		zap.Duration("interval", r.interval),
+		zap.Uint64("requests", now.requests-last.requests),
+		zap.Uint64("messages", now.messages-last.messages),
+		zap.Uint64("http_5xx", now.http5xx-last.http5xx),
+		zap.Float64("error_logs", now.errorLogs-last.errorLogs),
+		zap.Duration("p99", quantile(0.99, now.requests-last.requests, last.buckets, now.buckets)),
+		zap.Int64("in_flight_requests", InFlightRequests()),
+		zap.Int64("in_flight_messages", InFlightMessages()),
+	)
+}
+
+// quantile estimates q over the total observations made between two bucket snapshots,
+// interpolating linearly inside the bucket like histogram_quantile. Observations above
+// the highest bound are reported as that bound.
+func quantile(q float64, total uint64, last, now map[float64]uint64) time.Duration {
+	if total == 0 || len(now) == 0 {
+		return 0
+	}
+	bounds := make([]float64, 0, len(now))
+	for b := range now {
+		bounds = append(bounds, b)
+	}
+	sort.Float64s(bounds)
+
+	rank := q * float64(total)
+	lower, below := 0.0, uint64(0)
+	for _, b := range bounds {
+		count := now[b] - last[b]
+		if float64(count) >= rank {
+			inBucket := count - below
+			if inBucket == 0 {
+				return seconds(b)
+			}
+			return seconds(lower + (b-lower)*(rank-float64(below))/float64(inBucket))
+		}
+		lower, below = b, count
+	}
+	return seconds(bounds[len(bounds)-1])
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/amqp"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Queue is where completion events are published for the notification service.
+const Queue = "notifications"
+
+// Event types
+const (
+	PipelineCompleted = "pipeline.completed"
+	OrderCompleted    = "order.completed"
+	OrderCancelled    = "order.cancelled"
+)
+
+// Event tells the notification service that something worth telling a user about happened.
+type Event struct {
+	Type       string    `json:"type"`
+	Subject    string    `json:"subject"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Publish sends an event to Queue with the trace context of ctx, so notifications join the trace.
+func Publish(ctx context.Context, ch *amqp091.Channel, eventType, subject string) error {
+	body, err := json.Marshal(Event{Type: eventType, Subject: subject, OccurredAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	return amqp.Publish(ctx, ch, "", Queue, amqp091.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	})
+}
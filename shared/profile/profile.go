@@ -0,0 +1,94 @@
+// Package profile applies per-environment settings bundled into the binary, so one
+// build runs from the source tree, under compose and in Kubernetes. A profile is a
+// NAME.env file of environment variables in a file system the caller embeds;
+// APP_PROFILE picks one and must be set.
+//
+// Precedence, highest first: the real environment, then the profile, then the
+// defaults in code. A profile only fills in variables that aren't set, so anything
+// can still be overridden per process.
+package profile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Profile is the applied profile, for diagnostics.
+type Profile struct {
+	Name string `json:"name"`
+	// Applied lists the variables the profile set.
+	Applied []string `json:"applied"`
+	// Overridden lists the variables the profile has but the environment already set.
+	Overridden []string `json:"overridden"`
+}
+
+// Names lists the profiles in fsys.
+func Names(fsys fs.FS) []string {
+	files, _ := fs.Glob(fsys, "*.env")
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(f, ".env"))
+	}
+	return names
+}
+
+// Load applies the profile of fsys named by APP_PROFILE to the environment. Call it
+// first in main, before any configuration is read. An unset APP_PROFILE is an error:
+// which broker and database to use is never guessed.
+func Load(fsys fs.FS) (Profile, error) {
+	name := os.Getenv("APP_PROFILE")
+	if name == "" {
+		return Profile{}, errors.New("APP_PROFILE is not set, want one of " + strings.Join(Names(fsys), ", "))
+	}
+	return Apply(fsys, name)
+}
+
+// Apply sets every variable of the profile called name that isn't set already.
+func Apply(fsys fs.FS, name string) (Profile, error) {
+	p := Profile{Name: name}
+	data, err := fs.ReadFile(fsys, name+".env")
+	if err != nil {
+		return p, fmt.Errorf("unknown profile %q, want one of %s", name, strings.Join(Names(fsys), ", "))
+	}
+	vars, err := parse(data)
+	if err != nil {
+		return p, fmt.Errorf("profile %s: %w", name, err)
+	}
+	for key, value := range vars {
+		if _, set := os.LookupEnv(key); set {
+			p.Overridden = append(p.Overridden, key)
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return p, err
+		}
+		p.Applied = append(p.Applied, key)
+	}
+	sort.Strings(p.Applied)
+	sort.Strings(p.Overridden)
+	return p, nil
+}
+
+// parse reads KEY=VALUE lines; blank lines and lines starting with # are skipped.
+func parse(data []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("line %d: want KEY=VALUE", n)
+		}
+		vars[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return vars, s.Err()
+}
@@ -0,0 +1,75 @@
+package profile
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testFS = fstest.MapFS{
+	"docker.env": {Data: []byte("# compose\nPROFILE_TEST_BROKER = amqp://rabbitmq:5672/\n\nPROFILE_TEST_DB=postgres://db/app?sslmode=disable\n")},
+	"local.env":  {Data: []byte("PROFILE_TEST_BROKER=amqp://localhost:5672/\n")},
+	"broken.env": {Data: []byte("PROFILE_TEST_BROKER\n")},
+}
+
+// unsetAfter clears the profile's variables once the test is done, since Apply sets them.
+func unsetAfter(t *testing.T, keys ...string) {
+	t.Cleanup(func() {
+		for _, k := range keys {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestApply(t *testing.T) {
+	unsetAfter(t, "PROFILE_TEST_BROKER", "PROFILE_TEST_DB")
+	// The environment wins over the profile
+	t.Setenv("PROFILE_TEST_DB", "postgres://override/app")
+
+	p, err := Apply(testFS, "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Profile{Name: "docker", Applied: []string{"PROFILE_TEST_BROKER"}, Overridden: []string{"PROFILE_TEST_DB"}}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Apply = %+v, want %+v", p, want)
+	}
+	if got := os.Getenv("PROFILE_TEST_BROKER"); got != "amqp://rabbitmq:5672/" {
+		t.Errorf("PROFILE_TEST_BROKER = %q, want the profile's value, trimmed", got)
+	}
+	if got := os.Getenv("PROFILE_TEST_DB"); got != "postgres://override/app" {
+		t.Errorf("PROFILE_TEST_DB = %q, want the environment's value", got)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{name: "missing", want: `unknown profile "missing", want one of broken, docker, local`},
+		{name: "broken", want: "profile broken: line 1: want KEY=VALUE"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Apply(testFS, tt.name); err == nil || err.Error() != tt.want {
+				t.Errorf("Apply(%q) = %v, want %q", tt.name, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadNeedsAppProfile(t *testing.T) {
+	t.Setenv("APP_PROFILE", "")
+	if _, err := Load(testFS); err == nil || !strings.Contains(err.Error(), "APP_PROFILE is not set") {
+		t.Errorf("Load = %v, want an error asking for APP_PROFILE", err)
+	}
+
+	unsetAfter(t, "PROFILE_TEST_BROKER")
+	t.Setenv("APP_PROFILE", "local")
+	p, err := Load(testFS)
+	if err != nil || p.Name != "local" {
+		t.Errorf("Load = %+v, %v, want the local profile", p, err)
+	}
+}
@@ -0,0 +1,81 @@
+// Package random is the randomness behind simulated work and fault injection. Sources
+// are seedable, so a scenario run or a test of an error path can be repeated exactly:
+// set SIM_SEED to fix the process-wide source, or give a Deps or chaos window its own.
+package random
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+)
+
+// Source draws the random numbers simulations use.
+type Source interface {
+	Intn(n int) int
+	Int63n(n int64) int64
+	Float64() float64
+}
+
+// Rand is a Source safe for concurrent use.
+type Rand struct {
+	mu   sync.Mutex
+	r    *rand.Rand
+	seed int64
+}
+
+// New returns a Source that produces the same sequence for the same seed.
+func New(seed int64) *Rand {
+	return &Rand{r: rand.New(rand.NewSource(seed)), seed: seed}
+}
+
+func (r *Rand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Intn(n)
+}
+
+func (r *Rand) Int63n(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Int63n(n)
+}
+
+func (r *Rand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Float64()
+}
+
+// Seed is the seed r was created with.
+func (r *Rand) Seed() int64 {
+	return r.seed
+}
+
+// Default is the process-wide source, seeded from SIM_SEED or, if unset, the clock.
+// The seed is shown in /admin/config so a run can be repeated with it.
+var Default = New(seedFromEnv())
+
+func seedFromEnv() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("SIM_SEED"), 10, 64); err == nil {
+		return v
+	}
+	return time.Now().UnixNano()
+}
+
+func init() {
+	diagnostics.RegisterConfig("random", func() any {
+		return map[string]int64{"seed": Default.Seed()}
+	})
+}
+
+// Or returns s, or Default when s is nil, for optional Source fields.
+func Or(s Source) Source {
+	if s == nil {
+		return Default
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/daanielsharon/observability-go/shared/diagnostics"
+	"github.com/daanielsharon/observability-go/shared/errreport"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var panicsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "panics_total",
+	Help: "Number of recovered panics.",
+}, []string{"component"})
+
+// Handle records a recovered panic on the active span, logs the stack with trace
+// context, counts it and forwards it to the error tracker.
+// When no span is recording, a dedicated "panic" span is started so the panic still shows up in the trace.
+func Handle(ctx context.Context, log *zap.Logger, component string, recovered any) {
+	stack := string(debug.Stack())
+
+	err, ok := recovered.(error)
+	if !ok {
+		err = fmt.Errorf("panic: %v", recovered)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		ctx, span = otel.Tracer(component).Start(ctx, "panic")
+		defer span.End()
+	}
+	span.RecordError(err, trace.WithAttributes(attribute.String("exception.stacktrace", stack)))
+	span.SetStatus(codes.Error, err.Error())
+
+	fields := []zap.Field{
+		zap.String("component", component),
+		zap.Any("panic", recovered),
+		zap.String("stack", stack),
+	}
+	if sc := span.SpanContext(); sc.IsValid() {
+		fields = append(fields,
+			zap.String("trace_id", sc.TraceID().String()),
+			zap.String("span_id", sc.SpanID().String()),
+		)
+	}
+	log.Error("recovered from panic", fields...)
+
+	panicsTotal.WithLabelValues(component).Inc()
+	errreport.CapturePanic(ctx, recovered)
+	diagnostics.RecordError(ctx, err)
+}
+
+// Fiber replaces the stock recover middleware: panics are passed to Handle and answered with a 500.
+func Fiber(log *zap.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				Handle(c.UserContext(), log, "http", r)
+				err = fiber.ErrInternalServerError
+			}
+		}()
+		return c.Next()
+	}
+}
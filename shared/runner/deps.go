@@ -0,0 +1,156 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	dependencyUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "runner_dependency_up",
+		Help: "1 once a startup dependency was reachable, 0 while the runner waits for it.",
+	}, []string{"dependency"})
+	dependencyWait = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "runner_dependency_wait_seconds",
+		Help: "How long startup waited for a dependency.",
+	}, []string{"dependency"})
+)
+
+const (
+	DefaultDependencyTimeout = 2 * time.Minute
+
+	// Retry delays while waiting for a dependency, doubling from the first to the last
+	dependencyMinBackoff = 250 * time.Millisecond
+	dependencyMaxBackoff = 5 * time.Second
+	// How often a dependency that is still down is logged again
+	dependencyLogEvery = 10 * time.Second
+)
+
+// Check reports whether a dependency can be used; it must return once ctx expires.
+type Check func(ctx context.Context) error
+
+type dependency struct {
+	name     string
+	check    Check
+	optional bool
+}
+
+// WaitFor declares a dependency that must pass its check before any component starts.
+// If it doesn't within DependencyTimeout, Run fails.
+func (r *Runner) WaitFor(name string, check Check) {
+	r.dependencies = append(r.dependencies, dependency{name: name, check: check})
+}
+
+// WaitForOptional is WaitFor for a dependency the service can run without, such as the
+// trace backend: once DependencyTimeout passes, startup goes on with a warning.
+func (r *Runner) WaitForOptional(name string, check Check) {
+	r.dependencies = append(r.dependencies, dependency{name: name, check: check, optional: true})
+}
+
+// TCPCheck passes once addr accepts a TCP connection. addr is host:port or a URL with
+// a port, e.g. amqp://rabbitmq:5672.
+func TCPCheck(addr string) Check {
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		addr = u.Host
+	}
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTPCheck passes once a GET of url answers with a status below 500.
+func HTTPCheck(url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s answered %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// waitDependencies checks every dependency concurrently until they pass, retrying with
+// backoff. It fails on the first required dependency that times out, or when ctx ends.
+func (r *Runner) waitDependencies(ctx context.Context) error {
+	if len(r.dependencies) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.DependencyTimeout)
+	defer cancel()
+
+	errs := make([]error, len(r.dependencies))
+	var wg sync.WaitGroup
+	for i, d := range r.dependencies {
+		dependencyUp.WithLabelValues(d.name).Set(0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.waitDependency(ctx, d)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (r *Runner) waitDependency(ctx context.Context, d dependency) error {
+	log := r.log.With(zap.String("dependency", d.name))
+	start := time.Now()
+	backoff := dependencyMinBackoff
+	var lastLog time.Time
+
+	for attempt := 1; ; attempt++ {
+		checkCtx, cancel := context.WithTimeout(ctx, dependencyMaxBackoff)
+		err := d.check(checkCtx)
+		cancel()
+		if err == nil {
+			dependencyUp.WithLabelValues(d.name).Set(1)
+			dependencyWait.WithLabelValues(d.name).Set(time.Since(start).Seconds())
+			log.Info("dependency ready", zap.Int("attempts", attempt), zap.Duration("waited", time.Since(start)))
+			return nil
+		}
+		if time.Since(lastLog) >= dependencyLogEvery {
+			log.Info("waiting for dependency", zap.Int("attempt", attempt), zap.Duration("waited", time.Since(start)), zap.Error(err))
+			lastLog = time.Now()
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, dependencyMaxBackoff)
+		case <-ctx.Done():
+			dependencyWait.WithLabelValues(d.name).Set(time.Since(start).Seconds())
+			if errors.Is(ctx.Err(), context.Canceled) {
+				// Shutdown, not a timeout: an optional dependency hasn't given up either
+				return ctx.Err()
+			}
+			if d.optional {
+				log.Warn("optional dependency unavailable, starting without it", zap.Duration("waited", time.Since(start)), zap.Error(err))
+				return nil
+			}
+			log.Error("dependency unavailable", zap.Duration("waited", time.Since(start)), zap.Error(err))
+			return fmt.Errorf("dependency %s: %w", d.name, err)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	componentUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "runner_component_up",
+		Help: "1 while a component registered with the service runner is started.",
+	}, []string{"component"})
+	componentFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "runner_component_failures_total",
+		Help: "Component start/stop failures and runtime failures, by phase (start, stop, run).",
+	}, []string{"component", "phase"})
+	componentDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "runner_component_duration_seconds",
+		Help: "How long a component took to start or stop, by phase (start, stop).",
+	}, []string{"component", "phase"})
+	phaseDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "runner_phase_duration_seconds",
+		Help: "How long each lifecycle phase took: init (process start to Run, loading config in main), dependencies, start (all components), ready (process start to running) and stop (all components).",
+	}, []string{"phase"})
+)
+
+// processStart stands in for the time the process started: package variables are
+// initialized before main runs.
+var processStart = time.Now()
+
+const (
+	DefaultStartTimeout = 30 * time.Second
+	DefaultStopTimeout  = 10 * time.Second
+)
+
+// Service is a component of a binary. Start returns once the component is running;
+// long-running work belongs in a goroutine that reports failures through Runner.Fail.
+// Stop must return once the component has shut down or ctx expires.
+type Service interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Hook adapts a pair of funcs to Service; either may be nil.
+type Hook struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+func (h Hook) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+func (h Hook) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+type component struct {
+	name      string
+	svc       Service
+	dependsOn []string
+}
+
+// Runner starts components in dependency order, waits for SIGINT/SIGTERM or a
+// component failure, then stops them in reverse order, each within StopTimeout.
+type Runner struct {
+	StartTimeout time.Duration
+	StopTimeout  time.Duration
+	// DependencyTimeout bounds the wait for the dependencies declared with WaitFor.
+	DependencyTimeout time.Duration
+
+	log          *zap.Logger
+	components   []component
+	dependencies []dependency
+	failed       chan error
+}
+
+func New(log *zap.Logger) *Runner {
+	r := &Runner{
+		StartTimeout:      DefaultStartTimeout,
+		StopTimeout:       DefaultStopTimeout,
+		DependencyTimeout: DefaultDependencyTimeout,
+		log:               log,
+		failed:            make(chan error, 1),
+	}
+	if v, err := time.ParseDuration(os.Getenv("STARTUP_TIMEOUT")); err == nil {
+		r.DependencyTimeout = v
+	}
+	return r
+}
+
+// Add registers a component. It is started after the components it depends on
+// and stopped before them; components without dependencies keep registration order.
+func (r *Runner) Add(name string, svc Service, dependsOn ...string) {
+	r.components = append(r.components, component{name: name, svc: svc, dependsOn: dependsOn})
+}
+
+// Fail reports that a running component failed and triggers shutdown.
+func (r *Runner) Fail(name string, err error) {
+	componentFailures.WithLabelValues(name, "run").Inc()
+	select {
+	case r.failed <- fmt.Errorf("%s: %w", name, err):
+	default:
+	}
+}
+
+// Run waits for the declared dependencies, starts every component, blocks until
+// shutdown is requested and stops them again. It returns the error that caused the
+// shutdown, if any. A termination signal during the wait for dependencies ends Run
+// before anything is started.
+func (r *Runner) Run(ctx context.Context) error {
+	order, err := r.order()
+	if err != nil {
+		return err
+	}
+
+	phaseDuration.WithLabelValues("init").Set(time.Since(processStart).Seconds())
+
+	// A termination signal also ends the wait for dependencies
+	waitCtx, stopWait := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	waitStart := time.Now()
+	err = r.waitDependencies(waitCtx)
+	interrupted := waitCtx.Err() != nil
+	stopWait()
+	phaseDuration.WithLabelValues("dependencies").Set(time.Since(waitStart).Seconds())
+	if interrupted {
+		// The signal was spent on the wait; starting now would leave nothing to stop us
+		r.log.Info("received termination signal while waiting for dependencies, exiting")
+		return nil
+	}
+	if err != nil {
+		r.log.Error("startup dependencies unavailable", zap.Error(err))
+		return err
+	}
+
+	var started []component
+	var runErr error
+	startStart := time.Now()
+	for _, c := range order {
+		if err := r.start(ctx, c); err != nil {
+			runErr = err
+			break
+		}
+		started = append(started, c)
+	}
+	phaseDuration.WithLabelValues("start").Set(time.Since(startStart).Seconds())
+
+	if runErr == nil {
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		ready := time.Since(processStart)
+		phaseDuration.WithLabelValues("ready").Set(ready.Seconds())
+		r.log.Info("service running", zap.Duration("startup", ready))
+		select {
+		case <-ctx.Done():
+			r.log.Info("received termination signal, shutting down gracefully")
+		case runErr = <-r.failed:
+			r.log.Error("component failed, shutting down", zap.Error(runErr))
+		}
+		stop()
+	}
+
+	// The process usually exits before the next scrape, so the stop durations are logged too
+	stopStart := time.Now()
+	for i := len(started) - 1; i >= 0; i-- {
+		r.stop(started[i])
+	}
+	phaseDuration.WithLabelValues("stop").Set(time.Since(stopStart).Seconds())
+	r.log.Info("shutdown complete", zap.Duration("duration", time.Since(stopStart)))
+	return runErr
+}
+
+func (r *Runner) start(ctx context.Context, c component) error {
+	log := r.log.With(zap.String("component", c.name))
+	log.Info("starting component")
+
+	ctx, cancel := context.WithTimeout(ctx, r.StartTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.svc.Start(ctx)
+	componentDuration.WithLabelValues(c.name, "start").Set(time.Since(start).Seconds())
+	if err != nil {
+		componentFailures.WithLabelValues(c.name, "start").Inc()
+		log.Error("failed to start component", zap.Error(err))
+		return fmt.Errorf("start %s: %w", c.name, err)
+	}
+	componentUp.WithLabelValues(c.name).Set(1)
+	log.Info("component started", zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+func (r *Runner) stop(c component) {
+	log := r.log.With(zap.String("component", c.name))
+	log.Info("stopping component")
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.StopTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.svc.Stop(ctx)
+	componentDuration.WithLabelValues(c.name, "stop").Set(time.Since(start).Seconds())
+	componentUp.WithLabelValues(c.name).Set(0)
+	if err != nil {
+		componentFailures.WithLabelValues(c.name, "stop").Inc()
+		log.Error("failed to stop component", zap.Error(err), zap.Duration("duration", time.Since(start)))
+		return
+	}
+	log.Info("component stopped", zap.Duration("duration", time.Since(start)))
+}
+
+// order sorts components so each comes after its dependencies, keeping registration order otherwise.
+func (r *Runner) order() ([]component, error) {
+	byName := make(map[string]component, len(r.components))
+	for _, c := range r.components {
+		byName[c.name] = c
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(r.components))
+	order := make([]component, 0, len(r.components))
+
+	var visit func(c component) error
+	visit = func(c component) error {
+		switch state[c.name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle at component %q", c.name)
+		}
+		state[c.name] = visiting
+		for _, dep := range c.dependsOn {
+			d, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("component %q depends on unknown component %q", c.name, dep)
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[c.name] = done
+		order = append(order, c)
+		return nil
+	}
+
+	for _, c := range r.components {
+		if err := visit(c); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// phase reads the current value of a runner_phase_duration_seconds series.
+func phase(t *testing.T, name string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := phaseDuration.WithLabelValues(name).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestRunPhaseDurations(t *testing.T) {
+	r := New(zap.NewNop())
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+	sleep := func(d time.Duration, e string) func(context.Context) error {
+		return func(context.Context) error {
+			time.Sleep(d)
+			record(e)
+			return nil
+		}
+	}
+
+	r.WaitFor("db", func(ctx context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	r.Add("worker", Hook{
+		OnStart: func(ctx context.Context) error {
+			record("start worker")
+			// A runtime failure is what ends this run
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				r.Fail("worker", errors.New("lost connection"))
+			}()
+			return nil
+		},
+		OnStop: sleep(0, "stop worker"),
+	}, "cache")
+	r.Add("cache", Hook{OnStart: sleep(30*time.Millisecond, "start cache"), OnStop: sleep(20*time.Millisecond, "stop cache")})
+
+	err := r.Run(context.Background())
+	if err == nil || err.Error() != "worker: lost connection" {
+		t.Fatalf("Run = %v, want the worker's failure", err)
+	}
+
+	// Dependencies first, stopped in reverse
+	want := []string{"start cache", "start worker", "stop worker", "stop cache"}
+	if !slices.Equal(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	for _, tt := range []struct {
+		phase string
+		min   float64
+	}{
+		{phase: "dependencies", min: 0.02},
+		{phase: "start", min: 0.03},
+		{phase: "stop", min: 0.02},
+	} {
+		if got := phase(t, tt.phase); got < tt.min {
+			t.Errorf("%s phase = %.3fs, want at least %.3fs", tt.phase, got, tt.min)
+		}
+	}
+	// ready runs from process start, so it covers init, dependencies and start
+	if ready, sum := phase(t, "ready"), phase(t, "init")+phase(t, "dependencies")+phase(t, "start"); ready < sum {
+		t.Errorf("ready phase = %.3fs, want at least init+dependencies+start = %.3fs", ready, sum)
+	}
+}
+
+func TestRunStartFailureStopsStarted(t *testing.T) {
+	r := New(zap.NewNop())
+	var stopped []string
+	r.Add("a", Hook{OnStop: func(context.Context) error { stopped = append(stopped, "a"); return nil }})
+	r.Add("b", Hook{OnStop: func(context.Context) error { stopped = append(stopped, "b"); return nil }})
+	r.Add("c", Hook{
+		OnStart: func(context.Context) error { return errors.New("port in use") },
+		OnStop:  func(context.Context) error { stopped = append(stopped, "c"); return nil },
+	})
+
+	if err := r.Run(context.Background()); err == nil || err.Error() != "start c: port in use" {
+		t.Fatalf("Run = %v, want c's start failure", err)
+	}
+	if want := []string{"b", "a"}; !slices.Equal(stopped, want) {
+		t.Errorf("stopped = %v, want %v", stopped, want)
+	}
+}
@@ -0,0 +1,180 @@
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/loadgen"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// resetTimeout bounds the reset commands, which still run after the run is interrupted.
+const resetTimeout = 30 * time.Second
+
+// Runner plays scenarios: it applies each phase's commands through the controlplane
+// and points the load generator at the phase's load.
+type Runner struct {
+	// Controlplane is the controlplane's base URL, e.g. http://localhost:8083.
+	Controlplane string
+	Client       *http.Client
+	Load         *loadgen.Generator
+	// OnPhase, if set, is called as each phase starts.
+	OnPhase func(index int, p Phase)
+}
+
+// Run plays the phases in order and then the reset commands, which also run when ctx is
+// cancelled mid-scenario. The load is paused when Run returns.
+func (r *Runner) Run(ctx context.Context, s *Scenario) (err error) {
+	ctx, span := otel.Tracer("scenario").Start(ctx, "Run Scenario",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("scenario.name", s.Name),
+			attribute.Int("scenario.phases", len(s.Phases)),
+		))
+	defer func() {
+		r.Load.Set(0, nil)
+		resetCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resetTimeout)
+		defer cancel()
+		if resetErr := r.apply(resetCtx, s.Reset); resetErr != nil {
+			err = errors.Join(err, fmt.Errorf("reset: %w", resetErr))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	load := s.Load
+	for i, p := range s.Phases {
+		if p.Load != nil {
+			load = p.Load
+		}
+		if err := r.phase(ctx, s, i, p, load); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) phase(ctx context.Context, s *Scenario, index int, p Phase, load *Load) error {
+	ctx, span := otel.Tracer("scenario").Start(ctx, "Scenario Phase", trace.WithAttributes(
+		attribute.String("scenario.phase", p.Name),
+		attribute.Int("scenario.phase_index", index),
+		attribute.String("scenario.phase_duration", time.Duration(p.Duration).String()),
+	))
+	defer span.End()
+	if r.OnPhase != nil {
+		r.OnPhase(index, p)
+	}
+
+	if err := r.apply(ctx, chaosWindows(s, index, p, time.Now())); err != nil {
+		err = fmt.Errorf("phase %q: %w", p.Name, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if load != nil {
+		r.Load.SetCurve(load.curve(time.Now()), load.Paths,
+			attribute.String("scenario.name", s.Name),
+			attribute.String("scenario.phase", p.Name),
+		)
+	}
+
+	select {
+	case <-time.After(time.Duration(p.Duration)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// chaosWindows fills in the chaos commands of a phase: they all open at start, so every
+// target's window lines up, and run for the phase unless they say otherwise. Without a
+// scenario_id they are tagged "<scenario>/<phase>". With a scenario seed, each command
+// gets its own seed derived from it and the command's place in the scenario.
+func chaosWindows(s *Scenario, index int, p Phase, start time.Time) []Command {
+	cmds := make([]Command, len(p.Commands))
+	for i, c := range p.Commands {
+		if c.Command == "chaos" {
+			args := make(map[string]any, len(c.Args)+3)
+			for k, v := range c.Args {
+				args[k] = v
+			}
+			if _, ok := args["scenario_id"]; !ok {
+				args["scenario_id"] = s.Name + "/" + p.Name
+			}
+			if _, ok := args["start"]; !ok {
+				args["start"] = start.Format(time.RFC3339Nano)
+			}
+			if _, ok := args["duration"]; !ok {
+				args["duration"] = time.Duration(p.Duration).String()
+			}
+			if _, ok := args["seed"]; !ok && s.Seed != 0 {
+				args["seed"] = s.Seed + int64(index)*1000 + int64(i) + 1
+			}
+			c.Args = args
+		}
+		cmds[i] = c
+	}
+	return cmds
+}
+
+// apply sends the commands to the controlplane in order and fails if any instance
+// didn't take one, since the rest of the walkthrough would then be misleading.
+func (r *Runner) apply(ctx context.Context, cmds []Command) error {
+	for _, cmd := range cmds {
+		if err := r.send(ctx, cmd); err != nil {
+			return fmt.Errorf("command %s: %w", cmd.Command, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) send(ctx context.Context, cmd Command) error {
+	ctx, span := otel.Tracer("scenario").Start(ctx, "Send Command", trace.WithAttributes(
+		attribute.String("command", cmd.Command),
+		attribute.StringSlice("command.targets", cmd.Targets),
+	))
+	defer span.End()
+
+	body, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.Controlplane+"/commands", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("controlplane answered %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	var result struct {
+		Failed int `json:"failed"`
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return fmt.Errorf("invalid controlplane response: %w", err)
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("%d instances didn't apply it: %s", result.Failed, bytes.TrimSpace(b))
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+// Package scenario scripts demo incidents: a scenario file lists phases, each holding
+// the load to send and the chaos commands to apply for a while, so the same incident
+// can be walked through again and again.
+//
+//	name: checkout-incident
+//	load: {rps: 5, paths: [/hello, /call-app2]}
+//	phases:
+//	  - {name: normal, duration: 5m}
+//	  - name: error storm
+//	    duration: 2m
+//	    commands:
+//	      - {command: flags, targets: [app, consumer-1], args: {chaos: true}}
+//	reset:
+//	  - {command: flags, targets: [app, consumer-1], args: {chaos: false}}
+//
+// Commands are sent to the controlplane, which fans them out to every instance of
+// their targets.
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/loadgen"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Scenario is a scripted sequence of phases.
+type Scenario struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Load is sent from the start; a phase with its own load replaces it from then on.
+	Load   *Load   `json:"load,omitempty"`
+	Phases []Phase `json:"phases"`
+	// Reset runs after the last phase, or when the run is interrupted, to undo the chaos.
+	Reset []Command `json:"reset,omitempty"`
+	// Seed makes the chaos repeatable: every chaos window gets a seed derived from it,
+	// so a replay fails the same work in the same order.
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// Phase holds a load and a set of chaos commands for a duration.
+type Phase struct {
+	Name     string    `json:"name"`
+	Duration Duration  `json:"duration"`
+	Load     *Load     `json:"load,omitempty"`
+	Commands []Command `json:"commands,omitempty"`
+}
+
+// Load is the traffic sent to the target, spread evenly over the paths: a steady RPS,
+// or a time-of-day Profile.
+type Load struct {
+	RPS     float64          `json:"rps,omitempty"`
+	Profile *loadgen.Profile `json:"profile,omitempty"`
+	// Speed plays the profile faster than real time, e.g. 96 for a day in fifteen minutes.
+	Speed float64  `json:"speed,omitempty"`
+	Paths []string `json:"paths"`
+}
+
+// curve is the rate the load follows from start.
+func (l *Load) curve(start time.Time) loadgen.Curve {
+	if l.Profile == nil {
+		return loadgen.Constant(l.RPS)
+	}
+	if l.Speed > 0 && l.Speed != 1 {
+		return loadgen.Accelerate(l.Profile, start, l.Speed)
+	}
+	return l.Profile
+}
+
+// Command is a controlplane command: log_level, flags or failure_mode, with the body
+// the services' admin endpoint expects as args. No targets means every service.
+type Command struct {
+	Command string         `json:"command"`
+	Args    map[string]any `json:"args"`
+	Targets []string       `json:"targets,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "90s" or "5m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Total is how long the scenario runs.
+func (s *Scenario) Total() time.Duration {
+	var total time.Duration
+	for _, p := range s.Phases {
+		total += time.Duration(p.Duration)
+	}
+	return total
+}
+
+// LoadFile reads a scenario from a .yaml, .yml or .json file.
+func LoadFile(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read scenario: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	s, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse reads a JSON scenario and checks it.
+func Parse(b []byte) (*Scenario, error) {
+	var s Scenario
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Scenario) validate() error {
+	if s.Name == "" {
+		return errors.New("scenario has no name")
+	}
+	if len(s.Phases) == 0 {
+		return errors.New("scenario has no phases")
+	}
+	if err := s.Load.validate(); err != nil {
+		return err
+	}
+	for i, p := range s.Phases {
+		if p.Name == "" {
+			return fmt.Errorf("phase %d has no name", i+1)
+		}
+		if p.Duration <= 0 {
+			return fmt.Errorf("phase %q needs a positive duration", p.Name)
+		}
+		if err := p.Load.validate(); err != nil {
+			return fmt.Errorf("phase %q: %w", p.Name, err)
+		}
+		if err := validateCommands(p.Commands); err != nil {
+			return fmt.Errorf("phase %q: %w", p.Name, err)
+		}
+	}
+	if err := validateCommands(s.Reset); err != nil {
+		return fmt.Errorf("reset: %w", err)
+	}
+	return nil
+}
+
+func (l *Load) validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.RPS < 0 || l.Speed < 0 {
+		return errors.New("load rps and speed can't be negative")
+	}
+	if l.Profile != nil {
+		if l.RPS > 0 {
+			return errors.New("load has both rps and a profile")
+		}
+		if err := l.Profile.Validate(); err != nil {
+			return err
+		}
+	}
+	if (l.RPS > 0 || l.Profile != nil) && len(l.Paths) == 0 {
+		return errors.New("load has no paths")
+	}
+	for _, p := range l.Paths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("load path %q must start with /", p)
+		}
+	}
+	return nil
+}
+
+func validateCommands(cmds []Command) error {
+	for i, c := range cmds {
+		if c.Command == "" {
+			return fmt.Errorf("command %d has no name", i+1)
+		}
+	}
+	return nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so both formats decode through the same
+// struct tags and checks.
+func yamlToJSON(b []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	v, err := jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// jsonValue turns the map[interface{}]interface{} values yaml decodes into string-keyed maps.
+func jsonValue(v any) (any, error) {
+	switch v := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("non-string key %v", k)
+			}
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = converted
+		}
+		return m, nil
+	case []any:
+		for i, item := range v {
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	}
+	return v, nil
+}
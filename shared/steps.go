@@ -0,0 +1,82 @@
+package shared
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var stepDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "step_duration_seconds",
+	Help: "Duration of named handler steps recorded with shared.Steps, by step and outcome (ok, error).",
+}, []string{"step", "outcome"})
+
+// Timeline records the steps of a multi-step handler on the span in its context.
+type Timeline struct {
+	ctx   context.Context
+	spans bool
+	next  int
+}
+
+// StepsOption configures a Timeline.
+type StepsOption func(*Timeline)
+
+// WithStepSpans also runs each step in a child span named after it, for steps that
+// make calls of their own or should show as bars in the trace view.
+func WithStepSpans() StepsOption {
+	return func(t *Timeline) { t.spans = true }
+}
+
+// Steps starts a timeline on the span in ctx. Each step is added to that span as an
+// event stamped with the step's start, carrying its index, duration and any error, and
+// observed in step_duration_seconds.
+func Steps(ctx context.Context, opts ...StepsOption) *Timeline {
+	t := &Timeline{ctx: ctx}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Run runs fn as the step called name and returns its error. fn gets the step's
+// context: the child span's with WithStepSpans, the timeline's otherwise.
+func (t *Timeline) Run(name string, fn func(ctx context.Context) error) error {
+	index := t.next
+	t.next++
+
+	ctx := t.ctx
+	var child trace.Span
+	if t.spans {
+		ctx, child = otel.Tracer("steps").Start(ctx, name, trace.WithAttributes(
+			attribute.Int("step.index", index),
+		))
+		defer child.End()
+	}
+
+	start := time.Now()
+	err := fn(ctx)
+	elapsed := time.Since(start)
+
+	outcome := "ok"
+	eventAttrs := []attribute.KeyValue{
+		attribute.Int("step.index", index),
+		attribute.Float64("step.duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if err != nil {
+		outcome = "error"
+		eventAttrs = append(eventAttrs, attribute.String("error.message", err.Error()))
+		if child != nil {
+			child.RecordError(err)
+			child.SetStatus(codes.Error, err.Error())
+		}
+	}
+	trace.SpanFromContext(t.ctx).AddEvent(name, trace.WithTimestamp(start), trace.WithAttributes(eventAttrs...))
+	stepDuration.WithLabelValues(name, outcome).Observe(elapsed.Seconds())
+	return err
+}
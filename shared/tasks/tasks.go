@@ -0,0 +1,133 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared"
+	"github.com/daanielsharon/observability-go/shared/recovery"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	taskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "background_task_duration_seconds",
+		Help: "Duration of background tasks, by task name and outcome (ok, error, panic).",
+	}, []string{"task", "outcome"})
+	tasksActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "background_tasks_active",
+		Help: "Background tasks currently running.",
+	}, []string{"task"})
+)
+
+// Task describes a running background task.
+type Task struct {
+	ID      uint64    `json:"id"`
+	Name    string    `json:"name"`
+	Started time.Time `json:"started"`
+	TraceID string    `json:"trace_id,omitempty"`
+}
+
+var (
+	nextID atomic.Uint64
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	active = make(map[uint64]Task)
+)
+
+// Go runs fn in a new goroutine as the background task name. fn gets a span that is a
+// child of the span in ctx, and a context that is not cancelled with ctx, so the task
+// can outlive the request or message that started it. A returned error is recorded on
+// the span; a panic is recovered and handled like any other.
+func Go(ctx context.Context, log *zap.Logger, name string, fn func(ctx context.Context) error) {
+	ctx, span := otel.Tracer("tasks").Start(context.WithoutCancel(ctx), name,
+		trace.WithAttributes(attribute.String("task.name", name)),
+	)
+
+	t := Task{ID: nextID.Add(1), Name: name, Started: time.Now()}
+	if sc := span.SpanContext(); sc.IsValid() {
+		t.TraceID = sc.TraceID().String()
+	}
+	mu.Lock()
+	active[t.ID] = t
+	mu.Unlock()
+	tasksActive.WithLabelValues(name).Inc()
+	wg.Add(1)
+
+	go func() {
+		outcome := "ok"
+		defer func() {
+			if r := recover(); r != nil {
+				outcome = "panic"
+				recovery.Handle(ctx, log, "task", r)
+			}
+
+			span.End()
+			taskDuration.WithLabelValues(name, outcome).Observe(time.Since(t.Started).Seconds())
+			tasksActive.WithLabelValues(name).Dec()
+			mu.Lock()
+			delete(active, t.ID)
+			mu.Unlock()
+			wg.Done()
+		}()
+
+		if err := fn(ctx); err != nil {
+			outcome = "error"
+			shared.RecordError(ctx, err, "")
+			log.Error("background task failed",
+				zap.String("task", name),
+				zap.String("trace_id", t.TraceID),
+				zap.Error(err),
+			)
+		}
+	}()
+}
+
+// Active lists the running tasks, oldest first.
+func Active() []Task {
+	mu.Lock()
+	list := make([]Task, 0, len(active))
+	for _, t := range active {
+		list = append(list, t)
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Wait blocks until every running task has finished or ctx is done.
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Handler serves the running tasks as JSON, for admin endpoints.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Active())
+	})
+}
@@ -0,0 +1,101 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	samplingProbability = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "trace_sampling_probability",
+		Help: "Current head sampling probability chosen by the adaptive sampler.",
+	})
+	spansPerSecond = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "trace_spans_started_per_second",
+		Help: "Spans started per second, as observed by the adaptive sampler over its last window.",
+	})
+)
+
+const (
+	adaptiveWindow         = 5 * time.Second
+	adaptiveMinProbability = 0.001
+)
+
+// AdaptiveSampler samples root spans with a probability that is recomputed every
+// window so the number of sampled spans stays close to a spans-per-second budget.
+// It sees every span start, so child spans count against the budget too.
+type AdaptiveSampler struct {
+	budget float64
+
+	mu          sync.Mutex
+	probability float64
+	windowStart time.Time
+	started     int
+}
+
+func NewAdaptiveSampler(spansPerSecondBudget, initialProbability float64) *AdaptiveSampler {
+	samplingProbability.Set(initialProbability)
+	return &AdaptiveSampler{
+		budget:      spansPerSecondBudget,
+		probability: initialProbability,
+		windowStart: time.Now(),
+	}
+}
+
+func (a *AdaptiveSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	probability := a.observe()
+
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	ts := psc.TraceState()
+	if psc.IsValid() {
+		if psc.IsSampled() {
+			return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: ts}
+		}
+		return sdktrace.SamplingResult{Decision: sdktrace.Drop, Tracestate: ts}
+	}
+
+	// Same trace-ID based decision as TraceIDRatioBased, so it stays consistent across services
+	bound := uint64(probability * (1 << 63))
+	if binary.BigEndian.Uint64(p.TraceID[8:16])>>1 < bound {
+		return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: ts}
+	}
+	return sdktrace.SamplingResult{Decision: sdktrace.Drop, Tracestate: ts}
+}
+
+func (a *AdaptiveSampler) Description() string {
+	return fmt.Sprintf("AdaptiveSampler{budget=%g/s}", a.budget)
+}
+
+// observe counts a span start and, once per window, moves the probability towards budget/rate.
+func (a *AdaptiveSampler) observe() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.started++
+	elapsed := time.Since(a.windowStart)
+	if elapsed < adaptiveWindow {
+		return a.probability
+	}
+
+	rate := float64(a.started) / elapsed.Seconds()
+	target := 1.0
+	if rate > 0 {
+		target = math.Max(adaptiveMinProbability, math.Min(1, a.budget/rate))
+	}
+	// Smooth the change so bursty traffic doesn't make the probability oscillate
+	a.probability = (a.probability + target) / 2
+
+	a.started = 0
+	a.windowStart = time.Now()
+	spansPerSecond.Set(rate)
+	samplingProbability.Set(a.probability)
+	return a.probability
+}
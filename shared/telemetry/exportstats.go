@@ -0,0 +1,177 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var (
+	exportedSpans = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trace_exported_spans_total",
+		Help: "Spans handed to the trace exporter, by result (ok, error). Failed spans are lost.",
+	}, []string{"result"})
+	droppedSpans = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "trace_dropped_spans_total",
+		Help: "Spans dropped because the export queue was full.",
+	})
+	exportQueueSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "trace_export_queue_size",
+		Help: "Spans waiting to be exported.",
+	})
+)
+
+// SpanExportStats is the state of the span export pipeline, for GET /debug/telemetry.
+type SpanExportStats struct {
+	Exporter      string `json:"exporter"`
+	Endpoint      string `json:"endpoint,omitempty"`
+	QueueSize     int64  `json:"queue_size"`
+	QueueCapacity int64  `json:"queue_capacity"`
+	Exported      uint64 `json:"exported"`
+	// Failed spans were in a batch the exporter returned an error for.
+	Failed  uint64 `json:"failed"`
+	Dropped uint64 `json:"dropped"`
+	// LastExport is when a batch was last exported successfully.
+	LastExport  *time.Time `json:"last_export,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// exportStats is shared by the queue gate and the exporter wrapper of one provider.
+type exportStats struct {
+	exporter string
+	endpoint string
+	capacity int64
+
+	queued   atomic.Int64
+	exported atomic.Uint64
+	failed   atomic.Uint64
+	dropped  atomic.Uint64
+
+	mu          sync.Mutex
+	lastExport  time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+var currentExport atomic.Pointer[exportStats]
+
+// ExportStats reports the span export pipeline installed by InitTracer. ok is false
+// before InitTracer has run.
+func ExportStats() (stats SpanExportStats, ok bool) {
+	s := currentExport.Load()
+	if s == nil {
+		return SpanExportStats{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats = SpanExportStats{
+		Exporter:      s.exporter,
+		Endpoint:      s.endpoint,
+		QueueSize:     s.queued.Load(),
+		QueueCapacity: s.capacity,
+		Exported:      s.exported.Load(),
+		Failed:        s.failed.Load(),
+		Dropped:       s.dropped.Load(),
+		LastError:     s.lastError,
+	}
+	if !s.lastExport.IsZero() {
+		t := s.lastExport
+		stats.LastExport = &t
+	}
+	if !s.lastErrorAt.IsZero() {
+		t := s.lastErrorAt
+		stats.LastErrorAt = &t
+	}
+	return stats, true
+}
+
+// exportQueueCapacity is the batch processor's queue size, honouring OTEL_BSP_MAX_QUEUE_SIZE
+// as the SDK does.
+func exportQueueCapacity() int {
+	if n, err := strconv.Atoi(os.Getenv("OTEL_BSP_MAX_QUEUE_SIZE")); err == nil && n > 0 {
+		return n
+	}
+	return sdktrace.DefaultMaxQueueSize
+}
+
+// newExportPipeline wraps exp in a batch processor whose queue is counted. The gate in
+// front drops spans itself once capacity are waiting, so the SDK's own silent drop never
+// happens and every lost span shows up in the stats.
+func newExportPipeline(cfg Config, exp sdktrace.SpanExporter) sdktrace.SpanProcessor {
+	exporter := cfg.Exporter
+	if exporter == "" {
+		exporter = "otlp"
+	}
+	if exporter == "otlp" {
+		exporter += "/" + cfg.Protocol
+	}
+	capacity := exportQueueCapacity()
+	stats := &exportStats{exporter: exporter, endpoint: cfg.Collector(), capacity: int64(capacity)}
+	currentExport.Store(stats)
+
+	bsp := sdktrace.NewBatchSpanProcessor(recordingExporter{exp, stats}, sdktrace.WithMaxQueueSize(capacity))
+	return queueGate{next: bsp, stats: stats}
+}
+
+// queueGate counts sampled spans into the batch processor and drops them once the queue is full.
+type queueGate struct {
+	next  sdktrace.SpanProcessor
+	stats *exportStats
+}
+
+func (g queueGate) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	g.next.OnStart(parent, s)
+}
+
+func (g queueGate) OnEnd(s sdktrace.ReadOnlySpan) {
+	// The batch processor ignores unsampled spans too
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if g.stats.queued.Add(1) > g.stats.capacity {
+		g.stats.queued.Add(-1)
+		g.stats.dropped.Add(1)
+		droppedSpans.Inc()
+		return
+	}
+	exportQueueSize.Inc()
+	g.next.OnEnd(s)
+}
+
+func (g queueGate) Shutdown(ctx context.Context) error   { return g.next.Shutdown(ctx) }
+func (g queueGate) ForceFlush(ctx context.Context) error { return g.next.ForceFlush(ctx) }
+
+// recordingExporter takes each batch off the queue count and records how its export went.
+type recordingExporter struct {
+	sdktrace.SpanExporter
+	stats *exportStats
+}
+
+func (e recordingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	n := len(spans)
+	e.stats.queued.Add(-int64(n))
+	exportQueueSize.Sub(float64(n))
+
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	now := time.Now()
+	e.stats.mu.Lock()
+	defer e.stats.mu.Unlock()
+	if err != nil {
+		e.stats.failed.Add(uint64(n))
+		e.stats.lastError, e.stats.lastErrorAt = err.Error(), now
+		exportedSpans.WithLabelValues("error").Add(float64(n))
+		return err
+	}
+	e.stats.exported.Add(uint64(n))
+	e.stats.lastExport = now
+	exportedSpans.WithLabelValues("ok").Add(float64(n))
+	return nil
+}
@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// DefaultExcludedPaths are operational endpoints that shouldn't show up in traces or RED metrics.
+const DefaultExcludedPaths = "/metrics,/healthz,/debug,/admin"
+
+// PathFilter matches request paths by prefix.
+type PathFilter struct {
+	prefixes []string
+}
+
+// NewPathFilter parses a comma-separated list of path prefixes.
+func NewPathFilter(list string) *PathFilter {
+	f := &PathFilter{}
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			f.prefixes = append(f.prefixes, p)
+		}
+	}
+	return f
+}
+
+// PathFilterFromEnv reads TELEMETRY_EXCLUDED_PATHS, falling back to DefaultExcludedPaths when unset.
+func PathFilterFromEnv() *PathFilter {
+	list, ok := os.LookupEnv("TELEMETRY_EXCLUDED_PATHS")
+	if !ok {
+		list = DefaultExcludedPaths
+	}
+	return NewPathFilter(list)
+}
+
+// MarshalJSON lists the excluded prefixes, for config dumps.
+func (f *PathFilter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.prefixes)
+}
+
+func (f *PathFilter) Match(path string) bool {
+	for _, p := range f.prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sampler drops spans for excluded paths and defers everything else to base.
+// The path is taken from the http.route/http.target/url.path attributes, or from
+// span names shaped like "GET /path" as used by the handlers.
+func (f *PathFilter) Sampler(base sdktrace.Sampler) sdktrace.Sampler {
+	return &filterSampler{filter: f, base: base}
+}
+
+type filterSampler struct {
+	filter *PathFilter
+	base   sdktrace.Sampler
+}
+
+var pathKeys = []attribute.Key{"http.route", "http.target", "url.path"}
+
+func (s *filterSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if s.filter.Match(spanPath(p)) {
+		return sdktrace.SamplingResult{Decision: sdktrace.Drop}
+	}
+	return s.base.ShouldSample(p)
+}
+
+func (s *filterSampler) Description() string {
+	return "PathFilter{" + s.base.Description() + "}"
+}
+
+func spanPath(p sdktrace.SamplingParameters) string {
+	for _, kv := range p.Attributes {
+		for _, k := range pathKeys {
+			if kv.Key == k {
+				return kv.Value.AsString()
+			}
+		}
+	}
+	if _, path, ok := strings.Cut(p.Name, " "); ok && strings.HasPrefix(path, "/") {
+		return path
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package telemetry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.uber.org/zap"
+)
+
+var serviceInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "service_info",
+	Help: "Always 1; carries the deployment labels of the service for joins in PromQL.",
+}, []string{"service_name", "service_version", "service_namespace", "deployment_environment", "service_instance_id"})
+
+var instanceInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "instance_info",
+	Help: "Always 1; tells the replicas of a service apart by instance ID, host and pid.",
+}, []string{"service_name", "service_instance_id", "host_name", "pid"})
+
+// generatedInstanceID is made once per process, so every signal carries the same ID.
+var generatedInstanceID = sync.OnceValue(func() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+})
+
+// Identity says which deployment a process belongs to, so telemetry from several
+// environments can be told apart.
+type Identity struct {
+	ServiceName string
+	Version     string
+	Namespace   string
+	Environment string
+	// InstanceID is unique per process: two replicas on one host still differ.
+	InstanceID string
+	Hostname   string
+	// Stage is the pipeline stage the service runs, if it is part of the pipeline.
+	Stage string
+}
+
+// IdentityFromEnv reads SERVICE_NAME, SERVICE_VERSION, SERVICE_NAMESPACE,
+// DEPLOYMENT_ENVIRONMENT (default development), SERVICE_INSTANCE_ID (default the
+// hostname plus a random suffix chosen at startup) and PIPELINE_STAGE.
+func IdentityFromEnv() Identity {
+	id := Identity{
+		ServiceName: os.Getenv("SERVICE_NAME"),
+		Version:     os.Getenv("SERVICE_VERSION"),
+		Namespace:   os.Getenv("SERVICE_NAMESPACE"),
+		Environment: os.Getenv("DEPLOYMENT_ENVIRONMENT"),
+		InstanceID:  os.Getenv("SERVICE_INSTANCE_ID"),
+		Stage:       os.Getenv("PIPELINE_STAGE"),
+	}
+	if id.Environment == "" {
+		id.Environment = "development"
+	}
+	id.Hostname, _ = os.Hostname()
+	if id.InstanceID == "" {
+		id.InstanceID = generatedInstanceID()
+	}
+	return id
+}
+
+// legacyEnvironmentKey is the pre-1.27 name of deployment.environment.name, still set
+// for the dashboards and queries written against it.
+const legacyEnvironmentKey = attribute.Key("deployment.environment")
+
+// Attributes are the resource attributes for traces.
+func (id Identity) Attributes() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(id.ServiceName),
+		semconv.DeploymentEnvironmentName(id.Environment),
+		legacyEnvironmentKey.String(id.Environment),
+		semconv.ServiceInstanceID(id.InstanceID),
+		semconv.HostName(id.Hostname),
+	}
+	if id.Namespace != "" {
+		attrs = append(attrs, semconv.ServiceNamespace(id.Namespace))
+	}
+	if id.Version != "" {
+		attrs = append(attrs, semconv.ServiceVersion(id.Version))
+	}
+	return attrs
+}
+
+// LogFields are static fields added to every log entry.
+func (id Identity) LogFields() []zap.Field {
+	fields := []zap.Field{
+		zap.String("service_version", id.Version),
+		zap.String("service_namespace", id.Namespace),
+		zap.String("deployment_environment", id.Environment),
+		zap.String("service_instance_id", id.InstanceID),
+	}
+	if id.Stage != "" {
+		fields = append(fields, zap.String("pipeline_stage", id.Stage))
+	}
+	return fields
+}
+
+// PublishInfo exports the identity as the service_info and instance_info metrics.
+func (id Identity) PublishInfo() {
+	serviceInfo.WithLabelValues(id.ServiceName, id.Version, id.Namespace, id.Environment, id.InstanceID).Set(1)
+	instanceInfo.WithLabelValues(id.ServiceName, id.InstanceID, id.Hostname, strconv.Itoa(os.Getpid())).Set(1)
+}
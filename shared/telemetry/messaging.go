@@ -0,0 +1,86 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MessageSampling decides on consumer spans independently of the HTTP sampler,
+// so a large backfill through a queue doesn't flood the trace backend.
+type MessageSampling struct {
+	// Every keeps one in Every message traces; 0 follows the producer's decision.
+	Every int
+	// FailuresOnly keeps no message traces up front; the tail sampler still
+	// exports the ones whose spans end with an error.
+	FailuresOnly bool
+}
+
+// ParseMessageSampling reads "" (follow the producer), "failures" or "1/N".
+func ParseMessageSampling(s string) (MessageSampling, error) {
+	switch s = strings.TrimSpace(s); {
+	case s == "":
+		return MessageSampling{}, nil
+	case s == "failures":
+		return MessageSampling{FailuresOnly: true}, nil
+	case strings.HasPrefix(s, "1/"):
+		n, err := strconv.Atoi(s[2:])
+		if err != nil || n < 1 {
+			return MessageSampling{}, fmt.Errorf("invalid message sampling %q, want 1/N with N >= 1", s)
+		}
+		return MessageSampling{Every: n}, nil
+	}
+	return MessageSampling{}, fmt.Errorf("invalid message sampling %q, want failures or 1/N", s)
+}
+
+// Enabled reports whether message spans are sampled on their own.
+func (m MessageSampling) Enabled() bool {
+	return m.Every > 0 || m.FailuresOnly
+}
+
+// Sampler applies the message decision to consumer spans and leaves the rest to next.
+// Dropped spans are still recorded so the tail sampler can keep failed messages.
+func (m MessageSampling) Sampler(next sdktrace.Sampler) sdktrace.Sampler {
+	if !m.Enabled() {
+		return next
+	}
+	return messageSampler{cfg: m, next: next}
+}
+
+type messageSampler struct {
+	cfg  MessageSampling
+	next sdktrace.Sampler
+}
+
+func (s messageSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.next.ShouldSample(p)
+	if p.Kind != trace.SpanKindConsumer {
+		return res
+	}
+
+	// Decide by trace ID, like TraceIDRatioBased, so every consumer a message is
+	// forwarded through makes the same choice, as long as the forward stays in the
+	// message's trace
+	keep := false
+	if !s.cfg.FailuresOnly {
+		bound := uint64(1<<63) / uint64(s.cfg.Every)
+		keep = binary.BigEndian.Uint64(p.TraceID[8:16])>>1 < bound
+	}
+	if keep {
+		res.Decision = sdktrace.RecordAndSample
+	} else {
+		res.Decision = sdktrace.RecordOnly
+	}
+	return res
+}
+
+func (s messageSampler) Description() string {
+	if s.cfg.FailuresOnly {
+		return "MessageSampler{failures}{" + s.next.Description() + "}"
+	}
+	return fmt.Sprintf("MessageSampler{1/%d}{%s}", s.cfg.Every, s.next.Description())
+}
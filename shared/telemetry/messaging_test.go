@@ -0,0 +1,59 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestMessageSamplingTwoHops forwards messages from one consumer to another through a
+// producer span and the trace context headers, as consumer-1 does, and checks that
+// the second consumer keeps the first one's decision.
+func TestMessageSamplingTwoHops(t *testing.T) {
+	sampler := MessageSampling{Every: 4}.Sampler(sdktrace.ParentBased(sdktrace.AlwaysSample()))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler))
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+	prop := propagation.TraceContext{}
+
+	kept := 0
+	const messages = 200
+	for i := 0; i < messages; i++ {
+		// The producer's publish, sampled by the HTTP sampler
+		ctx, publish := tracer.Start(context.Background(), "task_queue send", trace.WithSpanKind(trace.SpanKindProducer))
+		headers := propagation.MapCarrier{}
+		prop.Inject(ctx, headers)
+		publish.End()
+
+		// First hop: consume, then forward in the message's trace
+		ctx, first := tracer.Start(prop.Extract(context.Background(), headers), "task_queue process",
+			trace.WithSpanKind(trace.SpanKindConsumer))
+		ctx, forward := tracer.Start(ctx, "task_queue_2 send", trace.WithSpanKind(trace.SpanKindProducer))
+		forwarded := propagation.MapCarrier{}
+		prop.Inject(ctx, forwarded)
+		forward.End()
+		first.End()
+
+		// Second hop
+		_, second := tracer.Start(prop.Extract(context.Background(), forwarded), "task_queue_2 process",
+			trace.WithSpanKind(trace.SpanKindConsumer))
+		second.End()
+
+		if a, b := first.SpanContext(), second.SpanContext(); a.TraceID() != b.TraceID() {
+			t.Fatalf("message %d: second hop in trace %s, want %s", i, b.TraceID(), a.TraceID())
+		}
+		if a, b := first.SpanContext().IsSampled(), second.SpanContext().IsSampled(); a != b {
+			t.Fatalf("message %d: first hop sampled %v, second hop %v", i, a, b)
+		}
+		if first.SpanContext().IsSampled() {
+			kept++
+		}
+	}
+	// 1 in 4 by trace ID; the bounds only check both decisions occur
+	if kept == 0 || kept == messages {
+		t.Errorf("kept %d of %d messages, want some of each", kept, messages)
+	}
+}
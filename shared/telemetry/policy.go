@@ -0,0 +1,118 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap/zapcore"
+)
+
+// RoutePolicy overrides telemetry settings for the routes under one path prefix.
+// Unset fields keep the service-wide behaviour.
+type RoutePolicy struct {
+	// SampleRatio replaces the head sampling ratio for traces starting on the route.
+	SampleRatio *float64 `json:"sample_ratio,omitempty"`
+	// LogLevel raises the minimum level of request-scoped loggers.
+	LogLevel *zapcore.Level `json:"log_level,omitempty"`
+	// Metrics set to false keeps the route out of the RED metrics.
+	Metrics *bool `json:"metrics,omitempty"`
+}
+
+// RoutePolicies maps path prefixes to policies; the longest matching prefix wins.
+// A nil *RoutePolicies has no policies.
+type RoutePolicies struct {
+	prefixes []string
+	policies map[string]RoutePolicy
+}
+
+// ParseRoutePolicies reads a JSON object keyed by path prefix, e.g.
+//
+//	{"/chain": {"sample_ratio": 1}, "/hello": {"sample_ratio": 0.01, "log_level": "warn", "metrics": false}}
+func ParseRoutePolicies(s string) (*RoutePolicies, error) {
+	r := &RoutePolicies{policies: make(map[string]RoutePolicy)}
+	if strings.TrimSpace(s) == "" {
+		return r, nil
+	}
+	if err := json.Unmarshal([]byte(s), &r.policies); err != nil {
+		return nil, fmt.Errorf("invalid route policies: %w", err)
+	}
+	for prefix := range r.policies {
+		r.prefixes = append(r.prefixes, prefix)
+	}
+	sort.Slice(r.prefixes, func(i, j int) bool { return len(r.prefixes[i]) > len(r.prefixes[j]) })
+	return r, nil
+}
+
+// RoutePoliciesFromEnv parses TELEMETRY_ROUTE_POLICIES; unset means no policies.
+func RoutePoliciesFromEnv() (*RoutePolicies, error) {
+	return ParseRoutePolicies(os.Getenv("TELEMETRY_ROUTE_POLICIES"))
+}
+
+// MarshalJSON writes the policies in the format ParseRoutePolicies reads, for config dumps.
+func (r *RoutePolicies) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.policies)
+}
+
+// Lookup returns the policy for path.
+func (r *RoutePolicies) Lookup(path string) (RoutePolicy, bool) {
+	if r == nil {
+		return RoutePolicy{}, false
+	}
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return r.policies[prefix], true
+		}
+	}
+	return RoutePolicy{}, false
+}
+
+// MetricsEnabled reports whether requests to path should be counted in the RED metrics.
+func (r *RoutePolicies) MetricsEnabled(path string) bool {
+	p, ok := r.Lookup(path)
+	return !ok || p.Metrics == nil || *p.Metrics
+}
+
+// Sampler applies the per-route sample ratio to root spans and defers everything
+// else to base. base still sees every span, so rate-based samplers keep counting.
+func (r *RoutePolicies) Sampler(base sdktrace.Sampler) sdktrace.Sampler {
+	return &policySampler{policies: r, base: base}
+}
+
+type policySampler struct {
+	policies *RoutePolicies
+	base     sdktrace.Sampler
+}
+
+func (s *policySampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.base.ShouldSample(p)
+	if trace.SpanContextFromContext(p.ParentContext).IsValid() {
+		return res
+	}
+	if policy, ok := s.policies.Lookup(spanPath(p)); ok && policy.SampleRatio != nil {
+		return sdktrace.TraceIDRatioBased(*policy.SampleRatio).ShouldSample(p)
+	}
+	return res
+}
+
+func (s *policySampler) Description() string {
+	return "RoutePolicies{" + s.base.Description() + "}"
+}
+
+type routePolicyKey struct{}
+
+// ContextWithRoutePolicy stores the policy of the current request in ctx.
+func ContextWithRoutePolicy(ctx context.Context, p RoutePolicy) context.Context {
+	return context.WithValue(ctx, routePolicyKey{}, p)
+}
+
+// RoutePolicyFromContext returns the policy stored by ContextWithRoutePolicy.
+func RoutePolicyFromContext(ctx context.Context) (RoutePolicy, bool) {
+	p, ok := ctx.Value(routePolicyKey{}).(RoutePolicy)
+	return p, ok
+}
@@ -0,0 +1,84 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/internal/ring"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// DefaultRecentTraces is how many root spans are kept unless TRACE_RECENT_ROOTS says otherwise.
+const DefaultRecentTraces = 100
+
+// RootSpan is a locally finished root span kept for GET /debug/recent-traces.
+type RootSpan struct {
+	TraceID  string        `json:"trace_id"`
+	SpanID   string        `json:"span_id"`
+	Name     string        `json:"name"`
+	Kind     string        `json:"kind"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Status   string        `json:"status"`
+	// StatusMessage is the error description, if any.
+	StatusMessage string `json:"status_message,omitempty"`
+	// Sampled is false for traces the tail sampler may still drop.
+	Sampled bool `json:"sampled"`
+}
+
+var recentTraces = ring.New[RootSpan](recentTracesSize())
+
+func recentTracesSize() int {
+	if n, err := strconv.Atoi(os.Getenv("TRACE_RECENT_ROOTS")); err == nil && n > 0 {
+		return n
+	}
+	return DefaultRecentTraces
+}
+
+// RecentTraces returns the last root spans finished in this process, newest first.
+func RecentTraces() []RootSpan {
+	return recentTraces.Snapshot()
+}
+
+// RecentTracesHandler serves RecentTraces as JSON.
+func RecentTracesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(RecentTraces())
+	})
+}
+
+// recentProcessor keeps spans whose parent is absent or in another process.
+type recentProcessor struct{}
+
+func (recentProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (recentProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if parent := s.Parent(); parent.IsValid() && !parent.IsRemote() {
+		return
+	}
+	status := s.Status()
+	root := RootSpan{
+		TraceID:  s.SpanContext().TraceID().String(),
+		SpanID:   s.SpanContext().SpanID().String(),
+		Name:     s.Name(),
+		Kind:     s.SpanKind().String(),
+		Start:    s.StartTime(),
+		Duration: s.EndTime().Sub(s.StartTime()),
+		Status:   status.Code.String(),
+		Sampled:  s.SpanContext().IsSampled(),
+	}
+	if status.Code == codes.Error {
+		root.StatusMessage = status.Description
+	}
+	recentTraces.Add(root)
+}
+
+func (recentProcessor) Shutdown(context.Context) error   { return nil }
+func (recentProcessor) ForceFlush(context.Context) error { return nil }
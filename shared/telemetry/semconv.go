@@ -0,0 +1,125 @@
+package telemetry
+
+import (
+	"net"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// SchemaURL is the semantic-convention version of the attributes the helpers below emit.
+const SchemaURL = semconv.SchemaURL
+
+// HTTPRequest is what a server span knows about a request when it starts.
+type HTTPRequest struct {
+	Method          string
+	Scheme          string
+	Path            string
+	Host            string
+	UserAgent       string
+	ClientAddress   string
+	ProtocolVersion string
+}
+
+// Attributes are the current-spec attributes of the request. Methods outside the spec's
+// list are reported as _OTHER, with the original kept alongside.
+func (r HTTPRequest) Attributes() []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 8)
+	attrs = append(attrs, httpMethod(r.Method)...)
+	attrs = append(attrs, semconv.URLScheme(r.Scheme), semconv.URLPath(r.Path))
+	if host, port, ok := splitHostPort(r.Host); ok {
+		attrs = append(attrs, semconv.ServerAddress(host))
+		if port > 0 {
+			attrs = append(attrs, semconv.ServerPort(port))
+		}
+	}
+	if r.UserAgent != "" {
+		attrs = append(attrs, semconv.UserAgentOriginal(r.UserAgent))
+	}
+	if r.ClientAddress != "" {
+		attrs = append(attrs, semconv.ClientAddress(r.ClientAddress))
+	}
+	if r.ProtocolVersion != "" {
+		attrs = append(attrs, semconv.NetworkProtocolVersion(r.ProtocolVersion))
+	}
+	return attrs
+}
+
+// httpStatusCode is the older name of http.response.status_code, still set for queries
+// written against it.
+const httpStatusCode attribute.Key = "http.status_code"
+
+// HTTPResponse are the attributes a server span learns once the route has run;
+// a 5xx also sets error.type to the status code, as the spec asks.
+func HTTPResponse(route string, status int) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.HTTPResponseStatusCode(status), httpStatusCode.Int(status)}
+	if route != "" {
+		attrs = append(attrs, semconv.HTTPRoute(route))
+	}
+	if status >= 500 {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+	}
+	return attrs
+}
+
+// ErrorType is error.type for a failure of a known class, such as an application error
+// code, which says more than the status code HTTPResponse falls back to.
+func ErrorType(class string) attribute.KeyValue {
+	return semconv.ErrorTypeKey.String(class)
+}
+
+// Messaging operations on RabbitMQ.
+var (
+	MessagingSend    = semconv.MessagingOperationTypeSend
+	MessagingProcess = semconv.MessagingOperationTypeProcess
+)
+
+// MessagingAttributes are the attributes of a RabbitMQ producer or consumer span. The
+// destination name is the routing key, which on the default exchange is the queue.
+func MessagingAttributes(op attribute.KeyValue, routingKey, messageID string, bodySize int) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemRabbitMQ,
+		op,
+		semconv.MessagingOperationName(op.Value.AsString()),
+		semconv.MessagingDestinationName(routingKey),
+		semconv.MessagingRabbitMQDestinationRoutingKey(routingKey),
+		semconv.MessagingMessageBodySize(bodySize),
+	}
+	if messageID != "" {
+		attrs = append(attrs, semconv.MessagingMessageID(messageID))
+	}
+	return attrs
+}
+
+var knownMethods = map[string]attribute.KeyValue{
+	"CONNECT": semconv.HTTPRequestMethodConnect,
+	"DELETE":  semconv.HTTPRequestMethodDelete,
+	"GET":     semconv.HTTPRequestMethodGet,
+	"HEAD":    semconv.HTTPRequestMethodHead,
+	"OPTIONS": semconv.HTTPRequestMethodOptions,
+	"PATCH":   semconv.HTTPRequestMethodPatch,
+	"POST":    semconv.HTTPRequestMethodPost,
+	"PUT":     semconv.HTTPRequestMethodPut,
+	"TRACE":   semconv.HTTPRequestMethodTrace,
+}
+
+func httpMethod(m string) []attribute.KeyValue {
+	if kv, ok := knownMethods[m]; ok {
+		return []attribute.KeyValue{kv}
+	}
+	return []attribute.KeyValue{semconv.HTTPRequestMethodOther, semconv.HTTPRequestMethodOriginal(m)}
+}
+
+func splitHostPort(hostport string) (string, int, bool) {
+	if hostport == "" {
+		return "", 0, false
+	}
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// No port
+		return hostport, 0, true
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port, true
+}
@@ -0,0 +1,64 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ShadowKey marks mirrored traffic, both as a baggage member and as a span attribute.
+const ShadowKey = "shadow"
+
+// ReplayKey marks replayed traffic, both as a baggage member and as a span attribute.
+const ReplayKey = "replay"
+
+// WithShadow marks ctx as carrying mirrored traffic. The mark travels as baggage, so
+// every span of the mirrored request is tagged shadow=true, in every service it reaches.
+func WithShadow(ctx context.Context) context.Context {
+	return withMark(ctx, ShadowKey)
+}
+
+// IsShadow reports whether ctx carries mirrored traffic.
+func IsShadow(ctx context.Context) bool {
+	return baggage.FromContext(ctx).Member(ShadowKey).Value() == "true"
+}
+
+// WithReplay marks ctx as carrying replayed traffic; its spans are tagged replay=true.
+func WithReplay(ctx context.Context) context.Context {
+	return withMark(ctx, ReplayKey)
+}
+
+// IsReplay reports whether ctx carries replayed traffic.
+func IsReplay(ctx context.Context) bool {
+	return baggage.FromContext(ctx).Member(ReplayKey).Value() == "true"
+}
+
+func withMark(ctx context.Context, key string) context.Context {
+	m, err := baggage.NewMember(key, "true")
+	if err != nil {
+		return ctx
+	}
+	b, err := baggage.FromContext(ctx).SetMember(m)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, b)
+}
+
+// shadowProcessor tags spans started in a shadow or replay context.
+type shadowProcessor struct{}
+
+func (shadowProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	if IsShadow(parent) {
+		s.SetAttributes(attribute.Bool(ShadowKey, true))
+	}
+	if IsReplay(parent) {
+		s.SetAttributes(attribute.Bool(ReplayKey, true))
+	}
+}
+
+func (shadowProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (shadowProcessor) Shutdown(context.Context) error   { return nil }
+func (shadowProcessor) ForceFlush(context.Context) error { return nil }
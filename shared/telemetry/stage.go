@@ -0,0 +1,46 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/daanielsharon/observability-go/shared/attrs"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Pipeline stages, in the order a request passes through them: app takes it in, app-2
+// processes it, consumer-1 forwards it and consumer-2 finishes it.
+const (
+	StageIngest  = "ingest"
+	StageProcess = "process"
+	StageForward = "forward"
+	StageFinal   = "final"
+)
+
+var stageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "pipeline_stage_duration_seconds",
+	Help:    "Time each pipeline stage spends on a request or message, from its local root span.",
+	Buckets: prometheus.ExponentialBuckets(.001, 2.5, 12),
+}, []string{"stage"})
+
+// stageProcessor tags every span with the service's pipeline stage and times the
+// stage's share of each request or message by its entry span.
+type stageProcessor struct{ stage string }
+
+func (p stageProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	s.SetAttributes(attrs.PipelineStage.String(p.stage))
+}
+
+func (p stageProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	localRoot := !s.Parent().IsValid() || s.Parent().IsRemote()
+	if !localRoot || (s.SpanKind() != trace.SpanKindServer && s.SpanKind() != trace.SpanKindConsumer) {
+		return
+	}
+	stageDuration.WithLabelValues(p.stage).Observe(s.EndTime().Sub(s.StartTime()).Seconds())
+}
+
+func (stageProcessor) Shutdown(context.Context) error   { return nil }
+func (stageProcessor) ForceFlush(context.Context) error { return nil }
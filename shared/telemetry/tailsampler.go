@@ -0,0 +1,165 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var retainedTraces = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "sampler_retained_traces_total",
+	Help: "Traces exported although the head sampler dropped them, by reason (error, latency).",
+}, []string{"reason"})
+
+const (
+	maxBufferedTraces = 10000
+	maxSpansPerTrace  = 512
+)
+
+// TailSampler keeps the traces its head sampler picks, but records the rest locally
+// and still exports a trace if any of its spans ends with an error or runs longer
+// than the latency threshold. It is both the Sampler and the SpanProcessor wrapping
+// the exporting processor.
+//
+// Decisions are per process: each service buffers its own part of a trace until the
+// local root span ends, so a retained trace may still miss spans from other services.
+type TailSampler struct {
+	head      sdktrace.Sampler
+	next      sdktrace.SpanProcessor
+	threshold time.Duration
+
+	mu      sync.Mutex
+	pending map[trace.TraceID][]sdktrace.ReadOnlySpan
+	kept    map[trace.TraceID]struct{}
+}
+
+// SpawnedBy marks the link from the root span of a detached goroutine's trace to the
+// span that started it. The tail sampler treats that span as the root's parent, so the
+// goroutine's trace keeps the decision made for the one it came from.
+var SpawnedBy = attribute.String("link.type", "spawned_by")
+
+func NewTailSampler(head sdktrace.Sampler, threshold time.Duration, next sdktrace.SpanProcessor) *TailSampler {
+	return &TailSampler{
+		head:      head,
+		next:      next,
+		threshold: threshold,
+		pending:   make(map[trace.TraceID][]sdktrace.ReadOnlySpan),
+		kept:      make(map[trace.TraceID]struct{}),
+	}
+}
+
+func (t *TailSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	// The head sampler sees every span, so rate-based samplers can count them
+	res := t.head.ShouldSample(p)
+
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	if !psc.IsValid() {
+		psc = spawnedBy(p.Links)
+	}
+	ts := psc.TraceState()
+	switch {
+	case psc.IsValid() && psc.IsSampled():
+		return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: ts}
+	case psc.IsValid():
+		// Parent was not sampled: record anyway so an error here can still retain the trace
+		return sdktrace.SamplingResult{Decision: sdktrace.RecordOnly, Tracestate: ts}
+	}
+
+	if res.Decision == sdktrace.Drop {
+		res.Decision = sdktrace.RecordOnly
+	}
+	return res
+}
+
+// spawnedBy returns the span context of the SpawnedBy link, if there is one.
+func spawnedBy(links []trace.Link) trace.SpanContext {
+	for _, l := range links {
+		for _, kv := range l.Attributes {
+			if kv == SpawnedBy {
+				return l.SpanContext
+			}
+		}
+	}
+	return trace.SpanContext{}
+}
+
+func (t *TailSampler) Description() string {
+	return "TailSampler{" + t.head.Description() + "}"
+}
+
+func (t *TailSampler) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	t.next.OnStart(parent, s)
+}
+
+func (t *TailSampler) OnEnd(s sdktrace.ReadOnlySpan) {
+	sc := s.SpanContext()
+	if sc.IsSampled() {
+		t.next.OnEnd(s)
+		return
+	}
+
+	id := sc.TraceID()
+	localRoot := !s.Parent().IsValid() || s.Parent().IsRemote()
+
+	reason := ""
+	if s.Status().Code == codes.Error {
+		reason = "error"
+	} else if s.EndTime().Sub(s.StartTime()) > t.threshold {
+		reason = "latency"
+	}
+
+	t.mu.Lock()
+	var flush []sdktrace.ReadOnlySpan
+	_, kept := t.kept[id]
+	switch {
+	case kept:
+		flush = []sdktrace.ReadOnlySpan{s}
+	case reason != "":
+		flush = append(t.pending[id], s)
+		delete(t.pending, id)
+		if !localRoot {
+			t.kept[id] = struct{}{}
+		}
+		retainedTraces.WithLabelValues(reason).Inc()
+	case localRoot:
+		delete(t.pending, id)
+	default:
+		spans, buffered := t.pending[id]
+		if (buffered || len(t.pending) < maxBufferedTraces) && len(spans) < maxSpansPerTrace {
+			t.pending[id] = append(spans, s)
+		}
+	}
+	if localRoot {
+		delete(t.kept, id)
+	}
+	t.mu.Unlock()
+
+	for _, span := range flush {
+		t.next.OnEnd(sampledSpan{ReadOnlySpan: span})
+	}
+}
+
+func (t *TailSampler) Shutdown(ctx context.Context) error {
+	return t.next.Shutdown(ctx)
+}
+
+func (t *TailSampler) ForceFlush(ctx context.Context) error {
+	return t.next.ForceFlush(ctx)
+}
+
+// sampledSpan flips the sampled flag so the exporting processor accepts a retained span.
+type sampledSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s sampledSpan) SpanContext() trace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
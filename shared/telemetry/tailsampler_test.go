@@ -0,0 +1,64 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTailSamplerFollowsSpawnedBy(t *testing.T) {
+	spawner := func(flags trace.TraceFlags) trace.SpanContext {
+		return trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: flags,
+		})
+	}
+	for _, tt := range []struct {
+		name  string
+		head  sdktrace.Sampler
+		links []trace.Link
+		want  sdktrace.SamplingDecision
+	}{
+		{
+			name:  "sampled spawner",
+			head:  sdktrace.NeverSample(),
+			links: []trace.Link{{SpanContext: spawner(trace.FlagsSampled), Attributes: []attribute.KeyValue{SpawnedBy}}},
+			want:  sdktrace.RecordAndSample,
+		},
+		{
+			name:  "unsampled spawner",
+			head:  sdktrace.AlwaysSample(),
+			links: []trace.Link{{SpanContext: spawner(0), Attributes: []attribute.KeyValue{SpawnedBy}}},
+			want:  sdktrace.RecordOnly,
+		},
+		{
+			name:  "other link",
+			head:  sdktrace.NeverSample(),
+			links: []trace.Link{{SpanContext: spawner(trace.FlagsSampled)}},
+			want:  sdktrace.RecordOnly,
+		},
+		{
+			name: "no link",
+			head: sdktrace.AlwaysSample(),
+			want: sdktrace.RecordAndSample,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewTailSampler(tt.head, time.Second, nil)
+			res := s.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: context.Background(),
+				TraceID:       trace.TraceID{2},
+				Name:          "goroutine",
+				Links:         tt.links,
+			})
+			if res.Decision != tt.want {
+				t.Errorf("decision = %v, want %v", res.Decision, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type Config struct {
+	ServiceName string
+	// Identity adds namespace, environment and instance ID to the trace resource.
+	Identity Identity
+	// Exporter is "otlp" (default), "zipkin" or "stdout", which prints spans for local runs.
+	Exporter string
+	// Endpoint is the OTLP host:port, e.g. tempo:4318 for HTTP or tempo:4317 for gRPC.
+	Endpoint string
+	// Protocol is "http" or "grpc".
+	Protocol string
+	// ZipkinEndpoint is the Zipkin span collector URL, used when Exporter is "zipkin".
+	ZipkinEndpoint string
+	// Filter drops spans for operational paths; nil keeps everything.
+	Filter *PathFilter
+	// Policies override the head sampling ratio for traces starting on specific routes.
+	Policies *RoutePolicies
+	// Messages samples consumer spans on their own instead of following the producer.
+	Messages MessageSampling
+	// SampleRatio is the share of traces kept up front; error and slow traces are retained regardless.
+	SampleRatio float64
+	// SpansPerSecond, when set, makes the head sampling probability adapt to this budget
+	// instead of staying at SampleRatio (which is then only the starting point).
+	SpansPerSecond   float64
+	LatencyThreshold time.Duration
+	// IDGenerator is "xray" for X-Ray compatible trace IDs; anything else uses the SDK's random IDs.
+	IDGenerator string
+}
+
+// ConfigFromEnv fills the sampling settings from TRACE_SAMPLE_RATIO (default 1),
+// TRACE_SPANS_PER_SECOND (default 0, adaptive sampling off) and TRACE_LATENCY_THRESHOLD (default 1s),
+// message sampling from TRACE_MESSAGE_SAMPLING ("failures" or "1/N"),
+// the ID generator from TRACE_ID_GENERATOR, the exporter from TRACE_EXPORTER and ZIPKIN_ENDPOINT,
+// and the deployment identity via IdentityFromEnv. TRACE_ENDPOINT and TRACE_PROTOCOL
+// override the OTLP endpoint and protocol given.
+func ConfigFromEnv(serviceName, endpoint, protocol string) Config {
+	cfg := Config{
+		ServiceName:      serviceName,
+		Identity:         IdentityFromEnv(),
+		Exporter:         os.Getenv("TRACE_EXPORTER"),
+		Endpoint:         endpoint,
+		Protocol:         protocol,
+		ZipkinEndpoint:   "http://localhost:9411/api/v2/spans",
+		SampleRatio:      1,
+		LatencyThreshold: time.Second,
+		IDGenerator:      os.Getenv("TRACE_ID_GENERATOR"),
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("TRACE_SAMPLE_RATIO"), 64); err == nil {
+		cfg.SampleRatio = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("TRACE_SPANS_PER_SECOND"), 64); err == nil {
+		cfg.SpansPerSecond = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("TRACE_LATENCY_THRESHOLD")); err == nil {
+		cfg.LatencyThreshold = v
+	}
+	if v, err := ParseMessageSampling(os.Getenv("TRACE_MESSAGE_SAMPLING")); err == nil {
+		cfg.Messages = v
+	}
+	if cfg.Exporter == "" {
+		cfg.Exporter = "otlp"
+	}
+	if v := os.Getenv("ZIPKIN_ENDPOINT"); v != "" {
+		cfg.ZipkinEndpoint = v
+	}
+	if v := os.Getenv("TRACE_ENDPOINT"); v != "" {
+		cfg.Endpoint = v
+	}
+	if v := os.Getenv("TRACE_PROTOCOL"); v == "http" || v == "grpc" {
+		cfg.Protocol = v
+	}
+	return cfg
+}
+
+// Collector is the address spans are exported to, for waiting on it at startup, or ""
+// when the exporter doesn't send them anywhere.
+func (cfg Config) Collector() string {
+	switch cfg.Exporter {
+	case "stdout":
+		return ""
+	case "zipkin":
+		return cfg.ZipkinEndpoint
+	}
+	return cfg.Endpoint
+}
+
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case "zipkin":
+		return zipkin.New(cfg.ZipkinEndpoint)
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+
+	var client otlptrace.Client
+	if cfg.Protocol == "grpc" {
+		client = otlptracegrpc.NewClient(
+			otlptracegrpc.WithEndpoint(cfg.Endpoint),
+			otlptracegrpc.WithInsecure(),
+		)
+	} else {
+		client = otlptracehttp.NewClient(
+			otlptracehttp.WithEndpoint(cfg.Endpoint),
+			otlptracehttp.WithInsecure(),
+		)
+	}
+	return otlptrace.New(ctx, client)
+}
+
+// InitTracer installs the global tracer provider exporting to Tempo over OTLP (or to Zipkin),
+// and the TraceContext+Baggage propagator. The returned func flushes and shuts down the provider.
+func InitTracer(ctx context.Context, cfg Config) (func(), error) {
+	exp, err := newExporter(ctx, cfg)
+	if err != nil {
+		return func() {}, err
+	}
+
+	id := cfg.Identity
+	id.ServiceName = cfg.ServiceName
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(SchemaURL),
+		resource.WithAttributes(id.Attributes()...),
+	)
+	if err != nil {
+		return func() {}, err
+	}
+
+	head := sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	if cfg.SpansPerSecond > 0 {
+		head = NewAdaptiveSampler(cfg.SpansPerSecond, cfg.SampleRatio)
+	}
+	if cfg.Policies != nil {
+		head = cfg.Policies.Sampler(head)
+	}
+
+	tail := NewTailSampler(head, cfg.LatencyThreshold, newExportPipeline(cfg, exp))
+	var sampler sdktrace.Sampler = tail
+	if cfg.Filter != nil {
+		sampler = cfg.Filter.Sampler(sampler)
+	}
+	sampler = cfg.Messages.Sampler(sampler)
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSpanProcessor(shadowProcessor{}),
+		sdktrace.WithSpanProcessor(watchProcessor{}),
+		sdktrace.WithSpanProcessor(tail),
+		sdktrace.WithSpanProcessor(recentProcessor{}),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	}
+	if id.Stage != "" {
+		opts = append(opts, sdktrace.WithSpanProcessor(stageProcessor{stage: id.Stage}))
+	}
+	if cfg.IDGenerator == "xray" {
+		opts = append(opts, sdktrace.WithIDGenerator(NewXRayIDGenerator()))
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	SetPropagator()
+
+	return func() { _ = tp.Shutdown(context.Background()) }, nil
+}
+
+// SetPropagator installs the W3C TraceContext and Baggage propagators used by every service.
+func SetPropagator() {
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	)
+}
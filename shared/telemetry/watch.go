@@ -0,0 +1,47 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type traceWatchKey struct{}
+
+type traceWatch struct {
+	mu sync.Mutex
+	id trace.TraceID
+}
+
+// WatchTrace returns a ctx that notes the trace of the first span started under it, and a
+// func returning that trace ID (zero until then). Middleware running around a handler that
+// starts its own span uses it to learn which trace the request ended up in.
+func WatchTrace(ctx context.Context) (context.Context, func() trace.TraceID) {
+	w := &traceWatch{}
+	return context.WithValue(ctx, traceWatchKey{}, w), func() trace.TraceID {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.id
+	}
+}
+
+// watchProcessor reports started spans to the WatchTrace of their parent context.
+type watchProcessor struct{}
+
+func (watchProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	w, ok := parent.Value(traceWatchKey{}).(*traceWatch)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.id.IsValid() {
+		w.id = s.SpanContext().TraceID()
+	}
+}
+
+func (watchProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (watchProcessor) Shutdown(context.Context) error   { return nil }
+func (watchProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,47 @@
+package telemetry
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// XRayIDGenerator produces trace IDs whose first 4 bytes are the epoch seconds,
+// as AWS X-Ray requires, so traces can be mirrored into X-Ray backends unchanged.
+type XRayIDGenerator struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func NewXRayIDGenerator() *XRayIDGenerator {
+	var seed int64
+	_ = binary.Read(crand.Reader, binary.LittleEndian, &seed)
+	return &XRayIDGenerator{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (g *XRayIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var tid trace.TraceID
+	binary.BigEndian.PutUint32(tid[:4], uint32(time.Now().Unix()))
+	_, _ = g.rand.Read(tid[4:])
+
+	var sid trace.SpanID
+	_, _ = g.rand.Read(sid[:])
+	return tid, sid
+}
+
+func (g *XRayIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var sid trace.SpanID
+	_, _ = g.rand.Read(sid[:])
+	return sid
+}
@@ -0,0 +1,107 @@
+// Package testkit holds the fakes the services' tests share: a clock that sleeps at
+// once, a fixed random source, and a recorder for the spans a test produces. It is
+// for tests only; nothing outside a _test.go file should import it.
+package testkit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daanielsharon/observability-go/shared/clock"
+	"github.com/daanielsharon/observability-go/shared/logger"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+// SleepClock is a fake clock whose Sleep records the delay and moves the clock past it
+// at once, so simulated work takes no time.
+type SleepClock struct {
+	*clock.Fake
+	mu    sync.Mutex
+	slept []time.Duration
+}
+
+func NewSleepClock() *SleepClock {
+	return &SleepClock{Fake: clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))}
+}
+
+func (c *SleepClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	c.slept = append(c.slept, d)
+	c.mu.Unlock()
+	c.Advance(d)
+}
+
+// After records the wait like Sleep and fires at once.
+func (c *SleepClock) After(d time.Duration) <-chan time.Time {
+	ch := c.Fake.After(d)
+	c.Sleep(d)
+	return ch
+}
+
+// Slept returns the delays slept so far, in order.
+func (c *SleepClock) Slept() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.slept...)
+}
+
+// Total returns the time slept so far.
+func (c *SleepClock) Total() time.Duration {
+	var sum time.Duration
+	for _, d := range c.Slept() {
+		sum += d
+	}
+	return sum
+}
+
+// FixedRand always draws N, capped to the range asked for.
+type FixedRand struct{ N int }
+
+func (r FixedRand) Intn(n int) int       { return min(r.N, n-1) }
+func (r FixedRand) Int63n(n int64) int64 { return min(int64(r.N), n-1) }
+func (r FixedRand) Float64() float64     { return 0 }
+
+// RecordSpans routes the global tracer provider to an in-memory exporter for the
+// duration of the test, and silences the global logger.
+func RecordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	logger.SetGlobal(&logger.Logger{Logger: zap.NewNop()})
+	t.Cleanup(func() {
+		_ = tp.Shutdown(context.Background())
+		otel.SetTracerProvider(prev)
+	})
+	return exporter
+}
+
+// FindSpan returns the first span named name, failing the test if there is none.
+func FindSpan(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range exporter.GetSpans() {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no span %q", name)
+	return tracetest.SpanStub{}
+}
+
+// Attr returns the span's attribute key, and whether it was set.
+func Attr(s tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
@@ -4,10 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/textproto"
+	"strings"
+	"time"
 
+	"github.com/daanielsharon/observability-go/shared/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
 )
 
 func InjectTraceContext(ctx context.Context) map[string]string {
@@ -26,10 +35,235 @@ func ExtractTraceContext(ctx context.Context, traceMap map[string]string) contex
 	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(traceMap))
 }
 
-func Trace(ctx context.Context, layer, funcName, spanName string) (context.Context, trace.Span, string) {
+// ValuesCarrier adapts a multi-valued header map, such as gRPC metadata or a custom
+// transport's headers, to a propagation.TextMapCarrier. Keys are written lowercase, as
+// gRPC requires; reads also find them in canonical HTTP form.
+type ValuesCarrier map[string][]string
+
+var _ propagation.TextMapCarrier = ValuesCarrier(nil)
+
+func (c ValuesCarrier) Get(key string) string {
+	for _, k := range []string{key, strings.ToLower(key), textproto.CanonicalMIMEHeaderKey(key)} {
+		if v := c[k]; len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+func (c ValuesCarrier) Set(key, value string) {
+	c[strings.ToLower(key)] = []string{value}
+}
+
+func (c ValuesCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// InjectTraceContextValues writes the trace context of ctx into a multi-valued header map.
+func InjectTraceContextValues(ctx context.Context, values map[string][]string) {
+	otel.GetTextMapPropagator().Inject(ctx, ValuesCarrier(values))
+}
+
+// ExtractTraceContextValues returns ctx with the trace context read from a multi-valued header map.
+func ExtractTraceContextValues(ctx context.Context, values map[string][]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, ValuesCarrier(values))
+}
+
+// InjectTraceContextGRPC returns ctx with the trace context added to its outgoing gRPC
+// metadata, keeping the metadata already there.
+func InjectTraceContextGRPC(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	InjectTraceContextValues(ctx, md)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// ExtractTraceContextGRPC returns ctx with the trace context from its incoming gRPC metadata.
+func ExtractTraceContextGRPC(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return ExtractTraceContextValues(ctx, md)
+}
+
+// AnyCarrier adapts a map[string]any, such as decoded JSON or message headers, to a
+// propagation.TextMapCarrier. String, []byte and json.RawMessage values are read as text.
+type AnyCarrier map[string]any
+
+var _ propagation.TextMapCarrier = AnyCarrier(nil)
+
+func (c AnyCarrier) Get(key string) string {
+	s, _ := carrierValue(c[key])
+	return s
+}
+
+func (c AnyCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c AnyCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// carrierValue returns v as text if it is a type a carrier can hold.
+func carrierValue(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.RawMessage:
+		// A JSON string is unquoted; anything else is kept as written
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			return s, true
+		}
+		return string(v), true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
+
+// CarrierFrom reads a trace carrier from headers: a map[string]any or map[string]string,
+// or their JSON encoding as a string or []byte, also when that JSON was encoded twice.
+// Values that aren't text are an error rather than being formatted.
+func CarrierFrom(raw any) (AnyCarrier, error) {
+	switch t := raw.(type) {
+	case nil:
+		return AnyCarrier{}, nil
+	case AnyCarrier:
+		return t, checkCarrier(t)
+	case map[string]any:
+		return AnyCarrier(t), checkCarrier(t)
+	case map[string]string:
+		c := make(AnyCarrier, len(t))
+		for k, v := range t {
+			c[k] = v
+		}
+		return c, nil
+	case string:
+		return carrierFromJSON([]byte(t))
+	case []byte:
+		return carrierFromJSON(t)
+	case json.RawMessage:
+		return carrierFromJSON(t)
+	}
+	return nil, fmt.Errorf("trace carrier: unsupported type %T", raw)
+}
+
+func carrierFromJSON(b []byte) (AnyCarrier, error) {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("trace carrier: %w", err)
+	}
+	// A carrier stored as a JSON string inside JSON
+	if s, ok := v.(string); ok {
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, fmt.Errorf("trace carrier: %w", err)
+		}
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("trace carrier: want a JSON object, got %T", v)
+	}
+	return AnyCarrier(m), checkCarrier(m)
+}
+
+func checkCarrier(m map[string]any) error {
+	for k, v := range m {
+		if _, ok := carrierValue(v); !ok {
+			return fmt.Errorf("trace carrier: header %q has unsupported type %T", k, v)
+		}
+	}
+	return nil
+}
+
+// ExtractTraceContextFrom returns ctx with the trace context read from raw as CarrierFrom
+// accepts it; on error ctx is returned unchanged.
+func ExtractTraceContextFrom(ctx context.Context, raw any) (context.Context, error) {
+	c, err := CarrierFrom(raw)
+	if err != nil {
+		return ctx, err
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, c), nil
+}
+
+var operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "operation_duration_seconds",
+	Help:    "Duration of operations traced with shared.Trace, by layer, function and outcome (ok, error).",
+	Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}, []string{"layer", "func", "outcome"})
+
+// Op is an operation started by Trace. Its End records the outcome on the span, in the
+// operation_duration_seconds histogram and in the log, so callers don't have to.
+type Op struct {
+	trace.Span
+	// SpanID is the span's ID as logged by logger.WithTrace.
+	SpanID string
+
+	ctx      context.Context
+	layer    string
+	funcName string
+	start    time.Time
+}
+
+// Trace starts a span named spanName with a tracer named "<layer>/<funcName>".
+// Call End on the returned Op with the operation's error, typically deferred:
+//
+//	ctx, op := shared.Trace(ctx, "service", "ReserveStock", "saga reserve")
+//	defer func() { op.End(err) }()
+func Trace(ctx context.Context, layer, funcName, spanName string) (context.Context, *Op) {
 	tracer := otel.Tracer(fmt.Sprintf("%s/%s", layer, funcName))
 	ctx, span := tracer.Start(ctx, spanName)
-	return ctx, span, span.SpanContext().SpanID().String()
+	return ctx, &Op{
+		Span:     span,
+		SpanID:   span.SpanContext().SpanID().String(),
+		ctx:      ctx,
+		layer:    layer,
+		funcName: funcName,
+		start:    time.Now(),
+	}
+}
+
+// End ends the span, marking it failed with RecordError if err is not nil, observes
+// the duration and logs the completion: failures at error level, the rest at debug.
+func (o *Op) End(err error) {
+	d := time.Since(o.start)
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+		RecordError(o.ctx, err, "")
+	}
+	operationDuration.WithLabelValues(o.layer, o.funcName, outcome).Observe(d.Seconds())
+
+	log := logger.WithTrace(o.ctx, o.SpanID)
+	if err != nil {
+		log.Error("operation failed",
+			zap.String("layer", o.layer),
+			zap.String("func", o.funcName),
+			zap.Duration("duration", d),
+			zap.Error(err),
+		)
+	} else {
+		log.Debug("operation completed",
+			zap.String("layer", o.layer),
+			zap.String("func", o.funcName),
+			zap.Duration("duration", d),
+		)
+	}
+	o.Span.End()
 }
 
 func Info(ctx context.Context) {
@@ -47,6 +281,9 @@ func Info(ctx context.Context) {
 }
 
 // dipakai untuk convert trace context json ke map[string]string
+//
+// Deprecated: use CarrierFrom, which keeps []byte values intact and reports malformed
+// input instead of dropping it.
 func ConvertToMap(raw any) map[string]string {
 	traceMap := make(map[string]string)
 	switch t := raw.(type) {
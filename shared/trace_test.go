@@ -0,0 +1,93 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceparent = "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01"
+
+func TestCarrierFrom(t *testing.T) {
+	doubleEncoded, _ := json.Marshal(`{"traceparent":"` + testTraceparent + `"}`)
+
+	for _, tt := range []struct {
+		name    string
+		raw     any
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "nil", raw: nil, want: map[string]string{}},
+		{name: "map[string]any", raw: map[string]any{"traceparent": testTraceparent}, want: map[string]string{"traceparent": testTraceparent}},
+		{name: "map[string]any with []byte value", raw: map[string]any{"traceparent": []byte(testTraceparent)}, want: map[string]string{"traceparent": testTraceparent}},
+		{name: "map[string]any with raw JSON string", raw: map[string]any{"traceparent": json.RawMessage(`"` + testTraceparent + `"`)}, want: map[string]string{"traceparent": testTraceparent}},
+		{name: "map[string]any with number", raw: map[string]any{"traceparent": 42}, wantErr: true},
+		{name: "map[string]string", raw: map[string]string{"traceparent": testTraceparent, "tracestate": "a=1"}, want: map[string]string{"traceparent": testTraceparent, "tracestate": "a=1"}},
+		{name: "JSON string", raw: `{"traceparent":"` + testTraceparent + `"}`, want: map[string]string{"traceparent": testTraceparent}},
+		{name: "JSON []byte", raw: []byte(`{"traceparent":"` + testTraceparent + `"}`), want: map[string]string{"traceparent": testTraceparent}},
+		{name: "json.RawMessage", raw: json.RawMessage(`{"traceparent":"` + testTraceparent + `"}`), want: map[string]string{"traceparent": testTraceparent}},
+		{name: "double-encoded JSON string", raw: string(doubleEncoded), want: map[string]string{"traceparent": testTraceparent}},
+		{name: "double-encoded JSON []byte", raw: doubleEncoded, want: map[string]string{"traceparent": testTraceparent}},
+		{name: "malformed JSON", raw: `{"traceparent":`, wantErr: true},
+		{name: "malformed double-encoded JSON", raw: `"{\"traceparent\":"`, wantErr: true},
+		{name: "JSON array", raw: `["traceparent"]`, wantErr: true},
+		{name: "JSON object with non-text value", raw: `{"traceparent":{"nested":true}}`, wantErr: true},
+		{name: "unsupported type int", raw: 42, wantErr: true},
+		{name: "unsupported type map[string]int", raw: map[string]int{"traceparent": 1}, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := CarrierFrom(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("CarrierFrom(%#v) = %v, want an error", tt.raw, c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CarrierFrom(%#v): %v", tt.raw, err)
+			}
+			got := make(map[string]string, len(c))
+			for _, k := range c.Keys() {
+				got[k] = c.Get(k)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CarrierFrom(%#v) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnyCarrierRoundTrip(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	})
+	c := AnyCarrier{}
+	otel.GetTextMapPropagator().Inject(trace.ContextWithSpanContext(context.Background(), sc), c)
+	if got := c.Get("traceparent"); got != testTraceparent {
+		t.Fatalf("injected traceparent = %q, want %q", got, testTraceparent)
+	}
+
+	// Through JSON and back, as message headers travel
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := ExtractTraceContextFrom(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := trace.SpanContextFromContext(ctx); !got.Equal(sc.WithRemote(true)) {
+		t.Errorf("extracted %v, want %v", got, sc)
+	}
+}
@@ -0,0 +1,308 @@
+package tracequery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTraceID is returned for IDs that are not 32 hex characters.
+var ErrInvalidTraceID = errors.New("invalid trace ID, want 32 hex characters")
+
+// Span is one span of a trace as stored in Tempo.
+type Span struct {
+	SpanID        string        `json:"span_id"`
+	ParentSpanID  string        `json:"parent_span_id,omitempty"`
+	Service       string        `json:"service"`
+	Name          string        `json:"name"`
+	Kind          string        `json:"kind,omitempty"`
+	Start         time.Time     `json:"start"`
+	Duration      time.Duration `json:"duration"`
+	Error         bool          `json:"error,omitempty"`
+	StatusMessage string        `json:"status_message,omitempty"`
+}
+
+// Log is one log entry mentioning the trace ID, as stored in Loki.
+type Log struct {
+	Time    time.Time      `json:"time"`
+	Service string         `json:"service"`
+	Level   string         `json:"level,omitempty"`
+	Message string         `json:"message"`
+	SpanID  string         `json:"span_id,omitempty"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// Event is a span start or a log entry on the merged timeline.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Offset is the time since the first event of the trace.
+	Offset time.Duration `json:"offset"`
+	// Depth is the span's distance from the root, or that of the span a log belongs to.
+	Depth int   `json:"depth"`
+	Span  *Span `json:"span,omitempty"`
+	Log   *Log  `json:"log,omitempty"`
+}
+
+// Timeline is everything known about a trace, in time order.
+type Timeline struct {
+	TraceID string  `json:"trace_id"`
+	Spans   int     `json:"spans"`
+	Logs    int     `json:"logs"`
+	Events  []Event `json:"events"`
+	// Warnings name the backends that could not be queried.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Client queries Tempo and Loki over their HTTP APIs.
+type Client struct {
+	TempoURL string
+	LokiURL  string
+	HTTP     *http.Client
+}
+
+// Timeline fetches the spans of traceID and the logs mentioning it within since,
+// and merges them. A backend that fails only adds a warning; the call fails if both do.
+func (c *Client) Timeline(ctx context.Context, traceID string, since time.Duration) (*Timeline, error) {
+	traceID = strings.ToLower(strings.TrimSpace(traceID))
+	if _, err := hex.DecodeString(traceID); err != nil || len(traceID) != 32 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTraceID, traceID)
+	}
+
+	var (
+		wg               sync.WaitGroup
+		spans            []Span
+		logs             []Log
+		spanErr, logsErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		spans, spanErr = c.Spans(ctx, traceID)
+	}()
+	go func() {
+		defer wg.Done()
+		logs, logsErr = c.Logs(ctx, traceID, since)
+	}()
+	wg.Wait()
+
+	if spanErr != nil && logsErr != nil {
+		return nil, fmt.Errorf("tempo: %v; loki: %v", spanErr, logsErr)
+	}
+	t := merge(traceID, spans, logs)
+	if spanErr != nil {
+		t.Warnings = append(t.Warnings, "tempo: "+spanErr.Error())
+	}
+	if logsErr != nil {
+		t.Warnings = append(t.Warnings, "loki: "+logsErr.Error())
+	}
+	return t, nil
+}
+
+func merge(traceID string, spans []Span, logs []Log) *Timeline {
+	t := &Timeline{TraceID: traceID, Spans: len(spans), Logs: len(logs)}
+
+	parents := make(map[string]string, len(spans))
+	for _, s := range spans {
+		parents[s.SpanID] = s.ParentSpanID
+	}
+	depth := func(id string) int {
+		d := 0
+		for p, ok := parents[id]; ok && p != "" && d < 64; p, ok = parents[p] {
+			d++
+		}
+		return d
+	}
+
+	for i := range spans {
+		s := &spans[i]
+		t.Events = append(t.Events, Event{Time: s.Start, Depth: depth(s.SpanID), Span: s})
+	}
+	for i := range logs {
+		l := &logs[i]
+		d := 0
+		if _, ok := parents[l.SpanID]; ok {
+			d = depth(l.SpanID) + 1
+		}
+		t.Events = append(t.Events, Event{Time: l.Time, Depth: d, Log: l})
+	}
+	sort.SliceStable(t.Events, func(i, j int) bool { return t.Events[i].Time.Before(t.Events[j].Time) })
+	if len(t.Events) > 0 {
+		first := t.Events[0].Time
+		for i := range t.Events {
+			t.Events[i].Offset = t.Events[i].Time.Sub(first)
+		}
+	}
+	return t
+}
+
+// Spans fetches the trace from Tempo's /api/traces endpoint.
+func (c *Client) Spans(ctx context.Context, traceID string) ([]Span, error) {
+	var body struct {
+		Batches []struct {
+			Resource struct {
+				Attributes []attribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+			// Older Tempo versions
+			InstrumentationLibrarySpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"instrumentationLibrarySpans"`
+		} `json:"batches"`
+	}
+	if err := c.get(ctx, c.TempoURL+"/api/traces/"+traceID, &body); err != nil {
+		return nil, err
+	}
+
+	var spans []Span
+	for _, b := range body.Batches {
+		service := ""
+		for _, a := range b.Resource.Attributes {
+			if a.Key == "service.name" {
+				service = a.Value.StringValue
+			}
+		}
+		var raw []otlpSpan
+		for _, ss := range b.ScopeSpans {
+			raw = append(raw, ss.Spans...)
+		}
+		for _, ss := range b.InstrumentationLibrarySpans {
+			raw = append(raw, ss.Spans...)
+		}
+		for _, s := range raw {
+			start := unixNano(s.StartTimeUnixNano)
+			spans = append(spans, Span{
+				SpanID:        otlpID(s.SpanID),
+				ParentSpanID:  otlpID(s.ParentSpanID),
+				Service:       service,
+				Name:          s.Name,
+				Kind:          strings.ToLower(strings.TrimPrefix(s.Kind, "SPAN_KIND_")),
+				Start:         start,
+				Duration:      unixNano(s.EndTimeUnixNano).Sub(start),
+				Error:         s.Status.Code == "STATUS_CODE_ERROR" || s.Status.Code == "2",
+				StatusMessage: s.Status.Message,
+			})
+		}
+	}
+	return spans, nil
+}
+
+type attribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	SpanID            string `json:"spanId"`
+	ParentSpanID      string `json:"parentSpanId"`
+	Name              string `json:"name"`
+	Kind              string `json:"kind"`
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string `json:"endTimeUnixNano"`
+	Status            struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+// otlpID normalizes a span ID to hex; Tempo's JSON encodes IDs as base64.
+func otlpID(id string) string {
+	if id == "" {
+		return ""
+	}
+	if _, err := hex.DecodeString(id); err == nil && len(id) == 16 {
+		return strings.ToLower(id)
+	}
+	if b, err := base64.StdEncoding.DecodeString(id); err == nil {
+		return hex.EncodeToString(b)
+	}
+	return id
+}
+
+func unixNano(s string) time.Time {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return time.Unix(0, n)
+}
+
+// Logs fetches log lines containing traceID from Loki, across every job.
+func (c *Client) Logs(ctx context.Context, traceID string, since time.Duration) ([]Log, error) {
+	end := time.Now()
+	q := url.Values{}
+	q.Set("query", fmt.Sprintf(`{job=~".+"} |= %q`, traceID))
+	q.Set("start", strconv.FormatInt(end.Add(-since).UnixNano(), 10))
+	q.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	q.Set("limit", "1000")
+	q.Set("direction", "forward")
+
+	var body struct {
+		Data struct {
+			Result []struct {
+				Stream map[string]string `json:"stream"`
+				Values [][2]string       `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := c.get(ctx, c.LokiURL+"/loki/api/v1/query_range?"+q.Encode(), &body); err != nil {
+		return nil, err
+	}
+
+	var logs []Log
+	for _, stream := range body.Data.Result {
+		for _, v := range stream.Values {
+			l := Log{Time: unixNano(v[0]), Service: stream.Stream["job"], Message: v[1]}
+			// Service logs are JSON; keep the raw line for anything else
+			var fields map[string]any
+			if json.Unmarshal([]byte(v[1]), &fields) == nil {
+				l.Level, _ = fields["level"].(string)
+				l.Message, _ = fields["msg"].(string)
+				l.SpanID, _ = fields["span_id"].(string)
+				for _, k := range []string{"level", "msg", "ts", "trace_id", "span_id", "caller", "logger",
+					"service_version", "service_namespace", "deployment_environment", "service_instance_id"} {
+					delete(fields, k)
+				}
+				l.Fields = fields
+			}
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+func (c *Client) get(ctx context.Context, u string, v any) error {
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
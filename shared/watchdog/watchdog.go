@@ -0,0 +1,172 @@
+package watchdog
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var stallsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "watchdog_stalls_total",
+	Help: "Number of stalls detected by the watchdog.",
+}, []string{"kind"})
+
+// maxStackDump caps the goroutine dump attached to stall logs.
+const maxStackDump = 64 << 10
+
+type Config struct {
+	// Interval is how often the heartbeat goroutine ticks and in-flight work is inspected.
+	Interval time.Duration
+	// MaxHeartbeatDelay is how late a heartbeat tick may fire before it counts as a stall.
+	MaxHeartbeatDelay time.Duration
+	// MaxHandlerDuration is how long a tracked handler may run before it is reported.
+	MaxHandlerDuration time.Duration
+	// MutexProfileFraction and BlockProfileRate feed /debug/pprof/mutex and /debug/pprof/block; zero leaves them off.
+	MutexProfileFraction int
+	BlockProfileRate     int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:             time.Second,
+		MaxHeartbeatDelay:    500 * time.Millisecond,
+		MaxHandlerDuration:   5 * time.Second,
+		MutexProfileFraction: 5,
+		BlockProfileRate:     int(time.Millisecond),
+	}
+}
+
+type operation struct {
+	name     string
+	traceID  string
+	started  time.Time
+	reported bool
+}
+
+// Watchdog detects a starved scheduler (late heartbeats) and handlers that run for too long.
+type Watchdog struct {
+	log *zap.Logger
+	cfg Config
+
+	mu       sync.Mutex
+	nextID   uint64
+	inFlight map[uint64]*operation
+}
+
+func New(log *zap.Logger, cfg Config) *Watchdog {
+	return &Watchdog{
+		log:      log,
+		cfg:      cfg,
+		inFlight: make(map[uint64]*operation),
+	}
+}
+
+// Start applies the profile rates and runs the heartbeat loop until the returned stop func is called.
+func (w *Watchdog) Start() func() {
+	runtime.SetMutexProfileFraction(w.cfg.MutexProfileFraction)
+	runtime.SetBlockProfileRate(w.cfg.BlockProfileRate)
+
+	done := make(chan struct{})
+	go w.run(done)
+
+	w.log.Info("watchdog started",
+		zap.Duration("interval", w.cfg.Interval),
+		zap.Duration("max_heartbeat_delay", w.cfg.MaxHeartbeatDelay),
+		zap.Duration("max_handler_duration", w.cfg.MaxHandlerDuration),
+	)
+	return func() { close(done) }
+}
+
+func (w *Watchdog) run(done chan struct{}) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	expected := time.Now().Add(w.cfg.Interval)
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if delay := now.Sub(expected); delay > w.cfg.MaxHeartbeatDelay {
+				stallsTotal.WithLabelValues("heartbeat").Inc()
+				w.log.Warn("watchdog heartbeat delayed",
+					zap.Duration("delay", delay),
+					zap.Int("goroutines", runtime.NumGoroutine()),
+					zap.String("stacks", dumpStacks()),
+				)
+			}
+			expected = now.Add(w.cfg.Interval)
+			w.checkHandlers(now)
+		}
+	}
+}
+
+func (w *Watchdog) checkHandlers(now time.Time) {
+	w.mu.Lock()
+	var offenders []operation
+	for _, op := range w.inFlight {
+		if op.reported || now.Sub(op.started) < w.cfg.MaxHandlerDuration {
+			continue
+		}
+		op.reported = true
+		offenders = append(offenders, *op)
+	}
+	w.mu.Unlock()
+
+	if len(offenders) == 0 {
+		return
+	}
+
+	stacks := dumpStacks()
+	for _, op := range offenders {
+		stallsTotal.WithLabelValues("handler").Inc()
+		w.log.Warn("watchdog detected long-running handler",
+			zap.String("handler", op.name),
+			zap.String("trace_id", op.traceID),
+			zap.Duration("elapsed", now.Sub(op.started)),
+			zap.String("stacks", stacks),
+		)
+	}
+}
+
+// Track registers a unit of work as in flight until the returned func is called.
+func (w *Watchdog) Track(ctx context.Context, name string) func() {
+	op := &operation{name: name, started: time.Now()}
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		op.traceID = sc.TraceID().String()
+	}
+
+	w.mu.Lock()
+	w.nextID++
+	id := w.nextID
+	w.inFlight[id] = op
+	w.mu.Unlock()
+
+	return func() {
+		w.mu.Lock()
+		delete(w.inFlight, id)
+		w.mu.Unlock()
+	}
+}
+
+// Fiber tracks every request as in-flight work, named by method and path.
+func (w *Watchdog) Fiber() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		done := w.Track(c.UserContext(), c.Method()+" "+c.Path())
+		defer done()
+		return c.Next()
+	}
+}
+
+func dumpStacks() string {
+	buf := make([]byte, maxStackDump)
+	n := runtime.Stack(buf, true)
+	return string(buf[:n])
+}